@@ -0,0 +1,160 @@
+// Package apperrors defines the typed errors returned by the service layer and
+// how they are presented to API clients.
+//
+// Every error carries a stable Code and a Message that is safe to show to
+// clients. The underlying cause (database or Stripe error) is kept for logging
+// and is never written to a response. Errors that are not an *Error are
+// reported to clients as a generic internal error.
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+	"strpe-connect/models"
+)
+
+// Code is a stable, machine readable error code
+type Code string
+
+const (
+	CodeNotFound             Code = "not_found"
+	CodeInsufficientFunds    Code = "insufficient_funds"
+	CodeOnboardingIncomplete Code = "onboarding_incomplete"
+	CodeBelowMinimum         Code = "below_minimum"
+	CodeStripeUnavailable    Code = "stripe_unavailable"
+	CodeConflict             Code = "conflict"
+	CodeInvalidRequest       Code = "invalid_request"
+	CodeSpendingCapExceeded  Code = "spending_cap_exceeded"
+	CodeRateLimited          Code = "rate_limited"
+	CodeIdempotencyMismatch  Code = "idempotency_key_reused"
+	CodeInternal             Code = "internal"
+)
+
+// Sentinel errors for matching with errors.Is. Any *Error with the same code matches.
+var (
+	ErrNotFound             = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrInsufficientFunds    = &Error{Code: CodeInsufficientFunds, Message: "insufficient funds"}
+	ErrOnboardingIncomplete = &Error{Code: CodeOnboardingIncomplete, Message: "Stripe Connect onboarding is incomplete"}
+	ErrBelowMinimum         = &Error{Code: CodeBelowMinimum, Message: "amount is below the minimum"}
+	ErrStripeUnavailable    = &Error{Code: CodeStripeUnavailable, Message: "Stripe is temporarily unavailable, please retry later"}
+	ErrConflict             = &Error{Code: CodeConflict, Message: "conflict"}
+)
+
+// Error is an error with a stable code and a client-safe message
+type Error struct {
+	Code    Code
+	Message string      // Safe to return to clients
+	Details interface{} // Optional structured data returned to clients
+	Err     error       // Underlying cause, only logged
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any *Error with the same code, so errors.Is(err, ErrNotFound) works
+// for every not found error regardless of its message
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails returns a copy of e carrying details
+func (e *Error) WithDetails(details interface{}) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// New returns an error with the given code and client-safe message
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap returns an error with the given code and client-safe message, keeping err as the cause
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// NotFound reports a missing resource, e.g. NotFound("wallet")
+func NotFound(resource string) *Error {
+	return &Error{Code: CodeNotFound, Message: resource + " not found"}
+}
+
+// InvalidRequest reports a malformed or invalid request
+func InvalidRequest(message string) *Error {
+	return &Error{Code: CodeInvalidRequest, Message: message}
+}
+
+// StripeUnavailable reports a failed Stripe API call without exposing its message
+func StripeUnavailable(err error) *Error {
+	return &Error{Code: CodeStripeUnavailable, Message: ErrStripeUnavailable.Message, Err: err}
+}
+
+// Conflict reports a request that conflicts with the current state
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+// CodeOf returns the code of the first *Error in err's chain, or CodeInternal
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// IsTransient reports whether err may go away on retry: an unexpected (database)
+// error or a Stripe outage, rather than a problem with the request itself
+func IsTransient(err error) bool {
+	code := CodeOf(err)
+	return code == CodeInternal || code == CodeStripeUnavailable
+}
+
+// HTTPStatus maps an error code to its HTTP status
+func HTTPStatus(code Code) int {
+	switch code {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeInsufficientFunds, CodeSpendingCapExceeded:
+		return http.StatusPaymentRequired
+	case CodeOnboardingIncomplete, CodeBelowMinimum, CodeIdempotencyMismatch:
+		return http.StatusUnprocessableEntity
+	case CodeStripeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeInvalidRequest:
+		return http.StatusBadRequest
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// Response returns the HTTP status and JSON envelope for err. Only the message
+// and details of an *Error are exposed, anything else becomes a generic error.
+func Response(err error, requestID string) (int, models.ErrorResponse) {
+	body := models.ErrorBody{
+		Code:      string(CodeInternal),
+		Message:   "internal server error",
+		RequestID: requestID,
+	}
+
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		body.Code = string(appErr.Code)
+		body.Message = appErr.Message
+		body.Details = appErr.Details
+	}
+
+	return HTTPStatus(Code(body.Code)), models.ErrorResponse{Error: body}
+}
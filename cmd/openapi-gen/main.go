@@ -0,0 +1,31 @@
+// Command openapi-gen writes the OpenAPI document generated from the handler
+// annotations and models DTOs. Run it through go generate ./openapi.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strpe-connect/openapi"
+)
+
+func main() {
+	handlersDir := flag.String("handlers", "handlers", "directory of the annotated handlers")
+	modelsDir := flag.String("models", "models", "directory of the models package")
+	out := flag.String("out", "openapi/openapi.json", "output file")
+	flag.Parse()
+
+	doc, err := openapi.Generate(*handlersDir, *modelsDir)
+	if err != nil {
+		log.Fatalf("Failed to generate OpenAPI document: %v", err)
+	}
+
+	data, err := openapi.Marshal(doc)
+	if err != nil {
+		log.Fatalf("Failed to encode OpenAPI document: %v", err)
+	}
+
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
@@ -0,0 +1,545 @@
+// Package config loads the service configuration into a typed struct.
+//
+// Values come from, in increasing precedence: the defaults below, an optional
+// YAML or TOML file named by CONFIG_FILE, and environment variables. Secrets can
+// also be read from a file named by the variable with a _FILE suffix (e.g.
+// DB_PASSWORD_FILE), for Docker and Kubernetes secrets. The loaded config is
+// validated before the server starts.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"strpe-connect/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Config is the complete service configuration. The yaml tags name the keys of
+// the config file, env tags the environment variables, and secret fields are
+// redacted when the config is printed.
+type Config struct {
+	Environment string `yaml:"environment" env:"APP_ENV"` // development or production
+
+	Server         ServerConfig         `yaml:"server"`
+	Database       DatabaseConfig       `yaml:"database"`
+	Stripe         StripeConfig         `yaml:"stripe"`
+	Payments       PaymentsConfig       `yaml:"payments"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Idempotency    IdempotencyConfig    `yaml:"idempotency"`
+	Analytics      AnalyticsConfig      `yaml:"analytics"`
+	Reconciliation ReconciliationConfig `yaml:"reconciliation"`
+	Solvency       SolvencyConfig       `yaml:"solvency"`
+	AccountSync    AccountSyncConfig    `yaml:"account_sync"`
+	Clearing       ClearingConfig       `yaml:"clearing"`
+	Payouts        PayoutsConfig        `yaml:"payouts"`
+	API            APIConfig            `yaml:"api"`
+	Health         HealthConfig         `yaml:"health"`
+	Tracing        TracingConfig        `yaml:"tracing"`
+	Logging        LoggingConfig        `yaml:"logging"`
+}
+
+type ServerConfig struct {
+	Port        int      `yaml:"port" env:"PORT"`
+	FrontendURL string   `yaml:"frontend_url" env:"FRONTEND_URL"`         // Always allowed by CORS
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ALLOWED_ORIGINS"` // Extra origins allowed by CORS
+	// How long /readyz fails before the server stops accepting connections on
+	// shutdown, so load balancers can drain it first
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DB_SSL_MODE"`
+	SSLRootCert     string        `yaml:"ssl_root_cert" env:"DB_SSL_ROOT_CERT"` // CA bundle for verify-ca / verify-full
+	MaxConns        int           `yaml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns        int           `yaml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	AutoMigrate     bool          `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+	TenantSchemas   []string      `yaml:"tenant_schemas" env:"TENANT_SCHEMAS"` // The first is the default tenant
+}
+
+type StripeConfig struct {
+	Mode             string        `yaml:"mode" env:"STRIPE_MODE"` // live calls Stripe, fake simulates it in memory
+	SecretKey        string        `yaml:"secret_key" env:"STRIPE_SECRET_KEY" secret:"true"`
+	WebhookSecret    string        `yaml:"webhook_secret" env:"STRIPE_WEBHOOK_SECRET" secret:"true"`
+	CallTimeout      time.Duration `yaml:"call_timeout" env:"STRIPE_CALL_TIMEOUT"`           // Each attempt of a Stripe call is cut off after this long
+	MaxRetries       int           `yaml:"max_retries" env:"STRIPE_MAX_RETRIES"`             // Retries of calls that failed with a retryable error, 0 disables retries
+	BreakerThreshold int           `yaml:"breaker_threshold" env:"STRIPE_BREAKER_THRESHOLD"` // Consecutive failed calls that open the circuit breaker
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env:"STRIPE_BREAKER_COOLDOWN"`   // How long an open circuit fails calls before trying Stripe again
+}
+
+type PaymentsConfig struct {
+	MinimumWithdrawal  float64 `yaml:"minimum_withdrawal" env:"MINIMUM_WITHDRAWAL_AMOUNT"`
+	PlatformFeePercent float64 `yaml:"platform_fee_percent" env:"PLATFORM_FEE_PERCENT"`
+}
+
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second" env:"RATE_LIMIT_REQUESTS_PER_SECOND"` // 0 disables rate limiting
+	Burst             int     `yaml:"burst" env:"RATE_LIMIT_BURST"`
+	Backend           string  `yaml:"backend" env:"RATE_LIMIT_BACKEND"` // memory or postgres
+}
+
+type IdempotencyConfig struct {
+	KeyTTL      time.Duration `yaml:"key_ttl" env:"IDEMPOTENCY_KEY_TTL"`
+	LockTimeout time.Duration `yaml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"` // A request still running after this long is presumed dead and its key can be retried
+}
+
+type AnalyticsConfig struct {
+	RollupInterval time.Duration `yaml:"rollup_interval" env:"ANALYTICS_ROLLUP_INTERVAL"`
+}
+
+type ReconciliationConfig struct {
+	Interval time.Duration `yaml:"interval" env:"RECONCILIATION_INTERVAL"`
+	Lookback time.Duration `yaml:"lookback" env:"RECONCILIATION_LOOKBACK"` // Stripe objects this long before the last run are compared again
+}
+
+type SolvencyConfig struct {
+	CheckInterval    time.Duration `yaml:"check_interval" env:"SOLVENCY_CHECK_INTERVAL"`
+	MinCoverageRatio float64       `yaml:"min_coverage_ratio" env:"SOLVENCY_MIN_COVERAGE_RATIO"` // Alert below this Stripe balance over liabilities
+}
+
+type AccountSyncConfig struct {
+	Interval             time.Duration `yaml:"interval" env:"ACCOUNT_SYNC_INTERVAL"`
+	StaleAfter           time.Duration `yaml:"stale_after" env:"ACCOUNT_SYNC_STALE_AFTER"`                       // Onboarded accounts are read again after this long
+	OnboardingStaleAfter time.Duration `yaml:"onboarding_stale_after" env:"ACCOUNT_SYNC_ONBOARDING_STALE_AFTER"` // Accounts still onboarding are read again after this long
+	BatchSize            int           `yaml:"batch_size" env:"ACCOUNT_SYNC_BATCH_SIZE"`                         // Accounts per tenant per run
+	Concurrency          int           `yaml:"concurrency" env:"ACCOUNT_SYNC_CONCURRENCY"`
+	RequestsPerSecond    float64       `yaml:"requests_per_second" env:"ACCOUNT_SYNC_REQUESTS_PER_SECOND"`
+}
+
+type ClearingConfig struct {
+	Period          time.Duration            `yaml:"period" env:"CLEARING_PERIOD"`                     // Earnings are withdrawable this long after the payment, 0 for right away
+	TierPeriods     map[string]time.Duration `yaml:"tier_periods" env:"CLEARING_TIER_PERIODS"`         // Period by developer tier, as tier=duration pairs
+	FunctionPeriods map[string]time.Duration `yaml:"function_periods" env:"CLEARING_FUNCTION_PERIODS"` // Period by function ID, over the tier and global periods
+	ReleaseInterval time.Duration            `yaml:"release_interval" env:"CLEARING_RELEASE_INTERVAL"`
+}
+
+type PayoutsConfig struct {
+	ScheduleInterval        time.Duration `yaml:"schedule_interval" env:"PAYOUT_SCHEDULE_INTERVAL"`                 // How often due payout schedules are run
+	WithdrawalRetryInterval time.Duration `yaml:"withdrawal_retry_interval" env:"PAYOUT_WITHDRAWAL_RETRY_INTERVAL"` // How often stuck withdrawals are looked for
+	WithdrawalRetryAfter    time.Duration `yaml:"withdrawal_retry_after" env:"PAYOUT_WITHDRAWAL_RETRY_AFTER"`       // How long a withdrawal is left to its own processing before it is retried
+}
+
+type APIConfig struct {
+	LegacySunset time.Time `yaml:"legacy_sunset" env:"API_LEGACY_SUNSET"` // Advertised on the unversioned /api routes
+}
+
+type HealthConfig struct {
+	CheckTimeout          time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	StripeCacheTTL        time.Duration `yaml:"stripe_cache_ttl" env:"HEALTH_STRIPE_CACHE_TTL"` // Stripe is pinged at most this often
+	WebhookBacklogMaxAge  time.Duration `yaml:"webhook_backlog_max_age" env:"HEALTH_WEBHOOK_BACKLOG_MAX_AGE"`
+	WithdrawalQueueMaxAge time.Duration `yaml:"withdrawal_queue_max_age" env:"HEALTH_WITHDRAWAL_QUEUE_MAX_AGE"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`            // none or otlp
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"` // OTLP/HTTP collector URL
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"` // Share of new traces recorded, 0 to 1
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`   // debug, info, warn or error
+	Format string `yaml:"format" env:"LOG_FORMAT"` // json or text
+}
+
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentProduction  = "production"
+
+	StripeModeLive = "live"
+	StripeModeFake = "fake"
+
+	TracingExporterNone = "none"
+	TracingExporterOTLP = "otlp"
+
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+
+	// fakeWebhookSecret signs the fake gateway's webhooks when no secret is configured
+	fakeWebhookSecret = "whsec_fake"
+)
+
+// Default returns the configuration used for anything not set in the config
+// file or the environment
+func Default() *Config {
+	return &Config{
+		Environment: EnvironmentDevelopment,
+		Server: ServerConfig{
+			Port:        8080,
+			FrontendURL: "http://localhost:3000",
+			CORSOrigins: []string{"http://localhost:5173"},
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "rival",
+			SSLMode:         "disable",
+			MaxConns:        10,
+			MinConns:        0,
+			MaxConnLifetime: time.Hour,
+			MaxConnIdleTime: 30 * time.Minute,
+			TenantSchemas:   []string{tenant.DefaultSchema},
+		},
+		Stripe: StripeConfig{
+			Mode:             StripeModeLive,
+			CallTimeout:      10 * time.Second,
+			MaxRetries:       2,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+		},
+		Payments: PaymentsConfig{
+			MinimumWithdrawal:  50.00,
+			PlatformFeePercent: 0,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: 10,
+			Burst:             20,
+			Backend:           "memory",
+		},
+		Idempotency: IdempotencyConfig{
+			KeyTTL:      24 * time.Hour,
+			LockTimeout: time.Minute,
+		},
+		Analytics: AnalyticsConfig{
+			RollupInterval: 5 * time.Minute,
+		},
+		Reconciliation: ReconciliationConfig{
+			Interval: time.Hour,
+			Lookback: 72 * time.Hour,
+		},
+		Solvency: SolvencyConfig{
+			CheckInterval:    15 * time.Minute,
+			MinCoverageRatio: 1,
+		},
+		AccountSync: AccountSyncConfig{
+			Interval:             5 * time.Minute,
+			StaleAfter:           24 * time.Hour,
+			OnboardingStaleAfter: 5 * time.Minute,
+			BatchSize:            200,
+			Concurrency:          4,
+			RequestsPerSecond:    10,
+		},
+		Clearing: ClearingConfig{
+			Period:          7 * 24 * time.Hour,
+			ReleaseInterval: 5 * time.Minute,
+		},
+		Payouts: PayoutsConfig{
+			ScheduleInterval:        5 * time.Minute,
+			WithdrawalRetryInterval: 5 * time.Minute,
+			WithdrawalRetryAfter:    5 * time.Minute,
+		},
+		API: APIConfig{
+			LegacySunset: time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+		},
+		Health: HealthConfig{
+			CheckTimeout:          2 * time.Second,
+			StripeCacheTTL:        30 * time.Second,
+			WebhookBacklogMaxAge:  15 * time.Minute,
+			WithdrawalQueueMaxAge: time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "stripe-connect-marketplace",
+			SampleRatio: 1,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, CONFIG_FILE and the
+// environment. Call Validate (or ValidateDatabase) before using it.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Stripe.Mode == StripeModeFake && cfg.Stripe.WebhookSecret == "" {
+		cfg.Stripe.WebhookSecret = fakeWebhookSecret
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	return c.validate(false)
+}
+
+// ValidateDatabase checks only what is needed to reach the database, for the
+// migrate command
+func (c *Config) ValidateDatabase() error {
+	return c.validate(true)
+}
+
+func (c *Config) validate(databaseOnly bool) error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	production := c.Environment == EnvironmentProduction
+	if c.Environment != EnvironmentDevelopment && !production {
+		fail("environment must be %s or %s, got %q", EnvironmentDevelopment, EnvironmentProduction, c.Environment)
+	}
+
+	// Database
+	if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" {
+		fail("database.host, database.name and database.user are required")
+	}
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		fail("database.ssl_mode %q is not a Postgres sslmode", c.Database.SSLMode)
+	}
+	if production && (c.Database.SSLMode == "disable" || c.Database.SSLMode == "allow") {
+		fail("database.ssl_mode must not be %q in production", c.Database.SSLMode)
+	}
+	if c.Database.MaxConns < 1 || c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		fail("database pool needs 0 <= min_conns <= max_conns and max_conns >= 1, got %d and %d", c.Database.MinConns, c.Database.MaxConns)
+	}
+	if len(c.Database.TenantSchemas) == 0 {
+		fail("database.tenant_schemas needs at least one schema")
+	}
+	for _, schema := range c.Database.TenantSchemas {
+		if !tenant.ValidSchema(schema) {
+			fail("database.tenant_schemas contains an invalid schema name %q", schema)
+		}
+	}
+
+	if databaseOnly {
+		return problemsError(problems)
+	}
+
+	// Server
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, origin := range c.AllowedOrigins() {
+		if err := validateOrigin(origin); err != nil {
+			fail("server.cors_origins: %v", err)
+		}
+	}
+
+	// Stripe, a live key must only be used in production and vice versa
+	switch c.Stripe.Mode {
+	case StripeModeLive:
+		switch {
+		case c.Stripe.SecretKey == "":
+			fail("stripe.secret_key is required when stripe.mode is live")
+		case production && !isLiveKey(c.Stripe.SecretKey):
+			fail("stripe.secret_key must be a live key (sk_live_ or rk_live_) in production")
+		case !production && isLiveKey(c.Stripe.SecretKey):
+			fail("stripe.secret_key is a live key but environment is %s, use a test key", c.Environment)
+		}
+	case StripeModeFake:
+		if production {
+			fail("stripe.mode fake is not allowed in production")
+		}
+	default:
+		fail("stripe.mode must be %s or %s, got %q", StripeModeLive, StripeModeFake, c.Stripe.Mode)
+	}
+	if c.Stripe.WebhookSecret == "" {
+		fail("stripe.webhook_secret is required")
+	} else if !strings.HasPrefix(c.Stripe.WebhookSecret, "whsec_") {
+		fail("stripe.webhook_secret must start with whsec_")
+	}
+	if c.Stripe.CallTimeout <= 0 || c.Stripe.BreakerCooldown <= 0 {
+		fail("stripe.call_timeout and stripe.breaker_cooldown must be positive")
+	}
+	if c.Stripe.MaxRetries < 0 || c.Stripe.BreakerThreshold < 1 {
+		fail("stripe needs max_retries >= 0 and breaker_threshold >= 1, got %d and %d", c.Stripe.MaxRetries, c.Stripe.BreakerThreshold)
+	}
+
+	// Payments
+	if c.Payments.MinimumWithdrawal <= 0 {
+		fail("payments.minimum_withdrawal must be positive, got %v", c.Payments.MinimumWithdrawal)
+	}
+	if c.Payments.PlatformFeePercent < 0 || c.Payments.PlatformFeePercent >= 100 {
+		fail("payments.platform_fee_percent must be at least 0 and below 100, got %v", c.Payments.PlatformFeePercent)
+	}
+
+	// Rate limiting and background jobs
+	if c.RateLimit.RequestsPerSecond < 0 || (c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst < 1) {
+		fail("rate_limit needs requests_per_second >= 0 and burst >= 1, got %v and %d", c.RateLimit.RequestsPerSecond, c.RateLimit.Burst)
+	}
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "postgres" {
+		fail("rate_limit.backend must be memory or postgres, got %q", c.RateLimit.Backend)
+	}
+	if c.Idempotency.KeyTTL <= 0 || c.Idempotency.LockTimeout <= 0 {
+		fail("idempotency.key_ttl and idempotency.lock_timeout must be positive")
+	}
+	if c.Idempotency.LockTimeout >= c.Idempotency.KeyTTL {
+		fail("idempotency.lock_timeout must be shorter than idempotency.key_ttl")
+	}
+	if c.Analytics.RollupInterval <= 0 {
+		fail("analytics.rollup_interval must be positive")
+	}
+	if c.Reconciliation.Interval <= 0 || c.Reconciliation.Lookback <= 0 {
+		fail("reconciliation.interval and reconciliation.lookback must be positive")
+	}
+	if c.Solvency.CheckInterval <= 0 {
+		fail("solvency.check_interval must be positive")
+	}
+	if c.Solvency.MinCoverageRatio <= 0 {
+		fail("solvency.min_coverage_ratio must be positive, got %v", c.Solvency.MinCoverageRatio)
+	}
+	if c.AccountSync.Interval <= 0 || c.AccountSync.StaleAfter <= 0 || c.AccountSync.OnboardingStaleAfter <= 0 {
+		fail("account_sync.interval, account_sync.stale_after and account_sync.onboarding_stale_after must be positive")
+	}
+	if c.AccountSync.BatchSize < 1 || c.AccountSync.Concurrency < 1 || c.AccountSync.RequestsPerSecond <= 0 {
+		fail("account_sync needs batch_size >= 1, concurrency >= 1 and requests_per_second > 0, got %d, %d and %v",
+			c.AccountSync.BatchSize, c.AccountSync.Concurrency, c.AccountSync.RequestsPerSecond)
+	}
+	if c.Clearing.Period < 0 {
+		fail("clearing.period must not be negative")
+	}
+	if c.Clearing.ReleaseInterval <= 0 {
+		fail("clearing.release_interval must be positive")
+	}
+	if c.Payouts.ScheduleInterval <= 0 {
+		fail("payouts.schedule_interval must be positive")
+	}
+	if c.Payouts.WithdrawalRetryInterval <= 0 || c.Payouts.WithdrawalRetryAfter <= 0 {
+		fail("payouts.withdrawal_retry_interval and payouts.withdrawal_retry_after must be positive")
+	}
+	for _, tier := range negativeDurations(c.Clearing.TierPeriods) {
+		fail("clearing.tier_periods: period of tier %s must not be negative", tier)
+	}
+	for _, function := range negativeDurations(c.Clearing.FunctionPeriods) {
+		fail("clearing.function_periods: period of function %s must not be negative", function)
+	}
+
+	// Health checks
+	if c.Health.CheckTimeout <= 0 || c.Health.WebhookBacklogMaxAge <= 0 || c.Health.WithdrawalQueueMaxAge <= 0 {
+		fail("health.check_timeout, health.webhook_backlog_max_age and health.withdrawal_queue_max_age must be positive")
+	}
+	if c.Health.StripeCacheTTL < 0 || c.Server.ShutdownDrainDelay < 0 {
+		fail("health.stripe_cache_ttl and server.shutdown_drain_delay must not be negative")
+	}
+
+	// Tracing
+	switch c.Tracing.Exporter {
+	case TracingExporterNone:
+	case TracingExporterOTLP:
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.endpoint must be an http or https URL, got %q", c.Tracing.Endpoint)
+		}
+		if c.Tracing.ServiceName == "" {
+			fail("tracing.service_name is required")
+		}
+	default:
+		fail("tracing.exporter must be %s or %s, got %q", TracingExporterNone, TracingExporterOTLP, c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	// Logging
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		fail("logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	if c.Logging.Format != LogFormatJSON && c.Logging.Format != LogFormatText {
+		fail("logging.format must be %s or %s, got %q", LogFormatJSON, LogFormatText, c.Logging.Format)
+	}
+
+	return problemsError(problems)
+}
+
+func problemsError(problems []string) error {
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// AllowedOrigins returns the CORS origins, the frontend URL first
+func (c *Config) AllowedOrigins() []string {
+	origins := []string{strings.TrimSuffix(c.Server.FrontendURL, "/")}
+	for _, origin := range c.Server.CORSOrigins {
+		origin = strings.TrimSuffix(origin, "/")
+		if origin != origins[0] {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// PoolConfig returns the pgx pool configuration for the database settings
+func (d DatabaseConfig) PoolConfig() (*pgxpool.Config, error) {
+	query := url.Values{}
+	query.Set("sslmode", d.SSLMode)
+	if d.SSLRootCert != "" {
+		query.Set("sslrootcert", d.SSLRootCert)
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     d.Host + ":" + strconv.Itoa(d.Port),
+		Path:     "/" + d.Name,
+		RawQuery: query.Encode(),
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database settings: %w", err)
+	}
+	poolConfig.MaxConns = int32(d.MaxConns)
+	poolConfig.MinConns = int32(d.MinConns)
+	poolConfig.MaxConnLifetime = d.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = d.MaxConnIdleTime
+	return poolConfig, nil
+}
+
+func isLiveKey(key string) bool {
+	return strings.HasPrefix(key, "sk_live_") || strings.HasPrefix(key, "rk_live_")
+}
+
+func validateOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q: %w", origin, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+// negativeDurations returns the sorted keys of periods with a negative duration
+func negativeDurations(periods map[string]time.Duration) []string {
+	var keys []string
+	for key, period := range periods {
+		if period < 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayersFileEnvAndSecretFiles(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", `
+server:
+  port: 9090
+  cors_origins: [https://app.example.com]
+database:
+  ssl_mode: require
+  max_conn_lifetime: 2h
+stripe:
+  webhook_secret: whsec_from_file
+payments:
+  minimum_withdrawal: 25
+clearing:
+  tier_periods:
+    trusted: 24h
+    new: 336h
+api:
+  legacy_sunset: 2028-01-01T00:00:00Z
+`))
+	t.Setenv("PORT", "7070")
+	t.Setenv("CLEARING_FUNCTION_PERIODS", "fn_1=0s, fn_2=1h30m")
+	t.Setenv("STRIPE_SECRET_KEY_FILE", writeFile(t, "stripe_key", "sk_test_from_secret_file\n"))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if cfg.Server.Port != 7070 {
+		t.Errorf("port = %d, want the environment to override the file", cfg.Server.Port)
+	}
+	if cfg.Database.SSLMode != "require" || cfg.Database.MaxConnLifetime != 2*time.Hour || cfg.Payments.MinimumWithdrawal != 25 {
+		t.Errorf("file settings not applied: %+v %+v", cfg.Database, cfg.Payments)
+	}
+	if cfg.Database.Host != "localhost" {
+		t.Errorf("host = %q, want the default", cfg.Database.Host)
+	}
+	if cfg.Stripe.SecretKey != "sk_test_from_secret_file" {
+		t.Errorf("secret key = %q, want the trimmed _FILE contents", cfg.Stripe.SecretKey)
+	}
+	if !cfg.API.LegacySunset.Equal(time.Date(2028, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("legacy sunset = %v", cfg.API.LegacySunset)
+	}
+	if got := strings.Join(cfg.AllowedOrigins(), ","); got != "http://localhost:3000,https://app.example.com" {
+		t.Errorf("allowed origins = %s", got)
+	}
+	if got := formatField(reflect.ValueOf(cfg.Clearing.TierPeriods)); got != "new=336h0m0s,trusted=24h0m0s" {
+		t.Errorf("tier periods = %s", got)
+	}
+	if got := formatField(reflect.ValueOf(cfg.Clearing.FunctionPeriods)); got != "fn_1=0s,fn_2=1h30m0s" {
+		t.Errorf("function periods = %s", got)
+	}
+}
+
+func TestLoadRejectsInvalidMapEntries(t *testing.T) {
+	t.Setenv("CLEARING_TIER_PERIODS", "trusted=24h,new")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), `invalid entry "new"`) {
+		t.Fatalf("Load() error = %v, want invalid entry", err)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.toml", `
+environment = "production"
+
+[database]
+tenant_schemas = ["acme", "globex"]
+max_conns = 25
+
+[stripe]
+secret_key = "sk_live_abc"
+webhook_secret = "whsec_abc"
+`))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Environment != EnvironmentProduction || cfg.Database.MaxConns != 25 || strings.Join(cfg.Database.TenantSchemas, ",") != "acme,globex" {
+		t.Errorf("TOML settings not applied: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", "database:\n  hots: db.internal\n"))
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "unknown key database.hots") {
+		t.Fatalf("Load() error = %v, want unknown key database.hots", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := Default()
+		cfg.Stripe.SecretKey = "sk_test_abc"
+		cfg.Stripe.WebhookSecret = "whsec_abc"
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   string
+	}{
+		{"valid", func(cfg *Config) {}, ""},
+		{"missing webhook secret", func(cfg *Config) { cfg.Stripe.WebhookSecret = "" }, "stripe.webhook_secret is required"},
+		{"live key in development", func(cfg *Config) { cfg.Stripe.SecretKey = "sk_live_abc" }, "use a test key"},
+		{"test key in production", func(cfg *Config) {
+			cfg.Environment = EnvironmentProduction
+			cfg.Database.SSLMode = "verify-full"
+		}, "must be a live key"},
+		{"fake Stripe in production", func(cfg *Config) {
+			cfg.Environment = EnvironmentProduction
+			cfg.Database.SSLMode = "verify-full"
+			cfg.Stripe.Mode = StripeModeFake
+		}, "fake is not allowed in production"},
+		{"plaintext database in production", func(cfg *Config) {
+			cfg.Environment = EnvironmentProduction
+			cfg.Stripe.SecretKey = "sk_live_abc"
+		}, `ssl_mode must not be "disable"`},
+		{"bad origin", func(cfg *Config) { cfg.Server.CORSOrigins = []string{"app.example.com"} }, "invalid origin"},
+		{"fee out of range", func(cfg *Config) { cfg.Payments.PlatformFeePercent = 100 }, "platform_fee_percent"},
+		{"negative tier clearing period", func(cfg *Config) {
+			cfg.Clearing.TierPeriods = map[string]time.Duration{"trusted": -time.Hour}
+		}, "period of tier trusted must not be negative"},
+		{"no withdrawal retry delay", func(cfg *Config) { cfg.Payouts.WithdrawalRetryAfter = 0 }, "payouts.withdrawal_retry_after must be positive"},
+		{"invalid tenant schema", func(cfg *Config) { cfg.Database.TenantSchemas = []string{"acme; DROP"} }, "invalid schema name"},
+		{"otlp without scheme", func(cfg *Config) {
+			cfg.Tracing.Exporter = TracingExporterOTLP
+			cfg.Tracing.Endpoint = "collector:4318"
+		}, "tracing.endpoint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDatabaseIgnoresStripe(t *testing.T) {
+	cfg := Default()
+	if err := cfg.ValidateDatabase(); err != nil {
+		t.Fatalf("ValidateDatabase() error = %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Validate() accepted a config without Stripe keys")
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Stripe.SecretKey = "sk_test_abc"
+
+	out := cfg.Redacted()
+	for _, secret := range []string{"hunter2", "sk_test_abc"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Redacted() leaks %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "database.password = [REDACTED]") || !strings.Contains(out, "stripe.webhook_secret = \n") {
+		t.Errorf("Redacted() output unexpected:\n%s", out)
+	}
+}
@@ -0,0 +1,286 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when the config is printed
+const redacted = "[REDACTED]"
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// secretFromFile returns the trimmed contents of the file named by key_FILE,
+// or "" when that is not set
+func secretFromFile(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// loadFile applies a YAML (.yaml, .yml) or TOML (.toml) config file. Unknown
+// keys are rejected so typos do not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := applyFileValues(reflect.ValueOf(cfg).Elem(), values, ""); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyFileValues(section reflect.Value, values map[string]interface{}, prefix string) error {
+	fields := map[string]reflect.Value{}
+	for i := 0; i < section.NumField(); i++ {
+		fields[section.Type().Field(i).Tag.Get("yaml")] = section.Field(i)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown key %s%s", prefix, key)
+		}
+
+		if isSection(field.Type()) {
+			nested, ok := values[key].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s%s must be a table", prefix, key)
+			}
+			if err := applyFileValues(field, nested, prefix+key+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := setField(field, fileValue(values[key])); err != nil {
+			return fmt.Errorf("%s%s: %w", prefix, key, err)
+		}
+	}
+	return nil
+}
+
+// fileValue turns a decoded YAML/TOML value into the string form used by
+// environment variables, so both are parsed the same way
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fileValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			items[i] = key + "=" + fileValue(v[key])
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// loadEnv applies every set environment variable named by an env tag
+func loadEnv(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), "", func(field reflect.Value, tag reflect.StructTag, _ string) error {
+		key := tag.Get("env")
+		if key == "" {
+			return nil
+		}
+
+		value := os.Getenv(key)
+		if value == "" && tag.Get("secret") == "true" {
+			var err error
+			if value, err = secretFromFile(key); err != nil {
+				return err
+			}
+		}
+		if value == "" {
+			return nil
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// walk calls fn for every setting, with its dotted config file path
+func walk(section reflect.Value, prefix string, fn func(field reflect.Value, tag reflect.StructTag, path string) error) error {
+	for i := 0; i < section.NumField(); i++ {
+		structField := section.Type().Field(i)
+		path := prefix + structField.Tag.Get("yaml")
+
+		if isSection(structField.Type) {
+			if err := walk(section.Field(i), path+".", fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(section.Field(i), structField.Tag, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(duration))
+	case field.Type() == timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid RFC 3339 time %q", value)
+		}
+		field.Set(reflect.ValueOf(t))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(number))
+	case field.Kind() == reflect.Float64:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(number)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String:
+		// Maps are written as key=value pairs separated by commas
+		entries := reflect.MakeMap(field.Type())
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, entry, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return fmt.Errorf("invalid entry %q, want key=value", item)
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(elem, entry); err != nil {
+				return fmt.Errorf("%s: %w", strings.TrimSpace(key), err)
+			}
+			entries.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), elem)
+		}
+		field.Set(entries)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// Redacted renders the effective configuration one setting per line, with
+// secrets replaced so it is safe to log
+func (c *Config) Redacted() string {
+	var b strings.Builder
+	walk(reflect.ValueOf(c).Elem(), "", func(field reflect.Value, tag reflect.StructTag, path string) error {
+		value := formatField(field)
+		if tag.Get("secret") == "true" && value != "" {
+			value = redacted
+		}
+		fmt.Fprintf(&b, "%s = %s\n", path, value)
+		return nil
+	})
+	return b.String()
+}
+
+func formatField(field reflect.Value) string {
+	switch {
+	case field.Type() == durationType:
+		return time.Duration(field.Int()).String()
+	case field.Type() == timeType:
+		return field.Interface().(time.Time).Format(time.RFC3339)
+	case field.Kind() == reflect.Slice:
+		items := make([]string, field.Len())
+		for i := range items {
+			items[i] = field.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	case field.Kind() == reflect.Map:
+		items := make([]string, 0, field.Len())
+		for _, key := range field.MapKeys() {
+			items = append(items, key.String()+"="+formatField(field.MapIndex(key)))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(field.Interface())
+	}
+}
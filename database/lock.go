@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AdvisoryLockKey turns a lock name into a pg_advisory_lock key
+func AdvisoryLockKey(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return int64(hash.Sum64())
+}
+
+// AdvisoryLock waits for the session advisory lock key on conn. The returned
+// unlock must be called before conn is released.
+func AdvisoryLock(ctx context.Context, conn *pgxpool.Conn, key int64) (unlock func(), err error) {
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return nil, err
+	}
+	return advisoryUnlock(conn, key), nil
+}
+
+// TryAdvisoryLock takes the session advisory lock key on conn if it is free.
+// When locked, the returned unlock must be called before conn is released.
+func TryAdvisoryLock(ctx context.Context, conn *pgxpool.Conn, key int64) (unlock func(), locked bool, err error) {
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		return nil, false, err
+	}
+	if !locked {
+		return nil, false, nil
+	}
+	return advisoryUnlock(conn, key), true, nil
+}
+
+func advisoryUnlock(conn *pgxpool.Conn, key int64) func() {
+	return func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			// The session still holds the lock, so drop the connection rather than pool it
+			conn.Conn().Close(context.Background())
+		}
+	}
+}
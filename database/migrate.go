@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strpe-connect/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrations run, so
+// replicas starting together (or a deploy racing a manual run) apply each
+// migration exactly once
+const migrationLockID int64 = 0x737472706d6967 // "strpmig"
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a known migration has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version. Versions must
+// start at 1, be contiguous and each have both an up and a down file.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", migration.Version, i+1)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrator applies the embedded migrations to one tenant schema and records
+// them in that schema's migrations table. Migrations are written against
+// tenant_schema and qualified for the target schema when run.
+type Migrator struct {
+	db         *pgxpool.Pool
+	schema     string
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool, schema string) (*Migrator, error) {
+	if !tenant.ValidSchema(schema) {
+		return nil, fmt.Errorf("invalid tenant schema %q", schema)
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, schema: schema, migrations: migrations}, nil
+}
+
+// Schema returns the tenant schema the migrator applies to
+func (m *Migrator) Schema() string {
+	return m.schema
+}
+
+// Up applies every pending migration in order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, current int) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the ones rolled back, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be at least 1, got %d", steps)
+	}
+
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, current int) error {
+		for version := current; version > 0 && len(rolledBack) < steps; version-- {
+			migration := m.migrations[version-1]
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every known migration with the time it was applied, if it has been
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, current int) error {
+		rows, err := conn.Query(ctx, m.qualify(`SELECT version, applied_at FROM tenant_schema.migrations`))
+		if err != nil {
+			return fmt.Errorf("failed to list applied migrations: %w", err)
+		}
+		defer rows.Close()
+
+		appliedAt := make(map[int]time.Time)
+		for rows.Next() {
+			var version int
+			var at time.Time
+			if err := rows.Scan(&version, &at); err != nil {
+				return fmt.Errorf("failed to scan applied migration: %w", err)
+			}
+			appliedAt[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list applied migrations: %w", err)
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Migration: migration}
+			if at, ok := appliedAt[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Latest returns the newest migration version this build knows
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the highest applied migration version, 0 if none. Unlike the
+// other methods it does not wait for the migration lock, so it is cheap enough
+// for health checks.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var exists bool
+	err := m.db.QueryRow(ctx, m.qualify(`SELECT to_regclass('tenant_schema.migrations') IS NOT NULL`)).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up migrations table of %s: %w", m.schema, err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err = m.db.QueryRow(ctx, m.qualify(`SELECT COALESCE(MAX(version), 0) FROM tenant_schema.migrations`)).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version of %s: %w", m.schema, err)
+	}
+	return version, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock,
+// after making sure the tracking table exists and the database is not ahead of
+// this binary. current is the highest applied version.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn, current int) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration connection: %w", err)
+	}
+	defer conn.Release()
+
+	unlock, err := AdvisoryLock(ctx, conn, migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer unlock()
+
+	_, err = conn.Exec(ctx, m.qualify(`
+		CREATE TABLE IF NOT EXISTS tenant_schema.migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	err = conn.QueryRow(ctx, m.qualify(`SELECT COALESCE(MAX(version), 0) FROM tenant_schema.migrations`)).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version of %s: %w", m.schema, err)
+	}
+	if current > len(m.migrations) {
+		return fmt.Errorf("schema %s is at version %d but this build only knows migrations up to %d", m.schema, current, len(m.migrations))
+	}
+
+	return fn(conn, current)
+}
+
+// apply runs one migration in either direction together with its tracking row,
+// in a single transaction
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, migration Migration, up bool) error {
+	direction, script := "up", migration.Up
+	if !up {
+		direction, script = "down", migration.Down
+	}
+
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.qualify(script)); err != nil {
+			return err
+		}
+		if up {
+			_, err := tx.Exec(ctx, m.qualify(`INSERT INTO tenant_schema.migrations (version, name) VALUES ($1, $2)`), migration.Version, migration.Name)
+			return err
+		}
+		_, err := tx.Exec(ctx, m.qualify(`DELETE FROM tenant_schema.migrations WHERE version = $1`), migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s %s %04d_%s: %w", m.schema, direction, migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) qualify(query string) string {
+	return tenant.QualifyFor(m.schema, query)
+}
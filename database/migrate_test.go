@@ -0,0 +1,31 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationsAreEmbedded(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for _, migration := range migrations {
+		for direction, script := range map[string]string{"up": migration.Up, "down": migration.Down} {
+			// Migrations must be re-runnable, since databases created from the old
+			// single schema file are adopted by running every migration once
+			for _, statement := range []string{"CREATE TABLE tenant_schema", "CREATE INDEX idx", "CREATE UNIQUE INDEX idx"} {
+				if strings.Contains(script, statement) {
+					t.Errorf("%04d_%s.%s.sql: %q should use IF NOT EXISTS", migration.Version, migration.Name, direction, statement)
+				}
+			}
+			if strings.Count(script, "CREATE TRIGGER") > strings.Count(script, "DROP TRIGGER IF EXISTS") {
+				t.Errorf("%04d_%s.%s.sql: CREATE TRIGGER without a preceding DROP TRIGGER IF EXISTS", migration.Version, migration.Name, direction)
+			}
+		}
+	}
+}
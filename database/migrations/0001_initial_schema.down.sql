@@ -0,0 +1,17 @@
+DROP VIEW IF EXISTS tenant_schema.v_transaction_history;
+DROP VIEW IF EXISTS tenant_schema.v_withdrawal_history;
+DROP VIEW IF EXISTS tenant_schema.v_developer_earnings;
+
+DROP TRIGGER IF EXISTS trigger_update_withdrawal_request_timestamp ON tenant_schema.withdrawal_requests;
+DROP FUNCTION IF EXISTS tenant_schema.update_withdrawal_request_timestamp();
+DROP TRIGGER IF EXISTS trigger_update_developer_wallet_timestamp ON tenant_schema.developer_wallets;
+DROP FUNCTION IF EXISTS tenant_schema.update_developer_wallet_timestamp();
+
+DROP TABLE IF EXISTS tenant_schema.platform_revenue CASCADE;
+DROP TABLE IF EXISTS tenant_schema.function_execution_transactions CASCADE;
+DROP TABLE IF EXISTS tenant_schema.withdrawal_requests CASCADE;
+DROP TABLE IF EXISTS tenant_schema.developer_wallets CASCADE;
+
+ALTER TABLE tenant_schema.organizations
+DROP COLUMN IF EXISTS is_developer,
+DROP COLUMN IF EXISTS stripe_connect_onboarded;
@@ -25,8 +25,8 @@ CREATE TABLE IF NOT EXISTS tenant_schema.developer_wallets (
         REFERENCES tenant_schema.organizations (id) ON DELETE CASCADE
 );
 
-CREATE INDEX idx_developer_wallets_org_id ON tenant_schema.developer_wallets(organization_id);
-CREATE INDEX idx_developer_wallets_stripe_account ON tenant_schema.developer_wallets(stripe_connect_account_id);
+CREATE INDEX IF NOT EXISTS idx_developer_wallets_org_id ON tenant_schema.developer_wallets(organization_id);
+CREATE INDEX IF NOT EXISTS idx_developer_wallets_stripe_account ON tenant_schema.developer_wallets(stripe_connect_account_id);
 
 -- ================================
 -- WITHDRAWAL REQUESTS - Track developer withdrawal requests
@@ -54,9 +54,9 @@ CREATE TABLE IF NOT EXISTS tenant_schema.withdrawal_requests (
         REFERENCES tenant_schema.organizations (id) ON DELETE CASCADE
 );
 
-CREATE INDEX idx_withdrawals_wallet_id ON tenant_schema.withdrawal_requests(developer_wallet_id);
-CREATE INDEX idx_withdrawals_org_id ON tenant_schema.withdrawal_requests(organization_id);
-CREATE INDEX idx_withdrawals_status ON tenant_schema.withdrawal_requests(status);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_wallet_id ON tenant_schema.withdrawal_requests(developer_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_org_id ON tenant_schema.withdrawal_requests(organization_id);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_status ON tenant_schema.withdrawal_requests(status);
 
 -- ================================
 -- FUNCTION EXECUTION TRANSACTIONS - Track payments for function executions
@@ -94,10 +94,10 @@ CREATE TABLE IF NOT EXISTS tenant_schema.function_execution_transactions (
         REFERENCES tenant_schema.organizations (id) ON DELETE CASCADE
 );
 
-CREATE INDEX idx_transactions_function_id ON tenant_schema.function_execution_transactions(function_id);
-CREATE INDEX idx_transactions_user_org ON tenant_schema.function_execution_transactions(user_organization_id);
-CREATE INDEX idx_transactions_dev_org ON tenant_schema.function_execution_transactions(developer_organization_id);
-CREATE INDEX idx_transactions_executed_at ON tenant_schema.function_execution_transactions(executed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_function_id ON tenant_schema.function_execution_transactions(function_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_org ON tenant_schema.function_execution_transactions(user_organization_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_dev_org ON tenant_schema.function_execution_transactions(developer_organization_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_executed_at ON tenant_schema.function_execution_transactions(executed_at DESC);
 
 -- ================================
 -- PLATFORM REVENUE - Track platform commission (optional, for future use)
@@ -114,8 +114,8 @@ CREATE TABLE IF NOT EXISTS tenant_schema.platform_revenue (
         REFERENCES tenant_schema.function_execution_transactions (id) ON DELETE CASCADE
 );
 
-CREATE INDEX idx_platform_revenue_transaction ON tenant_schema.platform_revenue(transaction_id);
-CREATE INDEX idx_platform_revenue_created_at ON tenant_schema.platform_revenue(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_platform_revenue_transaction ON tenant_schema.platform_revenue(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_platform_revenue_created_at ON tenant_schema.platform_revenue(created_at DESC);
 
 -- ================================
 -- ADD STRIPE CONNECT INFO TO ORGANIZATIONS (Optional enhancement)
@@ -192,7 +192,7 @@ FROM
     tenant_schema.function_execution_transactions fet
     LEFT JOIN tenant_schema.organizations uo ON fet.user_organization_id = uo.id
     LEFT JOIN tenant_schema.organizations do ON fet.developer_organization_id = do.id
-    LEFT JOIN tenant_schema.functions f ON fet.function_id = f.function_id::uuid
+    LEFT JOIN tenant_schema.functions f ON f.function_id::text = fet.function_id
 ORDER BY
     fet.executed_at DESC;
 
@@ -209,6 +209,7 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS trigger_update_developer_wallet_timestamp ON tenant_schema.developer_wallets;
 CREATE TRIGGER trigger_update_developer_wallet_timestamp
     BEFORE UPDATE ON tenant_schema.developer_wallets
     FOR EACH ROW
@@ -223,48 +224,8 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS trigger_update_withdrawal_request_timestamp ON tenant_schema.withdrawal_requests;
 CREATE TRIGGER trigger_update_withdrawal_request_timestamp
     BEFORE UPDATE ON tenant_schema.withdrawal_requests
     FOR EACH ROW
     EXECUTE FUNCTION tenant_schema.update_withdrawal_request_timestamp();
-
--- ================================
--- SAMPLE DATA FOR TESTING (Optional - Comment out for production)
--- ================================
-
--- Note: Run this only in development environment
--- COMMENT OUT BEFORE DEPLOYING TO PRODUCTION
-
-/*
--- Create a test developer wallet
-INSERT INTO tenant_schema.developer_wallets (organization_id, balance, total_earned, onboarding_completed, payouts_enabled)
-VALUES (
-    (SELECT id FROM tenant_schema.organizations LIMIT 1),
-    0.00,
-    0.00,
-    FALSE,
-    FALSE
-);
-*/
-
--- ================================
--- CLEANUP SCRIPT (Use with caution!)
--- ================================
-
-/*
--- DANGER: This will delete all Stripe Connect data
--- Only use this for development/testing
-
-DROP VIEW IF EXISTS tenant_schema.v_transaction_history;
-DROP VIEW IF EXISTS tenant_schema.v_withdrawal_history;
-DROP VIEW IF EXISTS tenant_schema.v_developer_earnings;
-
-DROP TABLE IF EXISTS tenant_schema.platform_revenue CASCADE;
-DROP TABLE IF EXISTS tenant_schema.function_execution_transactions CASCADE;
-DROP TABLE IF EXISTS tenant_schema.withdrawal_requests CASCADE;
-DROP TABLE IF EXISTS tenant_schema.developer_wallets CASCADE;
-
-ALTER TABLE tenant_schema.organizations
-DROP COLUMN IF EXISTS is_developer,
-DROP COLUMN IF EXISTS stripe_connect_onboarded;
-*/
@@ -0,0 +1,20 @@
+-- ================================
+-- IDEMPOTENCY KEYS - Replay protection for mutating API requests
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.idempotency_keys (
+    organization_id VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_method VARCHAR(10) NOT NULL,
+    request_path VARCHAR(500) NOT NULL,
+    request_hash CHAR(64) NOT NULL, -- SHA-256 of method, path and body
+    status VARCHAR(20) DEFAULT 'in_progress' NOT NULL, -- in_progress, completed
+    response_status INTEGER,
+    response_content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (organization_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON tenant_schema.idempotency_keys(expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tenant_schema.rate_limit_buckets;
+DROP TABLE IF EXISTS tenant_schema.spending_caps;
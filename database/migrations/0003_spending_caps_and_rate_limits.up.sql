@@ -0,0 +1,24 @@
+-- ================================
+-- SPENDING CAPS - Per user organization (and optionally per function) spend limits
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.spending_caps (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id VARCHAR(255) NOT NULL, -- Paying user organization
+    function_id VARCHAR(255), -- NULL caps spend across all functions
+    period VARCHAR(10) NOT NULL CHECK (period IN ('hour', 'day', 'month')),
+    limit_amount DECIMAL(12,2) NOT NULL CHECK (limit_amount > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_spending_caps_scope
+    ON tenant_schema.spending_caps(organization_id, (COALESCE(function_id, '')), period);
+
+-- ================================
+-- RATE LIMIT BUCKETS - Shared token buckets when running several replicas
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.rate_limit_buckets (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
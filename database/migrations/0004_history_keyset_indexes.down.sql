@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS tenant_schema.idx_transactions_user_org_keyset;
+DROP INDEX IF EXISTS tenant_schema.idx_transactions_dev_org_keyset;
+DROP INDEX IF EXISTS tenant_schema.idx_withdrawals_org_keyset;
+DROP INDEX IF EXISTS tenant_schema.idx_developer_wallets_keyset;
@@ -0,0 +1,7 @@
+-- ================================
+-- KEYSET PAGINATION - Indexes matching the (timestamp, id) sort of history listings
+-- ================================
+CREATE INDEX IF NOT EXISTS idx_developer_wallets_keyset ON tenant_schema.developer_wallets(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_org_keyset ON tenant_schema.withdrawal_requests(organization_id, requested_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_dev_org_keyset ON tenant_schema.function_execution_transactions(developer_organization_id, executed_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_org_keyset ON tenant_schema.function_execution_transactions(user_organization_id, executed_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trigger_record_account_ledger_entry ON tenant_schema.accounts;
+DROP FUNCTION IF EXISTS tenant_schema.record_account_ledger_entry();
+DROP TABLE IF EXISTS tenant_schema.account_ledger_entries;
@@ -0,0 +1,47 @@
+-- ================================
+-- ACCOUNT LEDGER - Every change to a user account balance, for statements
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.account_ledger_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL,
+    organization_id VARCHAR(255) NOT NULL,
+    entry_type VARCHAR(20) NOT NULL, -- top_up, charge, refund, adjustment
+    amount DECIMAL(12,2) NOT NULL, -- Signed change to account_balance
+    balance_after DECIMAL(12,2) NOT NULL,
+    reference_id VARCHAR(255), -- e.g. function execution transaction ID
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_ledger_org_created ON tenant_schema.account_ledger_entries(organization_id, created_at);
+
+-- Records balance changes made by any writer. Callers can classify the change with
+-- SET LOCAL app.ledger_entry_type / app.ledger_reference_id; otherwise increases
+-- are treated as top-ups and decreases as adjustments.
+CREATE OR REPLACE FUNCTION tenant_schema.record_account_ledger_entry()
+RETURNS TRIGGER AS $$
+DECLARE
+    delta DECIMAL(12,2) := NEW.account_balance - OLD.account_balance;
+    ledger_entry_type VARCHAR(20) := NULLIF(current_setting('app.ledger_entry_type', true), '');
+BEGIN
+    IF delta = 0 THEN
+        RETURN NEW;
+    END IF;
+
+    IF ledger_entry_type IS NULL THEN
+        ledger_entry_type := CASE WHEN delta > 0 THEN 'top_up' ELSE 'adjustment' END;
+    END IF;
+
+    INSERT INTO tenant_schema.account_ledger_entries
+    (account_id, organization_id, entry_type, amount, balance_after, reference_id)
+    VALUES (NEW.id, NEW.organization_id::text, ledger_entry_type, delta, NEW.account_balance,
+            NULLIF(current_setting('app.ledger_reference_id', true), ''));
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_record_account_ledger_entry ON tenant_schema.accounts;
+CREATE TRIGGER trigger_record_account_ledger_entry
+    AFTER UPDATE OF account_balance ON tenant_schema.accounts
+    FOR EACH ROW
+    EXECUTE FUNCTION tenant_schema.record_account_ledger_entry();
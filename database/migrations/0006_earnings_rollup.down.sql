@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tenant_schema.rollup_watermarks;
+DROP TABLE IF EXISTS tenant_schema.developer_earnings_daily;
@@ -0,0 +1,20 @@
+-- ================================
+-- EARNINGS ROLLUP - Daily developer earnings, refreshed incrementally for analytics
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.developer_earnings_daily (
+    developer_organization_id VARCHAR(255) NOT NULL,
+    day DATE NOT NULL, -- UTC day of executed_at
+    function_id VARCHAR(255) NOT NULL,
+    user_organization_id VARCHAR(255) NOT NULL, -- Kept so unique paying orgs can be counted per bucket
+    call_count INTEGER NOT NULL,
+    gross_amount DECIMAL(14,2) NOT NULL,
+    platform_fees DECIMAL(14,2) NOT NULL,
+    net_amount DECIMAL(14,2) NOT NULL,
+
+    PRIMARY KEY (developer_organization_id, day, function_id, user_organization_id)
+);
+
+CREATE TABLE IF NOT EXISTS tenant_schema.rollup_watermarks (
+    rollup_name VARCHAR(100) PRIMARY KEY,
+    refreshed_through TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- NOT VALID keeps withdrawals made under a lower configured minimum
+ALTER TABLE tenant_schema.withdrawal_requests DROP CONSTRAINT IF EXISTS withdrawal_requests_amount_check;
+ALTER TABLE tenant_schema.withdrawal_requests ADD CONSTRAINT withdrawal_requests_amount_check CHECK (amount >= 50.00) NOT VALID;
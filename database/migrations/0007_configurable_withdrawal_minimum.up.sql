@@ -0,0 +1,5 @@
+-- ================================
+-- WITHDRAWAL MINIMUM - Enforced by the service (MINIMUM_WITHDRAWAL_AMOUNT) instead of a fixed $50 check
+-- ================================
+ALTER TABLE tenant_schema.withdrawal_requests DROP CONSTRAINT IF EXISTS withdrawal_requests_amount_check;
+ALTER TABLE tenant_schema.withdrawal_requests ADD CONSTRAINT withdrawal_requests_amount_check CHECK (amount > 0);
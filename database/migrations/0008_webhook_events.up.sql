@@ -0,0 +1,16 @@
+-- ================================
+-- WEBHOOK EVENTS - Inbox of received Stripe events, for deduplication and backlog monitoring
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.webhook_events (
+    event_id VARCHAR(255) PRIMARY KEY, -- Stripe event ID (evt_...)
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'received', -- received, processed, failed, discarded
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_backlog ON tenant_schema.webhook_events(received_at)
+    WHERE status IN ('received', 'failed');
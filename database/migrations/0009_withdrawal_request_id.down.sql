@@ -0,0 +1 @@
+ALTER TABLE tenant_schema.withdrawal_requests DROP COLUMN IF EXISTS request_id;
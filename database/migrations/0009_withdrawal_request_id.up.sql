@@ -0,0 +1,4 @@
+-- ================================
+-- WITHDRAWAL REQUEST ID - Request ID of the API call that created the withdrawal, sent to Stripe as metadata
+-- ================================
+ALTER TABLE tenant_schema.withdrawal_requests ADD COLUMN IF NOT EXISTS request_id VARCHAR(255);
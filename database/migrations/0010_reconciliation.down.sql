@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tenant_schema.reconciliation_runs;
+DROP TABLE IF EXISTS tenant_schema.reconciliation_issues;
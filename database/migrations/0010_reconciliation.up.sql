@@ -0,0 +1,38 @@
+-- ================================
+-- RECONCILIATION - Mismatches between local withdrawals and wallets and what Stripe did
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.reconciliation_issues (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    issue_type VARCHAR(50) NOT NULL, -- missing_local_record, status_drift, amount_mismatch, orphan_payout, orphan_transfer, balance_mismatch
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, resolved
+    stripe_account_id VARCHAR(255) NOT NULL,
+    stripe_object_id VARCHAR(255) NOT NULL, -- Payout, transfer or account the issue is about
+    withdrawal_id VARCHAR(255), -- From the Stripe metadata, may name a withdrawal we do not have
+    organization_id UUID,
+    local_amount DECIMAL(12,2),
+    stripe_amount DECIMAL(12,2),
+    local_status VARCHAR(50),
+    stripe_status VARCHAR(50),
+    details TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+
+    CONSTRAINT uq_reconciliation_issue UNIQUE (issue_type, stripe_object_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_issues_open ON tenant_schema.reconciliation_issues(first_seen_at DESC, id DESC)
+    WHERE status = 'open';
+
+CREATE TABLE IF NOT EXISTS tenant_schema.reconciliation_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    since TIMESTAMPTZ NOT NULL,
+    accounts_checked INTEGER NOT NULL DEFAULT 0,
+    issues_found INTEGER NOT NULL DEFAULT 0,
+    issues_resolved INTEGER NOT NULL DEFAULT 0,
+    error TEXT -- Set when some accounts could not be compared, the checkpoint does not move
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started_at ON tenant_schema.reconciliation_runs(started_at DESC);
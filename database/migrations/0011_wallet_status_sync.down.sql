@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tenant_schema.idx_developer_wallets_status_synced_at;
+ALTER TABLE tenant_schema.developer_wallets DROP COLUMN IF EXISTS status_synced_at;
@@ -0,0 +1,9 @@
+-- ================================
+-- WALLET STATUS SYNC - When the onboarding flags of a wallet were last read from Stripe
+-- ================================
+ALTER TABLE tenant_schema.developer_wallets ADD COLUMN IF NOT EXISTS status_synced_at TIMESTAMPTZ;
+
+-- Background sync picks the wallets synced longest ago first
+CREATE INDEX IF NOT EXISTS idx_developer_wallets_status_synced_at
+    ON tenant_schema.developer_wallets (status_synced_at NULLS FIRST)
+    WHERE stripe_connect_account_id IS NOT NULL;
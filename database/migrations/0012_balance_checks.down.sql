@@ -0,0 +1,2 @@
+ALTER TABLE tenant_schema.accounts DROP CONSTRAINT IF EXISTS accounts_account_balance_check;
+ALTER TABLE tenant_schema.developer_wallets DROP CONSTRAINT IF EXISTS developer_wallets_balance_check;
@@ -0,0 +1,9 @@
+-- ================================
+-- BALANCE CHECKS - Wallet and account balances never go below zero
+-- ================================
+-- Fails if a balance is already negative, which must be corrected by hand first
+ALTER TABLE tenant_schema.developer_wallets DROP CONSTRAINT IF EXISTS developer_wallets_balance_check;
+ALTER TABLE tenant_schema.developer_wallets ADD CONSTRAINT developer_wallets_balance_check CHECK (balance >= 0);
+
+ALTER TABLE tenant_schema.accounts DROP CONSTRAINT IF EXISTS accounts_account_balance_check;
+ALTER TABLE tenant_schema.accounts ADD CONSTRAINT accounts_account_balance_check CHECK (account_balance >= 0);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS tenant_schema.idx_transactions_clearing;
+ALTER TABLE tenant_schema.function_execution_transactions DROP COLUMN IF EXISTS released_at;
+ALTER TABLE tenant_schema.function_execution_transactions DROP COLUMN IF EXISTS available_at;
+ALTER TABLE tenant_schema.developer_wallets DROP CONSTRAINT IF EXISTS developer_wallets_pending_balance_check;
+ALTER TABLE tenant_schema.developer_wallets DROP COLUMN IF EXISTS tier;
+ALTER TABLE tenant_schema.developer_wallets DROP COLUMN IF EXISTS pending_balance;
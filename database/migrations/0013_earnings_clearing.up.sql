@@ -0,0 +1,25 @@
+-- ================================
+-- EARNINGS CLEARING - Payments become withdrawable at available_at, until then
+-- their net amount is counted in the wallet's pending_balance
+-- ================================
+ALTER TABLE tenant_schema.developer_wallets ADD COLUMN IF NOT EXISTS pending_balance DECIMAL(12,2) NOT NULL DEFAULT 0.00;
+ALTER TABLE tenant_schema.developer_wallets ADD COLUMN IF NOT EXISTS tier VARCHAR(50); -- Selects the clearing period, NULL for the global one
+ALTER TABLE tenant_schema.developer_wallets DROP CONSTRAINT IF EXISTS developer_wallets_pending_balance_check;
+ALTER TABLE tenant_schema.developer_wallets ADD CONSTRAINT developer_wallets_pending_balance_check
+    CHECK (pending_balance >= 0 AND pending_balance <= balance);
+
+ALTER TABLE tenant_schema.function_execution_transactions ADD COLUMN IF NOT EXISTS available_at TIMESTAMPTZ;
+ALTER TABLE tenant_schema.function_execution_transactions ADD COLUMN IF NOT EXISTS released_at TIMESTAMPTZ;
+
+-- Earlier payments were withdrawable right away
+UPDATE tenant_schema.function_execution_transactions
+SET available_at = executed_at, released_at = executed_at
+WHERE available_at IS NULL;
+
+ALTER TABLE tenant_schema.function_execution_transactions ALTER COLUMN available_at SET DEFAULT NOW();
+ALTER TABLE tenant_schema.function_execution_transactions ALTER COLUMN available_at SET NOT NULL;
+
+-- The release job only looks at payments still clearing
+CREATE INDEX IF NOT EXISTS idx_transactions_clearing
+    ON tenant_schema.function_execution_transactions (available_at)
+    WHERE released_at IS NULL;
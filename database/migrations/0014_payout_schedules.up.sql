@@ -0,0 +1,24 @@
+-- ================================
+-- PAYOUT SCHEDULES - Automatic withdrawals per developer wallet
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.payout_schedules (
+    developer_wallet_id UUID PRIMARY KEY,
+    frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('manual', 'daily', 'weekly', 'monthly')),
+    weekday SMALLINT CHECK (weekday BETWEEN 0 AND 6), -- Weekly schedules, 0 is Sunday
+    day_of_month SMALLINT CHECK (day_of_month BETWEEN 1 AND 31), -- Monthly schedules, the last day in shorter months
+    threshold DECIMAL(12,2) NOT NULL DEFAULT 0.00 CHECK (threshold >= 0), -- Smallest automatic withdrawal
+    reserve DECIMAL(12,2) NOT NULL DEFAULT 0.00 CHECK (reserve >= 0), -- Left in the wallet by automatic withdrawals
+    next_run_at TIMESTAMPTZ, -- NULL for manual schedules
+    last_run_at TIMESTAMPTZ,
+    last_withdrawal_id UUID,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_payout_schedule_wallet
+        FOREIGN KEY (developer_wallet_id)
+        REFERENCES tenant_schema.developer_wallets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_payout_schedules_due ON tenant_schema.payout_schedules(next_run_at)
+    WHERE next_run_at IS NOT NULL;
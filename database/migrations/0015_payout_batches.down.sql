@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tenant_schema.payout_batch_entries;
+DROP TABLE IF EXISTS tenant_schema.payout_batches;
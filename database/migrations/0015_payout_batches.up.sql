@@ -0,0 +1,39 @@
+-- ================================
+-- PAYOUT BATCHES - Platform-run payout cycles paying every eligible developer at once
+-- ================================
+CREATE TABLE IF NOT EXISTS tenant_schema.payout_batches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft'
+        CHECK (status IN ('draft', 'executing', 'submitted', 'completed')),
+    cutoff_at TIMESTAMPTZ NOT NULL, -- Earnings that cleared after this are left for the next batch
+    executed_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ, -- Every withdrawal of the batch completed or failed
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payout_batches_created_at ON tenant_schema.payout_batches(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS tenant_schema.payout_batch_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    batch_id UUID NOT NULL,
+    developer_wallet_id UUID NOT NULL,
+    organization_id UUID NOT NULL,
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    excluded BOOLEAN NOT NULL DEFAULT FALSE, -- Left out by an admin during review
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'requesting', 'requested', 'rejected')),
+    withdrawal_id UUID, -- Recorded before the withdrawal is requested, its status tracks the payout
+    error TEXT, -- Why the withdrawal was rejected
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_payout_batch_entry_batch
+        FOREIGN KEY (batch_id)
+        REFERENCES tenant_schema.payout_batches (id) ON DELETE CASCADE,
+
+    CONSTRAINT fk_payout_batch_entry_wallet
+        FOREIGN KEY (developer_wallet_id)
+        REFERENCES tenant_schema.developer_wallets (id) ON DELETE CASCADE,
+
+    CONSTRAINT uq_payout_batch_entry_wallet UNIQUE (batch_id, developer_wallet_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE tenant_schema.idempotency_keys DROP COLUMN IF EXISTS locked_until;
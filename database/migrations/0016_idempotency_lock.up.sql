@@ -0,0 +1,5 @@
+-- ================================
+-- IDEMPOTENCY LOCK - An in-progress key past locked_until belongs to a request
+-- that died, and a retry takes it over. Existing keys can be taken over at once.
+-- ================================
+ALTER TABLE tenant_schema.idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ NOT NULL DEFAULT NOW();
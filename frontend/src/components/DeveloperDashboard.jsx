@@ -50,7 +50,7 @@ function DeveloperDashboard({ orgId, jwtToken }) {
       if (withdrawalsRes.status === 'fulfilled') setWithdrawals(withdrawalsRes.value.data.withdrawals || [])
     } catch (err) {
       console.error('Error loading dashboard:', err)
-      setError(err.response?.data?.error || 'Failed to load dashboard data')
+      setError(err.response?.data?.error?.message || 'Failed to load dashboard data')
     } finally {
       setLoading(false)
     }
@@ -76,7 +76,7 @@ function DeveloperDashboard({ orgId, jwtToken }) {
       window.open(onboarding_url, '_blank')
       setSuccess('Onboarding link opened in new tab. Complete the process and refresh this page.')
     } catch (err) {
-      setError(err.response?.data?.error || 'Failed to create onboarding link')
+      setError(err.response?.data?.error?.message || 'Failed to create onboarding link')
     }
   }
 
@@ -108,7 +108,7 @@ function DeveloperDashboard({ orgId, jwtToken }) {
       setSuccess(`Withdrawal request created! ${response.data.message}`)
       loadDashboardData()
     } catch (err) {
-      setError(err.response?.data?.error || 'Failed to request withdrawal')
+      setError(err.response?.data?.error?.message || 'Failed to request withdrawal')
     }
   }
 
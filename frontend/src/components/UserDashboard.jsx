@@ -65,7 +65,7 @@ function UserDashboard({ orgId, jwtToken }) {
       setSuccess(`Payment successful! Transaction ID: ${response.data.transaction_id}`)
       loadConnectedDevelopers() // Reload connected developers
     } catch (err) {
-      setError(err.response?.data?.error || 'Failed to process payment')
+      setError(err.response?.data?.error?.message || 'Failed to process payment')
     } finally {
       setLoading(false)
     }
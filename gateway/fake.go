@@ -0,0 +1,584 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/webhook"
+)
+
+// WebhookSink receives the signed webhook events emitted by the fake
+type WebhookSink func(ctx context.Context, payload []byte, signatureHeader string) error
+
+// HTTPWebhookSink posts events to url with a Stripe-Signature header, the way Stripe does
+func HTTPWebhookSink(url string) WebhookSink {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(ctx context.Context, payload []byte, signatureHeader string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Stripe-Signature", signatureHeader)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// FakeOptions configures the in-memory gateway
+type FakeOptions struct {
+	WebhookSecret string      // Signs emitted events
+	Webhooks      WebhookSink // Receives emitted events, nil only records them
+
+	// AutoCompleteOnboarding completes onboarding as soon as an account link is
+	// created, and links point straight at the return URL
+	AutoCompleteOnboarding bool
+
+	// AutoPayPayouts marks payouts paid as soon as they are created
+	AutoPayPayouts bool
+}
+
+// FakeEvent is a webhook event emitted by the fake
+type FakeEvent struct {
+	ID      string
+	Type    string
+	Payload []byte
+}
+
+// Fake is a stateful in-memory StripeGateway. Connected accounts hold a
+// balance in cents: transfers add to it and payouts draw on it, failing with
+// balance_insufficient like Stripe does. Transfers also draw on the platform
+// balance, which only FundPlatform adds to; it may go negative, since funding
+// the platform happens outside this service. Tests drive the rest of the
+// lifecycle with CompleteOnboarding, PayPayout and FailPayout, which emit the
+// same signed webhook events Stripe would send.
+type Fake struct {
+	opts FakeOptions
+
+	mu         sync.Mutex
+	idPrefix   string // Keeps IDs unique across fakes sharing a database
+	seq        int
+	accounts   map[string]*Account
+	balances   map[string]int64 // Connected account balance in cents
+	platform   int64            // Platform available balance in cents
+	transfers  map[string]*Transfer
+	payouts    map[string]*Payout
+	history    []*BalanceTransaction  // Balance transactions of connected accounts
+	idempotent map[string]interface{} // Idempotency key -> created object
+	failures   map[string]error       // Method -> error returned by its next call
+	events     []FakeEvent
+}
+
+// NewFake returns an empty in-memory gateway
+func NewFake(opts FakeOptions) *Fake {
+	return &Fake{
+		opts:       opts,
+		idPrefix:   strings.ReplaceAll(uuid.NewString(), "-", "")[:8],
+		accounts:   map[string]*Account{},
+		balances:   map[string]int64{},
+		transfers:  map[string]*Transfer{},
+		payouts:    map[string]*Payout{},
+		idempotent: map[string]interface{}{},
+		failures:   map[string]error{},
+	}
+}
+
+// ================================
+// STRIPE GATEWAY
+// ================================
+
+func (f *Fake) CreateAccount(ctx context.Context, params *CreateAccountParams) (*Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("CreateAccount"); err != nil {
+		return nil, err
+	}
+	if existing, ok := f.idempotent["account:"+params.IdempotencyKey].(*Account); ok && params.IdempotencyKey != "" {
+		return cloneAccount(existing), nil
+	}
+
+	acc := &Account{ID: f.nextID("acct"), Metadata: cloneMetadata(params.Metadata)}
+	f.accounts[acc.ID] = acc
+	if params.IdempotencyKey != "" {
+		f.idempotent["account:"+params.IdempotencyKey] = acc
+	}
+	return cloneAccount(acc), nil
+}
+
+func (f *Fake) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("GetAccount"); err != nil {
+		return nil, err
+	}
+	acc, ok := f.accounts[accountID]
+	if !ok {
+		return nil, resourceMissing("account", accountID)
+	}
+	return cloneAccount(acc), nil
+}
+
+func (f *Fake) CreateAccountLink(ctx context.Context, params *CreateAccountLinkParams) (*AccountLink, error) {
+	f.mu.Lock()
+	if err := f.takeFailure("CreateAccountLink"); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	if _, ok := f.accounts[params.AccountID]; !ok {
+		f.mu.Unlock()
+		return nil, resourceMissing("account", params.AccountID)
+	}
+
+	link := &AccountLink{
+		URL:       "https://connect.stripe.test/setup/e/" + params.AccountID,
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+	}
+	if f.opts.AutoCompleteOnboarding {
+		link.URL = params.ReturnURL
+	}
+	f.mu.Unlock()
+
+	if f.opts.AutoCompleteOnboarding {
+		// Like Stripe, a webhook delivery failure does not fail the API call
+		if err := f.CompleteOnboarding(ctx, params.AccountID); err != nil {
+			slog.WarnContext(ctx, "fake Stripe webhook delivery failed", "error", err)
+		}
+	}
+	return link, nil
+}
+
+func (f *Fake) CreateTransfer(ctx context.Context, params *CreateTransferParams) (*Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("CreateTransfer"); err != nil {
+		return nil, err
+	}
+	if existing, ok := f.idempotent["transfer:"+params.IdempotencyKey].(*Transfer); ok && params.IdempotencyKey != "" {
+		out := *existing
+		return &out, nil
+	}
+	if _, ok := f.accounts[params.DestinationAccountID]; !ok {
+		return nil, resourceMissing("account", params.DestinationAccountID)
+	}
+	if params.AmountCents <= 0 {
+		return nil, invalidRequest("amount must be positive")
+	}
+
+	tr := &Transfer{
+		ID:                   f.nextID("tr"),
+		DestinationAccountID: params.DestinationAccountID,
+		AmountCents:          params.AmountCents,
+		Currency:             params.Currency,
+		Metadata:             cloneMetadata(params.Metadata),
+		Created:              time.Now(),
+	}
+	f.transfers[tr.ID] = tr
+	f.balances[tr.DestinationAccountID] += tr.AmountCents
+	f.platform -= tr.AmountCents
+	f.recordBalanceTransaction(tr.DestinationAccountID, BalanceTransactionTypePayment, tr.ID, tr.AmountCents, tr.Currency)
+	if params.IdempotencyKey != "" {
+		f.idempotent["transfer:"+params.IdempotencyKey] = tr
+	}
+
+	out := *tr
+	return &out, nil
+}
+
+func (f *Fake) CreatePayout(ctx context.Context, params *CreatePayoutParams) (*Payout, error) {
+	f.mu.Lock()
+	if err := f.takeFailure("CreatePayout"); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	if existing, ok := f.idempotent["payout:"+params.IdempotencyKey].(*Payout); ok && params.IdempotencyKey != "" {
+		out := *existing
+		f.mu.Unlock()
+		return &out, nil
+	}
+
+	acc, ok := f.accounts[params.AccountID]
+	switch {
+	case !ok:
+		f.mu.Unlock()
+		return nil, resourceMissing("account", params.AccountID)
+	case !acc.PayoutsEnabled:
+		f.mu.Unlock()
+		return nil, &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest,
+			Code: stripe.ErrorCodePayoutsNotAllowed, Msg: "Payouts are not enabled for this account"}
+	case f.balances[params.AccountID] < params.AmountCents:
+		f.mu.Unlock()
+		return nil, &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest,
+			Code: stripe.ErrorCodeBalanceInsufficient, Msg: "You have insufficient funds in your Stripe account"}
+	}
+
+	po := &Payout{
+		ID:          f.nextID("po"),
+		AccountID:   params.AccountID,
+		AmountCents: params.AmountCents,
+		Currency:    params.Currency,
+		Status:      PayoutStatusPending,
+		Metadata:    cloneMetadata(params.Metadata),
+		ArrivalDate: time.Now().AddDate(0, 0, 2),
+		Created:     time.Now(),
+	}
+	f.payouts[po.ID] = po
+	f.balances[po.AccountID] -= po.AmountCents
+	f.recordBalanceTransaction(po.AccountID, BalanceTransactionTypePayout, po.ID, -po.AmountCents, po.Currency)
+	if params.IdempotencyKey != "" {
+		f.idempotent["payout:"+params.IdempotencyKey] = po
+	}
+	out := *po
+	f.mu.Unlock()
+
+	if f.opts.AutoPayPayouts {
+		if err := f.PayPayout(ctx, po.ID); err != nil {
+			slog.WarnContext(ctx, "fake Stripe webhook delivery failed", "error", err)
+		}
+		out.Status = PayoutStatusPaid
+	}
+	return &out, nil
+}
+
+func (f *Fake) ListTransfers(ctx context.Context, destinationAccountID string, since time.Time) ([]*Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("ListTransfers"); err != nil {
+		return nil, err
+	}
+	var transfers []*Transfer
+	for _, tr := range f.transfers {
+		if tr.DestinationAccountID == destinationAccountID && !tr.Created.Before(since) {
+			out := *tr
+			out.Metadata = cloneMetadata(tr.Metadata)
+			transfers = append(transfers, &out)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	return transfers, nil
+}
+
+func (f *Fake) ListPayouts(ctx context.Context, accountID string, since time.Time) ([]*Payout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("ListPayouts"); err != nil {
+		return nil, err
+	}
+	var payouts []*Payout
+	for _, po := range f.payouts {
+		if po.AccountID == accountID && !po.Created.Before(since) {
+			out := *po
+			out.Metadata = cloneMetadata(po.Metadata)
+			payouts = append(payouts, &out)
+		}
+	}
+	sort.Slice(payouts, func(i, j int) bool { return payouts[i].ID < payouts[j].ID })
+	return payouts, nil
+}
+
+func (f *Fake) ListBalanceTransactions(ctx context.Context, accountID string, since time.Time) ([]*BalanceTransaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("ListBalanceTransactions"); err != nil {
+		return nil, err
+	}
+	var transactions []*BalanceTransaction
+	for _, txn := range f.history {
+		if txn.AccountID == accountID && !txn.Created.Before(since) {
+			out := *txn
+			transactions = append(transactions, &out)
+		}
+	}
+	return transactions, nil
+}
+
+func (f *Fake) GetBalance(ctx context.Context, accountID string) (*Balance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.takeFailure("GetBalance"); err != nil {
+		return nil, err
+	}
+	if accountID == "" {
+		return &Balance{Available: map[string]int64{CurrencyUSD: f.platform}, Pending: map[string]int64{}}, nil
+	}
+	if _, ok := f.accounts[accountID]; !ok {
+		return nil, resourceMissing("account", accountID)
+	}
+	return &Balance{Available: map[string]int64{CurrencyUSD: f.balances[accountID]}, Pending: map[string]int64{}}, nil
+}
+
+func (f *Fake) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.takeFailure("Ping")
+}
+
+// ================================
+// TEST CONTROLS
+// ================================
+
+// CompleteOnboarding enables payouts and charges for an account and emits account.updated
+func (f *Fake) CompleteOnboarding(ctx context.Context, accountID string) error {
+	f.mu.Lock()
+	acc, ok := f.accounts[accountID]
+	if !ok {
+		f.mu.Unlock()
+		return resourceMissing("account", accountID)
+	}
+	acc.DetailsSubmitted = true
+	acc.PayoutsEnabled = true
+	acc.ChargesEnabled = true
+	object := accountObject(acc)
+	f.mu.Unlock()
+
+	return f.emit(ctx, "account.updated", accountID, object)
+}
+
+// PayPayout marks a payout paid and emits payout.paid
+func (f *Fake) PayPayout(ctx context.Context, payoutID string) error {
+	return f.settlePayout(ctx, payoutID, PayoutStatusPaid, "", "")
+}
+
+// FailPayout marks a payout failed, returns its amount to the account balance and emits payout.failed
+func (f *Fake) FailPayout(ctx context.Context, payoutID, failureCode, failureMessage string) error {
+	return f.settlePayout(ctx, payoutID, PayoutStatusFailed, failureCode, failureMessage)
+}
+
+// FailNext makes the next call to method (e.g. "CreatePayout") return err
+func (f *Fake) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = err
+}
+
+// Failing reports whether an error injected with FailNext still waits for its call
+func (f *Fake) Failing(method string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.failures[method]
+	return ok
+}
+
+// FundPlatform adds amountCents to the platform balance, like a user top-up would
+func (f *Fake) FundPlatform(amountCents int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.platform += amountCents
+}
+
+// Balance returns a connected account's balance in cents
+func (f *Fake) Balance(accountID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.balances[accountID]
+}
+
+// Payout returns a payout by ID
+func (f *Fake) Payout(payoutID string) (*Payout, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	po, ok := f.payouts[payoutID]
+	if !ok {
+		return nil, false
+	}
+	out := *po
+	return &out, true
+}
+
+// Transfers returns every transfer made, in creation order
+func (f *Fake) Transfers() []*Transfer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	transfers := make([]*Transfer, 0, len(f.transfers))
+	for _, tr := range f.transfers {
+		out := *tr
+		transfers = append(transfers, &out)
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	return transfers
+}
+
+// Events returns every webhook event emitted so far
+func (f *Fake) Events() []FakeEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeEvent(nil), f.events...)
+}
+
+func (f *Fake) settlePayout(ctx context.Context, payoutID, status, failureCode, failureMessage string) error {
+	f.mu.Lock()
+	po, ok := f.payouts[payoutID]
+	if !ok {
+		f.mu.Unlock()
+		return resourceMissing("payout", payoutID)
+	}
+	if po.Status != PayoutStatusPending {
+		f.mu.Unlock()
+		return invalidRequest("payout " + payoutID + " is already " + po.Status)
+	}
+	po.Status = status
+	po.FailureCode = failureCode
+	po.FailureMessage = failureMessage
+	if status == PayoutStatusFailed {
+		f.balances[po.AccountID] += po.AmountCents
+		f.recordBalanceTransaction(po.AccountID, BalanceTransactionTypePayoutFailure, po.ID, po.AmountCents, po.Currency)
+	}
+	object := payoutObject(po)
+	f.mu.Unlock()
+
+	return f.emit(ctx, "payout."+status, po.AccountID, object)
+}
+
+// emit records and delivers a signed event. It must be called without f.mu
+// held, since the receiver typically calls back into the gateway.
+func (f *Fake) emit(ctx context.Context, eventType, accountID string, object map[string]interface{}) error {
+	f.mu.Lock()
+	id := f.nextID("evt")
+	f.mu.Unlock()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"object":      "event",
+		"api_version": stripe.APIVersion,
+		"created":     time.Now().Unix(),
+		"livemode":    false,
+		"type":        eventType,
+		"account":     accountID,
+		"data":        map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.events = append(f.events, FakeEvent{ID: id, Type: eventType, Payload: payload})
+	f.mu.Unlock()
+
+	if f.opts.Webhooks == nil {
+		return nil
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  f.opts.WebhookSecret,
+	})
+	if err := f.opts.Webhooks(ctx, payload, signed.Header); err != nil {
+		return fmt.Errorf("failed to deliver %s webhook: %w", eventType, err)
+	}
+	return nil
+}
+
+// recordBalanceTransaction appends to the balance history of accountID, callers hold f.mu
+func (f *Fake) recordBalanceTransaction(accountID, txnType, sourceID string, amountCents int64, currency string) {
+	f.history = append(f.history, &BalanceTransaction{
+		ID:          f.nextID("txn"),
+		AccountID:   accountID,
+		AmountCents: amountCents,
+		Currency:    currency,
+		Type:        txnType,
+		SourceID:    sourceID,
+		Created:     time.Now(),
+	})
+}
+
+// nextID returns a Stripe-like ID, callers hold f.mu
+func (f *Fake) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake%s%06d", prefix, f.idPrefix, f.seq)
+}
+
+// takeFailure returns and clears an injected failure, callers hold f.mu
+func (f *Fake) takeFailure(method string) error {
+	err := f.failures[method]
+	delete(f.failures, method)
+	return err
+}
+
+// ================================
+// HELPERS
+// ================================
+
+func accountObject(acc *Account) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                acc.ID,
+		"object":            "account",
+		"type":              "express",
+		"details_submitted": acc.DetailsSubmitted,
+		"payouts_enabled":   acc.PayoutsEnabled,
+		"charges_enabled":   acc.ChargesEnabled,
+		"metadata":          cloneMetadata(acc.Metadata),
+	}
+}
+
+func payoutObject(po *Payout) map[string]interface{} {
+	object := map[string]interface{}{
+		"id":           po.ID,
+		"object":       "payout",
+		"amount":       po.AmountCents,
+		"currency":     po.Currency,
+		"status":       po.Status,
+		"arrival_date": po.ArrivalDate.Unix(),
+		"created":      po.Created.Unix(),
+		"metadata":     cloneMetadata(po.Metadata),
+	}
+	if po.FailureCode != "" {
+		object["failure_code"] = po.FailureCode
+		object["failure_message"] = po.FailureMessage
+	}
+	return object
+}
+
+func resourceMissing(resource, id string) error {
+	return &stripe.Error{
+		HTTPStatusCode: http.StatusNotFound,
+		Type:           stripe.ErrorTypeInvalidRequest,
+		Code:           stripe.ErrorCodeResourceMissing,
+		Msg:            fmt.Sprintf("No such %s: '%s'", resource, id),
+	}
+}
+
+func invalidRequest(msg string) error {
+	return &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest, Msg: msg}
+}
+
+func cloneAccount(acc *Account) *Account {
+	out := *acc
+	out.Metadata = cloneMetadata(acc.Metadata)
+	return &out
+}
+
+func cloneMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// onboardedAccount creates a connected account with payouts enabled
+func onboardedAccount(t *testing.T, f *Fake) string {
+	t.Helper()
+	ctx := context.Background()
+	acc, err := f.CreateAccount(ctx, &CreateAccountParams{})
+	if err != nil {
+		t.Fatalf("CreateAccount: %v", err)
+	}
+	if err := f.CompleteOnboarding(ctx, acc.ID); err != nil {
+		t.Fatalf("CompleteOnboarding: %v", err)
+	}
+	return acc.ID
+}
+
+func TestFakePayoutNeedsTransferredFunds(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake(FakeOptions{})
+	accountID := onboardedAccount(t, f)
+
+	// Earnings stay on the platform until they are transferred
+	_, err := f.CreatePayout(ctx, &CreatePayoutParams{AccountID: accountID, AmountCents: 5000, Currency: CurrencyUSD})
+	var stripeErr *stripe.Error
+	if !errors.As(err, &stripeErr) || stripeErr.Code != stripe.ErrorCodeBalanceInsufficient {
+		t.Fatalf("CreatePayout without funds = %v, want balance_insufficient", err)
+	}
+
+	transfer := &CreateTransferParams{DestinationAccountID: accountID, AmountCents: 5000, Currency: CurrencyUSD, IdempotencyKey: "withdrawal-1-transfer"}
+	first, err := f.CreateTransfer(ctx, transfer)
+	if err != nil {
+		t.Fatalf("CreateTransfer: %v", err)
+	}
+	retried, err := f.CreateTransfer(ctx, transfer)
+	if err != nil {
+		t.Fatalf("CreateTransfer retry: %v", err)
+	}
+	if retried.ID != first.ID || len(f.Transfers()) != 1 || f.Balance(accountID) != 5000 {
+		t.Fatalf("retried transfer %s, %d transfers, balance %d, want the first transfer once", retried.ID, len(f.Transfers()), f.Balance(accountID))
+	}
+
+	po, err := f.CreatePayout(ctx, &CreatePayoutParams{AccountID: accountID, AmountCents: 5000, Currency: CurrencyUSD})
+	if err != nil {
+		t.Fatalf("CreatePayout: %v", err)
+	}
+	if f.Balance(accountID) != 0 {
+		t.Errorf("balance = %d, want 0 after the payout", f.Balance(accountID))
+	}
+
+	// A failed payout leaves the funds on the connected account, not the platform
+	if err := f.FailPayout(ctx, po.ID, "account_closed", "The bank account has been closed"); err != nil {
+		t.Fatalf("FailPayout: %v", err)
+	}
+	if f.Balance(accountID) != 5000 {
+		t.Errorf("balance = %d, want the failed payout back on the account", f.Balance(accountID))
+	}
+}
@@ -0,0 +1,165 @@
+// Package gateway wraps the Stripe API calls made by the services behind the
+// StripeGateway interface. NewStripeGateway talks to Stripe, NewFake simulates
+// it in memory for tests and local development without network access.
+package gateway
+
+import (
+	"context"
+	"time"
+)
+
+// StripeGateway is every Stripe operation the platform performs.
+// Errors are returned as *stripe.Error so callers can classify them.
+type StripeGateway interface {
+	// Connected accounts
+	CreateAccount(ctx context.Context, params *CreateAccountParams) (*Account, error)
+	GetAccount(ctx context.Context, accountID string) (*Account, error)
+	CreateAccountLink(ctx context.Context, params *CreateAccountLinkParams) (*AccountLink, error)
+
+	// Money movement
+	CreateTransfer(ctx context.Context, params *CreateTransferParams) (*Transfer, error)
+	CreatePayout(ctx context.Context, params *CreatePayoutParams) (*Payout, error)
+
+	// Reporting, for reconciliation. Lists return the objects created at or after since.
+	ListTransfers(ctx context.Context, destinationAccountID string, since time.Time) ([]*Transfer, error)
+	ListPayouts(ctx context.Context, accountID string, since time.Time) ([]*Payout, error)
+	ListBalanceTransactions(ctx context.Context, accountID string, since time.Time) ([]*BalanceTransaction, error)
+	// GetBalance returns the balance of a connected account, or of the platform when accountID is empty
+	GetBalance(ctx context.Context, accountID string) (*Balance, error)
+
+	// Health
+	// Ping checks that Stripe is reachable and accepts the API key
+	Ping(ctx context.Context) error
+}
+
+// ================================
+// PARAMS
+// ================================
+
+// Idempotency keys are derived from our entity IDs, so a retried call, job or
+// request replays the original Stripe request instead of making a new one.
+// They must not contain request IDs, which differ between retries.
+
+// AccountIdempotencyKey is the key of the Connect account of a wallet
+func AccountIdempotencyKey(walletID string) string {
+	return "connect-account-" + walletID
+}
+
+// TransferIdempotencyKey is the key of the transfer of a withdrawal
+func TransferIdempotencyKey(withdrawalID string) string {
+	return "withdrawal-" + withdrawalID + "-transfer"
+}
+
+// PayoutIdempotencyKey is the key of the payout of a withdrawal
+func PayoutIdempotencyKey(withdrawalID string) string {
+	return "withdrawal-" + withdrawalID + "-payout"
+}
+
+// CreateAccountParams creates an Express connected account with transfers enabled
+type CreateAccountParams struct {
+	Metadata       map[string]string
+	IdempotencyKey string // Retries with the same key return the same account
+}
+
+// CreateAccountLinkParams creates an onboarding link for a connected account
+type CreateAccountLinkParams struct {
+	AccountID  string
+	RefreshURL string // Where to redirect if the link expired
+	ReturnURL  string // Where to redirect after onboarding
+}
+
+// CreateTransferParams moves platform funds to a connected account
+type CreateTransferParams struct {
+	DestinationAccountID string
+	AmountCents          int64
+	Currency             string
+	Metadata             map[string]string
+	IdempotencyKey       string
+}
+
+// CreatePayoutParams pays out a connected account's balance to its bank account
+type CreatePayoutParams struct {
+	AccountID      string
+	AmountCents    int64
+	Currency       string
+	Metadata       map[string]string
+	IdempotencyKey string
+}
+
+// ================================
+// OBJECTS
+// ================================
+
+// Account is a Stripe connected account
+type Account struct {
+	ID               string
+	DetailsSubmitted bool
+	PayoutsEnabled   bool
+	ChargesEnabled   bool
+	Metadata         map[string]string
+}
+
+// AccountLink is a single-use onboarding URL
+type AccountLink struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// Transfer is a movement of funds from the platform to a connected account
+type Transfer struct {
+	ID                   string
+	DestinationAccountID string
+	AmountCents          int64
+	Currency             string
+	Metadata             map[string]string
+	Created              time.Time
+}
+
+// Payout is a movement of funds from a connected account to its bank account
+type Payout struct {
+	ID             string
+	AccountID      string
+	AmountCents    int64
+	Currency       string
+	Status         string // pending, in_transit, paid, failed, canceled
+	Metadata       map[string]string
+	FailureCode    string
+	FailureMessage string
+	ArrivalDate    time.Time
+	Created        time.Time
+}
+
+// BalanceTransaction is an entry in the balance history of an account. Source
+// is the object that moved the funds, e.g. the payout of a payout_failure.
+type BalanceTransaction struct {
+	ID          string
+	AccountID   string
+	AmountCents int64 // Negative when funds left the balance
+	Currency    string
+	Type        string
+	SourceID    string
+	Created     time.Time
+}
+
+// Balance is the funds an account holds in Stripe, in cents by currency
+type Balance struct {
+	Available map[string]int64
+	Pending   map[string]int64
+}
+
+// Constants
+const (
+	CurrencyUSD = "usd"
+
+	PayoutStatusPending   = "pending"
+	PayoutStatusInTransit = "in_transit"
+	PayoutStatusPaid      = "paid"
+	PayoutStatusFailed    = "failed"
+	PayoutStatusCanceled  = "canceled"
+
+	// Balance transaction types the reconciler looks at
+	BalanceTransactionTypePayment       = "payment" // A transfer arriving on a connected account
+	BalanceTransactionTypePayout        = "payout"
+	BalanceTransactionTypePayoutFailure = "payout_failure"
+	BalanceTransactionTypePayoutCancel  = "payout_cancel"
+)
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"strpe-connect/metrics"
+	"strpe-connect/tracing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type instrumentedGateway struct {
+	next StripeGateway
+}
+
+// Instrument wraps next so every call is traced and recorded in the Stripe
+// latency and error metrics
+func Instrument(next StripeGateway) StripeGateway {
+	return &instrumentedGateway{next: next}
+}
+
+func (g *instrumentedGateway) CreateAccount(ctx context.Context, params *CreateAccountParams) (*Account, error) {
+	ctx, done := start(ctx, "create_account")
+	acc, err := g.next.CreateAccount(ctx, params)
+	done(err)
+	return acc, err
+}
+
+func (g *instrumentedGateway) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	ctx, done := start(ctx, "get_account", attribute.String("stripe.account_id", accountID))
+	acc, err := g.next.GetAccount(ctx, accountID)
+	done(err)
+	return acc, err
+}
+
+func (g *instrumentedGateway) CreateAccountLink(ctx context.Context, params *CreateAccountLinkParams) (*AccountLink, error) {
+	ctx, done := start(ctx, "create_account_link", attribute.String("stripe.account_id", params.AccountID))
+	link, err := g.next.CreateAccountLink(ctx, params)
+	done(err)
+	return link, err
+}
+
+func (g *instrumentedGateway) CreateTransfer(ctx context.Context, params *CreateTransferParams) (*Transfer, error) {
+	ctx, done := start(ctx, "create_transfer",
+		attribute.String("stripe.account_id", params.DestinationAccountID),
+		attribute.Int64("stripe.amount_cents", params.AmountCents),
+		attribute.String("stripe.idempotency_key", params.IdempotencyKey),
+	)
+	tr, err := g.next.CreateTransfer(ctx, params)
+	done(err)
+	return tr, err
+}
+
+func (g *instrumentedGateway) CreatePayout(ctx context.Context, params *CreatePayoutParams) (*Payout, error) {
+	ctx, done := start(ctx, "create_payout",
+		attribute.String("stripe.account_id", params.AccountID),
+		attribute.Int64("stripe.amount_cents", params.AmountCents),
+		attribute.String("stripe.idempotency_key", params.IdempotencyKey),
+	)
+	po, err := g.next.CreatePayout(ctx, params)
+	done(err)
+	return po, err
+}
+
+func (g *instrumentedGateway) ListTransfers(ctx context.Context, destinationAccountID string, since time.Time) ([]*Transfer, error) {
+	ctx, done := start(ctx, "list_transfers", attribute.String("stripe.account_id", destinationAccountID))
+	transfers, err := g.next.ListTransfers(ctx, destinationAccountID, since)
+	done(err)
+	return transfers, err
+}
+
+func (g *instrumentedGateway) ListPayouts(ctx context.Context, accountID string, since time.Time) ([]*Payout, error) {
+	ctx, done := start(ctx, "list_payouts", attribute.String("stripe.account_id", accountID))
+	payouts, err := g.next.ListPayouts(ctx, accountID, since)
+	done(err)
+	return payouts, err
+}
+
+func (g *instrumentedGateway) ListBalanceTransactions(ctx context.Context, accountID string, since time.Time) ([]*BalanceTransaction, error) {
+	ctx, done := start(ctx, "list_balance_transactions", attribute.String("stripe.account_id", accountID))
+	transactions, err := g.next.ListBalanceTransactions(ctx, accountID, since)
+	done(err)
+	return transactions, err
+}
+
+func (g *instrumentedGateway) GetBalance(ctx context.Context, accountID string) (*Balance, error) {
+	ctx, done := start(ctx, "get_balance", attribute.String("stripe.account_id", accountID))
+	balance, err := g.next.GetBalance(ctx, accountID)
+	done(err)
+	return balance, err
+}
+
+func (g *instrumentedGateway) Ping(ctx context.Context) error {
+	ctx, done := start(ctx, "ping")
+	err := g.next.Ping(ctx)
+	done(err)
+	return err
+}
+
+// start begins the span of a call. The returned function ends it and records
+// the call in the metrics.
+func start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	began := time.Now()
+	ctx, span := tracing.Start(ctx, "stripe."+operation, trace.SpanKindClient, attrs...)
+	return ctx, func(err error) {
+		code := errorCode(err)
+		metrics.ObserveStripeCall(operation, time.Since(began), code)
+		if code != "" {
+			span.SetAttributes(attribute.String("stripe.error_code", code))
+		}
+		tracing.End(span, err)
+	}
+}
+
+// errorCode labels a failed call with the Stripe error code, or the error type
+// when Stripe did not send a code
+func errorCode(err error) string {
+	var stripeErr *stripe.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &stripeErr) && stripeErr.Code != "":
+		return string(stripeErr.Code)
+	case errors.As(err, &stripeErr) && stripeErr.Type != "":
+		return string(stripeErr.Type)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "network"
+	}
+}
@@ -0,0 +1,319 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strpe-connect/apperrors"
+	"strpe-connect/metrics"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// ResilientOptions tunes NewResilient. Zero fields use the defaults below.
+type ResilientOptions struct {
+	CallTimeout      time.Duration // Each attempt is cut off after this long, or earlier at the deadline of ctx
+	MaxRetries       int           // Attempts after the first for retryable errors, negative disables retries
+	BaseBackoff      time.Duration // Upper bound of the first backoff, doubled for every later one
+	MaxBackoff       time.Duration
+	BreakerThreshold int           // Consecutive failed attempts that open the circuit
+	BreakerCooldown  time.Duration // How long an open circuit fails calls before letting one through
+}
+
+const (
+	DefaultCallTimeout      = 10 * time.Second
+	DefaultMaxRetries       = 2
+	DefaultBaseBackoff      = 250 * time.Millisecond
+	DefaultMaxBackoff       = 2 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+func (o ResilientOptions) withDefaults() ResilientOptions {
+	if o.CallTimeout <= 0 {
+		o.CallTimeout = DefaultCallTimeout
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultMaxRetries
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = DefaultBaseBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultMaxBackoff
+	}
+	if o.BreakerThreshold <= 0 {
+		o.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if o.BreakerCooldown <= 0 {
+		o.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return o
+}
+
+// ErrCircuitOpen is the cause of the stripe_unavailable error returned
+// without calling Stripe while the circuit is open
+var ErrCircuitOpen = errors.New("Stripe circuit breaker is open")
+
+type resilientGateway struct {
+	next    StripeGateway
+	opts    ResilientOptions
+	breaker *breaker
+}
+
+// NewResilient wraps next so every call gets a timeout, retryable errors are
+// retried with jittered backoff, and calls fail fast with a stripe_unavailable
+// error while Stripe keeps failing. Writes without an idempotency key get one
+// derived from the entity IDs in their metadata, and writes that still have
+// none are never retried, so a retry cannot move money twice.
+func NewResilient(next StripeGateway, opts ResilientOptions) StripeGateway {
+	opts = opts.withDefaults()
+	return &resilientGateway{
+		next:    next,
+		opts:    opts,
+		breaker: &breaker{threshold: opts.BreakerThreshold, cooldown: opts.BreakerCooldown},
+	}
+}
+
+func (g *resilientGateway) CreateAccount(ctx context.Context, params *CreateAccountParams) (*Account, error) {
+	if params.IdempotencyKey == "" && params.Metadata["wallet_id"] != "" {
+		derived := *params
+		derived.IdempotencyKey = AccountIdempotencyKey(params.Metadata["wallet_id"])
+		params = &derived
+	}
+	return call(ctx, g, "create_account", params.IdempotencyKey != "", func(ctx context.Context) (*Account, error) {
+		return g.next.CreateAccount(ctx, params)
+	})
+}
+
+func (g *resilientGateway) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	return call(ctx, g, "get_account", true, func(ctx context.Context) (*Account, error) {
+		return g.next.GetAccount(ctx, accountID)
+	})
+}
+
+// CreateAccountLink is retried without a key, a second link only replaces the first
+func (g *resilientGateway) CreateAccountLink(ctx context.Context, params *CreateAccountLinkParams) (*AccountLink, error) {
+	return call(ctx, g, "create_account_link", true, func(ctx context.Context) (*AccountLink, error) {
+		return g.next.CreateAccountLink(ctx, params)
+	})
+}
+
+func (g *resilientGateway) CreateTransfer(ctx context.Context, params *CreateTransferParams) (*Transfer, error) {
+	if params.IdempotencyKey == "" && params.Metadata["withdrawal_id"] != "" {
+		derived := *params
+		derived.IdempotencyKey = TransferIdempotencyKey(params.Metadata["withdrawal_id"])
+		params = &derived
+	}
+	return call(ctx, g, "create_transfer", params.IdempotencyKey != "", func(ctx context.Context) (*Transfer, error) {
+		return g.next.CreateTransfer(ctx, params)
+	})
+}
+
+func (g *resilientGateway) CreatePayout(ctx context.Context, params *CreatePayoutParams) (*Payout, error) {
+	if params.IdempotencyKey == "" && params.Metadata["withdrawal_id"] != "" {
+		derived := *params
+		derived.IdempotencyKey = PayoutIdempotencyKey(params.Metadata["withdrawal_id"])
+		params = &derived
+	}
+	return call(ctx, g, "create_payout", params.IdempotencyKey != "", func(ctx context.Context) (*Payout, error) {
+		return g.next.CreatePayout(ctx, params)
+	})
+}
+
+func (g *resilientGateway) ListTransfers(ctx context.Context, destinationAccountID string, since time.Time) ([]*Transfer, error) {
+	return call(ctx, g, "list_transfers", true, func(ctx context.Context) ([]*Transfer, error) {
+		return g.next.ListTransfers(ctx, destinationAccountID, since)
+	})
+}
+
+func (g *resilientGateway) ListPayouts(ctx context.Context, accountID string, since time.Time) ([]*Payout, error) {
+	return call(ctx, g, "list_payouts", true, func(ctx context.Context) ([]*Payout, error) {
+		return g.next.ListPayouts(ctx, accountID, since)
+	})
+}
+
+func (g *resilientGateway) ListBalanceTransactions(ctx context.Context, accountID string, since time.Time) ([]*BalanceTransaction, error) {
+	return call(ctx, g, "list_balance_transactions", true, func(ctx context.Context) ([]*BalanceTransaction, error) {
+		return g.next.ListBalanceTransactions(ctx, accountID, since)
+	})
+}
+
+func (g *resilientGateway) GetBalance(ctx context.Context, accountID string) (*Balance, error) {
+	return call(ctx, g, "get_balance", true, func(ctx context.Context) (*Balance, error) {
+		return g.next.GetBalance(ctx, accountID)
+	})
+}
+
+// Ping is not retried, health checks want to know about the first failure
+func (g *resilientGateway) Ping(ctx context.Context) error {
+	_, err := call(ctx, g, "ping", false, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, g.next.Ping(ctx)
+	})
+	return err
+}
+
+// call runs fn through the circuit breaker with a timeout per attempt. When
+// retry is set, retryable errors are tried again after a backoff until the
+// retries or the deadline of ctx run out.
+func call[T any](ctx context.Context, g *resilientGateway, operation string, retry bool, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	for attempt := 0; ; attempt++ {
+		if !g.breaker.allow() {
+			return zero, apperrors.StripeUnavailable(ErrCircuitOpen)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, g.opts.CallTimeout)
+		result, err := fn(attemptCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			g.breaker.success()
+			return result, nil
+		case ctx.Err() != nil:
+			// The caller gave up, which says nothing about Stripe
+			g.breaker.release()
+			return zero, err
+		case isOutage(err):
+			g.breaker.failure(ctx, operation)
+		default:
+			// Stripe answered, even if with an error
+			g.breaker.success()
+		}
+
+		if !retry || attempt >= g.opts.MaxRetries || !isRetryable(err) {
+			return zero, err
+		}
+		wait := g.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return zero, err
+		}
+
+		slog.WarnContext(ctx, "retrying Stripe call", "operation", operation, "attempt", attempt+1, "backoff", wait, "error", err)
+		metrics.ObserveStripeRetry(operation)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random wait below an exponentially growing bound, so
+// concurrent callers do not retry in lockstep
+func (g *resilientGateway) backoff(attempt int) time.Duration {
+	bound := g.opts.MaxBackoff
+	if attempt < 30 && g.opts.BaseBackoff<<attempt < bound {
+		bound = g.opts.BaseBackoff << attempt
+	}
+	return time.Duration(rand.Int63n(int64(bound))) + 1
+}
+
+// isRetryable reports whether a call that failed with err may succeed when
+// sent again: network errors, timeouts, rate limits, conflicting concurrent
+// requests with the same idempotency key, and server errors
+func isRetryable(err error) bool {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		switch stripeErr.HTTPStatusCode {
+		case http.StatusTooManyRequests, http.StatusConflict:
+			return true
+		}
+	}
+	return isOutage(err)
+}
+
+// isOutage reports whether err means Stripe could not be reached or failed to
+// handle the request, as opposed to rejecting it
+func isOutage(err error) bool {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode != 0 {
+		return stripeErr.HTTPStatusCode >= http.StatusInternalServerError
+	}
+	var appErr *apperrors.Error
+	return !errors.As(err, &appErr) && !errors.Is(err, context.Canceled)
+}
+
+// ================================
+// CIRCUIT BREAKER
+// ================================
+
+// breaker opens after threshold consecutive outages and then fails calls
+// until cooldown has passed. The first call after that is let through as a
+// probe: it closes the circuit if it succeeds and opens it again otherwise.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int       // Consecutive outages while closed
+	openedAt time.Time // Zero while closed
+	probing  bool      // A probe is in flight while half open
+}
+
+// allow reports whether a call may be sent to Stripe
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openedAt.IsZero():
+		return true
+	case b.probing || time.Since(b.openedAt) < b.cooldown:
+		return false
+	default:
+		b.probing = true
+		return true
+	}
+}
+
+// success records a call that Stripe answered
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if !b.openedAt.IsZero() {
+		b.openedAt = time.Time{}
+		metrics.ObserveStripeCircuit(false)
+		slog.Info("Stripe circuit breaker closed")
+	}
+}
+
+// failure records an outage, opening the circuit at the threshold or when
+// the probe of a half open circuit failed
+func (b *breaker) failure(ctx context.Context, operation string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !b.openedAt.IsZero() {
+		b.openedAt = time.Now()
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		metrics.ObserveStripeCircuit(true)
+		slog.ErrorContext(ctx, "Stripe circuit breaker opened, failing Stripe calls fast",
+			"operation", operation, "consecutive_failures", b.failures, "cooldown", b.cooldown)
+	}
+}
+
+// release frees the probe of a call abandoned by its caller, so the next call probes instead
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
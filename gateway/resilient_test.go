@@ -0,0 +1,256 @@
+package gateway_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// flaky fails the calls it overrides with the queued errors, after they
+// reached the wrapped gateway, like a response lost on the network
+type flaky struct {
+	gateway.StripeGateway
+
+	mu    sync.Mutex
+	calls int
+	errs  []error
+}
+
+func (f *flaky) next() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flaky) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *flaky) CreateTransfer(ctx context.Context, params *gateway.CreateTransferParams) (*gateway.Transfer, error) {
+	tr, err := f.StripeGateway.CreateTransfer(ctx, params)
+	if injected := f.next(); injected != nil {
+		return nil, injected
+	}
+	return tr, err
+}
+
+func (f *flaky) GetBalance(ctx context.Context, accountID string) (*gateway.Balance, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return f.StripeGateway.GetBalance(ctx, accountID)
+}
+
+// GetAccount hangs until its context is done
+func (f *flaky) GetAccount(ctx context.Context, accountID string) (*gateway.Account, error) {
+	f.next()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func stripeErr(status int) error {
+	return &stripe.Error{HTTPStatusCode: status, Msg: http.StatusText(status)}
+}
+
+var errNetwork = errors.New("connection reset by peer")
+
+// fastRetries keeps backoffs short so tests do not wait
+var fastRetries = gateway.ResilientOptions{BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestResilientRetriesTransferOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		params        gateway.CreateTransferParams
+		wantErr       bool
+		wantCalls     int
+		wantTransfers int
+	}{
+		{
+			name:          "key derived from the withdrawal",
+			params:        gateway.CreateTransferParams{Metadata: map[string]string{"withdrawal_id": "wd_1", "request_id": "req_1"}},
+			wantCalls:     2,
+			wantTransfers: 1,
+		},
+		{
+			name:          "explicit key",
+			params:        gateway.CreateTransferParams{IdempotencyKey: "transfer-1"},
+			wantCalls:     2,
+			wantTransfers: 1,
+		},
+		{
+			name:          "no key is not retried",
+			params:        gateway.CreateTransferParams{Metadata: map[string]string{"request_id": "req_1"}},
+			wantErr:       true,
+			wantCalls:     1,
+			wantTransfers: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := gateway.NewFake(gateway.FakeOptions{})
+			acc, err := fake.CreateAccount(ctx, &gateway.CreateAccountParams{})
+			if err != nil {
+				t.Fatalf("CreateAccount: %v", err)
+			}
+			stub := &flaky{StripeGateway: fake, errs: []error{errNetwork}}
+			g := gateway.NewResilient(stub, fastRetries)
+
+			params := tt.params
+			params.DestinationAccountID = acc.ID
+			params.AmountCents = 1000
+			params.Currency = gateway.CurrencyUSD
+			_, err = g.CreateTransfer(ctx, &params)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransfer error = %v, want error %v", err, tt.wantErr)
+			}
+			if stub.callCount() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", stub.callCount(), tt.wantCalls)
+			}
+			if got := len(fake.Transfers()); got != tt.wantTransfers {
+				t.Errorf("transfers = %d, want %d", got, tt.wantTransfers)
+			}
+			if params.IdempotencyKey != tt.params.IdempotencyKey {
+				t.Errorf("caller's params were changed to key %q", params.IdempotencyKey)
+			}
+		})
+	}
+}
+
+func TestResilientRetriesRetryableErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantErr   bool
+		wantCalls int
+	}{
+		{"network error", errNetwork, false, 2},
+		{"server error", stripeErr(http.StatusServiceUnavailable), false, 2},
+		{"rate limited", stripeErr(http.StatusTooManyRequests), false, 2},
+		{"concurrent request", stripeErr(http.StatusConflict), false, 2},
+		{"invalid request", stripeErr(http.StatusBadRequest), true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &flaky{StripeGateway: gateway.NewFake(gateway.FakeOptions{}), errs: []error{tt.err}}
+			g := gateway.NewResilient(stub, fastRetries)
+
+			_, err := g.GetBalance(context.Background(), "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetBalance error = %v, want error %v", err, tt.wantErr)
+			}
+			if stub.callCount() != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", stub.callCount(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResilientGivesUpAfterMaxRetries(t *testing.T) {
+	outage := stripeErr(http.StatusInternalServerError)
+	stub := &flaky{StripeGateway: gateway.NewFake(gateway.FakeOptions{}), errs: []error{outage, outage, outage, outage}}
+	opts := fastRetries
+	opts.MaxRetries = 2
+	g := gateway.NewResilient(stub, opts)
+
+	if _, err := g.GetBalance(context.Background(), ""); !errors.Is(err, outage) {
+		t.Fatalf("GetBalance error = %v, want the last Stripe error", err)
+	}
+	if stub.callCount() != 3 {
+		t.Errorf("calls = %d, want 3", stub.callCount())
+	}
+}
+
+func TestResilientTimesOutEachAttempt(t *testing.T) {
+	stub := &flaky{StripeGateway: gateway.NewFake(gateway.FakeOptions{})}
+	opts := fastRetries
+	opts.CallTimeout = 20 * time.Millisecond
+	g := gateway.NewResilient(stub, opts)
+
+	began := time.Now()
+	_, err := g.GetAccount(context.Background(), "acct_1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetAccount error = %v, want a timeout", err)
+	}
+	if stub.callCount() != 3 {
+		t.Errorf("calls = %d, want 3 timed out attempts", stub.callCount())
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("took %v, want each attempt cut off after the call timeout", elapsed)
+	}
+
+	// A nearer deadline on the caller's context wins, and is not retried
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	calls := stub.callCount()
+	if _, err := g.GetAccount(ctx, "acct_1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetAccount error = %v, want a timeout", err)
+	}
+	if stub.callCount() != calls+1 {
+		t.Errorf("calls = %d, want %d", stub.callCount(), calls+1)
+	}
+}
+
+func TestResilientCircuitBreaker(t *testing.T) {
+	outage := stripeErr(http.StatusServiceUnavailable)
+	stub := &flaky{StripeGateway: gateway.NewFake(gateway.FakeOptions{}), errs: []error{outage, outage, outage}}
+	opts := fastRetries
+	opts.MaxRetries = -1
+	opts.BreakerThreshold = 2
+	opts.BreakerCooldown = 50 * time.Millisecond
+	g := gateway.NewResilient(stub, opts)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.GetBalance(ctx, ""); !errors.Is(err, outage) {
+			t.Fatalf("call %d: error = %v, want the Stripe outage", i+1, err)
+		}
+	}
+
+	// Open: calls fail fast without reaching Stripe
+	_, err := g.GetBalance(ctx, "")
+	if apperrors.CodeOf(err) != apperrors.CodeStripeUnavailable || !errors.Is(err, gateway.ErrCircuitOpen) {
+		t.Fatalf("error = %v, want stripe_unavailable from the open circuit", err)
+	}
+	if stub.callCount() != 2 {
+		t.Errorf("calls = %d, want 2", stub.callCount())
+	}
+
+	// Half open: a failed probe opens the circuit again
+	time.Sleep(opts.BreakerCooldown)
+	if _, err := g.GetBalance(ctx, ""); !errors.Is(err, outage) {
+		t.Fatalf("probe error = %v, want the Stripe outage", err)
+	}
+	if _, err := g.GetBalance(ctx, ""); !errors.Is(err, gateway.ErrCircuitOpen) {
+		t.Fatalf("error = %v, want the circuit open again", err)
+	}
+
+	// A successful probe closes it
+	time.Sleep(opts.BreakerCooldown)
+	for i := 0; i < 2; i++ {
+		if _, err := g.GetBalance(ctx, ""); err != nil {
+			t.Fatalf("call %d after recovery: %v", i+1, err)
+		}
+	}
+	if stub.callCount() != 5 {
+		t.Errorf("calls = %d, want 5", stub.callCount())
+	}
+}
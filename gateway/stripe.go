@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/client"
+)
+
+type stripeGateway struct {
+	api *client.API
+}
+
+// NewStripeGateway returns a gateway calling the Stripe API with secretKey.
+// It has its own client, so the global stripe.Key is left untouched. The
+// client does not retry on its own, wrap the gateway with NewResilient.
+func NewStripeGateway(secretKey string) StripeGateway {
+	backends := stripe.NewBackendsWithConfig(&stripe.BackendConfig{MaxNetworkRetries: stripe.Int64(0)})
+	return &stripeGateway{api: client.New(secretKey, backends)}
+}
+
+func (g *stripeGateway) CreateAccount(ctx context.Context, params *CreateAccountParams) (*Account, error) {
+	accountParams := &stripe.AccountParams{
+		Type: stripe.String(string(stripe.AccountTypeExpress)),
+		Capabilities: &stripe.AccountCapabilitiesParams{
+			Transfers: &stripe.AccountCapabilitiesTransfersParams{
+				Requested: stripe.Bool(true),
+			},
+		},
+		Metadata: params.Metadata,
+	}
+	accountParams.Context = ctx
+	setIdempotencyKey(&accountParams.Params, params.IdempotencyKey)
+
+	acc, err := g.api.Accounts.New(accountParams)
+	if err != nil {
+		return nil, err
+	}
+	return toAccount(acc), nil
+}
+
+func (g *stripeGateway) GetAccount(ctx context.Context, accountID string) (*Account, error) {
+	accountParams := &stripe.AccountParams{}
+	accountParams.Context = ctx
+
+	acc, err := g.api.Accounts.GetByID(accountID, accountParams)
+	if err != nil {
+		return nil, err
+	}
+	return toAccount(acc), nil
+}
+
+func (g *stripeGateway) CreateAccountLink(ctx context.Context, params *CreateAccountLinkParams) (*AccountLink, error) {
+	linkParams := &stripe.AccountLinkParams{
+		Account:    stripe.String(params.AccountID),
+		RefreshURL: stripe.String(params.RefreshURL),
+		ReturnURL:  stripe.String(params.ReturnURL),
+		Type:       stripe.String("account_onboarding"),
+	}
+	linkParams.Context = ctx
+
+	link, err := g.api.AccountLinks.New(linkParams)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountLink{URL: link.URL, ExpiresAt: time.Unix(link.ExpiresAt, 0)}, nil
+}
+
+func (g *stripeGateway) CreateTransfer(ctx context.Context, params *CreateTransferParams) (*Transfer, error) {
+	transferParams := &stripe.TransferParams{
+		Amount:      stripe.Int64(params.AmountCents),
+		Currency:    stripe.String(params.Currency),
+		Destination: stripe.String(params.DestinationAccountID),
+		Metadata:    params.Metadata,
+	}
+	transferParams.Context = ctx
+	setIdempotencyKey(&transferParams.Params, params.IdempotencyKey)
+
+	tr, err := g.api.Transfers.New(transferParams)
+	if err != nil {
+		return nil, err
+	}
+	return &Transfer{
+		ID:                   tr.ID,
+		DestinationAccountID: params.DestinationAccountID,
+		AmountCents:          tr.Amount,
+		Currency:             string(tr.Currency),
+		Metadata:             tr.Metadata,
+		Created:              time.Unix(tr.Created, 0),
+	}, nil
+}
+
+func (g *stripeGateway) CreatePayout(ctx context.Context, params *CreatePayoutParams) (*Payout, error) {
+	payoutParams := &stripe.PayoutParams{
+		Amount:   stripe.Int64(params.AmountCents),
+		Currency: stripe.String(params.Currency),
+		Metadata: params.Metadata,
+	}
+	payoutParams.Context = ctx
+	payoutParams.SetStripeAccount(params.AccountID)
+	setIdempotencyKey(&payoutParams.Params, params.IdempotencyKey)
+
+	po, err := g.api.Payouts.New(payoutParams)
+	if err != nil {
+		return nil, err
+	}
+	return toPayout(po, params.AccountID), nil
+}
+
+func (g *stripeGateway) ListTransfers(ctx context.Context, destinationAccountID string, since time.Time) ([]*Transfer, error) {
+	params := &stripe.TransferListParams{
+		Destination:  stripe.String(destinationAccountID),
+		CreatedRange: &stripe.RangeQueryParams{GreaterThanOrEqual: since.Unix()},
+	}
+	params.Context = ctx
+
+	var transfers []*Transfer
+	iter := g.api.Transfers.List(params)
+	for iter.Next() {
+		tr := iter.Transfer()
+		transfers = append(transfers, &Transfer{
+			ID:                   tr.ID,
+			DestinationAccountID: destinationAccountID,
+			AmountCents:          tr.Amount,
+			Currency:             string(tr.Currency),
+			Metadata:             tr.Metadata,
+			Created:              time.Unix(tr.Created, 0),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (g *stripeGateway) ListPayouts(ctx context.Context, accountID string, since time.Time) ([]*Payout, error) {
+	params := &stripe.PayoutListParams{
+		CreatedRange: &stripe.RangeQueryParams{GreaterThanOrEqual: since.Unix()},
+	}
+	params.Context = ctx
+	params.SetStripeAccount(accountID)
+
+	var payouts []*Payout
+	iter := g.api.Payouts.List(params)
+	for iter.Next() {
+		payouts = append(payouts, toPayout(iter.Payout(), accountID))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
+
+func (g *stripeGateway) ListBalanceTransactions(ctx context.Context, accountID string, since time.Time) ([]*BalanceTransaction, error) {
+	params := &stripe.BalanceTransactionListParams{
+		CreatedRange: &stripe.RangeQueryParams{GreaterThanOrEqual: since.Unix()},
+	}
+	params.Context = ctx
+	params.SetStripeAccount(accountID)
+
+	var transactions []*BalanceTransaction
+	iter := g.api.BalanceTransactions.List(params)
+	for iter.Next() {
+		txn := iter.BalanceTransaction()
+		out := &BalanceTransaction{
+			ID:          txn.ID,
+			AccountID:   accountID,
+			AmountCents: txn.Amount,
+			Currency:    string(txn.Currency),
+			Type:        string(txn.Type),
+			Created:     time.Unix(txn.Created, 0),
+		}
+		if txn.Source != nil {
+			out.SourceID = txn.Source.ID
+		}
+		transactions = append(transactions, out)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (g *stripeGateway) GetBalance(ctx context.Context, accountID string) (*Balance, error) {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	if accountID != "" {
+		params.SetStripeAccount(accountID)
+	}
+
+	b, err := g.api.Balance.Get(params)
+	if err != nil {
+		return nil, err
+	}
+	balance := &Balance{Available: map[string]int64{}, Pending: map[string]int64{}}
+	for _, amount := range b.Available {
+		balance.Available[string(amount.Currency)] += amount.Amount
+	}
+	for _, amount := range b.Pending {
+		balance.Pending[string(amount.Currency)] += amount.Amount
+	}
+	return balance, nil
+}
+
+func (g *stripeGateway) Ping(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+
+	_, err := g.api.Balance.Get(params)
+	return err
+}
+
+func setIdempotencyKey(params *stripe.Params, key string) {
+	if key != "" {
+		params.IdempotencyKey = stripe.String(key)
+	}
+}
+
+func toAccount(acc *stripe.Account) *Account {
+	return &Account{
+		ID:               acc.ID,
+		DetailsSubmitted: acc.DetailsSubmitted,
+		PayoutsEnabled:   acc.PayoutsEnabled,
+		ChargesEnabled:   acc.ChargesEnabled,
+		Metadata:         acc.Metadata,
+	}
+}
+
+func toPayout(po *stripe.Payout, accountID string) *Payout {
+	return &Payout{
+		ID:             po.ID,
+		AccountID:      accountID,
+		AmountCents:    po.Amount,
+		Currency:       string(po.Currency),
+		Status:         string(po.Status),
+		Metadata:       po.Metadata,
+		FailureCode:    string(po.FailureCode),
+		FailureMessage: po.FailureMessage,
+		ArrivalDate:    time.Unix(po.ArrivalDate, 0),
+		Created:        time.Unix(po.Created, 0),
+	}
+}
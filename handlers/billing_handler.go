@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"strpe-connect/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ================================
+// BILLING ENDPOINTS (PAYING USER ORGANIZATIONS)
+// ================================
+
+// GetSpendHistory godoc
+// @Summary Get spend history
+// @Description Retrieves function execution payments made by a user organization
+// @Tags Billing
+// @Produce json
+// @Param X-Organization-ID header string true "User Organization ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Param from query string false "Executed at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Executed before (RFC 3339 or YYYY-MM-DD)"
+// @Param status query string false "Transaction status"
+// @Param function_id query string false "Function ID"
+// @Param counterparty_org_id query string false "Developer organization ID"
+// @Param min_amount query number false "Minimum amount"
+// @Param max_amount query number false "Maximum amount"
+// @Success 200 {object} models.GetSpendHistoryResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/billing/transactions [get]
+func (h *StripeConnectHandler) GetSpendHistory(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.GetSpendHistory(c.Request.Context(), orgID, page, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetBillingUsage godoc
+// @Summary Get usage and spend breakdown
+// @Description Spend of a user organization per function and per developer (defaults to the current month)
+// @Tags Billing
+// @Produce json
+// @Param X-Organization-ID header string true "User Organization ID"
+// @Param from query string false "Start, inclusive (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "End, exclusive (RFC 3339 or YYYY-MM-DD)"
+// @Success 200 {object} models.GetBillingUsageResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/billing/usage [get]
+func (h *StripeConnectHandler) GetBillingUsage(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	fromParam, toParam, err := parseTimeRange(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	if fromParam != nil {
+		from = *fromParam
+	}
+	if toParam != nil {
+		to = *toParam
+	}
+	if !to.After(from) {
+		respondInvalid(c, "to must be after from")
+		return
+	}
+
+	resp, err := h.service.GetBillingUsage(c.Request.Context(), orgID, from, to)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetBillingStatement godoc
+// @Summary Get monthly statement
+// @Description Opening balance, top-ups, charges, refunds and closing balance of a user organization for a month
+// @Tags Billing
+// @Produce json
+// @Param X-Organization-ID header string true "User Organization ID"
+// @Param month path string true "Statement month (YYYY-MM)"
+// @Success 200 {object} models.GetBillingStatementResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/billing/statements/{month} [get]
+func (h *StripeConnectHandler) GetBillingStatement(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	month, err := time.Parse(models.StatementMonthFormat, c.Param("month"))
+	if err != nil {
+		respondInvalid(c, "month must be formatted as YYYY-MM")
+		return
+	}
+
+	resp, err := h.service.GetBillingStatement(c.Request.Context(), orgID, month)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
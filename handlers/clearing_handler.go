@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"strpe-connect/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ================================
+// EARNINGS CLEARING ENDPOINTS (ADMIN)
+// ================================
+
+// SetDeveloperTier godoc
+// @Summary Set a developer's clearing tier
+// @Description Assigns a developer to one of the configured tiers, which sets how long their earnings stay pending
+// @Description before they can be withdrawn. An empty tier uses the global clearing period. Only later payments are affected.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param org_id path string true "Developer Organization ID"
+// @Param request body models.SetDeveloperTierRequest true "Tier"
+// @Success 200 {object} models.DeveloperTierResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/connected-developers/{org_id}/tier [put]
+func (h *StripeConnectHandler) SetDeveloperTier(c *gin.Context) {
+	var req models.SetDeveloperTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.SetDeveloperTier(c.Request.Context(), c.Param("org_id"), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
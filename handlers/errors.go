@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strpe-connect/apperrors"
+	"strpe-connect/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError writes err as the JSON error envelope. Only the client-safe
+// message of an apperrors.Error reaches the client, server errors are logged
+// with their cause so they can be found by request ID.
+func respondError(c *gin.Context, err error) {
+	status, body := apperrors.Response(err, requestid.FromContext(c.Request.Context()))
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request.Context(), "request failed", "method", c.Request.Method, "route", c.FullPath(), "status", status, "error", err)
+	}
+	c.JSON(status, body)
+}
+
+// respondInvalid rejects a malformed request with 400
+func respondInvalid(c *gin.Context, message string) {
+	respondError(c, apperrors.InvalidRequest(message))
+}
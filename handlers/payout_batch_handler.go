@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strpe-connect/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// payoutBatchReportColumns are the columns of the CSV payout batch report
+var payoutBatchReportColumns = []string{"organization_id", "developer_wallet_id", "amount", "status", "withdrawal_id", "error"}
+
+// ================================
+// PAYOUT BATCH ENDPOINTS (ADMIN)
+// ================================
+
+// CreatePayoutBatch godoc
+// @Summary Preview a payout batch
+// @Description Creates a draft payout batch with an entry for every onboarded developer with payouts enabled whose
+// @Description available balance, less their payout schedule reserve and the earnings that cleared after the cutoff,
+// @Description reaches the minimum withdrawal or their schedule threshold. Nothing is paid until the batch is executed.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body models.CreatePayoutBatchRequest true "Cutoff"
+// @Success 200 {object} models.PayoutBatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches [post]
+func (h *StripeConnectHandler) CreatePayoutBatch(c *gin.Context) {
+	var req models.CreatePayoutBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	cutoff, err := parseTime("cutoff", req.Cutoff)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.CreatePayoutBatch(c.Request.Context(), cutoff)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetPayoutBatches godoc
+// @Summary Get payout batches
+// @Description Lists payout batches, newest first
+// @Tags Admin
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Success 200 {object} models.GetPayoutBatchesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches [get]
+func (h *StripeConnectHandler) GetPayoutBatches(c *gin.Context) {
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.GetPayoutBatches(c.Request.Context(), page)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetPayoutBatch godoc
+// @Summary Get a payout batch
+// @Description Returns a payout batch with its entries and totals. Entries follow the status of their withdrawal
+// @Description once requested, and the batch completes when every withdrawal completed or failed.
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Payout batch ID"
+// @Success 200 {object} models.PayoutBatchResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches/{id} [get]
+func (h *StripeConnectHandler) GetPayoutBatch(c *gin.Context) {
+	resp, err := h.service.GetPayoutBatch(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdatePayoutBatchEntries godoc
+// @Summary Exclude payout batch entries
+// @Description Excludes entries from a draft payout batch, or includes them again
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Payout batch ID"
+// @Param request body models.UpdatePayoutBatchEntriesRequest true "Entries"
+// @Success 200 {object} models.PayoutBatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches/{id}/entries [patch]
+func (h *StripeConnectHandler) UpdatePayoutBatchEntries(c *gin.Context) {
+	var req models.UpdatePayoutBatchEntriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.UpdatePayoutBatchEntries(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExecutePayoutBatch godoc
+// @Summary Execute a payout batch
+// @Description Starts requesting a withdrawal for each included entry of a draft payout batch. Withdrawals are
+// @Description requested in the background; poll the batch for progress. Executing a batch that is still
+// @Description executing or submitted resumes the entries that were not requested yet.
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Payout batch ID"
+// @Success 202 {object} models.PayoutBatchResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches/{id}/execute [post]
+func (h *StripeConnectHandler) ExecutePayoutBatch(c *gin.Context) {
+	resp, err := h.service.ExecutePayoutBatch(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// GetPayoutBatchReport godoc
+// @Summary Export a payout batch report
+// @Description Exports the entries of a payout batch as a CSV file, or as JSON with the batch totals
+// @Tags Admin
+// @Produce text/csv
+// @Produce json
+// @Param id path string true "Payout batch ID"
+// @Param format query string false "Report format (csv, json)" default(csv)
+// @Success 200 {object} models.PayoutBatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/payout-batches/{id}/report [get]
+func (h *StripeConnectHandler) GetPayoutBatchReport(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		respondInvalid(c, "format must be csv or json")
+		return
+	}
+
+	resp, err := h.service.GetPayoutBatch(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payout-batch-%s.json"`, resp.ID))
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payout-batch-%s.csv"`, resp.ID))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(payoutBatchReportColumns)
+	for _, entry := range resp.Entries {
+		w.Write([]string{
+			entry.OrganizationID,
+			entry.DeveloperWalletID,
+			strconv.FormatFloat(entry.Amount, 'f', 2, 64),
+			entry.Status,
+			stringValue(entry.WithdrawalID),
+			stringValue(entry.Error),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		// The status is sent, so the client only sees a truncated file
+		slog.ErrorContext(c.Request.Context(), "failed to write payout batch report", "batch_id", resp.ID, "error", err)
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strpe-connect/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ================================
+// PAYOUT SCHEDULE ENDPOINTS
+// ================================
+
+// GetPayoutSchedule godoc
+// @Summary Get payout schedule
+// @Description Retrieves developer's automatic payout schedule and the outcome of its last run. Developers
+// @Description without a schedule are on manual payouts.
+// @Tags Withdrawals
+// @Produce json
+// @Param X-Organization-ID header string true "Organization ID"
+// @Success 200 {object} models.PayoutScheduleResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/connect/withdrawals/schedule [get]
+func (h *StripeConnectHandler) GetPayoutSchedule(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	resp, err := h.service.GetPayoutSchedule(c.Request.Context(), orgID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetPayoutSchedule godoc
+// @Summary Set payout schedule
+// @Description Sets developer's automatic payout schedule: manual, daily, weekly on a weekday or monthly on a day,
+// @Description at midnight UTC. Each run withdraws the available balance above the reserve when it reaches the threshold.
+// @Tags Withdrawals
+// @Accept json
+// @Produce json
+// @Param X-Organization-ID header string true "Organization ID"
+// @Param request body models.SetPayoutScheduleRequest true "Payout schedule"
+// @Success 200 {object} models.PayoutScheduleResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /api/v1/connect/withdrawals/schedule [put]
+func (h *StripeConnectHandler) SetPayoutSchedule(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	var req models.SetPayoutScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.SetPayoutSchedule(c.Request.Context(), orgID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
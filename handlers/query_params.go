@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strpe-connect/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePageRequest reads page, limit and cursor query parameters. A cursor
+// takes precedence over page.
+func parsePageRequest(c *gin.Context) (models.PageRequest, error) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	req := models.PageRequest{Page: page, Limit: limit}
+	if encoded := c.Query("cursor"); encoded != "" {
+		cursor, err := models.DecodeCursor(encoded)
+		if err != nil {
+			return req, err
+		}
+		req.After = cursor
+	}
+
+	return req, nil
+}
+
+// parseTimeQuery accepts RFC 3339 timestamps or plain dates (YYYY-MM-DD, UTC)
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := parseTime(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseTime parses an RFC 3339 timestamp or a plain date (YYYY-MM-DD, UTC)
+// given as key
+func parseTime(key, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", key)
+}
+
+func parseFloatQuery(c *gin.Context, key string) (*float64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+
+	return &number, nil
+}
+
+func parseBoolQuery(c *gin.Context, key string) (*bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+
+	return &b, nil
+}
+
+// parseTimeRange reads the from/to query parameters
+func parseTimeRange(c *gin.Context) (from, to *time.Time, err error) {
+	if from, err = parseTimeQuery(c, "from"); err != nil {
+		return nil, nil, err
+	}
+	if to, err = parseTimeQuery(c, "to"); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+// parseAmountRange reads the min_amount/max_amount query parameters
+func parseAmountRange(c *gin.Context) (min, max *float64, err error) {
+	if min, err = parseFloatQuery(c, "min_amount"); err != nil {
+		return nil, nil, err
+	}
+	if max, err = parseFloatQuery(c, "max_amount"); err != nil {
+		return nil, nil, err
+	}
+	return min, max, nil
+}
+
+func parseTransactionFilter(c *gin.Context) (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		Status:            c.Query("status"),
+		FunctionID:        c.Query("function_id"),
+		CounterpartyOrgID: c.Query("counterparty_org_id"),
+	}
+
+	var err error
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, filter.MaxAmount, err = parseAmountRange(c); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func parseWithdrawalFilter(c *gin.Context) (models.WithdrawalFilter, error) {
+	filter := models.WithdrawalFilter{
+		Status: c.Query("status"),
+	}
+
+	var err error
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return filter, err
+	}
+	if filter.MinAmount, filter.MaxAmount, err = parseAmountRange(c); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func parseDeveloperFilter(c *gin.Context) (models.DeveloperFilter, error) {
+	filter := models.DeveloperFilter{}
+
+	var err error
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return filter, err
+	}
+	if filter.OnboardingCompleted, err = parseBoolQuery(c, "onboarding_completed"); err != nil {
+		return filter, err
+	}
+	if filter.PayoutsEnabled, err = parseBoolQuery(c, "payouts_enabled"); err != nil {
+		return filter, err
+	}
+	if filter.MinBalance, err = parseFloatQuery(c, "min_balance"); err != nil {
+		return filter, err
+	}
+	if filter.MaxBalance, err = parseFloatQuery(c, "max_balance"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strpe-connect/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ================================
+// RECONCILIATION ENDPOINTS (ADMIN)
+// ================================
+
+// GetReconciliationIssues godoc
+// @Summary Get reconciliation issues
+// @Description Lists disagreements between local withdrawals and wallets and what Stripe did,
+// @Description newest first, with the last reconciliation run
+// @Tags Admin
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Param status query string false "Issue status (open, resolved)"
+// @Param issue_type query string false "Issue type"
+// @Param stripe_account_id query string false "Connected account ID"
+// @Success 200 {object} models.GetReconciliationIssuesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/reconciliation/issues [get]
+func (h *StripeConnectHandler) GetReconciliationIssues(c *gin.Context) {
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	filter := models.ReconciliationIssueFilter{
+		Status:          c.Query("status"),
+		IssueType:       c.Query("issue_type"),
+		StripeAccountID: c.Query("stripe_account_id"),
+	}
+	if filter.Status != "" && filter.Status != models.ReconciliationIssueStatusOpen && filter.Status != models.ReconciliationIssueStatusResolved {
+		respondInvalid(c, "status must be open or resolved")
+		return
+	}
+
+	resp, err := h.service.GetReconciliationIssues(c.Request.Context(), page, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RunReconciliation godoc
+// @Summary Run reconciliation now
+// @Description Compares withdrawals and wallets with Stripe transfers, payouts and balances of every
+// @Description connected account, instead of waiting for the periodic job
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} models.ReconciliationRun
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/reconciliation/run [post]
+func (h *StripeConnectHandler) RunReconciliation(c *gin.Context) {
+	run, err := h.service.RunReconciliation(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
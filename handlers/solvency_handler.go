@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ================================
+// SOLVENCY ENDPOINTS (ADMIN)
+// ================================
+
+// GetSolvencyReport godoc
+// @Summary Get platform solvency report
+// @Description Compares developer wallet balances, pending withdrawals and user prepaid balances of every
+// @Description tenant with the platform Stripe balance, with alerts when coverage is below the configured ratio
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} models.SolvencyReport
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/solvency [get]
+func (h *StripeConnectHandler) GetSolvencyReport(c *gin.Context) {
+	report, err := h.service.GetSolvencyReport(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
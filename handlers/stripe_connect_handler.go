@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"strpe-connect/apperrors"
 	"strpe-connect/models"
 	"strpe-connect/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v83/webhook"
@@ -39,25 +40,26 @@ func NewStripeConnectHandler(service services.StripeConnectService, webhookSecre
 // @Param X-Organization-ID header string true "Organization ID"
 // @Param request body models.CreateConnectAccountRequest true "Onboarding URLs"
 // @Success 200 {object} models.CreateConnectAccountResponse
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/connect/onboard [post]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/connect/onboard [post]
 func (h *StripeConnectHandler) CreateConnectAccount(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	var req models.CreateConnectAccountRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
 		return
 	}
 
 	resp, err := h.service.CreateConnectAccount(c.Request.Context(), orgID, req.RefreshURL, req.ReturnURL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -66,24 +68,26 @@ func (h *StripeConnectHandler) CreateConnectAccount(c *gin.Context) {
 
 // GetConnectAccountStatus godoc
 // @Summary Get Connect account status
-// @Description Retrieves the status of developer's Stripe Connect account and wallet
+// @Description Retrieves the status of developer's Stripe Connect account and wallet. The status is read
+// @Description from the wallet, which webhooks and a background sync keep current; status_synced_at tells
+// @Description when it was last read from Stripe.
 // @Tags Stripe Connect
 // @Produce json
 // @Param X-Organization-ID header string true "Organization ID"
 // @Success 200 {object} models.GetConnectAccountStatusResponse
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/connect/status [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/connect/status [get]
 func (h *StripeConnectHandler) GetConnectAccountStatus(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	resp, err := h.service.GetConnectAccountStatus(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -99,24 +103,26 @@ func (h *StripeConnectHandler) GetConnectAccountStatus(c *gin.Context) {
 // @Param X-Organization-ID header string true "Organization ID"
 // @Param request body models.CreateConnectAccountRequest true "Onboarding URLs"
 // @Success 200 {object} models.CreateConnectAccountResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/refresh-onboarding [post]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/connect/refresh-onboarding [post]
 func (h *StripeConnectHandler) RefreshOnboardingLink(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	var req models.CreateConnectAccountRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
 		return
 	}
 
 	resp, err := h.service.RefreshOnboardingLink(c.Request.Context(), orgID, req.RefreshURL, req.ReturnURL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -134,18 +140,19 @@ func (h *StripeConnectHandler) RefreshOnboardingLink(c *gin.Context) {
 // @Produce json
 // @Param X-Organization-ID header string true "Organization ID"
 // @Success 200 {object} models.GetWalletBalanceResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/wallet/balance [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/connect/wallet/balance [get]
 func (h *StripeConnectHandler) GetWalletBalance(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	resp, err := h.service.GetWalletBalance(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -160,22 +167,92 @@ func (h *StripeConnectHandler) GetWalletBalance(c *gin.Context) {
 // @Param X-Organization-ID header string true "Organization ID"
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Param from query string false "Executed at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Executed before (RFC 3339 or YYYY-MM-DD)"
+// @Param status query string false "Transaction status"
+// @Param function_id query string false "Function ID"
+// @Param counterparty_org_id query string false "Paying user organization ID"
+// @Param min_amount query number false "Minimum amount"
+// @Param max_amount query number false "Maximum amount"
 // @Success 200 {object} models.GetTransactionHistoryResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/wallet/transactions [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/connect/wallet/transactions [get]
 func (h *StripeConnectHandler) GetTransactionHistory(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
 
-	resp, err := h.service.GetTransactionHistory(c.Request.Context(), orgID, page, limit)
+	resp, err := h.service.GetTransactionHistory(c.Request.Context(), orgID, page, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetEarningsAnalytics godoc
+// @Summary Get earnings analytics
+// @Description Developer earnings bucketed by day, week or month and per function, with call counts, fees and unique paying organizations (defaults to the last 30 days)
+// @Tags Wallet
+// @Produce json
+// @Param X-Organization-ID header string true "Organization ID"
+// @Param granularity query string false "Bucket size: day, week or month" default(day)
+// @Param from query string false "Start, inclusive (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "End, exclusive (RFC 3339 or YYYY-MM-DD)"
+// @Success 200 {object} models.GetEarningsAnalyticsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/connect/wallet/analytics [get]
+func (h *StripeConnectHandler) GetEarningsAnalytics(c *gin.Context) {
+	orgID := c.GetHeader("X-Organization-ID")
+	if orgID == "" {
+		respondInvalid(c, "X-Organization-ID header is required")
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", models.GranularityDay)
+	if !models.IsValidGranularity(granularity) {
+		respondInvalid(c, "granularity must be day, week or month")
+		return
+	}
+
+	fromParam, toParam, err := parseTimeRange(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	to := time.Now().UTC()
+	if toParam != nil {
+		to = *toParam
+	}
+	from := to.AddDate(0, 0, -30)
+	if fromParam != nil {
+		from = *fromParam
+	}
+	if !to.After(from) {
+		respondInvalid(c, "to must be after from")
+		return
+	}
+
+	resp, err := h.service.GetEarningsAnalytics(c.Request.Context(), orgID, granularity, from, to)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -190,15 +267,32 @@ func (h *StripeConnectHandler) GetTransactionHistory(c *gin.Context) {
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Results per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Param from query string false "Joined at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Joined before (RFC 3339 or YYYY-MM-DD)"
+// @Param onboarding_completed query bool false "Filter by onboarding status"
+// @Param payouts_enabled query bool false "Filter by payouts enabled"
+// @Param min_balance query number false "Minimum wallet balance"
+// @Param max_balance query number false "Maximum wallet balance"
 // @Success 200 {object} models.GetConnectedDevelopersResponse
-// @Router /api/admin/connected-developers [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/connected-developers [get]
 func (h *StripeConnectHandler) GetConnectedDevelopers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
 
-	resp, err := h.service.GetConnectedDevelopers(c.Request.Context(), page, limit)
+	filter, err := parseDeveloperFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.GetConnectedDevelopers(c.Request.Context(), page, filter)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -213,18 +307,39 @@ func (h *StripeConnectHandler) GetConnectedDevelopers(c *gin.Context) {
 // @Produce json
 // @Param X-Organization-ID header string true "User Organization ID"
 // @Success 200 {object} models.GetConnectedDevelopersResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/connected-developers [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/connect/connected-developers [get]
 func (h *StripeConnectHandler) GetConnectedDevelopersForOrg(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	resp, err := h.service.GetConnectedDevelopersForOrg(c.Request.Context(), orgID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RefreshConnectAccountStatus godoc
+// @Summary Refresh a developer's Connect account status
+// @Description Reads the Stripe Connect account of an organization from Stripe now and saves its status,
+// @Description instead of waiting for a webhook or the background sync
+// @Tags Admin
+// @Produce json
+// @Param org_id path string true "Developer Organization ID"
+// @Success 200 {object} models.GetConnectAccountStatusResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/v1/admin/connected-developers/{org_id}/refresh-status [post]
+func (h *StripeConnectHandler) RefreshConnectAccountStatus(c *gin.Context) {
+	resp, err := h.service.RefreshConnectAccountStatus(c.Request.Context(), c.Param("org_id"))
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -244,24 +359,27 @@ func (h *StripeConnectHandler) GetConnectedDevelopersForOrg(c *gin.Context) {
 // @Param X-Organization-ID header string true "Organization ID"
 // @Param request body models.CreateWithdrawalRequest true "Withdrawal amount"
 // @Success 200 {object} models.CreateWithdrawalResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/withdrawals/request [post]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 402 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Router /api/v1/connect/withdrawals/request [post]
 func (h *StripeConnectHandler) RequestWithdrawal(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	var req models.CreateWithdrawalRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
 		return
 	}
 
 	resp, err := h.service.RequestWithdrawal(c.Request.Context(), orgID, req.Amount)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -276,22 +394,37 @@ func (h *StripeConnectHandler) RequestWithdrawal(c *gin.Context) {
 // @Param X-Organization-ID header string true "Organization ID"
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(50)
+// @Param cursor query string false "Opaque cursor from next_cursor (replaces page)"
+// @Param from query string false "Requested at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Requested before (RFC 3339 or YYYY-MM-DD)"
+// @Param status query string false "Withdrawal status"
+// @Param min_amount query number false "Minimum amount"
+// @Param max_amount query number false "Maximum amount"
 // @Success 200 {object} models.GetWithdrawalHistoryResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/withdrawals/history [get]
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/connect/withdrawals/history [get]
 func (h *StripeConnectHandler) GetWithdrawalHistory(c *gin.Context) {
 	orgID := c.GetHeader("X-Organization-ID")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page, err := parsePageRequest(c)
+	if err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
 
-	resp, err := h.service.GetWithdrawalHistory(c.Request.Context(), orgID, page, limit)
+	filter, err := parseWithdrawalFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.GetWithdrawalHistory(c.Request.Context(), orgID, page, filter)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -311,94 +444,191 @@ func (h *StripeConnectHandler) GetWithdrawalHistory(c *gin.Context) {
 // @Param X-Organization-ID header string true "User Organization ID"
 // @Param request body models.FunctionExecutionPaymentRequest true "Payment details"
 // @Success 200 {object} models.FunctionExecutionPaymentResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/connect/payments/execute [post]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 402 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Router /api/v1/connect/payments/execute [post]
 func (h *StripeConnectHandler) ProcessFunctionPayment(c *gin.Context) {
 	userOrgID := c.GetHeader("X-Organization-ID")
 	if userOrgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Organization-ID header is required"})
+		respondInvalid(c, "X-Organization-ID header is required")
 		return
 	}
 
 	var req models.FunctionExecutionPaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondInvalid(c, err.Error())
 		return
 	}
 
 	// In production, developer org ID would be looked up from functions table
 	if req.DeveloperOrganizationID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "developer_organization_id is required"})
+		respondInvalid(c, "developer_organization_id is required")
 		return
 	}
 
 	resp, err := h.service.ProcessFunctionExecutionPayment(c.Request.Context(), userOrgID, req.FunctionID, req.DeveloperOrganizationID, req.Amount)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ================================
+// SPENDING CAP ENDPOINTS (ADMIN)
+// ================================
+
+// GetSpendingCaps godoc
+// @Summary Get spending caps for a user organization
+// @Description Lists hourly, daily and monthly spending caps with spend in the current period
+// @Tags Admin
+// @Produce json
+// @Param organization_id query string true "User Organization ID"
+// @Success 200 {object} models.GetSpendingCapsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/spending-caps [get]
+func (h *StripeConnectHandler) GetSpendingCaps(c *gin.Context) {
+	orgID := c.Query("organization_id")
+	if orgID == "" {
+		respondInvalid(c, "organization_id query parameter is required")
+		return
+	}
+
+	resp, err := h.service.GetSpendingCaps(c.Request.Context(), orgID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetSpendingCap godoc
+// @Summary Create or update a spending cap
+// @Description Caps how much a user organization can spend per hour, day or month, optionally for one function
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body models.SetSpendingCapRequest true "Spending cap"
+// @Success 200 {object} models.SpendingCapSummary
+// @Failure 400 {object} models.ErrorResponse
+// @Router /api/v1/admin/spending-caps [put]
+func (h *StripeConnectHandler) SetSpendingCap(c *gin.Context) {
+	var req models.SetSpendingCapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err.Error())
+		return
+	}
+
+	resp, err := h.service.SetSpendingCap(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// DeleteSpendingCap godoc
+// @Summary Delete a spending cap
+// @Description Removes a spending cap by ID
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Spending cap ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/v1/admin/spending-caps/{id} [delete]
+func (h *StripeConnectHandler) DeleteSpendingCap(c *gin.Context) {
+	if err := h.service.DeleteSpendingCap(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Spending cap deleted"})
+}
+
 // ================================
 // WEBHOOK ENDPOINT
 // ================================
 
 // HandleWebhook godoc
 // @Summary Handle Stripe webhook events
-// @Description Receives and processes Stripe webhook events for Connect accounts
+// @Description Receives and processes Stripe webhook events for Connect accounts. Events are
+// @Description recorded in an inbox so redeliveries are acknowledged without being handled twice.
+// @Description Events that fail for a transient reason get a 5xx so Stripe retries them.
 // @Tags Webhooks
 // @Accept json
 // @Produce json
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Router /api/webhooks/stripe-connect [post]
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/v1/webhooks/stripe-connect [post]
 func (h *StripeConnectHandler) HandleWebhook(c *gin.Context) {
 	payload, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("Error reading webhook payload: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		slog.WarnContext(c.Request.Context(), "failed to read webhook payload", "error", err)
+		respondInvalid(c, "invalid payload")
 		return
 	}
 
 	signature := c.GetHeader("Stripe-Signature")
 	if signature == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing stripe-signature header"})
+		respondInvalid(c, "missing stripe-signature header")
 		return
 	}
 
 	// Verify webhook signature
 	event, err := webhook.ConstructEvent(payload, signature, h.webhookSecret)
 	if err != nil {
-		log.Printf("Webhook signature verification failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+		slog.WarnContext(c.Request.Context(), "webhook signature verification failed", "error", err)
+		respondInvalid(c, "invalid signature")
 		return
 	}
 
-	log.Printf("Received webhook event: %s", event.Type)
+	slog.InfoContext(c.Request.Context(), "webhook event received", "event_type", event.Type, "event_id", event.ID)
+
+	isNew, err := h.service.RecordWebhookEvent(c.Request.Context(), event.ID, string(event.Type), payload)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !isNew {
+		slog.InfoContext(c.Request.Context(), "webhook event already handled, skipping", "event_type", event.Type, "event_id", event.ID)
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
 
 	// Handle different event types
+	var handlingErr error
 	switch event.Type {
 	case "account.updated":
-		if err := h.handleAccountUpdated(c, event.Data.Raw); err != nil {
-			log.Printf("Error handling account.updated: %v", err)
-		}
+		handlingErr = h.handleAccountUpdated(c, event.Data.Raw)
 
 	case "payout.paid":
-		log.Printf("Payout paid event received")
-		if err := h.handlePayoutPaid(c, event.Data.Raw); err != nil {
-			log.Printf("Error handling payout.paid: %v", err)
-		}
+		handlingErr = h.handlePayoutPaid(c, event.Data.Raw)
 
 	case "payout.failed":
-		log.Printf("Payout failed event received")
-		if err := h.handlePayoutFailed(c, event.Data.Raw); err != nil {
-			log.Printf("Error handling payout.failed: %v", err)
-		}
+		handlingErr = h.handlePayoutFailed(c, event.Data.Raw)
 
 	default:
-		log.Printf("Unhandled webhook event type: %s", event.Type)
+		slog.InfoContext(c.Request.Context(), "unhandled webhook event type", "event_type", event.Type, "event_id", event.ID)
+	}
+
+	if handlingErr != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to handle webhook event", "event_type", event.Type, "event_id", event.ID, "error", handlingErr)
+	}
+	if err := h.service.CompleteWebhookEvent(c.Request.Context(), event.ID, string(event.Type), handlingErr); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// Ask Stripe to redeliver events that failed for a transient reason
+	if handlingErr != nil && apperrors.IsTransient(handlingErr) {
+		respondError(c, handlingErr)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"received": true})
@@ -410,7 +640,7 @@ func (h *StripeConnectHandler) handleAccountUpdated(c *gin.Context, rawData json
 	}
 
 	if err := json.Unmarshal(rawData, &account); err != nil {
-		return err
+		return apperrors.Wrap(err, apperrors.CodeInvalidRequest, "malformed account object")
 	}
 
 	return h.service.HandleAccountUpdated(c.Request.Context(), account.ID)
@@ -423,12 +653,12 @@ func (h *StripeConnectHandler) handlePayoutPaid(c *gin.Context, rawData json.Raw
 	}
 
 	if err := json.Unmarshal(rawData, &payout); err != nil {
-		return err
+		return apperrors.Wrap(err, apperrors.CodeInvalidRequest, "malformed payout object")
 	}
 
 	withdrawalID := payout.Metadata["withdrawal_id"]
 	if withdrawalID == "" {
-		log.Printf("WARNING: payout.paid event missing withdrawal_id in metadata")
+		slog.WarnContext(c.Request.Context(), "payout.paid event missing withdrawal_id in metadata", "payout_id", payout.ID)
 		return nil
 	}
 
@@ -437,19 +667,19 @@ func (h *StripeConnectHandler) handlePayoutPaid(c *gin.Context, rawData json.Raw
 
 func (h *StripeConnectHandler) handlePayoutFailed(c *gin.Context, rawData json.RawMessage) error {
 	var payout struct {
-		ID            string            `json:"id"`
-		Metadata      map[string]string `json:"metadata"`
-		FailureCode   string            `json:"failure_code"`
-		FailureMessage string           `json:"failure_message"`
+		ID             string            `json:"id"`
+		Metadata       map[string]string `json:"metadata"`
+		FailureCode    string            `json:"failure_code"`
+		FailureMessage string            `json:"failure_message"`
 	}
 
 	if err := json.Unmarshal(rawData, &payout); err != nil {
-		return err
+		return apperrors.Wrap(err, apperrors.CodeInvalidRequest, "malformed payout object")
 	}
 
 	withdrawalID := payout.Metadata["withdrawal_id"]
 	if withdrawalID == "" {
-		log.Printf("WARNING: payout.failed event missing withdrawal_id in metadata")
+		slog.WarnContext(c.Request.Context(), "payout.failed event missing withdrawal_id in metadata", "payout_id", payout.ID)
 		return nil
 	}
 
@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strpe-connect/database"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"strpe-connect/repository"
+	"strpe-connect/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres pings the database and reports the connection pool usage
+func Postgres(pool *pgxpool.Pool) Check {
+	return Check{
+		Name:     "postgres",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			stat := pool.Stat()
+			details := map[string]interface{}{
+				"total_conns":    stat.TotalConns(),
+				"idle_conns":     stat.IdleConns(),
+				"acquired_conns": stat.AcquiredConns(),
+				"max_conns":      stat.MaxConns(),
+			}
+			return details, pool.Ping(ctx)
+		},
+	}
+}
+
+// Migrations fails while any tenant schema is behind the migrations this build knows
+func Migrations(pool *pgxpool.Pool, schemas []string) Check {
+	return Check{
+		Name:     "migrations",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			details := map[string]interface{}{}
+			var errs []error
+			for _, schema := range schemas {
+				migrator, err := database.NewMigrator(pool, schema)
+				if err != nil {
+					return details, err
+				}
+				version, err := migrator.Version(ctx)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				details[schema] = map[string]int{"version": version, "latest": migrator.Latest()}
+				if version < migrator.Latest() {
+					errs = append(errs, fmt.Errorf("%s is at version %d of %d, run migrate up", schema, version, migrator.Latest()))
+				}
+			}
+			return details, errors.Join(errs...)
+		},
+	}
+}
+
+// Stripe checks that the Stripe API is reachable. Results are cached for
+// cacheTTL so probes do not eat into the API rate limit.
+func Stripe(stripeGateway gateway.StripeGateway, cacheTTL time.Duration) Check {
+	return Check{
+		Name:     "stripe",
+		CacheTTL: cacheTTL,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, stripeGateway.Ping(ctx)
+		},
+	}
+}
+
+// WebhookBacklog warns when received webhook events have waited longer than
+// maxAge to be handled successfully
+func WebhookBacklog(repo repository.StripeConnectRepository, schemas []string, maxAge time.Duration) Check {
+	return Check{
+		Name: "webhook_backlog",
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return queueDetails(ctx, schemas, maxAge, "webhook events", repo.GetWebhookBacklog)
+		},
+	}
+}
+
+// WithdrawalQueue warns when withdrawals have waited longer than maxAge to be
+// sent to Stripe
+func WithdrawalQueue(repo repository.StripeConnectRepository, schemas []string, maxAge time.Duration) Check {
+	return Check{
+		Name: "withdrawal_queue",
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return queueDetails(ctx, schemas, maxAge, "withdrawals", repo.GetWithdrawalQueueStats)
+		},
+	}
+}
+
+// queueDetails reports the depth and oldest item age of a queue per tenant
+func queueDetails(ctx context.Context, schemas []string, maxAge time.Duration, items string,
+	stats func(ctx context.Context) (*models.QueueStats, error)) (map[string]interface{}, error) {
+	details := map[string]interface{}{}
+	var errs []error
+	for _, schema := range schemas {
+		queue, err := stats(tenant.NewContext(ctx, schema))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", schema, err))
+			continue
+		}
+
+		var oldestAge time.Duration
+		if queue.OldestAt != nil {
+			oldestAge = time.Since(*queue.OldestAt)
+		}
+		details[schema] = map[string]interface{}{
+			"depth":              queue.Count,
+			"oldest_age_seconds": int64(oldestAge.Seconds()),
+		}
+		if oldestAge > maxAge {
+			errs = append(errs, fmt.Errorf("%s: oldest of %d %s has waited %s", schema, queue.Count, items, oldestAge.Round(time.Second)))
+		}
+	}
+	return details, errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+// Package health serves the liveness and readiness probes.
+//
+// /livez only reports that the process is up, so an orchestrator restarts it
+// when it hangs but not when a dependency is down. /readyz runs the registered
+// checks and fails when a critical one fails, or once graceful shutdown has
+// started, so load balancers stop routing new requests before the server exits.
+package health
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Status is the outcome of a check or of a whole report
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusWarn     Status = "warn"     // A non-critical check failed
+	StatusFail     Status = "fail"     // A critical check failed
+	StatusDraining Status = "draining" // Graceful shutdown has started
+)
+
+// Check is one probe of a dependency. Run returns details for the report and
+// an error when the dependency is unhealthy.
+type Check struct {
+	Name     string
+	Critical bool          // A failing critical check fails readiness, others only warn
+	Timeout  time.Duration // Overrides the checker's default timeout
+	CacheTTL time.Duration // Reuses the last result this long, for slow or rate limited probes
+	Run      func(ctx context.Context) (map[string]interface{}, error)
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status     Status                 `json:"status"`
+	Critical   bool                   `json:"critical"`
+	Error      string                 `json:"error,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	CheckedAt  time.Time              `json:"checked_at"`
+	Cached     bool                   `json:"cached,omitempty"`
+}
+
+// Report is the JSON body of /livez and /readyz
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the readiness checks and tracks graceful shutdown
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	started  time.Time
+	draining atomic.Bool
+
+	mu    sync.Mutex
+	cache map[string]CheckResult
+}
+
+// NewChecker returns a checker running checks with timeout unless a check sets its own
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+		started: time.Now(),
+		cache:   map[string]CheckResult{},
+	}
+}
+
+// Register serves /livez and /readyz on r
+func (h *Checker) Register(r *gin.Engine) {
+	r.GET("/livez", h.Live)
+	r.GET("/readyz", h.Ready)
+}
+
+// SetDraining makes readiness fail from now on, call it when shutdown starts
+func (h *Checker) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is running
+func (h *Checker) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, Report{
+		Status: StatusOK,
+		Checks: map[string]CheckResult{
+			"process": {
+				Status:    StatusOK,
+				Critical:  true,
+				CheckedAt: time.Now(),
+				Details: map[string]interface{}{
+					"uptime_seconds": int64(time.Since(h.started).Seconds()),
+					"goroutines":     runtime.NumGoroutine(),
+				},
+			},
+		},
+	})
+}
+
+// Ready runs every check and responds 503 if a critical one failed or the
+// server is shutting down
+func (h *Checker) Ready(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, Report{
+			Status: StatusDraining,
+			Checks: map[string]CheckResult{
+				"shutdown": {Status: StatusFail, Critical: true, Error: "server is shutting down", CheckedAt: time.Now()},
+			},
+		})
+		return
+	}
+
+	report := h.Run(c.Request.Context())
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Run runs every check concurrently and aggregates the results
+func (h *Checker) Run(ctx context.Context) Report {
+	results := make([]CheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+	for i, check := range h.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch {
+		case result.Status == StatusFail:
+			report.Status = StatusFail
+		case result.Status == StatusWarn && report.Status == StatusOK:
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+func (h *Checker) run(ctx context.Context, check Check) CheckResult {
+	if check.CacheTTL > 0 {
+		h.mu.Lock()
+		cached, ok := h.cache[check.Name]
+		h.mu.Unlock()
+		if ok && time.Since(cached.CheckedAt) < check.CacheTTL {
+			cached.Cached = true
+			return cached
+		}
+	}
+
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = h.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	details, err := check.Run(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		Critical:   check.Critical,
+		Details:    details,
+		DurationMS: time.Since(started).Milliseconds(),
+		CheckedAt:  started,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = StatusWarn
+		if check.Critical {
+			result.Status = StatusFail
+		}
+	}
+
+	if check.CacheTTL > 0 {
+		h.mu.Lock()
+		h.cache[check.Name] = result
+		h.mu.Unlock()
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func probe(t *testing.T, checker *Checker, path string) (int, Report) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	checker.Register(r)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decoding %s response: %v", path, err)
+	}
+	return rec.Code, report
+}
+
+func staticCheck(name string, critical bool, err error) Check {
+	return Check{
+		Name:     name,
+		Critical: critical,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			return map[string]interface{}{"checked": true}, err
+		},
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	down := errors.New("down")
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantCode   int
+		wantStatus Status
+	}{
+		{"all healthy", []Check{staticCheck("db", true, nil), staticCheck("stripe", false, nil)}, http.StatusOK, StatusOK},
+		{"non-critical failure only warns", []Check{staticCheck("db", true, nil), staticCheck("stripe", false, down)}, http.StatusOK, StatusWarn},
+		{"critical failure fails", []Check{staticCheck("db", true, down), staticCheck("stripe", false, down)}, http.StatusServiceUnavailable, StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, report := probe(t, NewChecker(time.Second, tt.checks...), "/readyz")
+			if code != tt.wantCode || report.Status != tt.wantStatus {
+				t.Errorf("got %d %s, want %d %s", code, report.Status, tt.wantCode, tt.wantStatus)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("report has %d checks, want %d", len(report.Checks), len(tt.checks))
+			}
+		})
+	}
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	checker := NewChecker(time.Second, staticCheck("db", true, nil))
+	checker.SetDraining()
+
+	if code, report := probe(t, checker, "/readyz"); code != http.StatusServiceUnavailable || report.Status != StatusDraining {
+		t.Errorf("readyz = %d %s, want 503 draining", code, report.Status)
+	}
+	if code, _ := probe(t, checker, "/livez"); code != http.StatusOK {
+		t.Errorf("livez = %d while draining, want 200", code)
+	}
+}
+
+func TestCheckTimeoutAndCache(t *testing.T) {
+	calls := 0
+	checker := NewChecker(10*time.Millisecond,
+		Check{
+			Name:     "slow",
+			Critical: true,
+			Run: func(ctx context.Context) (map[string]interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+		Check{
+			Name:     "cached",
+			CacheTTL: time.Minute,
+			Run: func(ctx context.Context) (map[string]interface{}, error) {
+				calls++
+				return nil, nil
+			},
+		},
+	)
+
+	first := checker.Run(context.Background())
+	if first.Checks["slow"].Status != StatusFail {
+		t.Errorf("slow check = %s, want it to time out and fail", first.Checks["slow"].Status)
+	}
+	second := checker.Run(context.Background())
+	if calls != 1 || !second.Checks["cached"].Cached {
+		t.Errorf("cached check ran %d times (cached = %v), want once", calls, second.Checks["cached"].Cached)
+	}
+}
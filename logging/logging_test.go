@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"strpe-connect/config"
+	"strpe-connect/requestid"
+	"strpe-connect/tenant"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"key sk_live_51HxYzAbCdEf rejected", "key [REDACTED] rejected"},
+		{"secret whsec_abc123", "secret [REDACTED]"},
+		{"No such account: acct_1NbXyZ2eZvKYlo2C", "No such account: acct_***lo2C"},
+		{"external account ba_1MqABC9xyz", "external account ba_***9xyz"},
+		{"iban DE89370400440532013000 on file", "iban DE***3000 on file"},
+		{"account 000123456789 routing", "account ***6789 routing"},
+		{"withdrawal 5f2b9c1e-1234-4abc-9def-123456789012", "withdrawal 5f2b9c1e-1234-4abc-9def-123456789012"},
+		{"amount 70.00", "amount 70.00"},
+	}
+
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerAddsContextAndRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.LoggingConfig{Level: "info", Format: config.LogFormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := tenant.NewContext(requestid.NewContext(context.Background(), "req-1"), "acme")
+	logger.ErrorContext(ctx, "payout to acct_1NbXyZ2eZvKYlo2C failed",
+		"routing_number", "110000000",
+		"error", errors.New("invalid api key sk_test_abc123"),
+	)
+	logger.DebugContext(ctx, "dropped below the level")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("want a single JSON record, got %q: %v", buf.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"msg":            "payout to acct_***lo2C failed",
+		"request_id":     "req-1",
+		"tenant":         "acme",
+		"routing_number": redacted,
+		"error":          "invalid api key " + redacted,
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestNewRejectsUnknownLevel(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, config.LoggingConfig{Level: "verbose"})
+	if err == nil || !strings.Contains(err.Error(), "verbose") {
+		t.Errorf("err = %v, want an invalid level error", err)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.LoggingConfig{Level: "debug", Format: config.LogFormatText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Log(context.Background(), slog.LevelDebug, "hello", "count", 2)
+
+	if got := buf.String(); !strings.Contains(got, "msg=hello") || !strings.Contains(got, "count=2") {
+		t.Errorf("text record = %q", got)
+	}
+}
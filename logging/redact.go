@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets and sensitive fields
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are field names whose whole value is redacted
+var sensitiveKeys = []string{
+	"password", "secret", "token", "authorization", "api_key",
+	"account_number", "routing_number", "iban", "card_number", "bank_account",
+}
+
+var (
+	// Stripe API keys and webhook signing secrets
+	secretPattern = regexp.MustCompile(`\b(?:sk|rk|pk)_(?:live|test)_[A-Za-z0-9]+|\bwhsec_[A-Za-z0-9]+`)
+	// Stripe connected account, bank account and card IDs keep their prefix and last 4 characters
+	stripeIDPattern = regexp.MustCompile(`\b(acct|ba|card|btok|src)_([A-Za-z0-9]+)`)
+	// IBANs and bare bank account numbers (9 to 17 digits not part of a UUID or larger word)
+	ibanPattern          = regexp.MustCompile(`\b[A-Z]{2}\d{2}[A-Z0-9]{11,30}\b`)
+	accountNumberPattern = regexp.MustCompile(`(^|[^\w-])(\d{9,17})($|[^\w-])`)
+)
+
+// Redact masks Stripe account IDs, bank details and secrets in s
+func Redact(s string) string {
+	s = secretPattern.ReplaceAllString(s, redacted)
+	s = stripeIDPattern.ReplaceAllStringFunc(s, func(id string) string {
+		prefix, rest, _ := strings.Cut(id, "_")
+		return prefix + "_***" + lastFour(rest)
+	})
+	s = ibanPattern.ReplaceAllStringFunc(s, func(iban string) string {
+		return iban[:2] + "***" + lastFour(iban)
+	})
+	return accountNumberPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := accountNumberPattern.FindStringSubmatch(match)
+		return parts[1] + "***" + lastFour(parts[2]) + parts[3]
+	})
+}
+
+func lastFour(s string) string {
+	if len(s) <= 4 {
+		return s
+	}
+	return s[len(s)-4:]
+}
+
+// redactAttr is the ReplaceAttr hook of the handlers. It also sees the message.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		// Errors often wrap Stripe messages that quote account IDs
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
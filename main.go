@@ -2,14 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strpe-connect/config"
+	"strpe-connect/database"
+	"strpe-connect/gateway"
 	"strpe-connect/handlers"
+	"strpe-connect/health"
+	"strpe-connect/logging"
+	"strpe-connect/metrics"
+	"strpe-connect/middleware"
+	"strpe-connect/openapi"
+	"strpe-connect/ratelimit"
 	"strpe-connect/repository"
+	"strpe-connect/router"
 	"strpe-connect/services"
+	"strpe-connect/tenant"
+	"strpe-connect/tracing"
 	"syscall"
 	"time"
 
@@ -17,120 +30,244 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+	envErr := godotenv.Load()
+
+	// Load configuration from defaults, CONFIG_FILE and the environment
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	// `config` prints the effective configuration and whether it is valid
+	if command == "config" {
+		fmt.Print(cfg.Redacted())
+		if err := cfg.Validate(); err != nil {
+			fatal("invalid configuration", "error", err)
+		}
+		return
+	}
+
+	// migrate only needs the database settings
+	if command == "migrate" {
+		err = cfg.ValidateDatabase()
+	} else {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fatal("invalid configuration", "error", err)
 	}
 
-	// Get configuration from environment
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "rival")
-	stripeSecretKey := getEnv("STRIPE_SECRET_KEY", "")
-	stripeWebhookSecret := getEnv("STRIPE_WEBHOOK_SECRET", "")
-	port := getEnv("PORT", "8080")
+	// JSON logs carrying the request ID, with Stripe IDs, bank details and secrets masked
+	logger, err := logging.New(os.Stdout, cfg.Logging)
+	if err != nil {
+		fatal("unable to set up logging", "error", err)
+	}
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Info("no .env file found, using environment variables")
+	}
+	slog.Info("effective configuration", "config", cfg.Redacted())
 
-	if stripeSecretKey == "" {
-		log.Fatal("STRIPE_SECRET_KEY is required")
+	// Tracing, spans are only exported when TRACING_EXPORTER=otlp
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("unable to set up tracing", "error", err)
 	}
 
 	// Initialize database connection
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+	poolConfig, err := cfg.Database.PoolConfig()
+	if err != nil {
+		fatal("unable to configure database", "error", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
 
 	ctx := context.Background()
-	dbPool, err := pgxpool.New(ctx, dbURL)
+	dbPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		fatal("unable to connect to database", "error", err)
 	}
 	defer dbPool.Close()
 
 	// Test database connection
 	if err := dbPool.Ping(ctx); err != nil {
-		log.Fatalf("Unable to ping database: %v", err)
+		fatal("unable to ping database", "error", err)
+	}
+	slog.Info("database connected")
+
+	// `migrate up|down [steps]|status` manages the schema and exits
+	if command == "migrate" {
+		err := runMigrateCommand(ctx, dbPool, cfg.Database.TenantSchemas, os.Args[2:])
+		dbPool.Close()
+		if err != nil {
+			fatal("migration failed", "error", err)
+		}
+		return
+	}
+
+	// Apply pending migrations to every tenant before serving, the advisory lock keeps replicas from racing
+	if cfg.Database.AutoMigrate {
+		for _, schema := range cfg.Database.TenantSchemas {
+			migrator, err := database.NewMigrator(dbPool, schema)
+			if err != nil {
+				fatal("unable to load migrations", "error", err)
+			}
+			applied, err := migrator.Up(ctx)
+			if err != nil {
+				fatal("unable to migrate database", "schema", schema, "error", err)
+			}
+			slog.Info("schema up to date", "schema", schema, "applied", len(applied))
+		}
 	}
-	log.Println("✅ Database connected successfully")
 
 	// Initialize repository
 	repo := repository.NewStripeConnectRepository(dbPool)
+	idempotencyRepo := repository.NewIdempotencyRepository(dbPool)
+
+	// Initialize per-organization rate limiter
+	var limiter ratelimit.Limiter
+	switch cfg.RateLimit.Backend {
+	case "postgres":
+		limiter = ratelimit.NewPostgresLimiter(repository.NewRateLimitRepository(dbPool), cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	default:
+		limiter = ratelimit.NewMemoryLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+
+	// Initialize Stripe gateway, the fake simulates Stripe in memory for local development
+	var stripeGateway gateway.StripeGateway
+	switch cfg.Stripe.Mode {
+	case config.StripeModeFake:
+		stripeGateway = gateway.NewFake(gateway.FakeOptions{
+			WebhookSecret:          cfg.Stripe.WebhookSecret,
+			Webhooks:               gateway.HTTPWebhookSink(fmt.Sprintf("http://localhost:%d/api/v1/webhooks/stripe-connect", cfg.Server.Port)),
+			AutoCompleteOnboarding: true,
+			AutoPayPayouts:         true,
+		})
+		slog.Warn("STRIPE_MODE=fake, no requests are sent to Stripe")
+	default:
+		stripeGateway = gateway.NewStripeGateway(cfg.Stripe.SecretKey)
+	}
+	// Every attempt is measured, retries and the circuit breaker sit on top
+	maxRetries := cfg.Stripe.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = -1 // No retries, rather than the default
+	}
+	stripeGateway = gateway.NewResilient(gateway.Instrument(stripeGateway), gateway.ResilientOptions{
+		CallTimeout:      cfg.Stripe.CallTimeout,
+		MaxRetries:       maxRetries,
+		BreakerThreshold: cfg.Stripe.BreakerThreshold,
+		BreakerCooldown:  cfg.Stripe.BreakerCooldown,
+	})
 
 	// Initialize service
-	stripeService := services.NewStripeConnectService(repo, stripeSecretKey)
+	stripeService := services.NewTracedService(services.NewStripeConnectService(repo, stripeGateway, services.Options{
+		MinimumWithdrawal:      cfg.Payments.MinimumWithdrawal,
+		PlatformFeePercent:     cfg.Payments.PlatformFeePercent,
+		ReconciliationLookback: cfg.Reconciliation.Lookback,
+		MinCoverageRatio:       cfg.Solvency.MinCoverageRatio,
+		TenantSchemas:          cfg.Database.TenantSchemas,
+		WithdrawalRetryAfter:   cfg.Payouts.WithdrawalRetryAfter,
+		AccountSync: services.AccountSyncOptions{
+			StaleAfter:           cfg.AccountSync.StaleAfter,
+			OnboardingStaleAfter: cfg.AccountSync.OnboardingStaleAfter,
+			BatchSize:            cfg.AccountSync.BatchSize,
+			Concurrency:          cfg.AccountSync.Concurrency,
+			RequestsPerSecond:    cfg.AccountSync.RequestsPerSecond,
+		},
+		Clearing: services.ClearingOptions{
+			Period:          cfg.Clearing.Period,
+			TierPeriods:     cfg.Clearing.TierPeriods,
+			FunctionPeriods: cfg.Clearing.FunctionPeriods,
+		},
+	}))
 
 	// Initialize handler
-	handler := handlers.NewStripeConnectHandler(stripeService, stripeWebhookSecret)
+	handler := handlers.NewStripeConnectHandler(stripeService, cfg.Stripe.WebhookSecret)
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// A span per request, continuing the caller's trace from the traceparent header
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		switch req.URL.Path {
+		case "/health", "/livez", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	})))
+
+	// Request IDs for error responses and logs
+	r.Use(middleware.RequestID())
+
+	// One structured access log record per request
+	r.Use(logging.Middleware())
+
+	// Request latency and status metrics
+	r.Use(metrics.Middleware())
 
 	// CORS configuration
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Organization-ID"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowOrigins:     cfg.AllowedOrigins(),
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Organization-ID", "Idempotency-Key", "X-Request-ID", "X-Tenant-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "Idempotent-Replayed", "API-Version", "Deprecation", "Sunset", "Link"},
 		AllowCredentials: true,
 	}))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
+			"status":  "healthy",
 			"service": "stripe-connect-marketplace",
 		})
 	})
 
-	// API routes
-	api := r.Group("/api")
-	{
-		// Stripe Connect routes
-		connect := api.Group("/connect")
-		{
-			// Onboarding
-			connect.POST("/onboard", handler.CreateConnectAccount)
-			connect.GET("/status", handler.GetConnectAccountStatus)
-			connect.POST("/refresh-onboarding", handler.RefreshOnboardingLink)
-			connect.GET("/connected-developers", handler.GetConnectedDevelopersForOrg)
-
-			// Wallet
-			wallet := connect.Group("/wallet")
-			{
-				wallet.GET("/balance", handler.GetWalletBalance)
-				wallet.GET("/transactions", handler.GetTransactionHistory)
-			}
-
-			// Withdrawals
-			withdrawals := connect.Group("/withdrawals")
-			{
-				withdrawals.POST("/request", handler.RequestWithdrawal)
-				withdrawals.GET("/history", handler.GetWithdrawalHistory)
-			}
+	// Liveness and readiness probes with a per-check breakdown
+	checker := health.NewChecker(cfg.Health.CheckTimeout,
+		health.Postgres(dbPool),
+		health.Migrations(dbPool, cfg.Database.TenantSchemas),
+		health.Stripe(stripeGateway, cfg.Health.StripeCacheTTL),
+		health.WebhookBacklog(repo, cfg.Database.TenantSchemas, cfg.Health.WebhookBacklogMaxAge),
+		health.WithdrawalQueue(repo, cfg.Database.TenantSchemas, cfg.Health.WithdrawalQueueMaxAge),
+	)
+	checker.Register(r)
 
-			// Payments
-			payments := connect.Group("/payments")
-			{
-				payments.POST("/execute", handler.ProcessFunctionPayment)
-			}
-		}
+	// Prometheus metrics, including the pool and per-tenant liabilities read on each scrape
+	if err := metrics.Register(metrics.NewPoolCollector(dbPool)); err != nil {
+		fatal("unable to register pool metrics", "error", err)
+	}
+	if err := metrics.Register(metrics.NewLiabilitiesCollector(repo, cfg.Database.TenantSchemas, cfg.Health.CheckTimeout)); err != nil {
+		fatal("unable to register liabilities metrics", "error", err)
+	}
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
-		// Admin endpoints
-		admin := api.Group("/admin")
-		{
-			admin.GET("/connected-developers", handler.GetConnectedDevelopers)
-		}
+	// OpenAPI document and docs UI
+	openapi.Register(r)
 
-		// Webhooks
-		webhooks := api.Group("/webhooks")
-		{
-			webhooks.POST("/stripe-connect", handler.HandleWebhook)
-		}
+	// API routes, versioned under /api/v1 with deprecated unversioned aliases
+	routerConfig := router.Config{
+		Handler:         handler,
+		IdempotencyRepo: idempotencyRepo,
+		IdempotencyTTL:  cfg.Idempotency.KeyTTL,
+		IdempotencyLock: cfg.Idempotency.LockTimeout,
+		LegacySunset:    cfg.API.LegacySunset,
+		TenantSchemas:   cfg.Database.TenantSchemas,
+	}
+	if cfg.RateLimit.RequestsPerSecond > 0 {
+		routerConfig.Limiter = limiter
 	}
+	router.Register(r, routerConfig)
 
 	// Serve static files (React build)
 	r.Static("/static", "./static")
@@ -141,17 +278,52 @@ func main() {
 
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:    ":" + port,
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: r,
 	}
 
+	// Background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runPeriodically(jobsCtx, "purge expired idempotency keys", time.Hour, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		deleted, err := idempotencyRepo.DeleteExpiredIdempotencyKeys(ctx)
+		if deleted > 0 {
+			slog.InfoContext(ctx, "purged expired idempotency keys", "deleted", deleted)
+		}
+		return err
+	}))
+	go runPeriodically(jobsCtx, "refresh earnings rollup", cfg.Analytics.RollupInterval, forEachTenant(cfg.Database.TenantSchemas, stripeService.RefreshEarningsRollup))
+	go runPeriodically(jobsCtx, "sync Connect account status", cfg.AccountSync.Interval, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		_, err := stripeService.SyncConnectAccounts(ctx)
+		return err
+	}))
+	go runPeriodically(jobsCtx, "release cleared earnings", cfg.Clearing.ReleaseInterval, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		_, err := stripeService.ReleaseClearedEarnings(ctx)
+		return err
+	}))
+	go runPeriodically(jobsCtx, "run payout schedules", cfg.Payouts.ScheduleInterval, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		_, err := stripeService.RunScheduledPayouts(ctx)
+		return err
+	}))
+	go runPeriodically(jobsCtx, "retry withdrawals", cfg.Payouts.WithdrawalRetryInterval, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		_, err := stripeService.RetryWithdrawals(ctx)
+		return err
+	}))
+	go runPeriodically(jobsCtx, "reconcile with Stripe", cfg.Reconciliation.Interval, forEachTenant(cfg.Database.TenantSchemas, func(ctx context.Context) error {
+		_, err := stripeService.RunReconciliation(ctx)
+		return err
+	}))
+	// Not per tenant: the report covers every tenant, which share the platform Stripe balance
+	go runPeriodically(jobsCtx, "check solvency", cfg.Solvency.CheckInterval, func(ctx context.Context) error {
+		_, err := stripeService.GetSolvencyReport(ctx)
+		return err
+	})
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("🚀 Server starting on http://localhost:%s", port)
-		log.Printf("📖 API Documentation: http://localhost:%s/swagger/index.html", port)
-		log.Printf("🏥 Health Check: http://localhost:%s/health", port)
+		slog.Info("server starting", "port", cfg.Server.Port, "docs", "/docs", "probes", "/livez,/readyz", "metrics", "/metrics")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			fatal("failed to start server", "error", err)
 		}
 	}()
 
@@ -159,23 +331,62 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("🛑 Shutting down server...")
+	slog.Info("shutting down server")
+
+	// Fail readiness first so load balancers stop sending new requests
+	checker.SetDraining()
+	if cfg.Server.ShutdownDrainDelay > 0 {
+		slog.Info("draining before closing connections", "delay", cfg.Server.ShutdownDrainDelay.String())
+		time.Sleep(cfg.Server.ShutdownDrainDelay)
+	}
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("❌ Server forced to shutdown: %v", err)
+		fatal("server forced to shutdown", "error", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+
+	slog.Info("server exited gracefully")
+}
 
-	log.Println("✅ Server exited gracefully")
+// fatal logs msg with args at error level and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// forEachTenant adapts job to run once per tenant schema, with the tenant in its context
+func forEachTenant(schemas []string, job func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, schema := range schemas {
+			if err := job(tenant.NewContext(ctx, schema)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", schema, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// runPeriodically runs job once at startup and then every interval until ctx is cancelled
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "background job failed", "job", name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-	return value
 }
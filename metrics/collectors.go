@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"strpe-connect/repository"
+	"strpe-connect/tenant"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ================================
+// CONNECTION POOL
+// ================================
+
+var (
+	poolTotalConns    = poolDesc("total_conns", "Connections in the pool.")
+	poolIdleConns     = poolDesc("idle_conns", "Idle connections in the pool.")
+	poolAcquiredConns = poolDesc("acquired_conns", "Connections currently in use.")
+	poolMaxConns      = poolDesc("max_conns", "Maximum size of the pool.")
+	poolAcquires      = poolDesc("acquires_total", "Connections acquired from the pool.")
+	poolEmptyAcquires = poolDesc("empty_acquires_total", "Acquires that had to wait for a connection.")
+	poolAcquireTime   = poolDesc("acquire_duration_seconds_total", "Time spent waiting to acquire connections.")
+)
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+}
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+// NewPoolCollector reports the pgxpool statistics of pool
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	return &poolCollector{pool: pool}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{poolTotalConns, poolIdleConns, poolAcquiredConns, poolMaxConns, poolAcquires, poolEmptyAcquires, poolAcquireTime} {
+		ch <- desc
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireTime, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
+
+// ================================
+// LIABILITIES
+// ================================
+
+var (
+	liabilitiesDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "developer_liabilities_dollars"),
+		"Sum of developer wallet balances, what the platform owes developers.", []string{"tenant"}, nil)
+	pendingAmountDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "pending_withdrawals_dollars"),
+		"Amount of pending and processing withdrawals.", []string{"tenant"}, nil)
+	pendingCountDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "pending_withdrawals"),
+		"Number of pending and processing withdrawals.", []string{"tenant"}, nil)
+)
+
+type liabilitiesCollector struct {
+	repo    repository.StripeConnectRepository
+	schemas []string
+	timeout time.Duration
+}
+
+// NewLiabilitiesCollector reports the liabilities of every tenant, queried on
+// each scrape within timeout
+func NewLiabilitiesCollector(repo repository.StripeConnectRepository, schemas []string, timeout time.Duration) prometheus.Collector {
+	return &liabilitiesCollector{repo: repo, schemas: schemas, timeout: timeout}
+}
+
+func (c *liabilitiesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- liabilitiesDesc
+	ch <- pendingAmountDesc
+	ch <- pendingCountDesc
+}
+
+func (c *liabilitiesCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	for _, schema := range c.schemas {
+		liabilities, err := c.repo.GetLiabilities(tenant.NewContext(ctx, schema))
+		if err != nil {
+			// Leave the series out rather than report a wrong value
+			slog.WarnContext(ctx, "failed to collect liabilities metrics", "schema", schema, "error", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(liabilitiesDesc, prometheus.GaugeValue, liabilities.WalletBalance, schema)
+		ch <- prometheus.MustNewConstMetric(pendingAmountDesc, prometheus.GaugeValue, liabilities.PendingWithdrawalAmount, schema)
+		ch <- prometheus.MustNewConstMetric(pendingCountDesc, prometheus.GaugeValue, float64(liabilities.PendingWithdrawalCount), schema)
+	}
+}
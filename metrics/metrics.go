@@ -0,0 +1,184 @@
+// Package metrics exposes Prometheus metrics for the HTTP API, money movement,
+// webhooks, Stripe calls and the database pool on /metrics.
+//
+// Counters are package level so services can record events without threading a
+// recorder through every constructor. Values that live in the database (pool
+// stats, liabilities) are read when Prometheus scrapes.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "marketplace"
+
+// registry holds every metric of the service, plus the Go runtime and process collectors
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	paymentsTotal = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_total",
+		Help:      "Function execution payments processed.",
+	})
+	paymentAmount = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_amount_dollars_total",
+		Help:      "Gross amount of function execution payments in dollars.",
+	})
+	platformFees = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "platform_fees_dollars_total",
+		Help:      "Platform fees taken from function execution payments in dollars.",
+	})
+
+	withdrawalsTotal = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdrawals_total",
+		Help:      "Withdrawals by the status they moved to.",
+	}, []string{"status"})
+	withdrawalAmount = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdrawal_amount_dollars_total",
+		Help:      "Amount of withdrawals in dollars by the status they moved to.",
+	}, []string{"status"})
+
+	webhookEvents = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Stripe webhook events by type and outcome (processed, failed, discarded, duplicate).",
+	}, []string{"type", "outcome"})
+
+	stripeRequestDuration = promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stripe_request_duration_seconds",
+		Help:      "Stripe API call latency by operation.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+	stripeRequestErrors = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stripe_request_errors_total",
+		Help:      "Failed Stripe API calls by operation and Stripe error code.",
+	}, []string{"operation", "code"})
+	stripeRetries = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stripe_retries_total",
+		Help:      "Stripe API calls sent again after a retryable error, by operation.",
+	}, []string{"operation"})
+	stripeCircuitOpen = promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stripe_circuit_open",
+		Help:      "1 while the Stripe circuit breaker fails calls fast, 0 otherwise.",
+	})
+
+	solvencyCoverage = promauto.With(registry).NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "solvency_coverage_ratio",
+		Help:      "Platform USD Stripe balance over developer and user liabilities, as of the last solvency check.",
+	})
+	platformBalance = promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "platform_balance_dollars",
+		Help:      "Platform Stripe balance by currency and state (available, pending), as of the last solvency check.",
+	}, []string{"currency", "state"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Register adds a collector, such as the pool or liabilities collector
+func Register(collector prometheus.Collector) error {
+	return registry.Register(collector)
+}
+
+// Middleware records the latency and status of every request. Routes are
+// labelled with their template (/api/v1/wallet/:org_id) to keep cardinality low.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObservePayment records a function execution payment
+func ObservePayment(amount, platformFee float64) {
+	paymentsTotal.Inc()
+	paymentAmount.Add(amount)
+	platformFees.Add(platformFee)
+}
+
+// ObserveWithdrawal records a withdrawal moving to status
+func ObserveWithdrawal(status string, amount float64) {
+	withdrawalsTotal.WithLabelValues(status).Inc()
+	withdrawalAmount.WithLabelValues(status).Add(amount)
+}
+
+// ObserveWebhookEvent records the outcome of a webhook event
+func ObserveWebhookEvent(eventType, outcome string) {
+	webhookEvents.WithLabelValues(eventType, outcome).Inc()
+}
+
+// ObserveStripeCall records a Stripe API call. errorCode is empty for calls
+// that succeeded.
+func ObserveStripeCall(operation string, duration time.Duration, errorCode string) {
+	stripeRequestDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if errorCode != "" {
+		stripeRequestErrors.WithLabelValues(operation, errorCode).Inc()
+	}
+}
+
+// ObserveStripeRetry records a Stripe API call sent again after a retryable error
+func ObserveStripeRetry(operation string) {
+	stripeRetries.WithLabelValues(operation).Inc()
+}
+
+// ObserveStripeCircuit records whether the Stripe circuit breaker is open
+func ObserveStripeCircuit(open bool) {
+	if open {
+		stripeCircuitOpen.Set(1)
+	} else {
+		stripeCircuitOpen.Set(0)
+	}
+}
+
+// ObserveSolvency records the result of a solvency check
+func ObserveSolvency(coverageRatio float64) {
+	solvencyCoverage.Set(coverageRatio)
+}
+
+// ObservePlatformBalance records the platform Stripe balance in one currency
+func ObservePlatformBalance(currency string, available, pending float64) {
+	platformBalance.WithLabelValues(currency, "available").Set(available)
+	platformBalance.WithLabelValues(currency, "pending").Set(pending)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"strpe-connect/models"
+	"strpe-connect/repository"
+	"strpe-connect/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMiddlewareLabelsRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/v1/wallet/:org_id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/api/v1/wallet/org-1", "/api/v1/wallet/org-2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := requestCount(t, "GET", "/api/v1/wallet/:org_id", "204"); got != 2 {
+		t.Errorf("requests to the wallet route = %d, want 2", got)
+	}
+	if got := requestCount(t, "GET", "unmatched", "404"); got != 1 {
+		t.Errorf("unmatched requests = %d, want 1", got)
+	}
+}
+
+// requestCount returns how many requests the latency histogram recorded for the labels
+func requestCount(t *testing.T, method, route, status string) uint64 {
+	t.Helper()
+	histogram, err := httpRequestDuration.GetMetricWithLabelValues(method, route, status)
+	if err != nil {
+		t.Fatalf("GetMetricWithLabelValues: %v", err)
+	}
+	var metric dto.Metric
+	if err := histogram.(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestLiabilitiesCollector(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	wallet, err := repo.CreateDeveloperWallet(ctx, "dev-org")
+	if err != nil {
+		t.Fatalf("CreateDeveloperWallet: %v", err)
+	}
+	if err := repo.UpdateWalletBalance(ctx, wallet.ID, 120.50); err != nil {
+		t.Fatalf("UpdateWalletBalance: %v", err)
+	}
+	withdrawal := &models.WithdrawalRequest{DeveloperWalletID: wallet.ID, OrganizationID: "dev-org", Amount: 70, Status: models.WithdrawalStatusPending}
+	if err := repo.CreateWithdrawalRequest(ctx, withdrawal); err != nil {
+		t.Fatalf("CreateWithdrawalRequest: %v", err)
+	}
+
+	collector := NewLiabilitiesCollector(repo, []string{tenant.DefaultSchema}, time.Second)
+	expected := `
+		# HELP marketplace_developer_liabilities_dollars Sum of developer wallet balances, what the platform owes developers.
+		# TYPE marketplace_developer_liabilities_dollars gauge
+		marketplace_developer_liabilities_dollars{tenant="tenant_schema"} 120.5
+		# HELP marketplace_pending_withdrawals Number of pending and processing withdrawals.
+		# TYPE marketplace_pending_withdrawals gauge
+		marketplace_pending_withdrawals{tenant="tenant_schema"} 1
+		# HELP marketplace_pending_withdrawals_dollars Amount of pending and processing withdrawals.
+		# TYPE marketplace_pending_withdrawals_dollars gauge
+		marketplace_pending_withdrawals_dollars{tenant="tenant_schema"} 70
+	`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
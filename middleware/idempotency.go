@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"strpe-connect/repository"
+	"strpe-connect/requestid"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idempotency replays the stored response for retried requests carrying the same
+// Idempotency-Key header. Keys are stored in the tenant's schema, scoped by the
+// X-Organization-ID header, and expire after ttl; a key without an organization
+// is rejected rather than left unprotected. Reusing a key with a different
+// request body is rejected with 422, and a retry that arrives while the original
+// is still running gets 409. A request that held its key for lock without
+// completing it is presumed dead, and a retry of it takes the key over.
+func Idempotency(repo repository.IdempotencyRepository, ttl, lock time.Duration) gin.HandlerFunc {
+	if ttl <= 0 {
+		ttl = models.DefaultIdempotencyKeyTTL
+	}
+	if lock <= 0 {
+		lock = models.DefaultIdempotencyLock
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(models.IdempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		orgID := c.GetHeader("X-Organization-ID")
+		if orgID == "" {
+			abortWithError(c, apperrors.InvalidRequest("Idempotency-Key requires the X-Organization-ID header"))
+			return
+		}
+
+		if len(key) > models.MaxIdempotencyKeyLength {
+			abortWithError(c, apperrors.InvalidRequest("Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, apperrors.InvalidRequest("invalid request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &models.IdempotencyRecord{
+			OrganizationID: orgID,
+			Key:            key,
+			RequestMethod:  c.Request.Method,
+			RequestPath:    c.FullPath(),
+			RequestHash:    requestFingerprint(c.Request.Method, c.FullPath(), body),
+			LockedUntil:    time.Now().Add(lock),
+			ExpiresAt:      time.Now().Add(ttl),
+		}
+
+		ctx := c.Request.Context()
+		reserved, err := repo.ReserveIdempotencyKey(ctx, record)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to reserve idempotency key", "error", err)
+			abortWithError(c, err)
+			return
+		}
+
+		if !reserved {
+			replayIdempotentResponse(c, repo, record)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Persist even if the client went away, otherwise the retry would run twice
+		storeCtx := context.WithoutCancel(ctx)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			// Server errors are not cached so the client can retry the request. Handlers
+			// behind this middleware write in a single transaction, so a failed request
+			// left nothing behind that a retry could apply twice.
+			if err := repo.ReleaseIdempotencyKey(storeCtx, orgID, key); err != nil {
+				slog.ErrorContext(ctx, "failed to release idempotency key", "error", err)
+			}
+			return
+		}
+
+		contentType := recorder.Header().Get("Content-Type")
+		if err := repo.CompleteIdempotencyKey(storeCtx, orgID, key, status, contentType, recorder.body.Bytes()); err != nil {
+			slog.ErrorContext(ctx, "failed to store idempotent response", "error", err)
+		}
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, repo repository.IdempotencyRepository, record *models.IdempotencyRecord) {
+	existing, err := repo.GetIdempotencyKey(c.Request.Context(), record.OrganizationID, record.Key)
+	if err != nil {
+		// The original request released the key between our reserve and read
+		abortWithError(c, apperrors.Conflict("request with this Idempotency-Key is being retried, please try again"))
+		return
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		abortWithError(c, apperrors.New(apperrors.CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request"))
+		return
+	}
+
+	if existing.Status != models.IdempotencyStatusCompleted || existing.ResponseStatus == nil {
+		abortWithError(c, apperrors.Conflict("request with this Idempotency-Key is still being processed"))
+		return
+	}
+
+	contentType := "application/json; charset=utf-8"
+	if existing.ResponseContentType != nil && *existing.ResponseContentType != "" {
+		contentType = *existing.ResponseContentType
+	}
+
+	c.Header(models.IdempotencyReplayedHeader, "true")
+	c.Data(*existing.ResponseStatus, contentType, existing.ResponseBody)
+	c.Abort()
+}
+
+// abortWithError stops the chain with the JSON error envelope for err
+func abortWithError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(apperrors.Response(err, requestid.FromContext(c.Request.Context())))
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte("\n"))
+	hash.Write([]byte(path))
+	hash.Write([]byte("\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder copies everything written to the client into a buffer
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"strpe-connect/models"
+)
+
+// memoryIdempotencyRepository keeps idempotency keys in memory, mirroring the
+// Postgres repository
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: make(map[string]models.IdempotencyRecord)}
+}
+
+func (r *memoryIdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := record.OrganizationID + "/" + record.Key
+	if existing, ok := r.records[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		stale := existing.Status == models.IdempotencyStatusInProgress && !existing.LockedUntil.After(time.Now()) &&
+			existing.RequestHash == record.RequestHash
+		if !stale {
+			return false, nil
+		}
+	}
+	record.Status = models.IdempotencyStatusInProgress
+	record.CreatedAt = time.Now()
+	r.records[id] = *record
+	return true, nil
+}
+
+func (r *memoryIdempotencyRepository) GetIdempotencyKey(ctx context.Context, organizationID, key string) (*models.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[organizationID+"/"+key]
+	if !ok {
+		return nil, errors.New("idempotency key not found")
+	}
+	return &record, nil
+}
+
+func (r *memoryIdempotencyRepository) CompleteIdempotencyKey(ctx context.Context, organizationID, key string, responseStatus int, contentType string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := organizationID + "/" + key
+	record := r.records[id]
+	record.Status = models.IdempotencyStatusCompleted
+	record.ResponseStatus = &responseStatus
+	record.ResponseContentType = &contentType
+	record.ResponseBody = append([]byte(nil), body...)
+	r.records[id] = record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, organizationID, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := organizationID + "/" + key
+	if r.records[id].Status == models.IdempotencyStatusInProgress {
+		delete(r.records, id)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, record := range r.records {
+		if !record.ExpiresAt.After(time.Now()) {
+			delete(r.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// idempotentServer serves POST /charges behind the Idempotency middleware. Each
+// call to the handler returns the next status from statuses, or 201.
+type idempotentServer struct {
+	router   *gin.Engine
+	mu       sync.Mutex
+	calls    int
+	statuses []int
+	block    chan struct{} // When set, the handler waits for it to close
+	started  chan struct{}
+}
+
+func newIdempotentServer(ttl, lock time.Duration) *idempotentServer {
+	gin.SetMode(gin.TestMode)
+	s := &idempotentServer{router: gin.New(), started: make(chan struct{}, 1)}
+	s.router.Use(Idempotency(newMemoryIdempotencyRepository(), ttl, lock))
+	s.router.POST("/charges", func(c *gin.Context) {
+		s.mu.Lock()
+		s.calls++
+		call := s.calls
+		status := http.StatusCreated
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		block := s.block
+		s.mu.Unlock()
+
+		if block != nil {
+			s.started <- struct{}{}
+			<-block
+		}
+		c.JSON(status, gin.H{"call": call})
+	})
+	return s
+}
+
+func (s *idempotentServer) post(orgID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charges", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if orgID != "" {
+		req.Header.Set("X-Organization-ID", orgID)
+	}
+	if key != "" {
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *idempotentServer) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+
+	first := s.post("org-1", "key-1", `{"amount":10}`)
+	if first.Code != http.StatusCreated || first.Header().Get(models.IdempotencyReplayedHeader) != "" {
+		t.Fatalf("first request = %d %v, want 201 not replayed", first.Code, first.Header())
+	}
+
+	replay := s.post("org-1", "key-1", `{"amount":10}`)
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if replay.Header().Get(models.IdempotencyReplayedHeader) != "true" {
+		t.Errorf("replay headers = %v, want %s", replay.Header(), models.IdempotencyReplayedHeader)
+	}
+	if !strings.HasPrefix(replay.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("replay content type = %q, want JSON", replay.Header().Get("Content-Type"))
+	}
+
+	// Keys are scoped by organization, and requests without a key always run
+	if rec := s.post("org-2", "key-1", `{"amount":10}`); rec.Code != http.StatusCreated || rec.Header().Get(models.IdempotencyReplayedHeader) != "" {
+		t.Errorf("other organization = %d %v, want a new response", rec.Code, rec.Header())
+	}
+	s.post("org-1", "", `{"amount":10}`)
+	if calls := s.callCount(); calls != 3 {
+		t.Errorf("handler ran %d times, want 3", calls)
+	}
+}
+
+func TestIdempotencyRejectsKeyWithoutOrganization(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+
+	rec := s.post("", "key-1", `{"amount":10}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "X-Organization-ID") {
+		t.Errorf("key without organization = %d %s, want 400", rec.Code, rec.Body)
+	}
+	if calls := s.callCount(); calls != 0 {
+		t.Errorf("handler ran %d times, want 0", calls)
+	}
+}
+
+func TestIdempotencyRejectsDifferentBody(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+
+	s.post("org-1", "key-1", `{"amount":10}`)
+	rec := s.post("org-1", "key-1", `{"amount":20}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "idempotency_key_reused") {
+		t.Errorf("reused key = %d %s, want 422 idempotency_key_reused", rec.Code, rec.Body)
+	}
+	if calls := s.callCount(); calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyConflictWhileInProgress(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+	s.block = make(chan struct{})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- s.post("org-1", "key-1", `{"amount":10}`) }()
+	<-s.started
+
+	rec := s.post("org-1", "key-1", `{"amount":10}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("retry while in progress = %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	close(s.block)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("original request = %d, want 201", first.Code)
+	}
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Header().Get(models.IdempotencyReplayedHeader) != "true" {
+		t.Errorf("retry after completion = %d %v, want a replay", rec.Code, rec.Header())
+	}
+}
+
+func TestIdempotencyTakesOverDeadRequest(t *testing.T) {
+	s := newIdempotentServer(time.Hour, 20*time.Millisecond)
+	s.block = make(chan struct{})
+	defer close(s.block)
+
+	// The first request never completes, like one whose server was killed
+	go s.post("org-1", "key-1", `{"amount":10}`)
+	<-s.started
+	s.mu.Lock()
+	s.block = nil
+	s.mu.Unlock()
+
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Code != http.StatusConflict {
+		t.Fatalf("retry within the lock = %d %s, want 409", rec.Code, rec.Body)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if rec := s.post("org-1", "key-1", `{"amount":20}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different request after the lock = %d %s, want 422", rec.Code, rec.Body)
+	}
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Code != http.StatusCreated || rec.Header().Get(models.IdempotencyReplayedHeader) != "" {
+		t.Fatalf("retry after the lock = %d %v, want it to run", rec.Code, rec.Header())
+	}
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Header().Get(models.IdempotencyReplayedHeader) != "true" {
+		t.Errorf("retry after completion = %d %v, want a replay", rec.Code, rec.Header())
+	}
+	if calls := s.callCount(); calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyReleasesServerErrors(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+	s.statuses = []int{http.StatusInternalServerError, http.StatusBadRequest}
+
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first request = %d, want 500", rec.Code)
+	}
+	// The key was released, so the retry runs and its client error is kept
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Code != http.StatusBadRequest || rec.Header().Get(models.IdempotencyReplayedHeader) != "" {
+		t.Fatalf("retry = %d %v, want 400 not replayed", rec.Code, rec.Header())
+	}
+	if rec := s.post("org-1", "key-1", `{"amount":10}`); rec.Code != http.StatusBadRequest || rec.Header().Get(models.IdempotencyReplayedHeader) != "true" {
+		t.Errorf("second retry = %d %v, want the replayed 400", rec.Code, rec.Header())
+	}
+	if calls := s.callCount(); calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	s := newIdempotentServer(20*time.Millisecond, time.Minute)
+
+	s.post("org-1", "key-1", `{"amount":10}`)
+	time.Sleep(30 * time.Millisecond)
+
+	// An expired key is taken over, even with a different body
+	rec := s.post("org-1", "key-1", `{"amount":20}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get(models.IdempotencyReplayedHeader) != "" {
+		t.Errorf("request after expiry = %d %v, want a new response", rec.Code, rec.Header())
+	}
+	if calls := s.callCount(); calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyRejectsLongKey(t *testing.T) {
+	s := newIdempotentServer(time.Hour, time.Minute)
+
+	rec := s.post("org-1", strings.Repeat("k", models.MaxIdempotencyKeyLength+1), `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("long key = %d, want 400", rec.Code)
+	}
+	if calls := s.callCount(); calls != 0 {
+		t.Errorf("handler ran %d times, want 0", calls)
+	}
+}
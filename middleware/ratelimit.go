@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"strpe-connect/apperrors"
+	"strpe-connect/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit throttles requests per organization (X-Organization-ID header).
+// Requests without an organization are left for the handler to reject. If the
+// limiter itself fails the request is let through rather than taking the API down.
+func RateLimit(limiter ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.GetHeader("X-Organization-ID")
+		if orgID == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), "org:"+orgID)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limiter unavailable, allowing request", "error", err)
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			abortWithError(c, apperrors.New(apperrors.CodeRateLimited, "rate limit exceeded, please slow down").
+				WithDetails(gin.H{"retry_after_seconds": seconds}))
+			return
+		}
+
+		c.Next()
+	}
+}
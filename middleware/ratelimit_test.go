@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubLimiter answers every Allow with the same result and records the keys
+type stubLimiter struct {
+	allowed    bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (l *stubLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.keys = append(l.keys, key)
+	return l.allowed, l.retryAfter, l.err
+}
+
+func rateLimited(t *testing.T, limiter *stubLimiter, orgID string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimit(limiter))
+	r.GET("/wallet", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/wallet", nil)
+	if orgID != "" {
+		req.Header.Set("X-Organization-ID", orgID)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		limiter        stubLimiter
+		orgID          string
+		wantCode       int
+		wantRetryAfter string
+		wantKeys       int
+	}{
+		{name: "allowed", limiter: stubLimiter{allowed: true}, orgID: "org-1", wantCode: http.StatusOK, wantKeys: 1},
+		{name: "limited", limiter: stubLimiter{retryAfter: 1500 * time.Millisecond}, orgID: "org-1", wantCode: http.StatusTooManyRequests, wantRetryAfter: "2", wantKeys: 1},
+		{name: "retry after is at least a second", limiter: stubLimiter{retryAfter: 10 * time.Millisecond}, orgID: "org-1", wantCode: http.StatusTooManyRequests, wantRetryAfter: "1", wantKeys: 1},
+		{name: "limiter failure lets the request through", limiter: stubLimiter{err: errors.New("database is down")}, orgID: "org-1", wantCode: http.StatusOK, wantKeys: 1},
+		{name: "no organization is not limited", limiter: stubLimiter{}, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := tt.limiter
+			rec := rateLimited(t, &limiter, tt.orgID)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if len(limiter.keys) != tt.wantKeys {
+				t.Fatalf("limiter called with %v, want %d keys", limiter.keys, tt.wantKeys)
+			}
+			if tt.wantKeys > 0 && limiter.keys[0] != "org:"+tt.orgID {
+				t.Errorf("key = %q, want org:%s", limiter.keys[0], tt.orgID)
+			}
+			if tt.wantCode == http.StatusTooManyRequests && !strings.Contains(rec.Body.String(), `"retry_after_seconds":`+tt.wantRetryAfter) {
+				t.Errorf("body = %s, want retry_after_seconds %s", rec.Body, tt.wantRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"strpe-connect/apperrors"
+	"strpe-connect/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant resolves the tenant schema from the X-Tenant-ID header (or the
+// tenant_id query parameter) and stores it in the request context for the
+// repositories. Requests without a tenant use the first schema in schemas;
+// unknown tenants are rejected.
+func Tenant(schemas []string) gin.HandlerFunc {
+	if len(schemas) == 0 {
+		schemas = []string{tenant.DefaultSchema}
+	}
+	known := make(map[string]bool, len(schemas))
+	for _, schema := range schemas {
+		known[schema] = true
+	}
+
+	return func(c *gin.Context) {
+		schema := c.GetHeader(tenant.Header)
+		if schema == "" {
+			schema = c.Query(tenant.QueryParam)
+		}
+		if schema == "" {
+			schema = schemas[0]
+		}
+
+		if !known[schema] {
+			abortWithError(c, apperrors.InvalidRequest("unknown tenant"))
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.NewContext(c.Request.Context(), schema))
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"strpe-connect/tenant"
+)
+
+// tenantRequest serves target behind the Tenant middleware and returns the
+// response and the schema the handler saw
+func tenantRequest(t *testing.T, schemas []string, target, header string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Tenant(schemas))
+
+	var schema string
+	r.GET("/wallet", func(c *gin.Context) {
+		schema = tenant.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if header != "" {
+		req.Header.Set(tenant.Header, header)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec, schema
+}
+
+func TestTenant(t *testing.T) {
+	schemas := []string{"acme", "globex"}
+	tests := []struct {
+		name       string
+		schemas    []string
+		target     string
+		header     string
+		wantCode   int
+		wantSchema string
+	}{
+		{name: "header", schemas: schemas, target: "/wallet", header: "globex", wantCode: http.StatusOK, wantSchema: "globex"},
+		{name: "query parameter", schemas: schemas, target: "/wallet?tenant_id=globex", wantCode: http.StatusOK, wantSchema: "globex"},
+		{name: "header wins over query parameter", schemas: schemas, target: "/wallet?tenant_id=globex", header: "acme", wantCode: http.StatusOK, wantSchema: "acme"},
+		{name: "first schema is the default", schemas: schemas, target: "/wallet", wantCode: http.StatusOK, wantSchema: "acme"},
+		{name: "no schemas configured", target: "/wallet", wantCode: http.StatusOK, wantSchema: tenant.DefaultSchema},
+		{name: "unknown tenant", schemas: schemas, target: "/wallet", header: "initech", wantCode: http.StatusBadRequest},
+		{name: "unknown tenant in query parameter", schemas: schemas, target: "/wallet?tenant_id=initech", wantCode: http.StatusBadRequest},
+		// The allow-list keeps other schemas, even valid ones, out of the SQL
+		{name: "default schema not in the list", schemas: schemas, target: "/wallet", header: tenant.DefaultSchema, wantCode: http.StatusBadRequest},
+		{name: "schema injection", schemas: schemas, target: "/wallet", header: "acme.wallets; --", wantCode: http.StatusBadRequest},
+		{name: "case matters", schemas: schemas, target: "/wallet", header: "ACME", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, schema := tenantRequest(t, tt.schemas, tt.target, tt.header)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				if schema != "" {
+					t.Errorf("handler ran with schema %q, want it not to run", schema)
+				}
+				if !strings.Contains(rec.Body.String(), "unknown tenant") {
+					t.Errorf("body = %s, want the unknown tenant error", rec.Body)
+				}
+				return
+			}
+			if schema != tt.wantSchema {
+				t.Errorf("schema = %q, want %q", schema, tt.wantSchema)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strpe-connect/database"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrateCommand handles the `migrate` subcommand for every tenant schema
+func runMigrateCommand(ctx context.Context, dbPool *pgxpool.Pool, schemas []string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid steps %q: %s", args[1], migrateUsage)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q: %s", args[0], migrateUsage)
+	}
+
+	for _, schema := range schemas {
+		migrator, err := database.NewMigrator(dbPool, schema)
+		if err != nil {
+			return err
+		}
+
+		switch args[0] {
+		case "up":
+			applied, err := migrator.Up(ctx)
+			for _, migration := range applied {
+				fmt.Printf("%s: applied %04d_%s\n", schema, migration.Version, migration.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(applied) == 0 {
+				fmt.Printf("%s: schema is up to date\n", schema)
+			}
+		case "down":
+			rolledBack, err := migrator.Down(ctx, steps)
+			for _, migration := range rolledBack {
+				fmt.Printf("%s: rolled back %04d_%s\n", schema, migration.Version, migration.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(rolledBack) == 0 {
+				fmt.Printf("%s: no migrations to roll back\n", schema)
+			}
+		case "status":
+			statuses, err := migrator.Status(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s:\n", schema)
+			for _, status := range statuses {
+				applied := "pending"
+				if status.AppliedAt != nil {
+					applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+				}
+				fmt.Printf("  %04d_%-40s %s\n", status.Version, status.Name, applied)
+			}
+		}
+	}
+
+	return nil
+}
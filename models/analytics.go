@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// EarningsTotals aggregates developer earnings over a date range
+type EarningsTotals struct {
+	CallCount        int     `json:"call_count"`
+	GrossAmount      float64 `json:"gross_amount"`
+	PlatformFees     float64 `json:"platform_fees"`
+	NetAmount        float64 `json:"net_amount"`
+	UniquePayingOrgs int     `json:"unique_paying_orgs"`
+}
+
+// EarningsBucket represents developer earnings for one day, week or month
+type EarningsBucket struct {
+	BucketStart time.Time `json:"bucket_start"`
+	EarningsTotals
+}
+
+// FunctionEarnings represents developer earnings for a single function
+type FunctionEarnings struct {
+	FunctionID   string `json:"function_id"`
+	FunctionName string `json:"function_name"`
+	EarningsTotals
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// GetEarningsAnalyticsResponse represents developer earnings analytics
+type GetEarningsAnalyticsResponse struct {
+	Granularity string             `json:"granularity"` // day, week, month
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	AsOf        time.Time          `json:"as_of"` // Transactions up to this time are included
+	Totals      EarningsTotals     `json:"totals"`
+	Series      []EarningsBucket   `json:"series"`
+	ByFunction  []FunctionEarnings `json:"by_function"`
+}
+
+// Constants
+const (
+	// Analytics granularities
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+
+	EarningsRollupName = "developer_earnings_daily"
+)
+
+// IsValidGranularity reports whether g is a supported analytics bucket size
+func IsValidGranularity(g string) bool {
+	return g == GranularityDay || g == GranularityWeek || g == GranularityMonth
+}
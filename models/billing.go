@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+)
+
+// AccountLedgerEntry represents a change to a user account balance.
+// Entries are written by a trigger on the accounts table.
+type AccountLedgerEntry struct {
+	ID             string    `json:"id" db:"id"`
+	AccountID      string    `json:"account_id" db:"account_id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	EntryType      string    `json:"entry_type" db:"entry_type"` // top_up, charge, refund, adjustment
+	Amount         float64   `json:"amount" db:"amount"`         // Signed change to the balance
+	BalanceAfter   float64   `json:"balance_after" db:"balance_after"`
+	ReferenceID    *string   `json:"reference_id" db:"reference_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// AccountLedgerSummary aggregates ledger entries for a statement period
+type AccountLedgerSummary struct {
+	NetSinceStart float64 // Net change from period start until now
+	NetSinceEnd   float64 // Net change from period end until now
+	TopUps        float64
+	Charges       float64 // Positive amount
+	Refunds       float64
+	Adjustments   float64 // Signed
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// GetBillingUsageResponse represents spend of a user organization over a date range
+type GetBillingUsageResponse struct {
+	OrganizationID string           `json:"organization_id"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	TotalSpend     float64          `json:"total_spend"`
+	TotalCalls     int              `json:"total_calls"`
+	ByFunction     []FunctionSpend  `json:"by_function"`
+	ByDeveloper    []DeveloperSpend `json:"by_developer"`
+}
+
+// FunctionSpend represents spend on a single function
+type FunctionSpend struct {
+	FunctionID              string  `json:"function_id"`
+	FunctionName            string  `json:"function_name"`
+	DeveloperOrganizationID string  `json:"developer_organization_id"`
+	CallCount               int     `json:"call_count"`
+	TotalAmount             float64 `json:"total_amount"`
+}
+
+// DeveloperSpend represents spend paid to a single developer organization
+type DeveloperSpend struct {
+	DeveloperOrganizationID string  `json:"developer_organization_id"`
+	FunctionCount           int     `json:"function_count"`
+	CallCount               int     `json:"call_count"`
+	TotalAmount             float64 `json:"total_amount"`
+}
+
+// GetBillingStatementResponse represents a monthly account statement
+type GetBillingStatementResponse struct {
+	OrganizationID string    `json:"organization_id"`
+	Month          string    `json:"month"` // YYYY-MM
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	OpeningBalance float64   `json:"opening_balance"`
+	TopUps         float64   `json:"top_ups"`
+	Charges        float64   `json:"charges"`
+	Refunds        float64   `json:"refunds"`
+	Adjustments    float64   `json:"adjustments"`
+	ClosingBalance float64   `json:"closing_balance"`
+}
+
+// GetSpendHistoryResponse represents payments made by a user organization
+type GetSpendHistoryResponse struct {
+	Transactions []SpendSummary `json:"transactions"`
+	Total        int            `json:"total"`
+	Page         int            `json:"page"`
+	Limit        int            `json:"limit"`
+	NextCursor   string         `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore      bool           `json:"has_more"`
+}
+
+// SpendSummary represents a payment from the paying organization's point of view
+type SpendSummary struct {
+	ID                    string    `json:"id"`
+	FunctionID            string    `json:"function_id"`
+	FunctionName          string    `json:"function_name"`
+	DeveloperOrganization string    `json:"developer_organization"`
+	Amount                float64   `json:"amount"`
+	Status                string    `json:"status"`
+	ExecutedAt            time.Time `json:"executed_at"`
+}
+
+// Constants
+const (
+	// Account ledger entry types
+	LedgerEntryTopUp      = "top_up"
+	LedgerEntryCharge     = "charge"
+	LedgerEntryRefund     = "refund"
+	LedgerEntryAdjustment = "adjustment"
+
+	StatementMonthFormat = "2006-01"
+)
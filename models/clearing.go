@@ -0,0 +1,18 @@
+package models
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// SetDeveloperTierRequest assigns a developer to a clearing period tier
+type SetDeveloperTierRequest struct {
+	Tier string `json:"tier"` // One of the configured tiers, empty for the global clearing period
+}
+
+// DeveloperTierResponse is a developer's tier and the clearing period it gives
+// their earnings. Per function clearing periods still take precedence.
+type DeveloperTierResponse struct {
+	OrganizationID        string  `json:"organization_id"`
+	Tier                  *string `json:"tier"`
+	ClearingPeriodSeconds int64   `json:"clearing_period_seconds"`
+}
@@ -0,0 +1,6 @@
+// Package models holds the database entities and the request/response DTOs of
+// the HTTP API. The DTOs here are the v1 wire contract served under /api/v1 and
+// its deprecated unversioned aliases, so fields may be added but not renamed or
+// removed. A breaking change belongs in a new package (models/v2) served by a
+// new router.Version.
+package models
@@ -0,0 +1,14 @@
+package models
+
+// ErrorResponse is the JSON envelope of every API error
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an API error
+type ErrorBody struct {
+	Code      string      `json:"code"`                 // Stable machine readable code, e.g. not_found
+	Message   string      `json:"message"`              // Human readable message
+	RequestID string      `json:"request_id,omitempty"` // Echoes the X-Request-ID response header
+	Details   interface{} `json:"details,omitempty"`    // Code specific structured data
+}
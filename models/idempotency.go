@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyRecord represents a stored Idempotency-Key and the response it produced
+type IdempotencyRecord struct {
+	OrganizationID      string    `json:"organization_id" db:"organization_id"`
+	Key                 string    `json:"idempotency_key" db:"idempotency_key"`
+	RequestMethod       string    `json:"request_method" db:"request_method"`
+	RequestPath         string    `json:"request_path" db:"request_path"`
+	RequestHash         string    `json:"request_hash" db:"request_hash"`
+	Status              string    `json:"status" db:"status"` // in_progress, completed
+	ResponseStatus      *int      `json:"response_status" db:"response_status"`
+	ResponseContentType *string   `json:"response_content_type" db:"response_content_type"`
+	ResponseBody        []byte    `json:"response_body" db:"response_body"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	LockedUntil         time.Time `json:"locked_until" db:"locked_until"` // An in-progress key past this is taken over by a retry
+	ExpiresAt           time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// Constants
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	MaxIdempotencyKeyLength   = 255
+	DefaultIdempotencyKeyTTL  = 24 * time.Hour
+	DefaultIdempotencyLock    = time.Minute
+
+	// Idempotency key statuses
+	IdempotencyStatusInProgress = "in_progress"
+	IdempotencyStatusCompleted  = "completed"
+)
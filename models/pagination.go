@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PageRequest represents page/limit pagination, or keyset pagination when After is set
+type PageRequest struct {
+	Page  int
+	Limit int
+	After *Cursor // Continue after this row instead of using Page
+	Peek  bool    // Limit includes one extra row, fetched to learn whether another page exists
+}
+
+// Offset returns the row offset for page based pagination
+func (p PageRequest) Offset() int {
+	if p.After != nil {
+		return 0
+	}
+	pageSize := p.Limit
+	if p.Peek {
+		pageSize--
+	}
+	return (p.Page - 1) * pageSize
+}
+
+// Cursor identifies the last row of a page by its sort key (timestamp, id)
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found || id == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	// Every paginated table has UUID keys, which the queries cast the ID to
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &Cursor{Time: time.Unix(0, unixNano).UTC(), ID: id}, nil
+}
+
+// ================================
+// LIST FILTERS
+// ================================
+
+// TransactionFilter narrows function execution transaction listings
+type TransactionFilter struct {
+	From              *time.Time // executed_at >= From
+	To                *time.Time // executed_at < To
+	Status            string
+	FunctionID        string
+	CounterpartyOrgID string // The other side of the payment (user org for developers)
+	MinAmount         *float64
+	MaxAmount         *float64
+}
+
+// WithdrawalFilter narrows withdrawal listings
+type WithdrawalFilter struct {
+	From      *time.Time // requested_at >= From
+	To        *time.Time // requested_at < To
+	Status    string
+	MinAmount *float64
+	MaxAmount *float64
+}
+
+// DeveloperFilter narrows developer wallet listings
+type DeveloperFilter struct {
+	From                *time.Time // created_at >= From
+	To                  *time.Time // created_at < To
+	OnboardingCompleted *bool
+	PayoutsEnabled      *bool
+	MinBalance          *float64
+	MaxBalance          *float64
+}
+
+// ReconciliationIssueFilter narrows reconciliation issue listings
+type ReconciliationIssueFilter struct {
+	Status          string
+	IssueType       string
+	StripeAccountID string
+}
+
+// Constants
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+)
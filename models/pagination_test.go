@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Time: time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC), ID: "6f1c3a52-1b3e-4a8e-9a55-1f2f3e4d5c6b"}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	if !decoded.Time.Equal(cursor.Time) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not base64", "not base64!"},
+		{"no separator", encode("1709296200000000000")},
+		{"empty id", encode("1709296200000000000:")},
+		{"non numeric time", encode("yesterday:6f1c3a52-1b3e-4a8e-9a55-1f2f3e4d5c6b")},
+		{"non uuid id", encode("1709296200000000000:1' OR '1'='1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := DecodeCursor(tt.encoded); err == nil || err.Error() != "invalid cursor" {
+				t.Errorf("DecodeCursor = %+v, %v, want invalid cursor", cursor, err)
+			}
+		})
+	}
+}
+
+func TestPageRequestOffset(t *testing.T) {
+	if offset := (PageRequest{Page: 3, Limit: 20}).Offset(); offset != 40 {
+		t.Errorf("offset = %d, want 40", offset)
+	}
+	// The extra row of a peek does not move the page
+	if offset := (PageRequest{Page: 3, Limit: 21, Peek: true}).Offset(); offset != 40 {
+		t.Errorf("offset of a peek = %d, want 40", offset)
+	}
+	if offset := (PageRequest{Page: 3, Limit: 20, After: &Cursor{}}).Offset(); offset != 0 {
+		t.Errorf("offset with a cursor = %d, want 0", offset)
+	}
+}
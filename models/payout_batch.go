@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+)
+
+// PayoutBatch is a platform-run payout cycle. A batch is previewed as a draft
+// listing every eligible developer, reviewed by an admin and then executed,
+// which requests a withdrawal for each included entry.
+type PayoutBatch struct {
+	ID          string     `json:"id" db:"id"`
+	Status      string     `json:"status" db:"status"`       // draft, executing, submitted, completed
+	CutoffAt    time.Time  `json:"cutoff_at" db:"cutoff_at"` // Earnings that cleared after this are left for the next batch
+	ExecutedAt  *time.Time `json:"executed_at" db:"executed_at"`
+	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// PayoutBatchEntry is the payout of one developer in a batch
+type PayoutBatchEntry struct {
+	ID                string    `json:"id" db:"id"`
+	BatchID           string    `json:"batch_id" db:"batch_id"`
+	DeveloperWalletID string    `json:"developer_wallet_id" db:"developer_wallet_id"`
+	OrganizationID    string    `json:"organization_id" db:"organization_id"`
+	Amount            float64   `json:"amount" db:"amount"`
+	Excluded          bool      `json:"excluded" db:"excluded"`
+	Status            string    `json:"status" db:"status"` // pending, requesting, requested, rejected
+	WithdrawalID      *string   `json:"withdrawal_id" db:"withdrawal_id"`
+	WithdrawalStatus  *string   `json:"withdrawal_status" db:"withdrawal_status"` // Joined from withdrawal_requests
+	Error             *string   `json:"error" db:"error"`                         // Why the withdrawal was rejected
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// CreatePayoutBatchRequest represents request to preview a payout batch
+type CreatePayoutBatchRequest struct {
+	Cutoff string `json:"cutoff" binding:"required"` // RFC 3339 time or YYYY-MM-DD, earnings cleared after it are left out
+}
+
+// UpdatePayoutBatchEntriesRequest represents request to exclude entries from
+// a draft payout batch, or include them again
+type UpdatePayoutBatchEntriesRequest struct {
+	EntryIDs []string `json:"entry_ids" binding:"required,min=1,dive,uuid"`
+	Excluded bool     `json:"excluded"`
+}
+
+// PayoutBatchEntryResponse represents the payout of one developer in a batch
+type PayoutBatchEntryResponse struct {
+	ID                string  `json:"id"`
+	OrganizationID    string  `json:"organization_id"`
+	DeveloperWalletID string  `json:"developer_wallet_id"`
+	Amount            float64 `json:"amount"`
+	Status            string  `json:"status"` // excluded, pending, requesting, rejected, or the status of the withdrawal
+	WithdrawalID      *string `json:"withdrawal_id"`
+	Error             *string `json:"error"`
+}
+
+// PayoutBatchTotals represents the progress of a payout batch. Counts and
+// amounts other than the excluded ones cover included entries only.
+type PayoutBatchTotals struct {
+	Entries         int     `json:"entries"`
+	Excluded        int     `json:"excluded"`
+	Pending         int     `json:"pending"`   // Not requested yet
+	InFlight        int     `json:"in_flight"` // Withdrawal pending or processing
+	Completed       int     `json:"completed"`
+	Failed          int     `json:"failed"` // Rejected or withdrawal failed
+	TotalAmount     float64 `json:"total_amount"`
+	ExcludedAmount  float64 `json:"excluded_amount"`
+	InFlightAmount  float64 `json:"in_flight_amount"`
+	CompletedAmount float64 `json:"completed_amount"`
+	FailedAmount    float64 `json:"failed_amount"`
+}
+
+// PayoutBatchResponse represents a payout batch with its entries
+type PayoutBatchResponse struct {
+	ID          string                     `json:"id"`
+	Status      string                     `json:"status"`
+	CutoffAt    time.Time                  `json:"cutoff_at"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	ExecutedAt  *time.Time                 `json:"executed_at"`
+	CompletedAt *time.Time                 `json:"completed_at"`
+	Totals      PayoutBatchTotals          `json:"totals"`
+	Entries     []PayoutBatchEntryResponse `json:"entries"`
+}
+
+// GetPayoutBatchesResponse represents a page of payout batches, newest first
+type GetPayoutBatchesResponse struct {
+	Batches    []PayoutBatch `json:"batches"`
+	Total      int           `json:"total"`
+	Page       int           `json:"page"`
+	Limit      int           `json:"limit"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore    bool          `json:"has_more"`
+}
+
+// Constants
+const (
+	// Payout batch statuses
+	PayoutBatchStatusDraft     = "draft"
+	PayoutBatchStatusExecuting = "executing" // Withdrawals are being requested
+	PayoutBatchStatusSubmitted = "submitted" // Every withdrawal was requested
+	PayoutBatchStatusCompleted = "completed" // Every withdrawal completed or failed
+
+	// Payout batch entry statuses
+	PayoutBatchEntryPending    = "pending"
+	PayoutBatchEntryRequesting = "requesting" // The withdrawal ID is recorded, the withdrawal may not exist yet
+	PayoutBatchEntryRequested  = "requested"
+	PayoutBatchEntryRejected   = "rejected"
+	PayoutBatchEntryExcluded   = "excluded" // Reported only, exclusion is a flag of the entry
+)
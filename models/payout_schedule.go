@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+)
+
+// PayoutSchedule makes automatic withdrawals from a developer wallet. At each
+// run the available balance above Reserve is withdrawn if it reaches Threshold.
+type PayoutSchedule struct {
+	DeveloperWalletID string     `json:"developer_wallet_id" db:"developer_wallet_id"`
+	OrganizationID    string     `json:"organization_id" db:"organization_id"` // Joined from developer_wallets
+	Frequency         string     `json:"frequency" db:"frequency"`             // manual, daily, weekly, monthly
+	Weekday           *int       `json:"weekday" db:"weekday"`                 // Weekly schedules, 0 is Sunday
+	DayOfMonth        *int       `json:"day_of_month" db:"day_of_month"`       // Monthly schedules
+	Threshold         float64    `json:"threshold" db:"threshold"`
+	Reserve           float64    `json:"reserve" db:"reserve"`
+	NextRunAt         *time.Time `json:"next_run_at" db:"next_run_at"` // nil for manual schedules
+	LastRunAt         *time.Time `json:"last_run_at" db:"last_run_at"`
+	LastWithdrawalID  *string    `json:"last_withdrawal_id" db:"last_withdrawal_id"`
+	LastError         *string    `json:"last_error" db:"last_error"` // Why the last run made no withdrawal, if it failed
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// SetPayoutScheduleRequest represents request to set a developer's payout schedule
+type SetPayoutScheduleRequest struct {
+	Frequency  string  `json:"frequency" binding:"required,oneof=manual daily weekly monthly"`
+	Weekday    *int    `json:"weekday" binding:"omitempty,min=0,max=6"`       // Required for weekly schedules, 0 is Sunday
+	DayOfMonth *int    `json:"day_of_month" binding:"omitempty,min=1,max=31"` // Required for monthly schedules, the last day in shorter months
+	Threshold  float64 `json:"threshold" binding:"gte=0"`                     // Smallest automatic withdrawal, at least the minimum withdrawal
+	Reserve    float64 `json:"reserve" binding:"gte=0"`                       // Left in the wallet by automatic withdrawals
+}
+
+// PayoutScheduleResponse represents a developer's payout schedule
+type PayoutScheduleResponse struct {
+	OrganizationID   string     `json:"organization_id"`
+	Frequency        string     `json:"frequency"`
+	Weekday          *int       `json:"weekday"`
+	DayOfMonth       *int       `json:"day_of_month"`
+	Threshold        float64    `json:"threshold"` // Threshold in effect, never below the minimum withdrawal
+	Reserve          float64    `json:"reserve"`
+	NextRunAt        *time.Time `json:"next_run_at"`
+	LastRunAt        *time.Time `json:"last_run_at"`
+	LastWithdrawalID *string    `json:"last_withdrawal_id"`
+	LastError        *string    `json:"last_error"`
+}
+
+// Constants
+const (
+	// Payout schedule frequencies, runs are at midnight UTC
+	PayoutFrequencyManual  = "manual"
+	PayoutFrequencyDaily   = "daily"
+	PayoutFrequencyWeekly  = "weekly"
+	PayoutFrequencyMonthly = "monthly"
+)
+
+// NextPayoutRun returns the first run of schedule after t, or nil for manual
+// schedules. Monthly schedules run on the last day of months shorter than
+// their day of the month.
+func NextPayoutRun(schedule *PayoutSchedule, t time.Time) *time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	var next time.Time
+	switch schedule.Frequency {
+	case PayoutFrequencyDaily:
+		next = day.AddDate(0, 0, 1)
+	case PayoutFrequencyWeekly:
+		if schedule.Weekday == nil {
+			return nil
+		}
+		days := (*schedule.Weekday - int(day.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		next = day.AddDate(0, 0, days)
+	case PayoutFrequencyMonthly:
+		if schedule.DayOfMonth == nil {
+			return nil
+		}
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = monthlyPayoutDay(month, *schedule.DayOfMonth)
+		if !next.After(t) {
+			next = monthlyPayoutDay(month.AddDate(0, 1, 0), *schedule.DayOfMonth)
+		}
+	default:
+		return nil
+	}
+	return &next
+}
+
+// monthlyPayoutDay returns dayOfMonth in the month starting at month, or the
+// last day of the month if it is shorter
+func monthlyPayoutDay(month time.Time, dayOfMonth int) time.Time {
+	lastDay := month.AddDate(0, 1, -1).Day()
+	if dayOfMonth > lastDay {
+		dayOfMonth = lastDay
+	}
+	return month.AddDate(0, 0, dayOfMonth-1)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// ReconciliationIssue is a disagreement between a local record and what Stripe
+// did. An issue is keyed by its type and the Stripe object it is about, so a
+// mismatch seen by every run stays one row until it is resolved.
+type ReconciliationIssue struct {
+	ID              string     `json:"id" db:"id"`
+	IssueType       string     `json:"issue_type" db:"issue_type"`
+	Status          string     `json:"status" db:"status"` // open, resolved
+	StripeAccountID string     `json:"stripe_account_id" db:"stripe_account_id"`
+	StripeObjectID  string     `json:"stripe_object_id" db:"stripe_object_id"` // Payout, transfer or account the issue is about
+	WithdrawalID    *string    `json:"withdrawal_id" db:"withdrawal_id"`
+	OrganizationID  *string    `json:"organization_id" db:"organization_id"`
+	LocalAmount     *float64   `json:"local_amount" db:"local_amount"`
+	StripeAmount    *float64   `json:"stripe_amount" db:"stripe_amount"`
+	LocalStatus     *string    `json:"local_status" db:"local_status"`
+	StripeStatus    *string    `json:"stripe_status" db:"stripe_status"`
+	Details         string     `json:"details" db:"details"`
+	FirstSeenAt     time.Time  `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt      time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	ResolvedAt      *time.Time `json:"resolved_at" db:"resolved_at"`
+}
+
+// ReconciliationRun records one pass of the reconciler over a tenant. The start
+// of the last run without errors is the checkpoint of the next one.
+type ReconciliationRun struct {
+	ID              string    `json:"id" db:"id"`
+	StartedAt       time.Time `json:"started_at" db:"started_at"`
+	FinishedAt      time.Time `json:"finished_at" db:"finished_at"`
+	Since           time.Time `json:"since" db:"since"` // Stripe objects created from here on were compared
+	AccountsChecked int       `json:"accounts_checked" db:"accounts_checked"`
+	IssuesFound     int       `json:"issues_found" db:"issues_found"`
+	IssuesResolved  int       `json:"issues_resolved" db:"issues_resolved"`
+	Error           *string   `json:"error" db:"error"` // Accounts that could not be compared
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// GetReconciliationIssuesResponse represents reconciliation issues and the last run
+type GetReconciliationIssuesResponse struct {
+	Issues     []ReconciliationIssue `json:"issues"`
+	Total      int                   `json:"total"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	NextCursor string                `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore    bool                  `json:"has_more"`
+	LastRun    *ReconciliationRun    `json:"last_run"`
+}
+
+// Constants
+const (
+	// Reconciliation issue types
+	ReconciliationIssueMissingLocalRecord = "missing_local_record" // Stripe object names a withdrawal we do not have
+	ReconciliationIssueStatusDrift        = "status_drift"         // Withdrawal status disagrees with the payout or transfer
+	ReconciliationIssueAmountMismatch     = "amount_mismatch"      // Withdrawal amount differs from the Stripe amount
+	ReconciliationIssueOrphanPayout       = "orphan_payout"        // Payout not made by the platform
+	ReconciliationIssueOrphanTransfer     = "orphan_transfer"      // Transfer not made for a withdrawal
+	ReconciliationIssueBalanceMismatch    = "balance_mismatch"     // Connected account holds funds no withdrawal accounts for
+
+	// Reconciliation issue statuses
+	ReconciliationIssueStatusOpen     = "open"
+	ReconciliationIssueStatusResolved = "resolved"
+)
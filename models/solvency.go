@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// SolvencyReport compares what the platform owes with its Stripe balance.
+// Liabilities are summed over every tenant, since they share the platform
+// Stripe account.
+type SolvencyReport struct {
+	DeveloperLiabilities   float64             `json:"developer_liabilities"`    // Sum of developer wallet balances
+	PendingWithdrawals     float64             `json:"pending_withdrawals"`      // Part of developer liabilities being paid out
+	PendingWithdrawalCount int                 `json:"pending_withdrawal_count"` // Number of pending and processing withdrawals not yet transferred
+	UserPrepaidBalances    float64             `json:"user_prepaid_balances"`    // Sum of user account balances
+	TotalLiabilities       float64             `json:"total_liabilities"`        // Developer liabilities plus user prepaid balances
+	PlatformRevenue        float64             `json:"platform_revenue"`         // Platform fees of completed payments, owed to no one
+	StripeBalance          []CurrencyBalance   `json:"stripe_balance"`           // Platform balance on Stripe by currency
+	CoverageRatio          *float64            `json:"coverage_ratio"`           // USD available and pending balance over total liabilities, null without liabilities
+	MinCoverageRatio       float64             `json:"min_coverage_ratio"`       // Alert threshold for the coverage ratio
+	Surplus                float64             `json:"surplus"`                  // USD balance less total liabilities, revenue not yet paid out when healthy
+	Healthy                bool                `json:"healthy"`
+	Alerts                 []string            `json:"alerts"`
+	Tenants                []TenantLiabilities `json:"tenants"`
+	GeneratedAt            time.Time           `json:"generated_at"`
+}
+
+// CurrencyBalance is a Stripe balance in one currency, in dollars
+type CurrencyBalance struct {
+	Currency  string  `json:"currency"`
+	Available float64 `json:"available"`
+	Pending   float64 `json:"pending"` // Not yet available, e.g. recent top-ups
+}
+
+// TenantLiabilities is the part of a solvency report from one tenant schema
+type TenantLiabilities struct {
+	Tenant      string      `json:"tenant"`
+	Liabilities Liabilities `json:"liabilities"`
+}
+
+// Constants
+const (
+	DefaultMinCoverageRatio = 1.0 // Alert as soon as the Stripe balance does not cover all liabilities
+)
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// SpendingCap limits how much a user organization can spend per period,
+// either across all functions or on a single function
+type SpendingCap struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	FunctionID     *string   `json:"function_id" db:"function_id"` // nil applies to all functions
+	Period         string    `json:"period" db:"period"`           // hour, day, month
+	LimitAmount    float64   `json:"limit_amount" db:"limit_amount"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ================================
+// REQUEST/RESPONSE DTOs
+// ================================
+
+// SetSpendingCapRequest represents request to create or update a spending cap
+type SetSpendingCapRequest struct {
+	OrganizationID string  `json:"organization_id" binding:"required"`
+	FunctionID     *string `json:"function_id"`
+	Period         string  `json:"period" binding:"required,oneof=hour day month"`
+	LimitAmount    float64 `json:"limit_amount" binding:"required,gt=0"`
+}
+
+// SpendingCapSummary represents a spending cap with spend in the current period
+type SpendingCapSummary struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	FunctionID     *string   `json:"function_id"`
+	Period         string    `json:"period"`
+	LimitAmount    float64   `json:"limit_amount"`
+	CurrentSpend   float64   `json:"current_spend"`
+	Remaining      float64   `json:"remaining"`
+	PeriodStart    time.Time `json:"period_start"`
+	ResetsAt       time.Time `json:"resets_at"`
+}
+
+// GetSpendingCapsResponse represents the spending caps of a user organization
+type GetSpendingCapsResponse struct {
+	OrganizationID string               `json:"organization_id"`
+	Caps           []SpendingCapSummary `json:"caps"`
+}
+
+// Constants
+const (
+	// Spending cap periods (calendar windows in UTC)
+	SpendingCapPeriodHour  = "hour"
+	SpendingCapPeriodDay   = "day"
+	SpendingCapPeriodMonth = "month"
+)
+
+// SpendingCapWindow returns the UTC calendar window of period that contains t
+func SpendingCapWindow(period string, t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	switch period {
+	case SpendingCapPeriodHour:
+		start = t.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	case SpendingCapPeriodMonth:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
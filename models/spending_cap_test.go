@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpendingCapWindow(t *testing.T) {
+	// 23:30 on the last day of February in UTC+2, which is 21:30 UTC
+	at := time.Date(2024, 2, 29, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	tests := []struct {
+		period    string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{SpendingCapPeriodHour, time.Date(2024, 2, 29, 21, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 22, 0, 0, 0, time.UTC)},
+		{SpendingCapPeriodDay, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{SpendingCapPeriodMonth, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			start, end := SpendingCapWindow(tt.period, at)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("window = %v to %v, want %v to %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
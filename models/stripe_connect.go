@@ -6,52 +6,69 @@ import (
 
 // DeveloperWallet represents a developer's earnings wallet
 type DeveloperWallet struct {
-	ID                      string    `json:"id" db:"id"`
-	OrganizationID          string    `json:"organization_id" db:"organization_id"`
-	StripeConnectAccountID  *string   `json:"stripe_connect_account_id" db:"stripe_connect_account_id"`
-	Balance                 float64   `json:"balance" db:"balance"`
-	TotalEarned             float64   `json:"total_earned" db:"total_earned"`
-	TotalWithdrawn          float64   `json:"total_withdrawn" db:"total_withdrawn"`
-	OnboardingCompleted     bool      `json:"onboarding_completed" db:"onboarding_completed"`
-	OnboardingURL           *string   `json:"onboarding_url" db:"onboarding_url"`
-	PayoutsEnabled          bool      `json:"payouts_enabled" db:"payouts_enabled"`
-	ChargesEnabled          bool      `json:"charges_enabled" db:"charges_enabled"`
-	CreatedAt               time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt               time.Time `json:"updated_at" db:"updated_at"`
+	ID                     string     `json:"id" db:"id"`
+	OrganizationID         string     `json:"organization_id" db:"organization_id"`
+	StripeConnectAccountID *string    `json:"stripe_connect_account_id" db:"stripe_connect_account_id"`
+	Balance                float64    `json:"balance" db:"balance"`
+	TotalEarned            float64    `json:"total_earned" db:"total_earned"`
+	TotalWithdrawn         float64    `json:"total_withdrawn" db:"total_withdrawn"`
+	PendingBalance         float64    `json:"pending_balance" db:"pending_balance"` // Part of Balance still in its clearing period
+	Tier                   *string    `json:"tier" db:"tier"`                       // Selects the clearing period, nil for the global one
+	OnboardingCompleted    bool       `json:"onboarding_completed" db:"onboarding_completed"`
+	OnboardingURL          *string    `json:"onboarding_url" db:"onboarding_url"`
+	PayoutsEnabled         bool       `json:"payouts_enabled" db:"payouts_enabled"`
+	ChargesEnabled         bool       `json:"charges_enabled" db:"charges_enabled"`
+	StatusSyncedAt         *time.Time `json:"status_synced_at" db:"status_synced_at"` // Last time the flags above were read from Stripe
+	CreatedAt              time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // WithdrawalRequest represents a developer's withdrawal request
 type WithdrawalRequest struct {
-	ID                  string     `json:"id" db:"id"`
-	DeveloperWalletID   string     `json:"developer_wallet_id" db:"developer_wallet_id"`
-	OrganizationID      string     `json:"organization_id" db:"organization_id"`
-	Amount              float64    `json:"amount" db:"amount"`
-	Status              string     `json:"status" db:"status"` // pending, processing, completed, failed, rejected
-	StripeTransferID    *string    `json:"stripe_transfer_id" db:"stripe_transfer_id"`
-	StripePayoutID      *string    `json:"stripe_payout_id" db:"stripe_payout_id"`
-	FailureReason       *string    `json:"failure_reason" db:"failure_reason"`
-	RequestedAt         time.Time  `json:"requested_at" db:"requested_at"`
-	CompletedAt         *time.Time `json:"completed_at" db:"completed_at"`
-	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+	ID                string     `json:"id" db:"id"`
+	DeveloperWalletID string     `json:"developer_wallet_id" db:"developer_wallet_id"`
+	OrganizationID    string     `json:"organization_id" db:"organization_id"`
+	Amount            float64    `json:"amount" db:"amount"`
+	Status            string     `json:"status" db:"status"` // pending, processing, completed, failed, rejected
+	StripeTransferID  *string    `json:"stripe_transfer_id" db:"stripe_transfer_id"`
+	StripePayoutID    *string    `json:"stripe_payout_id" db:"stripe_payout_id"`
+	FailureReason     *string    `json:"failure_reason" db:"failure_reason"`
+	RequestID         *string    `json:"-" db:"request_id"` // API request that created the withdrawal
+	RequestedAt       time.Time  `json:"requested_at" db:"requested_at"`
+	CompletedAt       *time.Time `json:"completed_at" db:"completed_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // FunctionExecutionTransaction represents a payment for function execution
 type FunctionExecutionTransaction struct {
-	ID                      string    `json:"id" db:"id"`
-	FunctionID              string    `json:"function_id" db:"function_id"`
-	UserOrganizationID      string    `json:"user_organization_id" db:"user_organization_id"`
-	DeveloperOrganizationID string    `json:"developer_organization_id" db:"developer_organization_id"`
-	UserAccountID           string    `json:"user_account_id" db:"user_account_id"`
-	DeveloperWalletID       string    `json:"developer_wallet_id" db:"developer_wallet_id"`
-	Amount                  float64   `json:"amount" db:"amount"`
-	PlatformFee             float64   `json:"platform_fee" db:"platform_fee"`
-	NetAmount               float64   `json:"net_amount" db:"net_amount"`
-	Description             *string   `json:"description" db:"description"`
-	Status                  string    `json:"status" db:"status"` // completed, failed, refunded
-	ExecutedAt              time.Time `json:"executed_at" db:"executed_at"`
-	CreatedAt               time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt               time.Time `json:"updated_at" db:"updated_at"`
+	ID                      string     `json:"id" db:"id"`
+	FunctionID              string     `json:"function_id" db:"function_id"`
+	UserOrganizationID      string     `json:"user_organization_id" db:"user_organization_id"`
+	DeveloperOrganizationID string     `json:"developer_organization_id" db:"developer_organization_id"`
+	UserAccountID           string     `json:"user_account_id" db:"user_account_id"`
+	DeveloperWalletID       string     `json:"developer_wallet_id" db:"developer_wallet_id"`
+	Amount                  float64    `json:"amount" db:"amount"`
+	PlatformFee             float64    `json:"platform_fee" db:"platform_fee"`
+	NetAmount               float64    `json:"net_amount" db:"net_amount"`
+	Description             *string    `json:"description" db:"description"`
+	Status                  string     `json:"status" db:"status"` // completed, failed, refunded
+	ExecutedAt              time.Time  `json:"executed_at" db:"executed_at"`
+	AvailableAt             time.Time  `json:"available_at" db:"available_at"` // End of the clearing period of NetAmount
+	ReleasedAt              *time.Time `json:"released_at" db:"released_at"`   // When NetAmount became withdrawable
+	CreatedAt               time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at" db:"updated_at"`
+	FunctionName            *string    `json:"function_name,omitempty" db:"function_name"` // Joined from the functions table
+}
+
+// Liabilities is what the platform owes developers across all wallets, and the
+// prepaid balances and fees it holds for user organizations and itself
+type Liabilities struct {
+	WalletBalance           float64 `json:"wallet_balance"`            // Sum of developer wallet balances
+	PendingWithdrawalAmount float64 `json:"pending_withdrawal_amount"` // Pending and processing withdrawals not yet transferred
+	PendingWithdrawalCount  int     `json:"pending_withdrawal_count"`
+	UserPrepaidBalance      float64 `json:"user_prepaid_balance"` // Sum of user account balances
+	PlatformRevenue         float64 `json:"platform_revenue"`     // Platform fees of completed payments
 }
 
 // ================================
@@ -73,15 +90,16 @@ type CreateConnectAccountResponse struct {
 
 // GetConnectAccountStatusResponse represents Connect account status
 type GetConnectAccountStatusResponse struct {
-	AccountID           string  `json:"account_id"`
-	OnboardingCompleted bool    `json:"onboarding_completed"`
-	PayoutsEnabled      bool    `json:"payouts_enabled"`
-	ChargesEnabled      bool    `json:"charges_enabled"`
-	Balance             float64 `json:"balance"`
-	TotalEarned         float64 `json:"total_earned"`
-	TotalWithdrawn      float64 `json:"total_withdrawn"`
-	CanWithdraw         bool    `json:"can_withdraw"`
-	MinimumWithdrawal   float64 `json:"minimum_withdrawal"`
+	AccountID           string     `json:"account_id"`
+	OnboardingCompleted bool       `json:"onboarding_completed"`
+	PayoutsEnabled      bool       `json:"payouts_enabled"`
+	ChargesEnabled      bool       `json:"charges_enabled"`
+	Balance             float64    `json:"balance"`
+	TotalEarned         float64    `json:"total_earned"`
+	TotalWithdrawn      float64    `json:"total_withdrawn"`
+	CanWithdraw         bool       `json:"can_withdraw"`
+	MinimumWithdrawal   float64    `json:"minimum_withdrawal"`
+	StatusSyncedAt      *time.Time `json:"status_synced_at"` // When the status flags were last read from Stripe, null if never
 }
 
 // CreateWithdrawalRequest represents request to withdraw funds
@@ -91,21 +109,23 @@ type CreateWithdrawalRequest struct {
 
 // CreateWithdrawalResponse represents response after creating withdrawal
 type CreateWithdrawalResponse struct {
-	WithdrawalID string  `json:"withdrawal_id"`
-	Amount       float64 `json:"amount"`
-	Status       string  `json:"status"`
-	Message      string  `json:"message"`
-	EstimatedArrival string `json:"estimated_arrival,omitempty"` // e.g., "2-3 business days"
+	WithdrawalID     string  `json:"withdrawal_id"`
+	Amount           float64 `json:"amount"`
+	Status           string  `json:"status"`
+	Message          string  `json:"message"`
+	EstimatedArrival string  `json:"estimated_arrival,omitempty"` // e.g., "2-3 business days"
 }
 
 // GetWalletBalanceResponse represents developer wallet balance
 type GetWalletBalanceResponse struct {
-	Balance           float64 `json:"balance"`
-	TotalEarned       float64 `json:"total_earned"`
-	TotalWithdrawn    float64 `json:"total_withdrawn"`
+	Balance            float64 `json:"balance"`
+	TotalEarned        float64 `json:"total_earned"`
+	TotalWithdrawn     float64 `json:"total_withdrawn"`
 	PendingWithdrawals float64 `json:"pending_withdrawals"`
-	CanWithdraw       bool    `json:"can_withdraw"`
-	MinimumWithdrawal float64 `json:"minimum_withdrawal"`
+	PendingBalance     float64 `json:"pending_balance"`   // Earnings still in their clearing period
+	AvailableBalance   float64 `json:"available_balance"` // Balance less pending balance and pending withdrawals
+	CanWithdraw        bool    `json:"can_withdraw"`
+	MinimumWithdrawal  float64 `json:"minimum_withdrawal"`
 }
 
 // GetConnectedDevelopersResponse represents list of all connected developers
@@ -114,6 +134,8 @@ type GetConnectedDevelopersResponse struct {
 	Total      int                         `json:"total"`
 	Page       int                         `json:"page"`
 	Limit      int                         `json:"limit"`
+	NextCursor string                      `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore    bool                        `json:"has_more"`
 }
 
 // ConnectedDeveloperSummary represents a summary of a connected developer
@@ -135,19 +157,21 @@ type GetTransactionHistoryResponse struct {
 	Total        int                  `json:"total"`
 	Page         int                  `json:"page"`
 	Limit        int                  `json:"limit"`
+	NextCursor   string               `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore      bool                 `json:"has_more"`
 }
 
 // TransactionSummary represents a summary of a transaction
 type TransactionSummary struct {
-	ID                 string    `json:"id"`
-	FunctionID         string    `json:"function_id"`
-	FunctionName       string    `json:"function_name"`
-	UserOrganization   string    `json:"user_organization"`
-	Amount             float64   `json:"amount"`
-	PlatformFee        float64   `json:"platform_fee"`
-	NetAmount          float64   `json:"net_amount"`
-	Status             string    `json:"status"`
-	ExecutedAt         time.Time `json:"executed_at"`
+	ID               string    `json:"id"`
+	FunctionID       string    `json:"function_id"`
+	FunctionName     string    `json:"function_name"`
+	UserOrganization string    `json:"user_organization"`
+	Amount           float64   `json:"amount"`
+	PlatformFee      float64   `json:"platform_fee"`
+	NetAmount        float64   `json:"net_amount"`
+	Status           string    `json:"status"`
+	ExecutedAt       time.Time `json:"executed_at"`
 }
 
 // GetWithdrawalHistoryResponse represents withdrawal history
@@ -156,16 +180,18 @@ type GetWithdrawalHistoryResponse struct {
 	Total       int                 `json:"total"`
 	Page        int                 `json:"page"`
 	Limit       int                 `json:"limit"`
+	NextCursor  string              `json:"next_cursor,omitempty"` // Opaque cursor for the next page
+	HasMore     bool                `json:"has_more"`
 }
 
 // WithdrawalSummary represents a summary of a withdrawal
 type WithdrawalSummary struct {
-	ID              string     `json:"id"`
-	Amount          float64    `json:"amount"`
-	Status          string     `json:"status"`
-	RequestedAt     time.Time  `json:"requested_at"`
-	CompletedAt     *time.Time `json:"completed_at"`
-	FailureReason   *string    `json:"failure_reason"`
+	ID            string     `json:"id"`
+	Amount        float64    `json:"amount"`
+	Status        string     `json:"status"`
+	RequestedAt   time.Time  `json:"requested_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	FailureReason *string    `json:"failure_reason"`
 }
 
 // FunctionExecutionPaymentRequest represents payment for function execution
@@ -177,13 +203,14 @@ type FunctionExecutionPaymentRequest struct {
 
 // FunctionExecutionPaymentResponse represents response after function execution payment
 type FunctionExecutionPaymentResponse struct {
-	TransactionID   string  `json:"transaction_id"`
-	Amount          float64 `json:"amount"`
-	PlatformFee     float64 `json:"platform_fee"`
-	NetAmount       float64 `json:"net_amount"`
-	UserBalance     float64 `json:"user_balance"`
-	DeveloperBalance float64 `json:"developer_balance"`
-	Message         string  `json:"message"`
+	TransactionID    string    `json:"transaction_id"`
+	Amount           float64   `json:"amount"`
+	PlatformFee      float64   `json:"platform_fee"`
+	NetAmount        float64   `json:"net_amount"`
+	UserBalance      float64   `json:"user_balance"`
+	DeveloperBalance float64   `json:"developer_balance"`
+	AvailableAt      time.Time `json:"available_at"` // When the net amount can be withdrawn
+	Message          string    `json:"message"`
 }
 
 // ConnectAccountLink represents Stripe account link
@@ -194,7 +221,7 @@ type ConnectAccountLink struct {
 
 // Constants
 const (
-	MinimumWithdrawalAmount = 50.00
+	MinimumWithdrawalAmount   = 50.00
 	DefaultPlatformFeePercent = 0.00 // Future: You can add platform commission (e.g., 10%)
 
 	// Withdrawal statuses
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// QueueStats summarizes work waiting to be done, for health checks
+type QueueStats struct {
+	Count    int        `json:"count"`
+	OldestAt *time.Time `json:"oldest_at,omitempty"`
+}
+
+// Constants
+const (
+	// Webhook event statuses. Received events are being handled (or the handler
+	// crashed), failed events are retried when Stripe redelivers them, and
+	// discarded events failed permanently and are kept for inspection.
+	WebhookEventStatusReceived  = "received"
+	WebhookEventStatusProcessed = "processed"
+	WebhookEventStatusFailed    = "failed"
+	WebhookEventStatusDiscarded = "discarded"
+)
@@ -0,0 +1,438 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	paramPattern    = regexp.MustCompile(`^(\S+)\s+(\S+)\s+(\S+)\s+(true|false)\s+"([^"]*)"(?:\s+default\(([^)]*)\))?`)
+	responsePattern = regexp.MustCompile(`^(\d{3})\s+\{(\w+)\}\s+(\S+)`)
+	routerPattern   = regexp.MustCompile(`^(\S+)\s+\[(\w+)\]`)
+)
+
+// Generate builds the OpenAPI document from the swag annotations on the
+// handlers in handlersDir and the DTO structs in modelsDir
+func Generate(handlersDir, modelsDir string) (*Document, error) {
+	structs, err := parseStructs(modelsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		structs: structs,
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info: Info{
+				Title:       "Stripe Connect Integration API",
+				Description: "Developer onboarding, wallets, withdrawals and function execution payments on Stripe Connect.",
+				Version:     "v1",
+			},
+			Paths:      map[string]map[string]*Operation{},
+			Components: Components{Schemas: map[string]*Schema{}},
+		},
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, handlersDir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse handlers: %w", err)
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Doc == nil {
+					continue
+				}
+				if err := g.addOperation(fn.Name.Name, fn.Doc); err != nil {
+					return nil, fmt.Errorf("%s: %w", fset.Position(fn.Pos()), err)
+				}
+			}
+		}
+	}
+
+	return g.doc, nil
+}
+
+type generator struct {
+	structs map[string]*ast.StructType
+	doc     *Document
+}
+
+// addOperation adds the operation described by a handler's doc comment.
+// Functions without an @Router annotation are skipped.
+func (g *generator) addOperation(name string, doc *ast.CommentGroup) error {
+	op := &Operation{OperationID: name, Responses: map[string]*Response{}}
+	var path, method string
+
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "@") {
+			continue
+		}
+		tag, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+
+		switch tag {
+		case "@Summary":
+			op.Summary = value
+		case "@Description":
+			// Repeated lines continue the description, as with swag
+			if op.Description != "" {
+				value = op.Description + "\n" + value
+			}
+			op.Description = value
+		case "@Tags":
+			for _, t := range strings.Split(value, ",") {
+				op.Tags = append(op.Tags, strings.TrimSpace(t))
+			}
+		case "@Param":
+			if err := g.addParam(op, value); err != nil {
+				return err
+			}
+		case "@Success", "@Failure":
+			m := responsePattern.FindStringSubmatch(value)
+			if m == nil {
+				return fmt.Errorf("malformed %s annotation %q", tag, value)
+			}
+			schema, err := g.typeSchema(m[3])
+			if err != nil {
+				return err
+			}
+			if m[2] == "array" {
+				schema = &Schema{Type: "array", Items: schema}
+			}
+			code, _ := strconv.Atoi(m[1])
+			op.Responses[m[1]] = &Response{
+				Description: http.StatusText(code),
+				Content:     map[string]MediaType{"application/json": {Schema: schema}},
+			}
+		case "@Router":
+			m := routerPattern.FindStringSubmatch(value)
+			if m == nil {
+				return fmt.Errorf("malformed @Router annotation %q", value)
+			}
+			path, method = m[1], strings.ToLower(m[2])
+		}
+	}
+
+	if path == "" {
+		return nil
+	}
+	if g.doc.Paths[path] == nil {
+		g.doc.Paths[path] = map[string]*Operation{}
+	}
+	if _, exists := g.doc.Paths[path][method]; exists {
+		return fmt.Errorf("duplicate operation %s %s", method, path)
+	}
+	g.doc.Paths[path][method] = op
+	return nil
+}
+
+func (g *generator) addParam(op *Operation, value string) error {
+	m := paramPattern.FindStringSubmatch(value)
+	if m == nil {
+		return fmt.Errorf("malformed @Param annotation %q", value)
+	}
+	name, in, typ, required, description, def := m[1], m[2], m[3], m[4] == "true", m[5], m[6]
+
+	schema, err := g.typeSchema(typ)
+	if err != nil {
+		return err
+	}
+
+	if in == "body" {
+		op.RequestBody = &RequestBody{
+			Description: description,
+			Required:    required,
+			Content:     map[string]MediaType{"application/json": {Schema: schema}},
+		}
+		return nil
+	}
+
+	if def != "" {
+		schema.Default = defaultValue(schema.Type, def)
+	}
+	op.Parameters = append(op.Parameters, &Parameter{
+		Name:        name,
+		In:          in,
+		Description: description,
+		Required:    required || in == "path",
+		Schema:      schema,
+	})
+	return nil
+}
+
+// typeSchema resolves an annotation type such as int, models.X or map[string]string
+func (g *generator) typeSchema(typ string) (*Schema, error) {
+	if name, ok := strings.CutPrefix(typ, "models."); ok {
+		if err := g.addComponent(name); err != nil {
+			return nil, err
+		}
+		return schemaRef(name), nil
+	}
+	if value, ok := strings.CutPrefix(typ, "map[string]"); ok {
+		inner, err := g.typeSchema(value)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: inner}, nil
+	}
+
+	switch typ {
+	case "string":
+		return &Schema{Type: "string"}, nil
+	case "int", "integer":
+		return &Schema{Type: "integer"}, nil
+	case "number", "float64":
+		return &Schema{Type: "number"}, nil
+	case "bool", "boolean":
+		return &Schema{Type: "boolean"}, nil
+	case "interface{}", "any", "object":
+		return &Schema{}, nil
+	}
+	return nil, fmt.Errorf("unsupported annotation type %q", typ)
+}
+
+// addComponent registers the named models struct and every struct it references
+func (g *generator) addComponent(name string) error {
+	if _, done := g.doc.Components.Schemas[name]; done {
+		return nil
+	}
+	st, ok := g.structs[name]
+	if !ok {
+		return fmt.Errorf("unknown model %q", name)
+	}
+
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.doc.Components.Schemas[name] = schema
+	return g.addFields(schema, st, isInput(st))
+}
+
+// isInput reports whether a struct is bound from a request body. Inputs take
+// required fields from their binding rules, outputs from omitempty.
+func isInput(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if bindingTag(field) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) addFields(schema *Schema, st *ast.StructType, input bool) error {
+	for _, field := range st.Fields.List {
+		// Embedded structs are flattened the same way encoding/json does
+		if len(field.Names) == 0 {
+			ident, ok := field.Type.(*ast.Ident)
+			if !ok || g.structs[ident.Name] == nil {
+				return fmt.Errorf("unsupported embedded field %s", exprString(field.Type))
+			}
+			if err := g.addFields(schema, g.structs[ident.Name], input); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, omitEmpty, skip := jsonName(field)
+		if skip {
+			continue
+		}
+		prop, err := g.exprSchema(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Names[0].Name, err)
+		}
+		if field.Comment != nil && prop.Ref == "" {
+			prop.Description = strings.TrimSpace(field.Comment.Text())
+		}
+		if input {
+			applyBinding(schema, prop, name, field)
+		} else if _, pointer := field.Type.(*ast.StarExpr); !omitEmpty && !pointer {
+			// Non-omitempty values are always present in responses
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+	sort.Strings(schema.Required)
+	return nil
+}
+
+func (g *generator) exprSchema(expr ast.Expr) (*Schema, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := g.structs[t.Name]; ok {
+			if err := g.addComponent(t.Name); err != nil {
+				return nil, err
+			}
+			return schemaRef(t.Name), nil
+		}
+		switch t.Name {
+		case "string":
+			return &Schema{Type: "string"}, nil
+		case "bool":
+			return &Schema{Type: "boolean"}, nil
+		case "int", "int32", "int64", "uint", "uint32", "uint64":
+			return &Schema{Type: "integer"}, nil
+		case "float32", "float64":
+			return &Schema{Type: "number"}, nil
+		}
+	case *ast.StarExpr:
+		inner, err := g.exprSchema(t.X)
+		if err != nil {
+			return nil, err
+		}
+		if inner.Ref == "" {
+			inner.Nullable = true
+		}
+		return inner, nil
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.exprSchema(t.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case *ast.MapType:
+		values, err := g.exprSchema(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case *ast.InterfaceType:
+		return &Schema{}, nil
+	case *ast.SelectorExpr:
+		switch exprString(t) {
+		case "time.Time":
+			return &Schema{Type: "string", Format: "date-time"}, nil
+		case "json.RawMessage":
+			return &Schema{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported type %s", exprString(expr))
+}
+
+// applyBinding copies gin binding rules that affect the wire contract
+func applyBinding(schema, prop *Schema, name string, field *ast.Field) {
+	for _, rule := range strings.Split(bindingTag(field), ",") {
+		switch {
+		case rule == "required":
+			schema.Required = append(schema.Required, name)
+		case strings.HasPrefix(rule, "oneof="):
+			prop.Enum = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		case strings.HasPrefix(rule, "min="), strings.HasPrefix(rule, "gt="):
+			key, value, _ := strings.Cut(rule, "=")
+			if min, err := strconv.ParseFloat(value, 64); err == nil {
+				prop.Minimum = &min
+				prop.ExclusiveMinimum = key == "gt"
+			}
+		}
+	}
+}
+
+func bindingTag(field *ast.Field) string {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, _ := strconv.Unquote(field.Tag.Value)
+	return reflect.StructTag(tag).Get("binding")
+}
+
+func jsonName(field *ast.Field) (name string, omitEmpty, skip bool) {
+	name = field.Names[0].Name
+	if !ast.IsExported(name) {
+		return "", false, true
+	}
+	if field.Tag == nil {
+		return name, false, false
+	}
+	tag, _ := strconv.Unquote(field.Tag.Value)
+	value, ok := reflect.StructTag(tag).Lookup("json")
+	if !ok {
+		return name, false, false
+	}
+	if value == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(value, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+	return name, contains(parts[1:], "omitempty"), false
+}
+
+// parseStructs returns every struct type declared in the package in dir
+func parseStructs(dir string) (map[string]*ast.StructType, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse models: %w", err)
+	}
+
+	structs := map[string]*ast.StructType{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				spec, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					structs[spec.Name.Name] = st
+				}
+				return false
+			})
+		}
+	}
+	return structs, nil
+}
+
+func defaultValue(typ, value string) interface{} {
+	switch typ {
+	case "integer":
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func exprString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return exprString(t.X) + "." + t.Sel.Name
+	case *ast.StarExpr:
+		return "*" + exprString(t.X)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"strpe-connect/handlers"
+	"strpe-connect/models"
+	"strpe-connect/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelTypes maps every component schema to the struct it documents
+var modelTypes = map[string]interface{}{
+	"ConnectedDeveloperSummary":        models.ConnectedDeveloperSummary{},
+	"CreateConnectAccountRequest":      models.CreateConnectAccountRequest{},
+	"CreateConnectAccountResponse":     models.CreateConnectAccountResponse{},
+	"CreatePayoutBatchRequest":         models.CreatePayoutBatchRequest{},
+	"CreateWithdrawalRequest":          models.CreateWithdrawalRequest{},
+	"CreateWithdrawalResponse":         models.CreateWithdrawalResponse{},
+	"CurrencyBalance":                  models.CurrencyBalance{},
+	"DeveloperSpend":                   models.DeveloperSpend{},
+	"DeveloperTierResponse":            models.DeveloperTierResponse{},
+	"EarningsBucket":                   models.EarningsBucket{},
+	"EarningsTotals":                   models.EarningsTotals{},
+	"ErrorBody":                        models.ErrorBody{},
+	"ErrorResponse":                    models.ErrorResponse{},
+	"FunctionEarnings":                 models.FunctionEarnings{},
+	"FunctionExecutionPaymentRequest":  models.FunctionExecutionPaymentRequest{},
+	"FunctionExecutionPaymentResponse": models.FunctionExecutionPaymentResponse{},
+	"FunctionSpend":                    models.FunctionSpend{},
+	"GetBillingStatementResponse":      models.GetBillingStatementResponse{},
+	"GetBillingUsageResponse":          models.GetBillingUsageResponse{},
+	"GetConnectAccountStatusResponse":  models.GetConnectAccountStatusResponse{},
+	"GetConnectedDevelopersResponse":   models.GetConnectedDevelopersResponse{},
+	"GetEarningsAnalyticsResponse":     models.GetEarningsAnalyticsResponse{},
+	"GetPayoutBatchesResponse":         models.GetPayoutBatchesResponse{},
+	"GetReconciliationIssuesResponse":  models.GetReconciliationIssuesResponse{},
+	"GetSpendHistoryResponse":          models.GetSpendHistoryResponse{},
+	"GetSpendingCapsResponse":          models.GetSpendingCapsResponse{},
+	"GetTransactionHistoryResponse":    models.GetTransactionHistoryResponse{},
+	"GetWalletBalanceResponse":         models.GetWalletBalanceResponse{},
+	"GetWithdrawalHistoryResponse":     models.GetWithdrawalHistoryResponse{},
+	"Liabilities":                      models.Liabilities{},
+	"PayoutBatch":                      models.PayoutBatch{},
+	"PayoutBatchEntryResponse":         models.PayoutBatchEntryResponse{},
+	"PayoutBatchResponse":              models.PayoutBatchResponse{},
+	"PayoutBatchTotals":                models.PayoutBatchTotals{},
+	"PayoutScheduleResponse":           models.PayoutScheduleResponse{},
+	"ReconciliationIssue":              models.ReconciliationIssue{},
+	"ReconciliationRun":                models.ReconciliationRun{},
+	"SetDeveloperTierRequest":          models.SetDeveloperTierRequest{},
+	"SetPayoutScheduleRequest":         models.SetPayoutScheduleRequest{},
+	"SetSpendingCapRequest":            models.SetSpendingCapRequest{},
+	"SolvencyReport":                   models.SolvencyReport{},
+	"SpendSummary":                     models.SpendSummary{},
+	"SpendingCapSummary":               models.SpendingCapSummary{},
+	"TenantLiabilities":                models.TenantLiabilities{},
+	"TransactionSummary":               models.TransactionSummary{},
+	"UpdatePayoutBatchEntriesRequest":  models.UpdatePayoutBatchEntriesRequest{},
+	"WithdrawalSummary":                models.WithdrawalSummary{},
+}
+
+func loadSpec(t *testing.T) *Document {
+	t.Helper()
+	var doc Document
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		t.Fatalf("embedded openapi.json is invalid: %v", err)
+	}
+	return &doc
+}
+
+func TestSpecIsUpToDate(t *testing.T) {
+	doc, err := Generate("../handlers", "../models")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	data, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(data, Spec) {
+		t.Fatal("openapi.json is out of date with the handler annotations or models, run: go generate ./openapi")
+	}
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.Register(r, router.Config{Handler: handlers.NewStripeConnectHandler(nil, "")})
+
+	doc := loadSpec(t)
+	served := map[string]bool{}
+	for _, route := range r.Routes() {
+		// Unversioned aliases are deprecated and intentionally undocumented
+		if !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		path := ginPathToOpenAPI(route.Path)
+		method := strings.ToLower(route.Method)
+		served[method+" "+path] = true
+
+		if doc.Paths[path][method] == nil {
+			t.Errorf("route %s %s is missing from the OpenAPI document", route.Method, path)
+		}
+	}
+
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if !served[method+" "+path] {
+				t.Errorf("documented operation %s %s is not served by the router", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestSchemasMatchModels(t *testing.T) {
+	doc := loadSpec(t)
+
+	for name, schema := range doc.Components.Schemas {
+		model, ok := modelTypes[name]
+		if !ok {
+			t.Errorf("schema %s has no entry in modelTypes", name)
+			continue
+		}
+
+		want := jsonFields(reflect.TypeOf(model))
+		got := map[string]string{}
+		for prop, propSchema := range schema.Properties {
+			got[prop] = propSchema.Type
+			if propSchema.Ref != "" {
+				got[prop] = "object"
+			}
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("schema %s drifted from models.%s:\n  spec:   %v\n  struct: %v", name, name, sortedFields(got), sortedFields(want))
+		}
+	}
+}
+
+// jsonFields returns the JSON property names of t and their OpenAPI types
+func jsonFields(t reflect.Type) map[string]string {
+	fields := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			for name, typ := range jsonFields(f.Type) {
+				fields[name] = typ
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = openAPIType(f.Type)
+	}
+	return fields
+}
+
+func openAPIType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf([]byte(nil)) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Interface:
+		return ""
+	}
+	return "object"
+}
+
+func ginPathToOpenAPI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func sortedFields(fields map[string]string) []string {
+	out := make([]string, 0, len(fields))
+	for name, typ := range fields {
+		out = append(out, name+":"+typ)
+	}
+	sort.Strings(out)
+	return out
+}
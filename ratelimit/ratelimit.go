@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strpe-connect/repository"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether a request identified by key may proceed. When it
+// may not, retryAfter tells the caller how long until a token is available.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// ================================
+// IN-PROCESS TOKEN BUCKET
+// ================================
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+type memoryLimiter struct {
+	mu            sync.Mutex
+	buckets       map[string]*bucket
+	ratePerSecond float64
+	burst         float64
+	lastPrune     time.Time
+	now           func() time.Time
+}
+
+// NewMemoryLimiter creates a token bucket limiter kept in process memory.
+// Each key refills at ratePerSecond tokens up to burst.
+func NewMemoryLimiter(ratePerSecond float64, burst int) Limiter {
+	return &memoryLimiter{
+		buckets:       make(map[string]*bucket),
+		ratePerSecond: ratePerSecond,
+		burst:         float64(burst),
+		lastPrune:     time.Now(),
+		now:           time.Now,
+	}
+}
+
+func (l *memoryLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneIdle(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	b.tokens = math.Min(l.burst, b.tokens+elapsed*l.ratePerSecond)
+	b.updatedAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	return false, retryAfter(b.tokens, l.ratePerSecond), nil
+}
+
+// pruneIdle drops buckets that have refilled completely, they carry no state
+func (l *memoryLimiter) pruneIdle(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	fullAfter := time.Duration(l.burst / l.ratePerSecond * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedAt) > fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ================================
+// POSTGRES TOKEN BUCKET
+// ================================
+
+type postgresLimiter struct {
+	repo          repository.RateLimitRepository
+	ratePerSecond float64
+	burst         int
+}
+
+// NewPostgresLimiter creates a token bucket limiter stored in Postgres so that
+// every replica shares the same buckets
+func NewPostgresLimiter(repo repository.RateLimitRepository, ratePerSecond float64, burst int) Limiter {
+	return &postgresLimiter{
+		repo:          repo,
+		ratePerSecond: ratePerSecond,
+		burst:         burst,
+	}
+}
+
+func (l *postgresLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	allowed, tokens, err := l.repo.TakeRateLimitToken(ctx, key, l.ratePerSecond, l.burst)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if allowed {
+		return true, 0, nil
+	}
+
+	return false, retryAfter(tokens, l.ratePerSecond), nil
+}
+
+func retryAfter(tokens, ratePerSecond float64) time.Duration {
+	missing := 1 - tokens
+	return time.Duration(missing / ratePerSecond * float64(time.Second))
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the in-process limiter
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestLimiter(ratePerSecond float64, burst int) (*memoryLimiter, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewMemoryLimiter(ratePerSecond, burst).(*memoryLimiter)
+	l.now = c.Now
+	l.lastPrune = c.now
+	return l, c
+}
+
+func allow(t *testing.T, l Limiter, key string) (bool, time.Duration) {
+	t.Helper()
+	allowed, retryAfter, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return allowed, retryAfter
+}
+
+func TestMemoryLimiterBurstAndRefill(t *testing.T) {
+	l, c := newTestLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := allow(t, l, "org:a"); !allowed {
+			t.Fatalf("request %d denied within the burst", i+1)
+		}
+	}
+	allowed, retryAfter := allow(t, l, "org:a")
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Fatalf("request after the burst = %v (retry after %v), want denied for 500ms", allowed, retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if allowed, _ := allow(t, l, "org:b"); !allowed {
+		t.Error("other key denied")
+	}
+
+	// Half a token accrued, so the wait halves
+	c.now = c.now.Add(250 * time.Millisecond)
+	if allowed, retryAfter := allow(t, l, "org:a"); allowed || retryAfter != 250*time.Millisecond {
+		t.Errorf("request after 250ms = %v (retry after %v), want denied for 250ms", allowed, retryAfter)
+	}
+	c.now = c.now.Add(250 * time.Millisecond)
+	if allowed, _ := allow(t, l, "org:a"); !allowed {
+		t.Error("request after a token refilled denied")
+	}
+
+	// A long idle refills up to the burst only
+	c.now = c.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if allowed, _ := allow(t, l, "org:a"); !allowed {
+			t.Fatalf("request %d after idling denied", i+1)
+		}
+	}
+	if allowed, _ := allow(t, l, "org:a"); allowed {
+		t.Error("bucket refilled past the burst")
+	}
+}
+
+func TestMemoryLimiterPrunesFullBuckets(t *testing.T) {
+	l, c := newTestLimiter(1, 2)
+	allow(t, l, "org:idle")
+
+	c.now = c.now.Add(30 * time.Second)
+	allow(t, l, "org:busy")
+	if len(l.buckets) != 2 {
+		t.Fatalf("%d buckets before the prune interval, want 2", len(l.buckets))
+	}
+
+	c.now = c.now.Add(31 * time.Second)
+	allow(t, l, "org:busy")
+	if _, ok := l.buckets["org:idle"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets = %v, want only org:busy", l.buckets)
+	}
+}
+
+// fakeRateLimitRepository returns fixed results from TakeRateLimitToken
+type fakeRateLimitRepository struct {
+	allowed bool
+	tokens  float64
+	err     error
+
+	key           string
+	ratePerSecond float64
+	burst         int
+}
+
+func (r *fakeRateLimitRepository) TakeRateLimitToken(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, float64, error) {
+	r.key, r.ratePerSecond, r.burst = key, ratePerSecond, burst
+	return r.allowed, r.tokens, r.err
+}
+
+func TestPostgresLimiter(t *testing.T) {
+	repo := &fakeRateLimitRepository{allowed: true, tokens: 4}
+	l := NewPostgresLimiter(repo, 5, 10)
+
+	if allowed, retryAfter := allow(t, l, "org:a"); !allowed || retryAfter != 0 {
+		t.Errorf("allowed request = %v (retry after %v), want allowed", allowed, retryAfter)
+	}
+	if repo.key != "org:a" || repo.ratePerSecond != 5 || repo.burst != 10 {
+		t.Errorf("repository called with %q %v %d, want org:a 5 10", repo.key, repo.ratePerSecond, repo.burst)
+	}
+
+	repo.allowed, repo.tokens = false, 0.5
+	if allowed, retryAfter := allow(t, l, "org:a"); allowed || retryAfter != 100*time.Millisecond {
+		t.Errorf("denied request = %v (retry after %v), want denied for 100ms", allowed, retryAfter)
+	}
+
+	repo.err = errors.New("database is down")
+	if _, _, err := l.Allow(context.Background(), "org:a"); !errors.Is(err, repo.err) {
+		t.Errorf("Allow error = %v, want the repository error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strpe-connect/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores a new in-progress key. It returns false when a
+	// live (unexpired) record already exists for the organization and key, unless
+	// it is an in-progress record for the same request whose lock ran out.
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error)
+	GetIdempotencyKey(ctx context.Context, organizationID, key string) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, organizationID, key string, responseStatus int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, organizationID, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *tenantDB
+}
+
+func NewIdempotencyRepository(db *pgxpool.Pool) IdempotencyRepository {
+	return &idempotencyRepository{db: newTenantDB(db)}
+}
+
+func (r *idempotencyRepository) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	record.Status = models.IdempotencyStatusInProgress
+	record.CreatedAt = time.Now()
+
+	// An expired record is taken over in place so the key becomes usable again,
+	// and so is the claim of a request that died before completing it
+	query := `
+		INSERT INTO tenant_schema.idempotency_keys
+		(organization_id, idempotency_key, request_method, request_path, request_hash, status, created_at, locked_until, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (organization_id, idempotency_key) DO UPDATE
+		SET request_method = EXCLUDED.request_method,
+		    request_path = EXCLUDED.request_path,
+		    request_hash = EXCLUDED.request_hash,
+		    status = EXCLUDED.status,
+		    response_status = NULL,
+		    response_content_type = NULL,
+		    response_body = NULL,
+		    created_at = EXCLUDED.created_at,
+		    locked_until = EXCLUDED.locked_until,
+		    expires_at = EXCLUDED.expires_at
+		WHERE tenant_schema.idempotency_keys.expires_at <= NOW()
+		   OR (tenant_schema.idempotency_keys.status = 'in_progress'
+		       AND tenant_schema.idempotency_keys.locked_until <= NOW()
+		       AND tenant_schema.idempotency_keys.request_hash = EXCLUDED.request_hash)
+	`
+
+	result, err := r.db.Exec(ctx, query,
+		record.OrganizationID, record.Key, record.RequestMethod, record.RequestPath,
+		record.RequestHash, record.Status, record.CreatedAt, record.LockedUntil, record.ExpiresAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *idempotencyRepository) GetIdempotencyKey(ctx context.Context, organizationID, key string) (*models.IdempotencyRecord, error) {
+	record := &models.IdempotencyRecord{}
+
+	query := `
+		SELECT organization_id, idempotency_key, request_method, request_path, request_hash, status,
+		       response_status, response_content_type, response_body, created_at, locked_until, expires_at
+		FROM tenant_schema.idempotency_keys
+		WHERE organization_id = $1 AND idempotency_key = $2
+	`
+
+	err := r.db.QueryRow(ctx, query, organizationID, key).Scan(
+		&record.OrganizationID, &record.Key, &record.RequestMethod, &record.RequestPath, &record.RequestHash,
+		&record.Status, &record.ResponseStatus, &record.ResponseContentType, &record.ResponseBody,
+		&record.CreatedAt, &record.LockedUntil, &record.ExpiresAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("idempotency key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return record, nil
+}
+
+func (r *idempotencyRepository) CompleteIdempotencyKey(ctx context.Context, organizationID, key string, responseStatus int, contentType string, body []byte) error {
+	query := `
+		UPDATE tenant_schema.idempotency_keys
+		SET status = $1, response_status = $2, response_content_type = $3, response_body = $4
+		WHERE organization_id = $5 AND idempotency_key = $6
+	`
+
+	_, err := r.db.Exec(ctx, query, models.IdempotencyStatusCompleted, responseStatus, contentType, body, organizationID, key)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *idempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, organizationID, key string) error {
+	query := `
+		DELETE FROM tenant_schema.idempotency_keys
+		WHERE organization_id = $1 AND idempotency_key = $2 AND status = $3
+	`
+
+	_, err := r.db.Exec(ctx, query, organizationID, key, models.IdempotencyStatusInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *idempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM tenant_schema.idempotency_keys
+		WHERE expires_at <= NOW()
+	`
+
+	result, err := r.db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
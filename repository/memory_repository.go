@@ -0,0 +1,1823 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryRepository is an in-memory StripeConnectRepository for tests and local
+// development. It mirrors the Postgres implementation, including its
+// constraints, the cent precision of DECIMAL(12,2) columns and the ledger
+// entries written by the accounts trigger. Returned records are copies.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	charges sync.Mutex // Serializes ChargeFunctionExecution like the account row lock
+
+	wallets      map[string]*models.DeveloperWallet
+	withdrawals  map[string]*models.WithdrawalRequest
+	transactions map[string]*models.FunctionExecutionTransaction
+	accounts     map[string]*Account
+	ledger       []models.AccountLedgerEntry
+	caps         map[string]*models.SpendingCap
+	webhooks     map[string]*webhookEvent
+	issues       map[string]*models.ReconciliationIssue // Keyed by issue type and Stripe object ID
+	runs         []*models.ReconciliationRun
+	schedules    map[string]*models.PayoutSchedule // Keyed by wallet ID
+	batches      map[string]*models.PayoutBatch
+	batchEntries map[string]*models.PayoutBatchEntry
+	locks        map[string]bool // Advisory locks held
+
+	earningsDaily     []earningsDailyRow
+	refreshedThrough  time.Time
+	rollupInitialized bool
+}
+
+// earningsDailyRow is a row of developer_earnings_daily
+type earningsDailyRow struct {
+	developerOrgID string
+	day            time.Time
+	functionID     string
+	userOrgID      string
+	callCount      int
+	grossAmount    float64
+	platformFees   float64
+	netAmount      float64
+}
+
+// webhookEvent is a row of webhook_events
+type webhookEvent struct {
+	eventType  string
+	status     string
+	attempts   int
+	lastError  *string
+	receivedAt time.Time
+}
+
+var _ StripeConnectRepository = (*MemoryRepository)(nil)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		wallets:      map[string]*models.DeveloperWallet{},
+		withdrawals:  map[string]*models.WithdrawalRequest{},
+		transactions: map[string]*models.FunctionExecutionTransaction{},
+		accounts:     map[string]*Account{},
+		caps:         map[string]*models.SpendingCap{},
+		webhooks:     map[string]*webhookEvent{},
+		issues:       map[string]*models.ReconciliationIssue{},
+		schedules:    map[string]*models.PayoutSchedule{},
+		batches:      map[string]*models.PayoutBatch{},
+		batchEntries: map[string]*models.PayoutBatchEntry{},
+		locks:        map[string]bool{},
+	}
+}
+
+// AddAccount creates a user account, which the Postgres schema leaves to the
+// rest of the platform. Like an INSERT, it does not write a ledger entry.
+func (r *MemoryRepository) AddAccount(organizationID string, balance float64) *Account {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account := &Account{ID: uuid.New().String(), OrganizationID: organizationID, AccountBalance: cents(balance)}
+	r.accounts[account.ID] = account
+	clone := *account
+	return &clone
+}
+
+// AdjustAccountBalance changes a user account balance at a given time, like
+// the rest of the platform does for top-ups and refunds. Like the accounts
+// trigger, it writes a ledger entry of entryType.
+func (r *MemoryRepository) AdjustAccountBalance(organizationID, entryType string, amount float64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, account := range r.accounts {
+		if account.OrganizationID != organizationID {
+			continue
+		}
+		account.AccountBalance = cents(account.AccountBalance + amount)
+		r.ledger = append(r.ledger, models.AccountLedgerEntry{
+			ID:             uuid.New().String(),
+			AccountID:      account.ID,
+			OrganizationID: organizationID,
+			EntryType:      entryType,
+			Amount:         cents(amount),
+			BalanceAfter:   account.AccountBalance,
+			CreatedAt:      at,
+		})
+		return
+	}
+}
+
+// ================================
+// DEVELOPER WALLET OPERATIONS
+// ================================
+
+func (r *MemoryRepository) CreateDeveloperWallet(ctx context.Context, organizationID string) (*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.wallets {
+		if w.OrganizationID == organizationID {
+			return nil, fmt.Errorf("failed to create developer wallet: duplicate organization_id %s", organizationID)
+		}
+	}
+
+	now := time.Now()
+	wallet := &models.DeveloperWallet{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.wallets[wallet.ID] = wallet
+
+	return cloneWallet(wallet), nil
+}
+
+func (r *MemoryRepository) GetDeveloperWalletByOrgID(ctx context.Context, organizationID string) (*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.wallets {
+		if w.OrganizationID == organizationID {
+			return cloneWallet(w), nil
+		}
+	}
+	return nil, apperrors.NotFound("wallet")
+}
+
+func (r *MemoryRepository) GetAllDeveloperWallets(ctx context.Context, filter models.DeveloperFilter, page models.PageRequest) ([]*models.DeveloperWallet, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*models.DeveloperWallet
+	for _, w := range r.wallets {
+		if filter.From != nil && w.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !w.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.OnboardingCompleted != nil && w.OnboardingCompleted != *filter.OnboardingCompleted {
+			continue
+		}
+		if filter.PayoutsEnabled != nil && w.PayoutsEnabled != *filter.PayoutsEnabled {
+			continue
+		}
+		if filter.MinBalance != nil && w.Balance < *filter.MinBalance {
+			continue
+		}
+		if filter.MaxBalance != nil && w.Balance > *filter.MaxBalance {
+			continue
+		}
+		matched = append(matched, w)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return keysetLess(matched[j].CreatedAt, matched[j].ID, matched[i].CreatedAt, matched[i].ID)
+	})
+	total := len(matched)
+
+	wallets := []*models.DeveloperWallet{}
+	for _, i := range paginate(len(matched), page, func(i int) (time.Time, string) { return matched[i].CreatedAt, matched[i].ID }) {
+		wallets = append(wallets, cloneWallet(matched[i]))
+	}
+
+	return wallets, total, nil
+}
+
+func (r *MemoryRepository) GetWalletByID(ctx context.Context, walletID string) (*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return nil, apperrors.NotFound("wallet")
+	}
+	return cloneWallet(w), nil
+}
+
+func (r *MemoryRepository) UpdateStripeConnectAccountID(ctx context.Context, walletID, stripeAccountID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.wallets {
+		if w.ID != walletID && w.StripeConnectAccountID != nil && *w.StripeConnectAccountID == stripeAccountID {
+			return fmt.Errorf("failed to update stripe account ID: duplicate stripe_connect_account_id %s", stripeAccountID)
+		}
+	}
+
+	if w, ok := r.wallets[walletID]; ok {
+		w.StripeConnectAccountID = &stripeAccountID
+		w.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *MemoryRepository) UpdateOnboardingStatus(ctx context.Context, walletID string, completed, payoutsEnabled, chargesEnabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if w, ok := r.wallets[walletID]; ok {
+		w.OnboardingCompleted = completed
+		w.PayoutsEnabled = payoutsEnabled
+		w.ChargesEnabled = chargesEnabled
+		now := time.Now()
+		w.StatusSyncedAt = &now
+		w.UpdatedAt = now
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetWalletsToSync(ctx context.Context, syncedBefore, onboardingSyncedBefore time.Time, limit int) ([]*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var wallets []*models.DeveloperWallet
+	for _, w := range r.wallets {
+		if w.StripeConnectAccountID == nil {
+			continue
+		}
+		onboarding := !(w.OnboardingCompleted && w.PayoutsEnabled)
+		if w.StatusSyncedAt == nil || w.StatusSyncedAt.Before(syncedBefore) || (onboarding && w.StatusSyncedAt.Before(onboardingSyncedBefore)) {
+			wallets = append(wallets, cloneWallet(w))
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		a, b := wallets[i].StatusSyncedAt, wallets[j].StatusSyncedAt
+		switch {
+		case a == nil || b == nil:
+			if a == nil && b == nil {
+				return wallets[i].ID < wallets[j].ID
+			}
+			return a == nil
+		case !a.Equal(*b):
+			return a.Before(*b)
+		}
+		return wallets[i].ID < wallets[j].ID
+	})
+	if len(wallets) > limit {
+		wallets = wallets[:limit]
+	}
+	return wallets, nil
+}
+
+func (r *MemoryRepository) UpdateWalletBalance(ctx context.Context, walletID string, amount float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Same guard as the conditional UPDATE
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return apperrors.NotFound("wallet")
+	}
+	if cents(w.Balance+amount) < w.PendingBalance {
+		return apperrors.ErrInsufficientFunds
+	}
+
+	w.Balance = cents(w.Balance + amount)
+	if amount > 0 {
+		w.TotalEarned = cents(w.TotalEarned + amount)
+	} else {
+		w.TotalWithdrawn = cents(w.TotalWithdrawn - amount)
+	}
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryRepository) UpdateWalletTier(ctx context.Context, walletID string, tier *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return apperrors.NotFound("wallet")
+	}
+	w.Tier = nil
+	if tier != nil {
+		w.Tier = stringPtr(*tier)
+	}
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+// ================================
+// WITHDRAWAL OPERATIONS
+// ================================
+
+func (r *MemoryRepository) CreateWithdrawalRequest(ctx context.Context, withdrawal *models.WithdrawalRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if withdrawal.Amount <= 0 {
+		return fmt.Errorf("failed to create withdrawal request: amount violates check constraint")
+	}
+	wallet, ok := r.wallets[withdrawal.DeveloperWalletID]
+	if !ok {
+		return apperrors.NotFound("wallet")
+	}
+
+	// The mutex plays the part of the wallet row lock
+	available := wallet.Balance - wallet.PendingBalance
+	for _, w := range r.withdrawals {
+		if w.DeveloperWalletID == wallet.ID && reservesBalance(w) {
+			available -= w.Amount
+		}
+	}
+	if cents(available) < cents(withdrawal.Amount) {
+		return apperrors.ErrInsufficientFunds
+	}
+
+	now := time.Now()
+	if withdrawal.ID == "" {
+		withdrawal.ID = uuid.New().String()
+	}
+	withdrawal.RequestedAt = now
+	withdrawal.CreatedAt = now
+	withdrawal.UpdatedAt = now
+
+	clone := *withdrawal
+	clone.Amount = cents(clone.Amount)
+	r.withdrawals[clone.ID] = &clone
+	return nil
+}
+
+func (r *MemoryRepository) GetWithdrawalByID(ctx context.Context, withdrawalID string) (*models.WithdrawalRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.withdrawals[withdrawalID]
+	if !ok {
+		return nil, apperrors.NotFound("withdrawal")
+	}
+	clone := *w
+	return &clone, nil
+}
+
+func (r *MemoryRepository) UpdateWithdrawalStatus(ctx context.Context, withdrawalID, status string, stripeTransferID, stripePayoutID, failureReason *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.withdrawals[withdrawalID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	w.Status = status
+	if stripeTransferID != nil {
+		w.StripeTransferID = stringPtr(*stripeTransferID)
+	}
+	if stripePayoutID != nil {
+		w.StripePayoutID = stringPtr(*stripePayoutID)
+	}
+	if failureReason != nil {
+		w.FailureReason = stringPtr(*failureReason)
+	}
+	if status == models.WithdrawalStatusCompleted || status == models.WithdrawalStatusFailed {
+		w.CompletedAt = &now
+	}
+	w.UpdatedAt = now
+	return nil
+}
+
+func (r *MemoryRepository) RecordWithdrawalTransfer(ctx context.Context, withdrawalID, transferID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	withdrawal, ok := r.withdrawals[withdrawalID]
+	if !ok || withdrawal.StripeTransferID != nil {
+		return nil
+	}
+	wallet, ok := r.wallets[withdrawal.DeveloperWalletID]
+	if !ok || cents(wallet.Balance-withdrawal.Amount) < wallet.PendingBalance {
+		return apperrors.ErrInsufficientFunds
+	}
+
+	now := time.Now()
+	withdrawal.StripeTransferID = stringPtr(transferID)
+	withdrawal.UpdatedAt = now
+	wallet.Balance = cents(wallet.Balance - withdrawal.Amount)
+	wallet.TotalWithdrawn = cents(wallet.TotalWithdrawn + withdrawal.Amount)
+	wallet.UpdatedAt = now
+	return nil
+}
+
+func (r *MemoryRepository) GetWithdrawalsByOrgID(ctx context.Context, organizationID string, filter models.WithdrawalFilter, page models.PageRequest) ([]*models.WithdrawalRequest, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*models.WithdrawalRequest
+	for _, w := range r.withdrawals {
+		if w.OrganizationID != organizationID {
+			continue
+		}
+		if filter.From != nil && w.RequestedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !w.RequestedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.Status != "" && w.Status != filter.Status {
+			continue
+		}
+		if filter.MinAmount != nil && w.Amount < *filter.MinAmount {
+			continue
+		}
+		if filter.MaxAmount != nil && w.Amount > *filter.MaxAmount {
+			continue
+		}
+		matched = append(matched, w)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return keysetLess(matched[j].RequestedAt, matched[j].ID, matched[i].RequestedAt, matched[i].ID)
+	})
+	total := len(matched)
+
+	var withdrawals []*models.WithdrawalRequest
+	for _, i := range paginate(len(matched), page, func(i int) (time.Time, string) { return matched[i].RequestedAt, matched[i].ID }) {
+		clone := *matched[i]
+		withdrawals = append(withdrawals, &clone)
+	}
+
+	return withdrawals, total, nil
+}
+
+func (r *MemoryRepository) GetWithdrawalsToRetry(ctx context.Context, updatedBefore time.Time, limit int) ([]*models.WithdrawalRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var withdrawals []*models.WithdrawalRequest
+	for _, w := range r.withdrawals {
+		if (w.Status == models.WithdrawalStatusPending || w.Status == models.WithdrawalStatusProcessing) && w.UpdatedAt.Before(updatedBefore) {
+			clone := *w
+			withdrawals = append(withdrawals, &clone)
+		}
+	}
+	sort.Slice(withdrawals, func(i, j int) bool {
+		if !withdrawals[i].UpdatedAt.Equal(withdrawals[j].UpdatedAt) {
+			return withdrawals[i].UpdatedAt.Before(withdrawals[j].UpdatedAt)
+		}
+		return withdrawals[i].ID < withdrawals[j].ID
+	})
+	if len(withdrawals) > limit {
+		withdrawals = withdrawals[:limit]
+	}
+	return withdrawals, nil
+}
+
+func (r *MemoryRepository) GetPendingWithdrawalsTotal(ctx context.Context, walletID string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total float64
+	for _, w := range r.withdrawals {
+		if w.DeveloperWalletID == walletID && reservesBalance(w) {
+			total += w.Amount
+		}
+	}
+	return cents(total), nil
+}
+
+func (r *MemoryRepository) HasWithdrawalsInFlight(ctx context.Context, walletID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, w := range r.withdrawals {
+		if w.DeveloperWalletID == walletID && (w.Status == models.WithdrawalStatusPending || w.Status == models.WithdrawalStatusProcessing) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reservesBalance reports whether w holds back part of its wallet's balance: it
+// is pending or processing and its amount was not yet deducted with the transfer
+func reservesBalance(w *models.WithdrawalRequest) bool {
+	return (w.Status == models.WithdrawalStatusPending || w.Status == models.WithdrawalStatusProcessing) && w.StripeTransferID == nil
+}
+
+func (r *MemoryRepository) GetWithdrawalQueueStats(ctx context.Context) (*models.QueueStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := &models.QueueStats{}
+	for _, w := range r.withdrawals {
+		if w.Status == models.WithdrawalStatusPending || w.Status == models.WithdrawalStatusProcessing {
+			stats.Count++
+			stats.OldestAt = earliest(stats.OldestAt, w.RequestedAt)
+		}
+	}
+	return stats, nil
+}
+
+func (r *MemoryRepository) GetLiabilities(ctx context.Context) (*models.Liabilities, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	liabilities := &models.Liabilities{}
+	for _, wallet := range r.wallets {
+		liabilities.WalletBalance += wallet.Balance
+	}
+	for _, w := range r.withdrawals {
+		if reservesBalance(w) {
+			liabilities.PendingWithdrawalAmount += w.Amount
+			liabilities.PendingWithdrawalCount++
+		}
+	}
+	for _, account := range r.accounts {
+		liabilities.UserPrepaidBalance += account.AccountBalance
+	}
+	for _, tx := range r.transactions {
+		if tx.Status == models.TransactionStatusCompleted {
+			liabilities.PlatformRevenue += tx.PlatformFee
+		}
+	}
+	liabilities.WalletBalance = cents(liabilities.WalletBalance)
+	liabilities.PendingWithdrawalAmount = cents(liabilities.PendingWithdrawalAmount)
+	liabilities.UserPrepaidBalance = cents(liabilities.UserPrepaidBalance)
+	liabilities.PlatformRevenue = cents(liabilities.PlatformRevenue)
+	return liabilities, nil
+}
+
+// ================================
+// TRANSACTION OPERATIONS
+// ================================
+
+func (r *MemoryRepository) ChargeFunctionExecution(ctx context.Context, tx *models.FunctionExecutionTransaction, check func(ctx context.Context, spent SpendReader) error) error {
+	r.charges.Lock()
+	defer r.charges.Unlock()
+
+	if err := r.checkAccountBalance(tx); err != nil {
+		return err
+	}
+	if check != nil {
+		spent := func(ctx context.Context, functionID *string, since time.Time) (float64, error) {
+			return r.GetUserOrgSpendSince(ctx, tx.UserOrganizationID, functionID, since)
+		}
+		if err := check(ctx, spent); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tx.ID == "" {
+		tx.ID = uuid.New().String()
+	}
+	if _, ok := r.transactions[tx.ID]; ok {
+		return fmt.Errorf("failed to create transaction: duplicate id %s", tx.ID)
+	}
+	account, ok := r.accounts[tx.UserAccountID]
+	if !ok {
+		return apperrors.NotFound("account")
+	}
+	if account.AccountBalance < tx.Amount {
+		return apperrors.ErrInsufficientFunds
+	}
+	wallet, ok := r.wallets[tx.DeveloperWalletID]
+	if !ok {
+		return fmt.Errorf("failed to create transaction: developer wallet %s does not exist", tx.DeveloperWalletID)
+	}
+
+	now := time.Now()
+	account.AccountBalance = cents(account.AccountBalance - tx.Amount)
+	r.ledger = append(r.ledger, models.AccountLedgerEntry{
+		ID:             uuid.New().String(),
+		AccountID:      account.ID,
+		OrganizationID: account.OrganizationID,
+		EntryType:      models.LedgerEntryCharge,
+		Amount:         -cents(tx.Amount),
+		BalanceAfter:   account.AccountBalance,
+		ReferenceID:    stringPtr(tx.ID),
+		CreatedAt:      now,
+	})
+
+	tx.ExecutedAt = now
+	tx.CreatedAt = now
+	tx.UpdatedAt = now
+	if tx.AvailableAt.IsZero() {
+		tx.AvailableAt = now
+	}
+
+	clone := *tx
+	clone.Amount = cents(clone.Amount)
+	clone.PlatformFee = cents(clone.PlatformFee)
+	clone.NetAmount = cents(clone.NetAmount)
+	clone.FunctionName = nil
+	r.transactions[clone.ID] = &clone
+
+	wallet.Balance = cents(wallet.Balance + clone.NetAmount)
+	wallet.TotalEarned = cents(wallet.TotalEarned + clone.NetAmount)
+	if clone.ReleasedAt == nil {
+		wallet.PendingBalance = cents(wallet.PendingBalance + clone.NetAmount)
+	}
+	wallet.UpdatedAt = now
+	return nil
+}
+
+// checkAccountBalance fails like the locked account read of the Postgres charge
+func (r *MemoryRepository) checkAccountBalance(tx *models.FunctionExecutionTransaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, ok := r.accounts[tx.UserAccountID]
+	if !ok {
+		return apperrors.NotFound("account")
+	}
+	if account.AccountBalance < tx.Amount {
+		return apperrors.ErrInsufficientFunds
+	}
+	return nil
+}
+
+// BackdateTransaction moves the execution time of a payment, as for a payment
+// recorded after it ran
+func (r *MemoryRepository) BackdateTransaction(transactionID string, executedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tx, ok := r.transactions[transactionID]; ok {
+		tx.ExecutedAt = executedAt
+	}
+}
+
+func (r *MemoryRepository) ReleaseClearedEarnings(ctx context.Context, now time.Time) (int, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var released int
+	var amount float64
+	releasedAt := time.Now()
+	for _, tx := range r.transactions {
+		if tx.ReleasedAt != nil || tx.AvailableAt.After(now) {
+			continue
+		}
+		at := releasedAt
+		tx.ReleasedAt = &at
+		tx.UpdatedAt = releasedAt
+		if wallet, ok := r.wallets[tx.DeveloperWalletID]; ok {
+			wallet.PendingBalance = math.Max(cents(wallet.PendingBalance-tx.NetAmount), 0)
+			wallet.UpdatedAt = releasedAt
+		}
+		released++
+		amount += tx.NetAmount
+	}
+	return released, cents(amount), nil
+}
+
+func (r *MemoryRepository) GetTransactionsByDeveloperOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	return r.listTransactions(func(tx *models.FunctionExecutionTransaction) (string, string) {
+		return tx.DeveloperOrganizationID, tx.UserOrganizationID
+	}, orgID, filter, page)
+}
+
+func (r *MemoryRepository) GetTransactionsByUserOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	return r.listTransactions(func(tx *models.FunctionExecutionTransaction) (string, string) {
+		return tx.UserOrganizationID, tx.DeveloperOrganizationID
+	}, orgID, filter, page)
+}
+
+// listTransactions lists transactions owned by orgID, sides returns the owner
+// and counterparty organizations of a transaction
+func (r *MemoryRepository) listTransactions(sides func(*models.FunctionExecutionTransaction) (string, string), orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*models.FunctionExecutionTransaction
+	for _, tx := range r.transactions {
+		owner, counterparty := sides(tx)
+		if owner != orgID {
+			continue
+		}
+		if filter.From != nil && tx.ExecutedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !tx.ExecutedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.Status != "" && tx.Status != filter.Status {
+			continue
+		}
+		if filter.FunctionID != "" && tx.FunctionID != filter.FunctionID {
+			continue
+		}
+		if filter.CounterpartyOrgID != "" && counterparty != filter.CounterpartyOrgID {
+			continue
+		}
+		if filter.MinAmount != nil && tx.Amount < *filter.MinAmount {
+			continue
+		}
+		if filter.MaxAmount != nil && tx.Amount > *filter.MaxAmount {
+			continue
+		}
+		matched = append(matched, tx)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return keysetLess(matched[j].ExecutedAt, matched[j].ID, matched[i].ExecutedAt, matched[i].ID)
+	})
+	total := len(matched)
+
+	var transactions []*models.FunctionExecutionTransaction
+	for _, i := range paginate(len(matched), page, func(i int) (time.Time, string) { return matched[i].ExecutedAt, matched[i].ID }) {
+		clone := *matched[i]
+		transactions = append(transactions, &clone)
+	}
+
+	return transactions, total, nil
+}
+
+func (r *MemoryRepository) GetTransactionByID(ctx context.Context, transactionID string) (*models.FunctionExecutionTransaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx, ok := r.transactions[transactionID]
+	if !ok {
+		return nil, apperrors.NotFound("transaction")
+	}
+	clone := *tx
+	return &clone, nil
+}
+
+func (r *MemoryRepository) GetConnectedDevelopersByUserOrg(ctx context.Context, userOrgID string) ([]*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paid := map[string]float64{}
+	for _, tx := range r.transactions {
+		if tx.UserOrganizationID == userOrgID {
+			paid[tx.DeveloperOrganizationID] += tx.Amount
+		}
+	}
+
+	wallets := []*models.DeveloperWallet{}
+	for _, w := range r.wallets {
+		if _, ok := paid[w.OrganizationID]; ok {
+			wallets = append(wallets, cloneWallet(w))
+		}
+	}
+	sort.SliceStable(wallets, func(i, j int) bool {
+		return paid[wallets[i].OrganizationID] > paid[wallets[j].OrganizationID]
+	})
+
+	return wallets, nil
+}
+
+// ================================
+// ACCOUNT OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetAccountByOrgID(ctx context.Context, orgID string) (*Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range r.accounts {
+		if a.OrganizationID == orgID {
+			clone := *a
+			return &clone, nil
+		}
+	}
+	return nil, apperrors.NotFound("account")
+}
+
+// ================================
+// BILLING OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetUserOrgSpendByFunction(ctx context.Context, userOrgID string, from, to time.Time) ([]models.FunctionSpend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type key struct{ functionID, developerOrgID string }
+	byKey := map[key]*models.FunctionSpend{}
+	for _, tx := range r.completedSpend(userOrgID, from, to) {
+		k := key{tx.FunctionID, tx.DeveloperOrganizationID}
+		if byKey[k] == nil {
+			byKey[k] = &models.FunctionSpend{FunctionID: tx.FunctionID, DeveloperOrganizationID: tx.DeveloperOrganizationID}
+		}
+		byKey[k].CallCount++
+		byKey[k].TotalAmount = cents(byKey[k].TotalAmount + tx.Amount)
+	}
+
+	spend := []models.FunctionSpend{}
+	for _, fs := range byKey {
+		spend = append(spend, *fs)
+	}
+	sort.Slice(spend, func(i, j int) bool { return spend[i].TotalAmount > spend[j].TotalAmount })
+
+	return spend, nil
+}
+
+func (r *MemoryRepository) GetUserOrgSpendByDeveloper(ctx context.Context, userOrgID string, from, to time.Time) ([]models.DeveloperSpend, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byDeveloper := map[string]*models.DeveloperSpend{}
+	functions := map[string]map[string]bool{}
+	for _, tx := range r.completedSpend(userOrgID, from, to) {
+		ds := byDeveloper[tx.DeveloperOrganizationID]
+		if ds == nil {
+			ds = &models.DeveloperSpend{DeveloperOrganizationID: tx.DeveloperOrganizationID}
+			byDeveloper[tx.DeveloperOrganizationID] = ds
+			functions[tx.DeveloperOrganizationID] = map[string]bool{}
+		}
+		functions[tx.DeveloperOrganizationID][tx.FunctionID] = true
+		ds.FunctionCount = len(functions[tx.DeveloperOrganizationID])
+		ds.CallCount++
+		ds.TotalAmount = cents(ds.TotalAmount + tx.Amount)
+	}
+
+	spend := []models.DeveloperSpend{}
+	for _, ds := range byDeveloper {
+		spend = append(spend, *ds)
+	}
+	sort.Slice(spend, func(i, j int) bool { return spend[i].TotalAmount > spend[j].TotalAmount })
+
+	return spend, nil
+}
+
+// completedSpend returns completed payments by userOrgID executed in [from, to)
+func (r *MemoryRepository) completedSpend(userOrgID string, from, to time.Time) []*models.FunctionExecutionTransaction {
+	var spend []*models.FunctionExecutionTransaction
+	for _, tx := range r.transactions {
+		if tx.UserOrganizationID == userOrgID && tx.Status == models.TransactionStatusCompleted &&
+			!tx.ExecutedAt.Before(from) && tx.ExecutedAt.Before(to) {
+			spend = append(spend, tx)
+		}
+	}
+	return spend
+}
+
+func (r *MemoryRepository) GetAccountLedgerSummary(ctx context.Context, orgID string, periodStart, periodEnd time.Time) (*models.AccountLedgerSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := &models.AccountLedgerSummary{}
+	for _, e := range r.ledger {
+		if e.OrganizationID != orgID || e.CreatedAt.Before(periodStart) {
+			continue
+		}
+
+		summary.NetSinceStart += e.Amount
+		if !e.CreatedAt.Before(periodEnd) {
+			summary.NetSinceEnd += e.Amount
+			continue
+		}
+
+		switch e.EntryType {
+		case models.LedgerEntryTopUp:
+			summary.TopUps += e.Amount
+		case models.LedgerEntryCharge:
+			summary.Charges -= e.Amount
+		case models.LedgerEntryRefund:
+			summary.Refunds += e.Amount
+		case models.LedgerEntryAdjustment:
+			summary.Adjustments += e.Amount
+		}
+	}
+
+	summary.NetSinceStart = cents(summary.NetSinceStart)
+	summary.NetSinceEnd = cents(summary.NetSinceEnd)
+	summary.TopUps = cents(summary.TopUps)
+	summary.Charges = cents(summary.Charges)
+	summary.Refunds = cents(summary.Refunds)
+	summary.Adjustments = cents(summary.Adjustments)
+
+	return summary, nil
+}
+
+// ================================
+// ANALYTICS OPERATIONS
+// ================================
+
+// RefreshEarningsRollup rebuilds whole UTC days from the previous watermark, with
+// the same five minute lag as the Postgres implementation
+func (r *MemoryRepository) RefreshEarningsRollup(ctx context.Context) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refreshedThrough := time.Now().Add(-5 * time.Minute)
+	refreshFrom := utcDay(r.refreshedThrough)
+
+	rows := r.earningsDaily[:0]
+	for _, row := range r.earningsDaily {
+		if row.day.Before(refreshFrom) {
+			rows = append(rows, row)
+		}
+	}
+
+	type key struct {
+		developerOrgID string
+		day            time.Time
+		functionID     string
+		userOrgID      string
+	}
+	rebuilt := map[key]*earningsDailyRow{}
+	for _, tx := range r.transactions {
+		if tx.Status != models.TransactionStatusCompleted || tx.ExecutedAt.Before(refreshFrom) || !tx.ExecutedAt.Before(refreshedThrough) {
+			continue
+		}
+		k := key{tx.DeveloperOrganizationID, utcDay(tx.ExecutedAt), tx.FunctionID, tx.UserOrganizationID}
+		row := rebuilt[k]
+		if row == nil {
+			row = &earningsDailyRow{developerOrgID: k.developerOrgID, day: k.day, functionID: k.functionID, userOrgID: k.userOrgID}
+			rebuilt[k] = row
+		}
+		row.callCount++
+		row.grossAmount = cents(row.grossAmount + tx.Amount)
+		row.platformFees = cents(row.platformFees + tx.PlatformFee)
+		row.netAmount = cents(row.netAmount + tx.NetAmount)
+	}
+	for _, row := range rebuilt {
+		rows = append(rows, *row)
+	}
+
+	r.earningsDaily = rows
+	r.refreshedThrough = refreshedThrough
+	r.rollupInitialized = true
+
+	return refreshedThrough, nil
+}
+
+func (r *MemoryRepository) GetEarningsRollupWatermark(ctx context.Context) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.rollupInitialized {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	return r.refreshedThrough, nil
+}
+
+func (r *MemoryRepository) GetEarningsTotals(ctx context.Context, developerOrgID string, from, to time.Time) (*models.EarningsTotals, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := &earningsAccumulator{}
+	for _, row := range r.earningsRows(developerOrgID, from, to) {
+		totals.add(row)
+	}
+	result := totals.totals()
+	return &result, nil
+}
+
+func (r *MemoryRepository) GetEarningsSeries(ctx context.Context, developerOrgID, granularity string, from, to time.Time) ([]models.EarningsBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets := map[time.Time]*earningsAccumulator{}
+	for _, row := range r.earningsRows(developerOrgID, from, to) {
+		start := truncateDay(row.day, granularity)
+		if buckets[start] == nil {
+			buckets[start] = &earningsAccumulator{}
+		}
+		buckets[start].add(row)
+	}
+
+	series := []models.EarningsBucket{}
+	for start, acc := range buckets {
+		series = append(series, models.EarningsBucket{BucketStart: start, EarningsTotals: acc.totals()})
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].BucketStart.Before(series[j].BucketStart) })
+
+	return series, nil
+}
+
+func (r *MemoryRepository) GetEarningsByFunction(ctx context.Context, developerOrgID string, from, to time.Time) ([]models.FunctionEarnings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byFunction := map[string]*earningsAccumulator{}
+	for _, row := range r.earningsRows(developerOrgID, from, to) {
+		if byFunction[row.functionID] == nil {
+			byFunction[row.functionID] = &earningsAccumulator{}
+		}
+		byFunction[row.functionID].add(row)
+	}
+
+	earnings := []models.FunctionEarnings{}
+	for functionID, acc := range byFunction {
+		earnings = append(earnings, models.FunctionEarnings{FunctionID: functionID, EarningsTotals: acc.totals()})
+	}
+	sort.Slice(earnings, func(i, j int) bool { return earnings[i].NetAmount > earnings[j].NetAmount })
+
+	return earnings, nil
+}
+
+// earningsRows returns rollup rows of a developer for the UTC days in [from, to)
+func (r *MemoryRepository) earningsRows(developerOrgID string, from, to time.Time) []earningsDailyRow {
+	fromDay, toDay := utcDay(from), utcDay(to)
+
+	var rows []earningsDailyRow
+	for _, row := range r.earningsDaily {
+		if row.developerOrgID == developerOrgID && !row.day.Before(fromDay) && row.day.Before(toDay) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// earningsAccumulator sums rollup rows and counts distinct paying organizations
+type earningsAccumulator struct {
+	sum      models.EarningsTotals
+	userOrgs map[string]bool
+}
+
+func (a *earningsAccumulator) add(row earningsDailyRow) {
+	if a.userOrgs == nil {
+		a.userOrgs = map[string]bool{}
+	}
+	a.userOrgs[row.userOrgID] = true
+	a.sum.CallCount += row.callCount
+	a.sum.GrossAmount = cents(a.sum.GrossAmount + row.grossAmount)
+	a.sum.PlatformFees = cents(a.sum.PlatformFees + row.platformFees)
+	a.sum.NetAmount = cents(a.sum.NetAmount + row.netAmount)
+}
+
+func (a *earningsAccumulator) totals() models.EarningsTotals {
+	totals := a.sum
+	totals.UniquePayingOrgs = len(a.userOrgs)
+	return totals
+}
+
+// ================================
+// SPENDING CAP OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetSpendingCapsByOrgID(ctx context.Context, orgID string) ([]*models.SpendingCap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	caps := []*models.SpendingCap{}
+	for _, c := range r.caps {
+		if c.OrganizationID == orgID {
+			clone := *c
+			caps = append(caps, &clone)
+		}
+	}
+
+	// Caps for all functions first, like ORDER BY function_id NULLS FIRST, period
+	sort.Slice(caps, func(i, j int) bool {
+		if (caps[i].FunctionID == nil) != (caps[j].FunctionID == nil) {
+			return caps[i].FunctionID == nil
+		}
+		if caps[i].FunctionID != nil && *caps[i].FunctionID != *caps[j].FunctionID {
+			return *caps[i].FunctionID < *caps[j].FunctionID
+		}
+		return caps[i].Period < caps[j].Period
+	})
+
+	return caps, nil
+}
+
+func (r *MemoryRepository) UpsertSpendingCap(ctx context.Context, spendingCap *models.SpendingCap) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if spendingCap.LimitAmount <= 0 {
+		return fmt.Errorf("failed to save spending cap: limit_amount violates check constraint")
+	}
+
+	now := time.Now()
+	for _, c := range r.caps {
+		if c.OrganizationID == spendingCap.OrganizationID && c.Period == spendingCap.Period &&
+			stringValue(c.FunctionID) == stringValue(spendingCap.FunctionID) {
+			c.LimitAmount = cents(spendingCap.LimitAmount)
+			c.UpdatedAt = now
+			spendingCap.ID, spendingCap.CreatedAt, spendingCap.UpdatedAt = c.ID, c.CreatedAt, c.UpdatedAt
+			return nil
+		}
+	}
+
+	spendingCap.ID = uuid.New().String()
+	spendingCap.CreatedAt = now
+	spendingCap.UpdatedAt = now
+
+	clone := *spendingCap
+	clone.LimitAmount = cents(clone.LimitAmount)
+	r.caps[clone.ID] = &clone
+	return nil
+}
+
+func (r *MemoryRepository) DeleteSpendingCap(ctx context.Context, capID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.caps[capID]; !ok {
+		return apperrors.NotFound("spending cap")
+	}
+	delete(r.caps, capID)
+	return nil
+}
+
+func (r *MemoryRepository) GetUserOrgSpendSince(ctx context.Context, userOrgID string, functionID *string, since time.Time) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total float64
+	for _, tx := range r.transactions {
+		if tx.UserOrganizationID != userOrgID || tx.Status != models.TransactionStatusCompleted || tx.ExecutedAt.Before(since) {
+			continue
+		}
+		if functionID != nil && tx.FunctionID != *functionID {
+			continue
+		}
+		total += tx.Amount
+	}
+	return cents(total), nil
+}
+
+// ================================
+// PAYOUT SCHEDULE OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetPayoutSchedule(ctx context.Context, walletID string) (*models.PayoutSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedule, ok := r.schedules[walletID]
+	if !ok {
+		return nil, apperrors.NotFound("payout schedule")
+	}
+	return r.clonePayoutSchedule(schedule), nil
+}
+
+func (r *MemoryRepository) UpsertPayoutSchedule(ctx context.Context, schedule *models.PayoutSchedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.wallets[schedule.DeveloperWalletID]; !ok {
+		return fmt.Errorf("failed to save payout schedule: violates foreign key constraint fk_payout_schedule_wallet")
+	}
+	if schedule.Threshold < 0 || schedule.Reserve < 0 {
+		return fmt.Errorf("failed to save payout schedule: threshold or reserve violates check constraint")
+	}
+
+	now := time.Now()
+	clone := *schedule
+	clone.Threshold = cents(clone.Threshold)
+	clone.Reserve = cents(clone.Reserve)
+	clone.CreatedAt = now
+	clone.UpdatedAt = now
+	if existing, ok := r.schedules[schedule.DeveloperWalletID]; ok {
+		clone.LastRunAt, clone.LastWithdrawalID, clone.LastError = existing.LastRunAt, existing.LastWithdrawalID, existing.LastError
+		clone.CreatedAt = existing.CreatedAt
+	}
+	r.schedules[clone.DeveloperWalletID] = r.clonePayoutSchedule(&clone)
+
+	schedule.LastRunAt, schedule.LastWithdrawalID, schedule.LastError = clone.LastRunAt, clone.LastWithdrawalID, clone.LastError
+	schedule.CreatedAt, schedule.UpdatedAt = clone.CreatedAt, clone.UpdatedAt
+	return nil
+}
+
+func (r *MemoryRepository) GetDuePayoutSchedules(ctx context.Context, now time.Time, limit int) ([]*models.PayoutSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedules := []*models.PayoutSchedule{}
+	for _, schedule := range r.schedules {
+		if schedule.NextRunAt != nil && !schedule.NextRunAt.After(now) {
+			schedules = append(schedules, r.clonePayoutSchedule(schedule))
+		}
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].NextRunAt.Equal(*schedules[j].NextRunAt) {
+			return schedules[i].NextRunAt.Before(*schedules[j].NextRunAt)
+		}
+		return schedules[i].DeveloperWalletID < schedules[j].DeveloperWalletID
+	})
+	if len(schedules) > limit {
+		schedules = schedules[:limit]
+	}
+
+	return schedules, nil
+}
+
+func (r *MemoryRepository) RecordPayoutRun(ctx context.Context, walletID string, ranAt time.Time, nextRunAt *time.Time, withdrawalID, lastError *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	schedule, ok := r.schedules[walletID]
+	if !ok {
+		return apperrors.NotFound("payout schedule")
+	}
+
+	schedule.LastRunAt = &ranAt
+	schedule.NextRunAt = cloneTime(nextRunAt)
+	if withdrawalID != nil {
+		schedule.LastWithdrawalID = stringPtr(*withdrawalID)
+	}
+	schedule.LastError = nil
+	if lastError != nil {
+		schedule.LastError = stringPtr(*lastError)
+	}
+	schedule.UpdatedAt = time.Now()
+	return nil
+}
+
+// clonePayoutSchedule copies schedule with the organization of its wallet,
+// like the join of the Postgres queries
+func (r *MemoryRepository) clonePayoutSchedule(schedule *models.PayoutSchedule) *models.PayoutSchedule {
+	clone := *schedule
+	if wallet, ok := r.wallets[schedule.DeveloperWalletID]; ok {
+		clone.OrganizationID = wallet.OrganizationID
+	}
+	if schedule.Weekday != nil {
+		weekday := *schedule.Weekday
+		clone.Weekday = &weekday
+	}
+	if schedule.DayOfMonth != nil {
+		day := *schedule.DayOfMonth
+		clone.DayOfMonth = &day
+	}
+	clone.NextRunAt = cloneTime(schedule.NextRunAt)
+	clone.LastRunAt = cloneTime(schedule.LastRunAt)
+	if schedule.LastWithdrawalID != nil {
+		clone.LastWithdrawalID = stringPtr(*schedule.LastWithdrawalID)
+	}
+	if schedule.LastError != nil {
+		clone.LastError = stringPtr(*schedule.LastError)
+	}
+	return &clone
+}
+
+// ================================
+// PAYOUT BATCH OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetPayoutCandidates(ctx context.Context, cutoff time.Time, minimum float64) ([]*models.PayoutBatchEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type candidate struct {
+		entry   *models.PayoutBatchEntry
+		payable float64
+	}
+	var candidates []candidate
+	for _, wallet := range r.wallets {
+		if !wallet.OnboardingCompleted || !wallet.PayoutsEnabled || wallet.StripeConnectAccountID == nil {
+			continue
+		}
+
+		threshold := minimum
+		payable := wallet.Balance - wallet.PendingBalance
+		if schedule, ok := r.schedules[wallet.ID]; ok {
+			threshold = math.Max(schedule.Threshold, minimum)
+			payable -= schedule.Reserve
+		}
+		for _, w := range r.withdrawals {
+			if w.DeveloperWalletID == wallet.ID && reservesBalance(w) {
+				payable -= w.Amount
+			}
+		}
+		for _, tx := range r.transactions {
+			if tx.DeveloperWalletID == wallet.ID && tx.ReleasedAt != nil && tx.AvailableAt.After(cutoff) {
+				payable -= tx.NetAmount
+			}
+		}
+
+		payable = cents(payable)
+		amount := math.Floor(payable*100+1e-6) / 100
+		if amount < threshold {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			entry: &models.PayoutBatchEntry{
+				DeveloperWalletID: wallet.ID,
+				OrganizationID:    wallet.OrganizationID,
+				Amount:            amount,
+				Status:            models.PayoutBatchEntryPending,
+			},
+			payable: payable,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].payable != candidates[j].payable {
+			return candidates[i].payable > candidates[j].payable
+		}
+		return candidates[i].entry.OrganizationID < candidates[j].entry.OrganizationID
+	})
+
+	entries := []*models.PayoutBatchEntry{}
+	for _, c := range candidates {
+		entries = append(entries, c.entry)
+	}
+	return entries, nil
+}
+
+func (r *MemoryRepository) CreatePayoutBatch(ctx context.Context, batch *models.PayoutBatch, entries []*models.PayoutBatchEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Amount <= 0 {
+			return fmt.Errorf("failed to create payout batch entry: amount violates check constraint")
+		}
+		if _, ok := r.wallets[entry.DeveloperWalletID]; !ok {
+			return fmt.Errorf("failed to create payout batch entry: violates foreign key constraint fk_payout_batch_entry_wallet")
+		}
+		if seen[entry.DeveloperWalletID] {
+			return fmt.Errorf("failed to create payout batch entry: violates unique constraint uq_payout_batch_entry_wallet")
+		}
+		seen[entry.DeveloperWalletID] = true
+	}
+
+	now := time.Now()
+	batch.ID = uuid.New().String()
+	batch.Status = models.PayoutBatchStatusDraft
+	batch.CreatedAt = now
+	batch.UpdatedAt = now
+	clone := *batch
+	r.batches[batch.ID] = &clone
+
+	for _, entry := range entries {
+		entry.ID = uuid.New().String()
+		entry.BatchID = batch.ID
+		entry.Status = models.PayoutBatchEntryPending
+		entry.CreatedAt = now
+		entry.UpdatedAt = now
+		clone := *entry
+		clone.Amount = cents(clone.Amount)
+		clone.WithdrawalStatus = nil
+		r.batchEntries[entry.ID] = &clone
+	}
+	return nil
+}
+
+func (r *MemoryRepository) GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch, ok := r.batches[batchID]
+	if !ok {
+		return nil, apperrors.NotFound("payout batch")
+	}
+	return clonePayoutBatch(batch), nil
+}
+
+func (r *MemoryRepository) GetPayoutBatches(ctx context.Context, page models.PageRequest) ([]*models.PayoutBatch, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*models.PayoutBatch
+	for _, batch := range r.batches {
+		matched = append(matched, batch)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return keysetLess(matched[j].CreatedAt, matched[j].ID, matched[i].CreatedAt, matched[i].ID)
+	})
+
+	var batches []*models.PayoutBatch
+	for _, i := range paginate(len(matched), page, func(i int) (time.Time, string) { return matched[i].CreatedAt, matched[i].ID }) {
+		batches = append(batches, clonePayoutBatch(matched[i]))
+	}
+
+	return batches, len(matched), nil
+}
+
+func (r *MemoryRepository) GetPayoutBatchEntries(ctx context.Context, batchID string) ([]*models.PayoutBatchEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []*models.PayoutBatchEntry{}
+	for _, entry := range r.batchEntries {
+		if entry.BatchID != batchID {
+			continue
+		}
+		clone := *entry
+		clone.WithdrawalStatus = nil
+		if entry.WithdrawalID != nil {
+			clone.WithdrawalID = stringPtr(*entry.WithdrawalID)
+			if w, ok := r.withdrawals[*entry.WithdrawalID]; ok {
+				clone.WithdrawalStatus = stringPtr(w.Status)
+			}
+		}
+		if entry.Error != nil {
+			clone.Error = stringPtr(*entry.Error)
+		}
+		entries = append(entries, &clone)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Amount != entries[j].Amount {
+			return entries[i].Amount > entries[j].Amount
+		}
+		return entries[i].OrganizationID < entries[j].OrganizationID
+	})
+	return entries, nil
+}
+
+func (r *MemoryRepository) SetPayoutBatchEntriesExcluded(ctx context.Context, batchID string, entryIDs []string, excluded bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch, ok := r.batches[batchID]
+	if !ok || batch.Status != models.PayoutBatchStatusDraft {
+		return 0, nil
+	}
+
+	var updated int
+	for _, id := range entryIDs {
+		entry, ok := r.batchEntries[id]
+		if !ok || entry.BatchID != batchID {
+			continue
+		}
+		entry.Excluded = excluded
+		entry.UpdatedAt = time.Now()
+		updated++
+	}
+	return updated, nil
+}
+
+func (r *MemoryRepository) TransitionPayoutBatch(ctx context.Context, batchID, from, to string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch, ok := r.batches[batchID]
+	if !ok || batch.Status != from {
+		return false, nil
+	}
+
+	now := time.Now()
+	batch.Status = to
+	if to == models.PayoutBatchStatusExecuting && batch.ExecutedAt == nil {
+		batch.ExecutedAt = &now
+	}
+	if to == models.PayoutBatchStatusCompleted {
+		batch.CompletedAt = &now
+	}
+	batch.UpdatedAt = now
+	return true, nil
+}
+
+func (r *MemoryRepository) RecordPayoutBatchEntry(ctx context.Context, entryID, status string, withdrawalID, errorMessage *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.batchEntries[entryID]
+	if !ok {
+		return apperrors.NotFound("payout batch entry")
+	}
+
+	entry.Status = status
+	entry.WithdrawalID = nil
+	if withdrawalID != nil {
+		entry.WithdrawalID = stringPtr(*withdrawalID)
+	}
+	entry.Error = nil
+	if errorMessage != nil {
+		entry.Error = stringPtr(*errorMessage)
+	}
+	entry.UpdatedAt = time.Now()
+	return nil
+}
+
+func clonePayoutBatch(batch *models.PayoutBatch) *models.PayoutBatch {
+	clone := *batch
+	clone.ExecutedAt = cloneTime(batch.ExecutedAt)
+	clone.CompletedAt = cloneTime(batch.CompletedAt)
+	return &clone
+}
+
+// ================================
+// ADVISORY LOCKS
+// ================================
+
+func (r *MemoryRepository) WithAdvisoryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	r.mu.Lock()
+	if r.locks[name] {
+		r.mu.Unlock()
+		return false, nil
+	}
+	r.locks[name] = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.locks, name)
+		r.mu.Unlock()
+	}()
+
+	return true, fn(ctx)
+}
+
+// ================================
+// WEBHOOK INBOX OPERATIONS
+// ================================
+
+func (r *MemoryRepository) RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.webhooks[eventID]
+	if !ok {
+		r.webhooks[eventID] = &webhookEvent{
+			eventType:  eventType,
+			status:     models.WebhookEventStatusReceived,
+			attempts:   1,
+			receivedAt: time.Now(),
+		}
+		return true, nil
+	}
+	if event.status != models.WebhookEventStatusReceived && event.status != models.WebhookEventStatusFailed {
+		return false, nil
+	}
+	event.status = models.WebhookEventStatusReceived
+	event.attempts++
+	return true, nil
+}
+
+func (r *MemoryRepository) CompleteWebhookEvent(ctx context.Context, eventID, status string, lastError *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.webhooks[eventID]
+	if !ok {
+		return apperrors.NotFound("webhook event")
+	}
+	event.status = status
+	event.lastError = lastError
+	return nil
+}
+
+func (r *MemoryRepository) GetWebhookBacklog(ctx context.Context) (*models.QueueStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := &models.QueueStats{}
+	for _, event := range r.webhooks {
+		if event.status == models.WebhookEventStatusReceived || event.status == models.WebhookEventStatusFailed {
+			stats.Count++
+			stats.OldestAt = earliest(stats.OldestAt, event.receivedAt)
+		}
+	}
+	return stats, nil
+}
+
+// ================================
+// RECONCILIATION OPERATIONS
+// ================================
+
+func (r *MemoryRepository) GetConnectedWallets(ctx context.Context) ([]*models.DeveloperWallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var wallets []*models.DeveloperWallet
+	for _, w := range r.wallets {
+		if w.StripeConnectAccountID != nil {
+			wallets = append(wallets, cloneWallet(w))
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return keysetLess(wallets[i].CreatedAt, wallets[i].ID, wallets[j].CreatedAt, wallets[j].ID)
+	})
+	return wallets, nil
+}
+
+func (r *MemoryRepository) GetUnpaidTransfersTotal(ctx context.Context, walletID string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total float64
+	for _, w := range r.withdrawals {
+		if w.DeveloperWalletID == walletID && w.Status == models.WithdrawalStatusFailed && w.StripeTransferID != nil {
+			total += w.Amount
+		}
+	}
+	return cents(total), nil
+}
+
+func (r *MemoryRepository) UpsertReconciliationIssue(ctx context.Context, issue *models.ReconciliationIssue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key := issue.IssueType + "/" + issue.StripeObjectID
+	stored, ok := r.issues[key]
+	if !ok {
+		stored = &models.ReconciliationIssue{ID: uuid.New().String(), FirstSeenAt: now}
+		r.issues[key] = stored
+	}
+
+	firstSeen, id := stored.FirstSeenAt, stored.ID
+	*stored = *issue
+	stored.ID = id
+	stored.Status = models.ReconciliationIssueStatusOpen
+	stored.FirstSeenAt = firstSeen
+	stored.LastSeenAt = now
+	stored.ResolvedAt = nil
+	if stored.LocalAmount != nil {
+		stored.LocalAmount = floatPtr(cents(*stored.LocalAmount))
+	}
+	if stored.StripeAmount != nil {
+		stored.StripeAmount = floatPtr(cents(*stored.StripeAmount))
+	}
+
+	*issue = *stored
+	return nil
+}
+
+func (r *MemoryRepository) ResolveReconciliationIssues(ctx context.Context, objectIDs, stillOpen []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	examined := make(map[string]bool, len(objectIDs))
+	for _, id := range objectIDs {
+		examined[id] = true
+	}
+	keep := make(map[string]bool, len(stillOpen))
+	for _, id := range stillOpen {
+		keep[id] = true
+	}
+
+	resolved := 0
+	now := time.Now()
+	for _, issue := range r.issues {
+		if issue.Status == models.ReconciliationIssueStatusOpen && examined[issue.StripeObjectID] && !keep[issue.ID] {
+			issue.Status = models.ReconciliationIssueStatusResolved
+			issue.ResolvedAt = &now
+			resolved++
+		}
+	}
+	return resolved, nil
+}
+
+func (r *MemoryRepository) GetReconciliationIssues(ctx context.Context, filter models.ReconciliationIssueFilter, page models.PageRequest) ([]*models.ReconciliationIssue, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*models.ReconciliationIssue
+	for _, issue := range r.issues {
+		if filter.Status != "" && issue.Status != filter.Status {
+			continue
+		}
+		if filter.IssueType != "" && issue.IssueType != filter.IssueType {
+			continue
+		}
+		if filter.StripeAccountID != "" && issue.StripeAccountID != filter.StripeAccountID {
+			continue
+		}
+		matched = append(matched, issue)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return keysetLess(matched[j].FirstSeenAt, matched[j].ID, matched[i].FirstSeenAt, matched[i].ID)
+	})
+	total := len(matched)
+
+	var issues []*models.ReconciliationIssue
+	for _, i := range paginate(len(matched), page, func(i int) (time.Time, string) { return matched[i].FirstSeenAt, matched[i].ID }) {
+		clone := *matched[i]
+		issues = append(issues, &clone)
+	}
+
+	return issues, total, nil
+}
+
+func (r *MemoryRepository) CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run.ID = uuid.New().String()
+	clone := *run
+	r.runs = append(r.runs, &clone)
+	return nil
+}
+
+func (r *MemoryRepository) GetLastReconciliationRun(ctx context.Context, successfulOnly bool) (*models.ReconciliationRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var last *models.ReconciliationRun
+	for _, run := range r.runs {
+		if successfulOnly && run.Error != nil {
+			continue
+		}
+		if last == nil || run.StartedAt.After(last.StartedAt) {
+			last = run
+		}
+	}
+	if last == nil {
+		return nil, apperrors.NotFound("reconciliation run")
+	}
+	clone := *last
+	return &clone, nil
+}
+
+// ================================
+// HELPERS
+// ================================
+
+// keysetLess orders rows by (time, id) ascending, like a row comparison in SQL
+func keysetLess(t1 time.Time, id1 string, t2 time.Time, id2 string) bool {
+	if !t1.Equal(t2) {
+		return t1.Before(t2)
+	}
+	return id1 < id2
+}
+
+// paginate returns the indexes of a page of n rows sorted by (time, id) descending
+func paginate(n int, page models.PageRequest, key func(i int) (time.Time, string)) []int {
+	var indexes []int
+	for i := 0; i < n; i++ {
+		if page.After != nil {
+			t, id := key(i)
+			if !keysetLess(t, id, page.After.Time, page.After.ID) {
+				continue
+			}
+		}
+		indexes = append(indexes, i)
+	}
+
+	offset := page.Offset()
+	if offset > len(indexes) {
+		offset = len(indexes)
+	}
+	indexes = indexes[offset:]
+	if len(indexes) > page.Limit {
+		indexes = indexes[:page.Limit]
+	}
+	return indexes
+}
+
+// earliest returns the earlier of oldest and t, like MIN() over a column
+func earliest(oldest *time.Time, t time.Time) *time.Time {
+	if oldest == nil || t.Before(*oldest) {
+		return &t
+	}
+	return oldest
+}
+
+// cents rounds an amount to the precision of a DECIMAL(12,2) column
+func cents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// truncateDay mirrors date_trunc for the analytics granularities, weeks start on Monday
+func truncateDay(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case models.GranularityWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case models.GranularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func cloneWallet(w *models.DeveloperWallet) *models.DeveloperWallet {
+	clone := *w
+	if w.StripeConnectAccountID != nil {
+		clone.StripeConnectAccountID = stringPtr(*w.StripeConnectAccountID)
+	}
+	if w.StatusSyncedAt != nil {
+		synced := *w.StatusSyncedAt
+		clone.StatusSyncedAt = &synced
+	}
+	if w.Tier != nil {
+		clone.Tier = stringPtr(*w.Tier)
+	}
+	return &clone
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+)
+
+// whereBuilder assembles a WHERE clause with numbered placeholders. Conditions
+// are written with "?" for each argument, which is rewritten to $1, $2, ...
+type whereBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *whereBuilder) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		b.args = append(b.args, arg)
+		condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(b.args)), 1)
+	}
+	b.conditions = append(b.conditions, condition)
+}
+
+// arg appends a bare argument and returns its placeholder, for LIMIT/OFFSET
+func (b *whereBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *whereBuilder) sql() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// clone copies the builder so a COUNT query and a page query can share filters
+func (b *whereBuilder) clone() *whereBuilder {
+	return &whereBuilder{
+		conditions: append([]string(nil), b.conditions...),
+		args:       append([]interface{}(nil), b.args...),
+	}
+}
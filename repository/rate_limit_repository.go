@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RateLimitRepository interface {
+	// TakeRateLimitToken refills the bucket for elapsed time and consumes one token
+	// if available. It returns the tokens left in the bucket.
+	TakeRateLimitToken(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, float64, error)
+}
+
+type rateLimitRepository struct {
+	db *tenantDB
+}
+
+func NewRateLimitRepository(db *pgxpool.Pool) RateLimitRepository {
+	return &rateLimitRepository{db: newTenantDB(db)}
+}
+
+func (r *rateLimitRepository) TakeRateLimitToken(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, float64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin rate limit transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The upsert refills the bucket and keeps the row locked until commit
+	refillQuery := `
+		INSERT INTO tenant_schema.rate_limit_buckets AS b (bucket_key, tokens, updated_at)
+		VALUES ($1, $2::float8, NOW())
+		ON CONFLICT (bucket_key) DO UPDATE
+		SET tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at)) * $3::float8),
+		    updated_at = NOW()
+		RETURNING tokens
+	`
+
+	var tokens float64
+	if err := tx.QueryRow(ctx, refillQuery, key, float64(burst), ratePerSecond).Scan(&tokens); err != nil {
+		return false, 0, fmt.Errorf("failed to refill rate limit bucket: %w", err)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+		takeQuery := `
+			UPDATE tenant_schema.rate_limit_buckets
+			SET tokens = $1
+			WHERE bucket_key = $2
+		`
+		if _, err := tx.Exec(ctx, takeQuery, tokens, key); err != nil {
+			return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, fmt.Errorf("failed to commit rate limit transaction: %w", err)
+	}
+
+	return allowed, tokens, nil
+}
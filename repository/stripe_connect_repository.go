@@ -2,50 +2,172 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
+	"strpe-connect/apperrors"
+	"strpe-connect/database"
 	"strpe-connect/models"
+	"strpe-connect/tenant"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// SpendReader returns what the paying user organization spent on functionID
+// since a time, or on every function when functionID is nil. It reads inside
+// the charge, so it sees every payment committed before the account was locked.
+type SpendReader func(ctx context.Context, functionID *string, since time.Time) (float64, error)
+
 type StripeConnectRepository interface {
 	// Developer Wallet operations
 	CreateDeveloperWallet(ctx context.Context, organizationID string) (*models.DeveloperWallet, error)
 	GetDeveloperWalletByOrgID(ctx context.Context, organizationID string) (*models.DeveloperWallet, error)
-	GetAllDeveloperWallets(ctx context.Context, limit, offset int) ([]*models.DeveloperWallet, error)
+	GetAllDeveloperWallets(ctx context.Context, filter models.DeveloperFilter, page models.PageRequest) ([]*models.DeveloperWallet, int, error)
 	UpdateStripeConnectAccountID(ctx context.Context, walletID, stripeAccountID string) error
 	UpdateOnboardingStatus(ctx context.Context, walletID string, completed, payoutsEnabled, chargesEnabled bool) error
+	// GetWalletsToSync returns up to limit wallets with a Stripe account whose
+	// status was never synced or last synced before syncedBefore, or before
+	// onboardingSyncedBefore while onboarding is incomplete, least recently synced first
+	GetWalletsToSync(ctx context.Context, syncedBefore, onboardingSyncedBefore time.Time, limit int) ([]*models.DeveloperWallet, error)
+	// UpdateWalletBalance adds amount, which is negative for debits, to the
+	// balance. It returns apperrors.ErrInsufficientFunds instead of going below
+	// zero or drawing on the pending balance, and apperrors.ErrNotFound when
+	// there is no such wallet.
 	UpdateWalletBalance(ctx context.Context, walletID string, amount float64) error
+	UpdateWalletTier(ctx context.Context, walletID string, tier *string) error
 	GetWalletByID(ctx context.Context, walletID string) (*models.DeveloperWallet, error)
 
 	// Withdrawal operations
+	// CreateWithdrawalRequest atomically checks that the wallet balance less its
+	// pending and processing withdrawals covers the amount, and creates the
+	// withdrawal, keeping its ID when it has one. It returns
+	// apperrors.ErrInsufficientFunds otherwise.
 	CreateWithdrawalRequest(ctx context.Context, withdrawal *models.WithdrawalRequest) error
 	GetWithdrawalByID(ctx context.Context, withdrawalID string) (*models.WithdrawalRequest, error)
-	UpdateWithdrawalStatus(ctx context.Context, withdrawalID, status string, stripeTransferID *string, failureReason *string) error
-	GetWithdrawalsByOrgID(ctx context.Context, organizationID string, limit, offset int) ([]*models.WithdrawalRequest, error)
+	UpdateWithdrawalStatus(ctx context.Context, withdrawalID, status string, stripeTransferID, stripePayoutID, failureReason *string) error
+	// RecordWithdrawalTransfer records the transfer of a withdrawal and deducts
+	// its amount from the wallet in one database transaction, since the transfer
+	// paid the developer whatever happens to the payout. It does nothing when the
+	// withdrawal already has a transfer, so retries deduct once.
+	RecordWithdrawalTransfer(ctx context.Context, withdrawalID, transferID string) error
+	GetWithdrawalsByOrgID(ctx context.Context, organizationID string, filter models.WithdrawalFilter, page models.PageRequest) ([]*models.WithdrawalRequest, int, error)
+	// GetWithdrawalsToRetry returns up to limit pending or processing withdrawals
+	// last updated before updatedBefore, least recently updated first
+	GetWithdrawalsToRetry(ctx context.Context, updatedBefore time.Time, limit int) ([]*models.WithdrawalRequest, error)
+	// GetPendingWithdrawalsTotal sums the pending and processing withdrawals not
+	// yet deducted from the wallet, that is without a recorded transfer
 	GetPendingWithdrawalsTotal(ctx context.Context, walletID string) (float64, error)
+	// HasWithdrawalsInFlight reports whether the wallet has a pending or
+	// processing withdrawal, transferred or not
+	HasWithdrawalsInFlight(ctx context.Context, walletID string) (bool, error)
+	GetWithdrawalQueueStats(ctx context.Context) (*models.QueueStats, error)
+	GetLiabilities(ctx context.Context) (*models.Liabilities, error)
 
 	// Transaction operations
-	CreateTransaction(ctx context.Context, tx *models.FunctionExecutionTransaction) error
-	GetTransactionsByDeveloperOrg(ctx context.Context, orgID string, limit, offset int) ([]*models.FunctionExecutionTransaction, error)
-	GetTransactionsByUserOrg(ctx context.Context, orgID string, limit, offset int) ([]*models.FunctionExecutionTransaction, error)
+	// ChargeFunctionExecution deducts a payment from the user account, records it
+	// and credits its net amount to the developer wallet in one database
+	// transaction, so a failure never charges the user without paying the
+	// developer. The account row stays locked from before check runs until the
+	// charge commits, so concurrent payments of the same user cannot all pass
+	// check; an error from check aborts the charge. It returns
+	// apperrors.ErrInsufficientFunds when the account balance does not cover the
+	// amount. Until ReleasedAt is set the net amount also counts towards the
+	// wallet's pending balance.
+	ChargeFunctionExecution(ctx context.Context, tx *models.FunctionExecutionTransaction, check func(ctx context.Context, spent SpendReader) error) error
+	// ReleaseClearedEarnings releases the payments whose available_at is not after
+	// now, moving their net amount out of the pending balance of their wallets. It
+	// returns how many payments and dollars were released.
+	ReleaseClearedEarnings(ctx context.Context, now time.Time) (int, float64, error)
+	GetTransactionsByDeveloperOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error)
+	GetTransactionsByUserOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error)
 	GetTransactionByID(ctx context.Context, transactionID string) (*models.FunctionExecutionTransaction, error)
 	GetConnectedDevelopersByUserOrg(ctx context.Context, userOrgID string) ([]*models.DeveloperWallet, error)
 
 	// Account operations (user balance)
 	GetAccountByOrgID(ctx context.Context, orgID string) (*Account, error)
-	DeductUserBalance(ctx context.Context, accountID string, amount float64) error
+
+	// Billing operations (paying user organizations)
+	GetUserOrgSpendByFunction(ctx context.Context, userOrgID string, from, to time.Time) ([]models.FunctionSpend, error)
+	GetUserOrgSpendByDeveloper(ctx context.Context, userOrgID string, from, to time.Time) ([]models.DeveloperSpend, error)
+	GetAccountLedgerSummary(ctx context.Context, orgID string, periodStart, periodEnd time.Time) (*models.AccountLedgerSummary, error)
+
+	// Analytics operations (developer earnings rollup)
+	RefreshEarningsRollup(ctx context.Context) (time.Time, error)
+	GetEarningsRollupWatermark(ctx context.Context) (time.Time, error)
+	GetEarningsTotals(ctx context.Context, developerOrgID string, from, to time.Time) (*models.EarningsTotals, error)
+	GetEarningsSeries(ctx context.Context, developerOrgID, granularity string, from, to time.Time) ([]models.EarningsBucket, error)
+	GetEarningsByFunction(ctx context.Context, developerOrgID string, from, to time.Time) ([]models.FunctionEarnings, error)
+
+	// Spending cap operations
+	GetSpendingCapsByOrgID(ctx context.Context, orgID string) ([]*models.SpendingCap, error)
+	UpsertSpendingCap(ctx context.Context, spendingCap *models.SpendingCap) error
+	DeleteSpendingCap(ctx context.Context, capID string) error
+	GetUserOrgSpendSince(ctx context.Context, userOrgID string, functionID *string, since time.Time) (float64, error)
+
+	// Payout schedule operations
+	GetPayoutSchedule(ctx context.Context, walletID string) (*models.PayoutSchedule, error)
+	// UpsertPayoutSchedule saves the settings and next run of a schedule, keeping
+	// the outcome of its last run
+	UpsertPayoutSchedule(ctx context.Context, schedule *models.PayoutSchedule) error
+	// GetDuePayoutSchedules returns up to limit schedules whose next run is not
+	// after now, earliest first
+	GetDuePayoutSchedules(ctx context.Context, now time.Time, limit int) ([]*models.PayoutSchedule, error)
+	// RecordPayoutRun saves the outcome of a schedule's run and moves it to
+	// nextRunAt. A nil withdrawalID keeps the last withdrawal.
+	RecordPayoutRun(ctx context.Context, walletID string, ranAt time.Time, nextRunAt *time.Time, withdrawalID, lastError *string) error
+
+	// Payout batch operations
+	// GetPayoutCandidates returns an entry for each onboarded wallet with payouts
+	// enabled whose payable amount reaches the larger of minimum and its schedule
+	// threshold. The payable amount is the available balance less the schedule
+	// reserve and the earnings released after cutoff, largest first.
+	GetPayoutCandidates(ctx context.Context, cutoff time.Time, minimum float64) ([]*models.PayoutBatchEntry, error)
+	CreatePayoutBatch(ctx context.Context, batch *models.PayoutBatch, entries []*models.PayoutBatchEntry) error
+	GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatch, error)
+	GetPayoutBatches(ctx context.Context, page models.PageRequest) ([]*models.PayoutBatch, int, error)
+	GetPayoutBatchEntries(ctx context.Context, batchID string) ([]*models.PayoutBatchEntry, error)
+	// SetPayoutBatchEntriesExcluded flags entries of a draft batch and returns
+	// how many were updated
+	SetPayoutBatchEntriesExcluded(ctx context.Context, batchID string, entryIDs []string, excluded bool) (int, error)
+	// TransitionPayoutBatch moves a batch from status from to status to. It
+	// returns false when the batch is not in status from.
+	TransitionPayoutBatch(ctx context.Context, batchID, from, to string) (bool, error)
+	RecordPayoutBatchEntry(ctx context.Context, entryID, status string, withdrawalID, errorMessage *string) error
+
+	// WithAdvisoryLock runs fn while holding the lock name for the tenant in ctx,
+	// across every replica. It returns false without running fn when the lock is
+	// held elsewhere.
+	WithAdvisoryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+
+	// Webhook inbox operations
+	// RecordWebhookEvent stores a received event. It returns false when the event
+	// was already processed or discarded, so redeliveries are not handled twice.
+	RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error)
+	CompleteWebhookEvent(ctx context.Context, eventID, status string, lastError *string) error
+	GetWebhookBacklog(ctx context.Context) (*models.QueueStats, error)
+
+	// Reconciliation operations
+	GetConnectedWallets(ctx context.Context) ([]*models.DeveloperWallet, error)
+	// GetUnpaidTransfersTotal sums failed withdrawals whose transfer reached the
+	// connected account, where the funds stay when the payout fails
+	GetUnpaidTransfersTotal(ctx context.Context, walletID string) (float64, error)
+	UpsertReconciliationIssue(ctx context.Context, issue *models.ReconciliationIssue) error
+	// ResolveReconciliationIssues resolves the open issues about objectIDs, except
+	// the issues in stillOpen that the same run found again
+	ResolveReconciliationIssues(ctx context.Context, objectIDs, stillOpen []string) (int, error)
+	GetReconciliationIssues(ctx context.Context, filter models.ReconciliationIssueFilter, page models.PageRequest) ([]*models.ReconciliationIssue, int, error)
+	CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error
+	GetLastReconciliationRun(ctx context.Context, successfulOnly bool) (*models.ReconciliationRun, error)
 }
 
 type stripeConnectRepository struct {
-	db *pgxpool.Pool
+	db *tenantDB
 }
 
 func NewStripeConnectRepository(db *pgxpool.Pool) StripeConnectRepository {
-	return &stripeConnectRepository{db: db}
+	return &stripeConnectRepository{db: newTenantDB(db)}
 }
 
 // Account represents user account (from existing schema)
@@ -78,7 +200,7 @@ func (r *stripeConnectRepository) CreateDeveloperWallet(ctx context.Context, org
 		(id, organization_id, balance, total_earned, total_withdrawn, onboarding_completed, payouts_enabled, charges_enabled, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, organization_id, stripe_connect_account_id, balance, total_earned, total_withdrawn,
-		          onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, created_at, updated_at
+		          onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, status_synced_at, pending_balance, tier, created_at, updated_at
 	`
 
 	err := r.db.QueryRow(ctx, query,
@@ -88,7 +210,7 @@ func (r *stripeConnectRepository) CreateDeveloperWallet(ctx context.Context, org
 	).Scan(
 		&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
 		&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
-		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.CreatedAt, &wallet.UpdatedAt,
+		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
 	)
 
 	if err != nil {
@@ -103,7 +225,7 @@ func (r *stripeConnectRepository) GetDeveloperWalletByOrgID(ctx context.Context,
 
 	query := `
 		SELECT id, organization_id, stripe_connect_account_id, balance, total_earned, total_withdrawn,
-		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, created_at, updated_at
+		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, status_synced_at, pending_balance, tier, created_at, updated_at
 		FROM tenant_schema.developer_wallets
 		WHERE organization_id = $1
 	`
@@ -111,11 +233,11 @@ func (r *stripeConnectRepository) GetDeveloperWalletByOrgID(ctx context.Context,
 	err := r.db.QueryRow(ctx, query, organizationID).Scan(
 		&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
 		&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
-		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.CreatedAt, &wallet.UpdatedAt,
+		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
 	)
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("wallet not found")
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("wallet")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wallet: %w", err)
@@ -124,18 +246,49 @@ func (r *stripeConnectRepository) GetDeveloperWalletByOrgID(ctx context.Context,
 	return wallet, nil
 }
 
-func (r *stripeConnectRepository) GetAllDeveloperWallets(ctx context.Context, limit, offset int) ([]*models.DeveloperWallet, error) {
+func (r *stripeConnectRepository) GetAllDeveloperWallets(ctx context.Context, filter models.DeveloperFilter, page models.PageRequest) ([]*models.DeveloperWallet, int, error) {
+	where := &whereBuilder{}
+	if filter.From != nil {
+		where.add("dw.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where.add("dw.created_at < ?", *filter.To)
+	}
+	if filter.OnboardingCompleted != nil {
+		where.add("dw.onboarding_completed = ?", *filter.OnboardingCompleted)
+	}
+	if filter.PayoutsEnabled != nil {
+		where.add("dw.payouts_enabled = ?", *filter.PayoutsEnabled)
+	}
+	if filter.MinBalance != nil {
+		where.add("dw.balance >= ?", *filter.MinBalance)
+	}
+	if filter.MaxBalance != nil {
+		where.add("dw.balance <= ?", *filter.MaxBalance)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM tenant_schema.developer_wallets dw ` + where.sql()
+	if err := r.db.QueryRow(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count wallets: %w", err)
+	}
+
+	pageWhere := where.clone()
+	if page.After != nil {
+		pageWhere.add("(dw.created_at, dw.id) < (?, ?::uuid)", page.After.Time, page.After.ID)
+	}
+
 	query := `
 		SELECT dw.id, dw.organization_id, dw.stripe_connect_account_id, dw.balance, dw.total_earned, dw.total_withdrawn,
-		       dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.created_at, dw.updated_at
+		       dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.status_synced_at, dw.pending_balance, dw.tier, dw.created_at, dw.updated_at
 		FROM tenant_schema.developer_wallets dw
-		ORDER BY dw.created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+		` + pageWhere.sql() + `
+		ORDER BY dw.created_at DESC, dw.id DESC
+		LIMIT ` + pageWhere.arg(page.Limit) + ` OFFSET ` + pageWhere.arg(page.Offset())
 
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	rows, err := r.db.Query(ctx, query, pageWhere.args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query wallets: %w", err)
+		return nil, 0, fmt.Errorf("failed to query wallets: %w", err)
 	}
 	defer rows.Close()
 
@@ -145,19 +298,19 @@ func (r *stripeConnectRepository) GetAllDeveloperWallets(ctx context.Context, li
 		err := rows.Scan(
 			&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
 			&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
-			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.CreatedAt, &wallet.UpdatedAt,
+			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan wallet: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan wallet: %w", err)
 		}
 		wallets = append(wallets, wallet)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, 0, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return wallets, nil
+	return wallets, total, nil
 }
 
 func (r *stripeConnectRepository) GetWalletByID(ctx context.Context, walletID string) (*models.DeveloperWallet, error) {
@@ -165,7 +318,7 @@ func (r *stripeConnectRepository) GetWalletByID(ctx context.Context, walletID st
 
 	query := `
 		SELECT id, organization_id, stripe_connect_account_id, balance, total_earned, total_withdrawn,
-		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, created_at, updated_at
+		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, status_synced_at, pending_balance, tier, created_at, updated_at
 		FROM tenant_schema.developer_wallets
 		WHERE id = $1
 	`
@@ -173,9 +326,12 @@ func (r *stripeConnectRepository) GetWalletByID(ctx context.Context, walletID st
 	err := r.db.QueryRow(ctx, query, walletID).Scan(
 		&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
 		&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
-		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.CreatedAt, &wallet.UpdatedAt,
+		&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("wallet")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
@@ -201,7 +357,7 @@ func (r *stripeConnectRepository) UpdateStripeConnectAccountID(ctx context.Conte
 func (r *stripeConnectRepository) UpdateOnboardingStatus(ctx context.Context, walletID string, completed, payoutsEnabled, chargesEnabled bool) error {
 	query := `
 		UPDATE tenant_schema.developer_wallets
-		SET onboarding_completed = $1, payouts_enabled = $2, charges_enabled = $3, updated_at = NOW()
+		SET onboarding_completed = $1, payouts_enabled = $2, charges_enabled = $3, status_synced_at = NOW(), updated_at = NOW()
 		WHERE id = $4
 	`
 
@@ -213,6 +369,49 @@ func (r *stripeConnectRepository) UpdateOnboardingStatus(ctx context.Context, wa
 	return nil
 }
 
+func (r *stripeConnectRepository) GetWalletsToSync(ctx context.Context, syncedBefore, onboardingSyncedBefore time.Time, limit int) ([]*models.DeveloperWallet, error) {
+	query := `
+		SELECT id, organization_id, stripe_connect_account_id, balance, total_earned, total_withdrawn,
+		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, status_synced_at, pending_balance, tier, created_at, updated_at
+		FROM tenant_schema.developer_wallets
+		WHERE stripe_connect_account_id IS NOT NULL
+		  AND (status_synced_at IS NULL
+		       OR status_synced_at < $1
+		       OR (status_synced_at < $2 AND NOT (onboarding_completed AND payouts_enabled)))
+		ORDER BY status_synced_at NULLS FIRST, id
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(ctx, query, syncedBefore, onboardingSyncedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wallets to sync: %w", err)
+	}
+	defer rows.Close()
+
+	var wallets []*models.DeveloperWallet
+	for rows.Next() {
+		wallet := &models.DeveloperWallet{}
+		err := rows.Scan(
+			&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
+			&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
+			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return wallets, nil
+}
+
+// UpdateWalletBalance adds amount to a wallet's balance. A debit larger than
+// the available part of the balance changes nothing and returns
+// apperrors.ErrInsufficientFunds.
 func (r *stripeConnectRepository) UpdateWalletBalance(ctx context.Context, walletID string, amount float64) error {
 	query := `
 		UPDATE tenant_schema.developer_wallets
@@ -220,14 +419,45 @@ func (r *stripeConnectRepository) UpdateWalletBalance(ctx context.Context, walle
 		    total_earned = total_earned + CASE WHEN $1 > 0 THEN $1 ELSE 0 END,
 		    total_withdrawn = total_withdrawn + CASE WHEN $1 < 0 THEN ABS($1) ELSE 0 END,
 		    updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND balance + $1 >= pending_balance
 	`
 
-	_, err := r.db.Exec(ctx, query, amount, walletID)
+	result, err := r.db.Exec(ctx, query, amount, walletID)
 	if err != nil {
 		return fmt.Errorf("failed to update wallet balance: %w", err)
 	}
 
+	// A missing wallet also affects no rows, tell it apart from the guard
+	if result.RowsAffected() == 0 {
+		var exists bool
+		err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tenant_schema.developer_wallets WHERE id = $1)`, walletID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up wallet: %w", err)
+		}
+		if !exists {
+			return apperrors.NotFound("wallet")
+		}
+		return apperrors.ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) UpdateWalletTier(ctx context.Context, walletID string, tier *string) error {
+	query := `
+		UPDATE tenant_schema.developer_wallets
+		SET tier = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	result, err := r.db.Exec(ctx, query, tier, walletID)
+	if err != nil {
+		return fmt.Errorf("failed to update wallet tier: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("wallet")
+	}
+
 	return nil
 }
 
@@ -235,27 +465,69 @@ func (r *stripeConnectRepository) UpdateWalletBalance(ctx context.Context, walle
 // WITHDRAWAL OPERATIONS
 // ================================
 
+// CreateWithdrawalRequest reserves the withdrawal amount on its wallet. The
+// wallet row stays locked from the balance check to the insert, so concurrent
+// requests are checked one after the other and cannot overdraw it. A
+// withdrawal that already has an ID keeps it.
 func (r *stripeConnectRepository) CreateWithdrawalRequest(ctx context.Context, withdrawal *models.WithdrawalRequest) error {
-	withdrawal.ID = uuid.New().String()
+	if withdrawal.ID == "" {
+		withdrawal.ID = uuid.New().String()
+	}
 	withdrawal.RequestedAt = time.Now()
 	withdrawal.CreatedAt = time.Now()
 	withdrawal.UpdatedAt = time.Now()
 
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Earnings still clearing cannot be withdrawn
+	var balance, pending float64
+	err = tx.QueryRow(ctx, `
+		SELECT balance - pending_balance
+		FROM tenant_schema.developer_wallets
+		WHERE id = $1
+		FOR UPDATE
+	`, withdrawal.DeveloperWalletID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperrors.NotFound("wallet")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM tenant_schema.withdrawal_requests
+		WHERE developer_wallet_id = $1 AND status IN ('pending', 'processing') AND stripe_transfer_id IS NULL
+	`, withdrawal.DeveloperWalletID).Scan(&pending)
+	if err != nil {
+		return fmt.Errorf("failed to get pending withdrawals: %w", err)
+	}
+	if cents(balance-pending) < cents(withdrawal.Amount) {
+		return apperrors.ErrInsufficientFunds
+	}
+
 	query := `
 		INSERT INTO tenant_schema.withdrawal_requests
-		(id, developer_wallet_id, organization_id, amount, status, requested_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		(id, developer_wallet_id, organization_id, amount, status, request_id, requested_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
-	_, err := r.db.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
 		withdrawal.ID, withdrawal.DeveloperWalletID, withdrawal.OrganizationID, withdrawal.Amount,
-		withdrawal.Status, withdrawal.RequestedAt, withdrawal.CreatedAt, withdrawal.UpdatedAt,
+		withdrawal.Status, withdrawal.RequestID, withdrawal.RequestedAt, withdrawal.CreatedAt, withdrawal.UpdatedAt,
 	)
-
 	if err != nil {
 		return fmt.Errorf("failed to create withdrawal request: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit withdrawal request: %w", err)
+	}
+
 	return nil
 }
 
@@ -264,7 +536,7 @@ func (r *stripeConnectRepository) GetWithdrawalByID(ctx context.Context, withdra
 
 	query := `
 		SELECT id, developer_wallet_id, organization_id, amount, status, stripe_transfer_id, stripe_payout_id,
-		       failure_reason, requested_at, completed_at, created_at, updated_at
+		       failure_reason, request_id, requested_at, completed_at, created_at, updated_at
 		FROM tenant_schema.withdrawal_requests
 		WHERE id = $1
 	`
@@ -272,10 +544,13 @@ func (r *stripeConnectRepository) GetWithdrawalByID(ctx context.Context, withdra
 	err := r.db.QueryRow(ctx, query, withdrawalID).Scan(
 		&withdrawal.ID, &withdrawal.DeveloperWalletID, &withdrawal.OrganizationID, &withdrawal.Amount,
 		&withdrawal.Status, &withdrawal.StripeTransferID, &withdrawal.StripePayoutID,
-		&withdrawal.FailureReason, &withdrawal.RequestedAt, &withdrawal.CompletedAt,
+		&withdrawal.FailureReason, &withdrawal.RequestID, &withdrawal.RequestedAt, &withdrawal.CompletedAt,
 		&withdrawal.CreatedAt, &withdrawal.UpdatedAt,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("withdrawal")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get withdrawal: %w", err)
 	}
@@ -283,18 +558,19 @@ func (r *stripeConnectRepository) GetWithdrawalByID(ctx context.Context, withdra
 	return withdrawal, nil
 }
 
-func (r *stripeConnectRepository) UpdateWithdrawalStatus(ctx context.Context, withdrawalID, status string, stripeTransferID *string, failureReason *string) error {
+func (r *stripeConnectRepository) UpdateWithdrawalStatus(ctx context.Context, withdrawalID, status string, stripeTransferID, stripePayoutID, failureReason *string) error {
 	query := `
 		UPDATE tenant_schema.withdrawal_requests
 		SET status = $1,
 		    stripe_transfer_id = COALESCE($2, stripe_transfer_id),
-		    failure_reason = COALESCE($3, failure_reason),
+		    stripe_payout_id = COALESCE($3, stripe_payout_id),
+		    failure_reason = COALESCE($4, failure_reason),
 		    completed_at = CASE WHEN $1 IN ('completed', 'failed') THEN NOW() ELSE completed_at END,
 		    updated_at = NOW()
-		WHERE id = $4
+		WHERE id = $5
 	`
 
-	_, err := r.db.Exec(ctx, query, status, stripeTransferID, failureReason, withdrawalID)
+	_, err := r.db.Exec(ctx, query, status, stripeTransferID, stripePayoutID, failureReason, withdrawalID)
 	if err != nil {
 		return fmt.Errorf("failed to update withdrawal status: %w", err)
 	}
@@ -302,19 +578,129 @@ func (r *stripeConnectRepository) UpdateWithdrawalStatus(ctx context.Context, wi
 	return nil
 }
 
-func (r *stripeConnectRepository) GetWithdrawalsByOrgID(ctx context.Context, organizationID string, limit, offset int) ([]*models.WithdrawalRequest, error) {
+func (r *stripeConnectRepository) RecordWithdrawalTransfer(ctx context.Context, withdrawalID, transferID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var walletID string
+	var amount float64
+	err = tx.QueryRow(ctx, `
+		UPDATE tenant_schema.withdrawal_requests
+		SET stripe_transfer_id = $1, updated_at = NOW()
+		WHERE id = $2 AND stripe_transfer_id IS NULL
+		RETURNING developer_wallet_id, amount
+	`, transferID, withdrawalID).Scan(&walletID, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Recorded by an earlier attempt, or no such withdrawal
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record transfer: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE tenant_schema.developer_wallets
+		SET balance = balance - $1,
+		    total_withdrawn = total_withdrawn + $1,
+		    updated_at = NOW()
+		WHERE id = $2 AND balance - $1 >= pending_balance
+	`, amount, walletID)
+	if err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrInsufficientFunds
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transfer: %w", err)
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) GetWithdrawalsByOrgID(ctx context.Context, organizationID string, filter models.WithdrawalFilter, page models.PageRequest) ([]*models.WithdrawalRequest, int, error) {
+	where := &whereBuilder{}
+	where.add("organization_id = ?", organizationID)
+	if filter.From != nil {
+		where.add("requested_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where.add("requested_at < ?", *filter.To)
+	}
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	if filter.MinAmount != nil {
+		where.add("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where.add("amount <= ?", *filter.MaxAmount)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM tenant_schema.withdrawal_requests ` + where.sql()
+	if err := r.db.QueryRow(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count withdrawals: %w", err)
+	}
+
+	pageWhere := where.clone()
+	if page.After != nil {
+		pageWhere.add("(requested_at, id) < (?, ?::uuid)", page.After.Time, page.After.ID)
+	}
+
 	query := `
 		SELECT id, developer_wallet_id, organization_id, amount, status, stripe_transfer_id, stripe_payout_id,
-		       failure_reason, requested_at, completed_at, created_at, updated_at
+		       failure_reason, request_id, requested_at, completed_at, created_at, updated_at
 		FROM tenant_schema.withdrawal_requests
-		WHERE organization_id = $1
-		ORDER BY requested_at DESC
-		LIMIT $2 OFFSET $3
+		` + pageWhere.sql() + `
+		ORDER BY requested_at DESC, id DESC
+		LIMIT ` + pageWhere.arg(page.Limit) + ` OFFSET ` + pageWhere.arg(page.Offset())
+
+	rows, err := r.db.Query(ctx, query, pageWhere.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get withdrawals: %w", err)
+	}
+	defer rows.Close()
+
+	var withdrawals []*models.WithdrawalRequest
+	for rows.Next() {
+		withdrawal := &models.WithdrawalRequest{}
+		err := rows.Scan(
+			&withdrawal.ID, &withdrawal.DeveloperWalletID, &withdrawal.OrganizationID, &withdrawal.Amount,
+			&withdrawal.Status, &withdrawal.StripeTransferID, &withdrawal.StripePayoutID,
+			&withdrawal.FailureReason, &withdrawal.RequestID, &withdrawal.RequestedAt, &withdrawal.CompletedAt,
+			&withdrawal.CreatedAt, &withdrawal.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return withdrawals, total, nil
+}
+
+func (r *stripeConnectRepository) GetWithdrawalsToRetry(ctx context.Context, updatedBefore time.Time, limit int) ([]*models.WithdrawalRequest, error) {
+	query := `
+		SELECT id, developer_wallet_id, organization_id, amount, status, stripe_transfer_id, stripe_payout_id,
+		       failure_reason, request_id, requested_at, completed_at, created_at, updated_at
+		FROM tenant_schema.withdrawal_requests
+		WHERE status IN ('pending', 'processing') AND updated_at < $1
+		ORDER BY updated_at, id
+		LIMIT $2
 	`
 
-	rows, err := r.db.Query(ctx, query, organizationID, limit, offset)
+	rows, err := r.db.Query(ctx, query, updatedBefore, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get withdrawals: %w", err)
+		return nil, fmt.Errorf("failed to query withdrawals to retry: %w", err)
 	}
 	defer rows.Close()
 
@@ -324,7 +710,7 @@ func (r *stripeConnectRepository) GetWithdrawalsByOrgID(ctx context.Context, org
 		err := rows.Scan(
 			&withdrawal.ID, &withdrawal.DeveloperWalletID, &withdrawal.OrganizationID, &withdrawal.Amount,
 			&withdrawal.Status, &withdrawal.StripeTransferID, &withdrawal.StripePayoutID,
-			&withdrawal.FailureReason, &withdrawal.RequestedAt, &withdrawal.CompletedAt,
+			&withdrawal.FailureReason, &withdrawal.RequestID, &withdrawal.RequestedAt, &withdrawal.CompletedAt,
 			&withdrawal.CreatedAt, &withdrawal.UpdatedAt,
 		)
 		if err != nil {
@@ -333,6 +719,10 @@ func (r *stripeConnectRepository) GetWithdrawalsByOrgID(ctx context.Context, org
 		withdrawals = append(withdrawals, withdrawal)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
 	return withdrawals, nil
 }
 
@@ -342,7 +732,7 @@ func (r *stripeConnectRepository) GetPendingWithdrawalsTotal(ctx context.Context
 	query := `
 		SELECT COALESCE(SUM(amount), 0)
 		FROM tenant_schema.withdrawal_requests
-		WHERE developer_wallet_id = $1 AND status IN ('pending', 'processing')
+		WHERE developer_wallet_id = $1 AND status IN ('pending', 'processing') AND stripe_transfer_id IS NULL
 	`
 
 	err := r.db.QueryRow(ctx, query, walletID).Scan(&total)
@@ -353,80 +743,286 @@ func (r *stripeConnectRepository) GetPendingWithdrawalsTotal(ctx context.Context
 	return total, nil
 }
 
+func (r *stripeConnectRepository) HasWithdrawalsInFlight(ctx context.Context, walletID string) (bool, error) {
+	var inFlight bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM tenant_schema.withdrawal_requests
+			WHERE developer_wallet_id = $1 AND status IN ('pending', 'processing')
+		)
+	`
+
+	err := r.db.QueryRow(ctx, query, walletID).Scan(&inFlight)
+	if err != nil {
+		return false, fmt.Errorf("failed to check withdrawals in flight: %w", err)
+	}
+
+	return inFlight, nil
+}
+
+func (r *stripeConnectRepository) GetWithdrawalQueueStats(ctx context.Context) (*models.QueueStats, error) {
+	stats := &models.QueueStats{}
+
+	query := `
+		SELECT COUNT(*), MIN(requested_at)
+		FROM tenant_schema.withdrawal_requests
+		WHERE status IN ('pending', 'processing')
+	`
+
+	err := r.db.QueryRow(ctx, query).Scan(&stats.Count, &stats.OldestAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get withdrawal queue stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *stripeConnectRepository) GetLiabilities(ctx context.Context) (*models.Liabilities, error) {
+	liabilities := &models.Liabilities{}
+
+	query := `
+		SELECT
+			(SELECT COALESCE(SUM(balance), 0) FROM tenant_schema.developer_wallets),
+			(SELECT COALESCE(SUM(account_balance), 0) FROM tenant_schema.accounts),
+			(SELECT COALESCE(SUM(platform_fee), 0) FROM tenant_schema.function_execution_transactions WHERE status = 'completed'),
+			COALESCE(SUM(amount), 0),
+			COUNT(*)
+		FROM tenant_schema.withdrawal_requests
+		WHERE status IN ('pending', 'processing') AND stripe_transfer_id IS NULL
+	`
+
+	err := r.db.QueryRow(ctx, query).Scan(&liabilities.WalletBalance, &liabilities.UserPrepaidBalance, &liabilities.PlatformRevenue,
+		&liabilities.PendingWithdrawalAmount, &liabilities.PendingWithdrawalCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get liabilities: %w", err)
+	}
+
+	return liabilities, nil
+}
+
 // ================================
 // TRANSACTION OPERATIONS
 // ================================
 
-func (r *stripeConnectRepository) CreateTransaction(ctx context.Context, tx *models.FunctionExecutionTransaction) error {
-	tx.ID = uuid.New().String()
-	tx.ExecutedAt = time.Now()
-	tx.CreatedAt = time.Now()
-	tx.UpdatedAt = time.Now()
+func (r *stripeConnectRepository) ChargeFunctionExecution(ctx context.Context, transaction *models.FunctionExecutionTransaction, check func(ctx context.Context, spent SpendReader) error) error {
+	if transaction.ID == "" {
+		transaction.ID = uuid.New().String()
+	}
+	transaction.ExecutedAt = time.Now()
+	transaction.CreatedAt = time.Now()
+	transaction.UpdatedAt = time.Now()
+	if transaction.AvailableAt.IsZero() {
+		transaction.AvailableAt = transaction.ExecutedAt
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Classify the account ledger entry written by the accounts trigger
+	_, err = tx.Exec(ctx, `SELECT set_config('app.ledger_entry_type', $1, true), set_config('app.ledger_reference_id', $2, true)`,
+		models.LedgerEntryCharge, transaction.ID)
+	if err != nil {
+		return fmt.Errorf("failed to tag ledger entry: %w", err)
+	}
+
+	// Lock the account so payments of the same user check and deduct one at a time
+	var balance float64
+	err = tx.QueryRow(ctx, `SELECT account_balance FROM tenant_schema.accounts WHERE id = $1 FOR UPDATE`,
+		transaction.UserAccountID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperrors.NotFound("account")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+	if balance < transaction.Amount {
+		return apperrors.ErrInsufficientFunds
+	}
+
+	if check != nil {
+		spent := func(ctx context.Context, functionID *string, since time.Time) (float64, error) {
+			return userOrgSpendSince(ctx, tx, transaction.UserOrganizationID, functionID, since)
+		}
+		if err := check(ctx, spent); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE tenant_schema.accounts
+		SET account_balance = account_balance - $1, updated_at = NOW()
+		WHERE id = $2
+	`, transaction.Amount, transaction.UserAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to deduct balance: %w", err)
+	}
 
 	query := `
 		INSERT INTO tenant_schema.function_execution_transactions
 		(id, function_id, user_organization_id, developer_organization_id, user_account_id, developer_wallet_id,
-		 amount, platform_fee, net_amount, description, status, executed_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		 amount, platform_fee, net_amount, description, status, executed_at, available_at, released_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
-	_, err := r.db.Exec(ctx, query,
-		tx.ID, tx.FunctionID, tx.UserOrganizationID, tx.DeveloperOrganizationID, tx.UserAccountID,
-		tx.DeveloperWalletID, tx.Amount, tx.PlatformFee, tx.NetAmount, tx.Description, tx.Status,
-		tx.ExecutedAt, tx.CreatedAt, tx.UpdatedAt,
+	_, err = tx.Exec(ctx, query,
+		transaction.ID, transaction.FunctionID, transaction.UserOrganizationID, transaction.DeveloperOrganizationID, transaction.UserAccountID,
+		transaction.DeveloperWalletID, transaction.Amount, transaction.PlatformFee, transaction.NetAmount, transaction.Description, transaction.Status,
+		transaction.ExecutedAt, transaction.AvailableAt, transaction.ReleasedAt, transaction.CreatedAt, transaction.UpdatedAt,
 	)
-
 	if err != nil {
 		return fmt.Errorf("failed to create transaction: %w", err)
 	}
 
+	pending := 0.0
+	if transaction.ReleasedAt == nil {
+		pending = transaction.NetAmount
+	}
+	result, err := tx.Exec(ctx, `
+		UPDATE tenant_schema.developer_wallets
+		SET balance = balance + $1,
+		    total_earned = total_earned + $1,
+		    pending_balance = pending_balance + $2,
+		    updated_at = NOW()
+		WHERE id = $3
+	`, transaction.NetAmount, pending, transaction.DeveloperWalletID)
+	if err != nil {
+		return fmt.Errorf("failed to credit wallet: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("wallet")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit payment: %w", err)
+	}
+
 	return nil
 }
 
-func (r *stripeConnectRepository) GetTransactionsByDeveloperOrg(ctx context.Context, orgID string, limit, offset int) ([]*models.FunctionExecutionTransaction, error) {
+// ReleaseClearedEarnings releases in one statement, so concurrent runs never
+// release a payment twice: the second waits for the first and skips its rows.
+func (r *stripeConnectRepository) ReleaseClearedEarnings(ctx context.Context, now time.Time) (int, float64, error) {
 	query := `
-		SELECT id, function_id, user_organization_id, developer_organization_id, user_account_id,
-		       developer_wallet_id, amount, platform_fee, net_amount, description, status,
-		       executed_at, created_at, updated_at
-		FROM tenant_schema.function_execution_transactions
-		WHERE developer_organization_id = $1
-		ORDER BY executed_at DESC
-		LIMIT $2 OFFSET $3
+		WITH released AS (
+			UPDATE tenant_schema.function_execution_transactions
+			SET released_at = NOW(), updated_at = NOW()
+			WHERE released_at IS NULL AND available_at <= $1
+			RETURNING developer_wallet_id, net_amount
+		), totals AS (
+			SELECT developer_wallet_id, COUNT(*) AS payments, SUM(net_amount) AS amount
+			FROM released
+			GROUP BY developer_wallet_id
+		)
+		UPDATE tenant_schema.developer_wallets dw
+		SET pending_balance = GREATEST(dw.pending_balance - totals.amount, 0), updated_at = NOW()
+		FROM totals
+		WHERE dw.id = totals.developer_wallet_id
+		RETURNING totals.payments, totals.amount
 	`
 
-	rows, err := r.db.Query(ctx, query, orgID, limit, offset)
+	rows, err := r.db.Query(ctx, query, now)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transactions: %w", err)
+		return 0, 0, fmt.Errorf("failed to release cleared earnings: %w", err)
 	}
 	defer rows.Close()
 
-	return r.scanTransactions(rows)
+	var released int
+	var amount float64
+	for rows.Next() {
+		var payments int
+		var walletAmount float64
+		if err := rows.Scan(&payments, &walletAmount); err != nil {
+			return 0, 0, fmt.Errorf("failed to scan released earnings: %w", err)
+		}
+		released += payments
+		amount += walletAmount
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return released, amount, nil
 }
 
-func (r *stripeConnectRepository) GetTransactionsByUserOrg(ctx context.Context, orgID string, limit, offset int) ([]*models.FunctionExecutionTransaction, error) {
-	query := `
-		SELECT id, function_id, user_organization_id, developer_organization_id, user_account_id,
-		       developer_wallet_id, amount, platform_fee, net_amount, description, status,
-		       executed_at, created_at, updated_at
-		FROM tenant_schema.function_execution_transactions
-		WHERE user_organization_id = $1
-		ORDER BY executed_at DESC
-		LIMIT $2 OFFSET $3
-	`
+func (r *stripeConnectRepository) GetTransactionsByDeveloperOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	return r.listTransactions(ctx, "developer_organization_id", "user_organization_id", orgID, filter, page)
+}
+
+func (r *stripeConnectRepository) GetTransactionsByUserOrg(ctx context.Context, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	return r.listTransactions(ctx, "user_organization_id", "developer_organization_id", orgID, filter, page)
+}
+
+// listTransactions lists transactions where ownerColumn = orgID. The counterparty
+// filter applies to the opposite side of the payment.
+func (r *stripeConnectRepository) listTransactions(ctx context.Context, ownerColumn, counterpartyColumn, orgID string, filter models.TransactionFilter, page models.PageRequest) ([]*models.FunctionExecutionTransaction, int, error) {
+	where := &whereBuilder{}
+	where.add("t."+ownerColumn+" = ?", orgID)
+	if filter.From != nil {
+		where.add("t.executed_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where.add("t.executed_at < ?", *filter.To)
+	}
+	if filter.Status != "" {
+		where.add("t.status = ?", filter.Status)
+	}
+	if filter.FunctionID != "" {
+		where.add("t.function_id = ?", filter.FunctionID)
+	}
+	if filter.CounterpartyOrgID != "" {
+		where.add("t."+counterpartyColumn+" = ?", filter.CounterpartyOrgID)
+	}
+	if filter.MinAmount != nil {
+		where.add("t.amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where.add("t.amount <= ?", *filter.MaxAmount)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM tenant_schema.function_execution_transactions t ` + where.sql()
+	if err := r.db.QueryRow(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count transactions: %w", err)
+	}
 
-	rows, err := r.db.Query(ctx, query, orgID, limit, offset)
+	pageWhere := where.clone()
+	if page.After != nil {
+		pageWhere.add("(t.executed_at, t.id) < (?, ?::uuid)", page.After.Time, page.After.ID)
+	}
+
+	query := `
+		SELECT t.id, t.function_id, t.user_organization_id, t.developer_organization_id, t.user_account_id,
+		       t.developer_wallet_id, t.amount, t.platform_fee, t.net_amount, t.description, t.status,
+		       t.executed_at, t.available_at, t.released_at, t.created_at, t.updated_at, f.function_name
+		FROM tenant_schema.function_execution_transactions t
+		LEFT JOIN tenant_schema.functions f ON f.function_id::text = t.function_id
+		` + pageWhere.sql() + `
+		ORDER BY t.executed_at DESC, t.id DESC
+		LIMIT ` + pageWhere.arg(page.Limit) + ` OFFSET ` + pageWhere.arg(page.Offset())
+
+	rows, err := r.db.Query(ctx, query, pageWhere.args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get transactions: %w", err)
+		return nil, 0, fmt.Errorf("failed to get transactions: %w", err)
 	}
 	defer rows.Close()
 
-	return r.scanTransactions(rows)
+	transactions, err := r.scanTransactions(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return transactions, total, nil
 }
 
 func (r *stripeConnectRepository) GetConnectedDevelopersByUserOrg(ctx context.Context, userOrgID string) ([]*models.DeveloperWallet, error) {
 	query := `
 		SELECT DISTINCT dw.id, dw.organization_id, dw.stripe_connect_account_id, dw.balance, dw.total_earned, dw.total_withdrawn,
-		       dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.created_at, dw.updated_at,
+		       dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.status_synced_at, dw.pending_balance, dw.tier, dw.created_at, dw.updated_at,
 		       SUM(tx.amount) as total_paid_to_developer,
 		       COUNT(tx.id) as transaction_count
 		FROM tenant_schema.developer_wallets dw
@@ -434,7 +1030,7 @@ func (r *stripeConnectRepository) GetConnectedDevelopersByUserOrg(ctx context.Co
 			ON tx.developer_organization_id = dw.organization_id
 		WHERE tx.user_organization_id = $1
 		GROUP BY dw.id, dw.organization_id, dw.stripe_connect_account_id, dw.balance, dw.total_earned, dw.total_withdrawn,
-		         dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.created_at, dw.updated_at
+		         dw.onboarding_completed, dw.onboarding_url, dw.payouts_enabled, dw.charges_enabled, dw.status_synced_at, dw.pending_balance, dw.tier, dw.created_at, dw.updated_at
 		ORDER BY total_paid_to_developer DESC
 	`
 
@@ -453,7 +1049,7 @@ func (r *stripeConnectRepository) GetConnectedDevelopersByUserOrg(ctx context.Co
 		err := rows.Scan(
 			&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
 			&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
-			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.CreatedAt, &wallet.UpdatedAt,
+			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
 			&totalPaid, &txCount,
 		)
 		if err != nil {
@@ -475,7 +1071,7 @@ func (r *stripeConnectRepository) GetTransactionByID(ctx context.Context, transa
 	query := `
 		SELECT id, function_id, user_organization_id, developer_organization_id, user_account_id,
 		       developer_wallet_id, amount, platform_fee, net_amount, description, status,
-		       executed_at, created_at, updated_at
+		       executed_at, available_at, released_at, created_at, updated_at
 		FROM tenant_schema.function_execution_transactions
 		WHERE id = $1
 	`
@@ -483,9 +1079,12 @@ func (r *stripeConnectRepository) GetTransactionByID(ctx context.Context, transa
 	err := r.db.QueryRow(ctx, query, transactionID).Scan(
 		&tx.ID, &tx.FunctionID, &tx.UserOrganizationID, &tx.DeveloperOrganizationID,
 		&tx.UserAccountID, &tx.DeveloperWalletID, &tx.Amount, &tx.PlatformFee, &tx.NetAmount,
-		&tx.Description, &tx.Status, &tx.ExecutedAt, &tx.CreatedAt, &tx.UpdatedAt,
+		&tx.Description, &tx.Status, &tx.ExecutedAt, &tx.AvailableAt, &tx.ReleasedAt, &tx.CreatedAt, &tx.UpdatedAt,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("transaction")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get transaction: %w", err)
 	}
@@ -504,7 +1103,7 @@ func (r *stripeConnectRepository) scanTransactions(rows interface {
 		err := rows.Scan(
 			&tx.ID, &tx.FunctionID, &tx.UserOrganizationID, &tx.DeveloperOrganizationID,
 			&tx.UserAccountID, &tx.DeveloperWalletID, &tx.Amount, &tx.PlatformFee, &tx.NetAmount,
-			&tx.Description, &tx.Status, &tx.ExecutedAt, &tx.CreatedAt, &tx.UpdatedAt,
+			&tx.Description, &tx.Status, &tx.ExecutedAt, &tx.AvailableAt, &tx.ReleasedAt, &tx.CreatedAt, &tx.UpdatedAt, &tx.FunctionName,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan transaction: %w", err)
@@ -529,6 +1128,9 @@ func (r *stripeConnectRepository) GetAccountByOrgID(ctx context.Context, orgID s
 	`
 
 	err := r.db.QueryRow(ctx, query, orgID).Scan(&account.ID, &account.OrganizationID, &account.AccountBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("account")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
@@ -536,22 +1138,1073 @@ func (r *stripeConnectRepository) GetAccountByOrgID(ctx context.Context, orgID s
 	return account, nil
 }
 
-func (r *stripeConnectRepository) DeductUserBalance(ctx context.Context, accountID string, amount float64) error {
+// ================================
+// BILLING OPERATIONS
+// ================================
+
+func (r *stripeConnectRepository) GetUserOrgSpendByFunction(ctx context.Context, userOrgID string, from, to time.Time) ([]models.FunctionSpend, error) {
 	query := `
-		UPDATE tenant_schema.accounts
-		SET account_balance = account_balance - $1, updated_at = NOW()
-		WHERE id = $2 AND account_balance >= $1
+		SELECT t.function_id, COALESCE(MAX(f.function_name), ''), t.developer_organization_id, COUNT(*), COALESCE(SUM(t.amount), 0)
+		FROM tenant_schema.function_execution_transactions t
+		LEFT JOIN tenant_schema.functions f ON f.function_id::text = t.function_id
+		WHERE t.user_organization_id = $1 AND t.executed_at >= $2 AND t.executed_at < $3 AND t.status = 'completed'
+		GROUP BY t.function_id, t.developer_organization_id
+		ORDER BY SUM(t.amount) DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userOrgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spend by function: %w", err)
+	}
+	defer rows.Close()
+
+	spend := []models.FunctionSpend{}
+	for rows.Next() {
+		var fs models.FunctionSpend
+		if err := rows.Scan(&fs.FunctionID, &fs.FunctionName, &fs.DeveloperOrganizationID, &fs.CallCount, &fs.TotalAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan function spend: %w", err)
+		}
+		spend = append(spend, fs)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return spend, nil
+}
+
+func (r *stripeConnectRepository) GetUserOrgSpendByDeveloper(ctx context.Context, userOrgID string, from, to time.Time) ([]models.DeveloperSpend, error) {
+	query := `
+		SELECT developer_organization_id, COUNT(DISTINCT function_id), COUNT(*), COALESCE(SUM(amount), 0)
+		FROM tenant_schema.function_execution_transactions
+		WHERE user_organization_id = $1 AND executed_at >= $2 AND executed_at < $3 AND status = 'completed'
+		GROUP BY developer_organization_id
+		ORDER BY SUM(amount) DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userOrgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spend by developer: %w", err)
+	}
+	defer rows.Close()
+
+	spend := []models.DeveloperSpend{}
+	for rows.Next() {
+		var ds models.DeveloperSpend
+		if err := rows.Scan(&ds.DeveloperOrganizationID, &ds.FunctionCount, &ds.CallCount, &ds.TotalAmount); err != nil {
+			return nil, fmt.Errorf("failed to scan developer spend: %w", err)
+		}
+		spend = append(spend, ds)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return spend, nil
+}
+
+func (r *stripeConnectRepository) GetAccountLedgerSummary(ctx context.Context, orgID string, periodStart, periodEnd time.Time) (*models.AccountLedgerSummary, error) {
+	summary := &models.AccountLedgerSummary{}
+
+	query := `
+		SELECT
+			COALESCE(SUM(amount), 0),
+			COALESCE(SUM(amount) FILTER (WHERE created_at >= $3), 0),
+			COALESCE(SUM(amount) FILTER (WHERE created_at < $3 AND entry_type = 'top_up'), 0),
+			COALESCE(-SUM(amount) FILTER (WHERE created_at < $3 AND entry_type = 'charge'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE created_at < $3 AND entry_type = 'refund'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE created_at < $3 AND entry_type = 'adjustment'), 0)
+		FROM tenant_schema.account_ledger_entries
+		WHERE organization_id = $1 AND created_at >= $2
+	`
+
+	err := r.db.QueryRow(ctx, query, orgID, periodStart, periodEnd).Scan(
+		&summary.NetSinceStart, &summary.NetSinceEnd, &summary.TopUps,
+		&summary.Charges, &summary.Refunds, &summary.Adjustments,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account ledger summary: %w", err)
+	}
+
+	return summary, nil
+}
+
+// ================================
+// ANALYTICS OPERATIONS
+// ================================
+
+// RefreshEarningsRollup recomputes developer_earnings_daily from the start of the
+// day containing the previous watermark. Whole days are rebuilt so the refresh is
+// idempotent, and the new watermark trails NOW() to pick up in-flight inserts.
+func (r *stripeConnectRepository) RefreshEarningsRollup(ctx context.Context) (time.Time, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin rollup refresh: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tenant_schema.rollup_watermarks (rollup_name, refreshed_through)
+		VALUES ($1, 'epoch')
+		ON CONFLICT (rollup_name) DO NOTHING
+	`, models.EarningsRollupName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to initialize rollup watermark: %w", err)
+	}
+
+	var watermark, refreshedThrough time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT refreshed_through, NOW() - INTERVAL '5 minutes'
+		FROM tenant_schema.rollup_watermarks
+		WHERE rollup_name = $1
+		FOR UPDATE
+	`, models.EarningsRollupName).Scan(&watermark, &refreshedThrough)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock rollup watermark: %w", err)
+	}
+
+	watermark = watermark.UTC()
+	refreshFrom := time.Date(watermark.Year(), watermark.Month(), watermark.Day(), 0, 0, 0, 0, time.UTC)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM tenant_schema.developer_earnings_daily
+		WHERE day >= ($1::timestamptz AT TIME ZONE 'UTC')::date
+	`, refreshFrom)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to clear rollup days: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tenant_schema.developer_earnings_daily
+		(developer_organization_id, day, function_id, user_organization_id, call_count, gross_amount, platform_fees, net_amount)
+		SELECT developer_organization_id::text, (executed_at AT TIME ZONE 'UTC')::date, function_id, user_organization_id::text,
+		       COUNT(*), SUM(amount), SUM(platform_fee), SUM(net_amount)
+		FROM tenant_schema.function_execution_transactions
+		WHERE executed_at >= $1 AND executed_at < $2 AND status = 'completed'
+		GROUP BY 1, 2, 3, 4
+	`, refreshFrom, refreshedThrough)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to rebuild rollup days: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE tenant_schema.rollup_watermarks
+		SET refreshed_through = $1
+		WHERE rollup_name = $2
+	`, refreshedThrough, models.EarningsRollupName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to advance rollup watermark: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("failed to commit rollup refresh: %w", err)
+	}
+
+	return refreshedThrough, nil
+}
+
+func (r *stripeConnectRepository) GetEarningsRollupWatermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+
+	query := `
+		SELECT COALESCE(MAX(refreshed_through), 'epoch')
+		FROM tenant_schema.rollup_watermarks
+		WHERE rollup_name = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, models.EarningsRollupName).Scan(&watermark)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get rollup watermark: %w", err)
+	}
+
+	return watermark, nil
+}
+
+func (r *stripeConnectRepository) GetEarningsTotals(ctx context.Context, developerOrgID string, from, to time.Time) (*models.EarningsTotals, error) {
+	totals := &models.EarningsTotals{}
+
+	query := `
+		SELECT COALESCE(SUM(call_count), 0), COALESCE(SUM(gross_amount), 0), COALESCE(SUM(platform_fees), 0),
+		       COALESCE(SUM(net_amount), 0), COUNT(DISTINCT user_organization_id)
+		FROM tenant_schema.developer_earnings_daily
+		WHERE developer_organization_id = $1
+		  AND day >= ($2::timestamptz AT TIME ZONE 'UTC')::date
+		  AND day < ($3::timestamptz AT TIME ZONE 'UTC')::date
+	`
+
+	err := r.db.QueryRow(ctx, query, developerOrgID, from, to).Scan(
+		&totals.CallCount, &totals.GrossAmount, &totals.PlatformFees, &totals.NetAmount, &totals.UniquePayingOrgs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *stripeConnectRepository) GetEarningsSeries(ctx context.Context, developerOrgID, granularity string, from, to time.Time) ([]models.EarningsBucket, error) {
+	query := `
+		SELECT date_trunc($2, day::timestamp) AS bucket,
+		       SUM(call_count), SUM(gross_amount), SUM(platform_fees), SUM(net_amount), COUNT(DISTINCT user_organization_id)
+		FROM tenant_schema.developer_earnings_daily
+		WHERE developer_organization_id = $1
+		  AND day >= ($3::timestamptz AT TIME ZONE 'UTC')::date
+		  AND day < ($4::timestamptz AT TIME ZONE 'UTC')::date
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := r.db.Query(ctx, query, developerOrgID, granularity, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings series: %w", err)
+	}
+	defer rows.Close()
+
+	series := []models.EarningsBucket{}
+	for rows.Next() {
+		var b models.EarningsBucket
+		err := rows.Scan(&b.BucketStart, &b.CallCount, &b.GrossAmount, &b.PlatformFees, &b.NetAmount, &b.UniquePayingOrgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan earnings bucket: %w", err)
+		}
+		series = append(series, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return series, nil
+}
+
+func (r *stripeConnectRepository) GetEarningsByFunction(ctx context.Context, developerOrgID string, from, to time.Time) ([]models.FunctionEarnings, error) {
+	query := `
+		SELECT e.function_id, COALESCE(MAX(f.function_name), ''),
+		       SUM(e.call_count), SUM(e.gross_amount), SUM(e.platform_fees), SUM(e.net_amount), COUNT(DISTINCT e.user_organization_id)
+		FROM tenant_schema.developer_earnings_daily e
+		LEFT JOIN tenant_schema.functions f ON f.function_id::text = e.function_id
+		WHERE e.developer_organization_id = $1
+		  AND e.day >= ($2::timestamptz AT TIME ZONE 'UTC')::date
+		  AND e.day < ($3::timestamptz AT TIME ZONE 'UTC')::date
+		GROUP BY e.function_id
+		ORDER BY SUM(e.net_amount) DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, developerOrgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings by function: %w", err)
+	}
+	defer rows.Close()
+
+	earnings := []models.FunctionEarnings{}
+	for rows.Next() {
+		var fe models.FunctionEarnings
+		err := rows.Scan(&fe.FunctionID, &fe.FunctionName, &fe.CallCount, &fe.GrossAmount, &fe.PlatformFees, &fe.NetAmount, &fe.UniquePayingOrgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan function earnings: %w", err)
+		}
+		earnings = append(earnings, fe)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return earnings, nil
+}
+
+// ================================
+// SPENDING CAP OPERATIONS
+// ================================
+
+func (r *stripeConnectRepository) GetSpendingCapsByOrgID(ctx context.Context, orgID string) ([]*models.SpendingCap, error) {
+	query := `
+		SELECT id, organization_id, function_id, period, limit_amount, created_at, updated_at
+		FROM tenant_schema.spending_caps
+		WHERE organization_id = $1
+		ORDER BY function_id NULLS FIRST, period
+	`
+
+	rows, err := r.db.Query(ctx, query, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spending caps: %w", err)
+	}
+	defer rows.Close()
+
+	caps := []*models.SpendingCap{}
+	for rows.Next() {
+		spendingCap := &models.SpendingCap{}
+		err := rows.Scan(
+			&spendingCap.ID, &spendingCap.OrganizationID, &spendingCap.FunctionID, &spendingCap.Period, &spendingCap.LimitAmount,
+			&spendingCap.CreatedAt, &spendingCap.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan spending cap: %w", err)
+		}
+		caps = append(caps, spendingCap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return caps, nil
+}
+
+func (r *stripeConnectRepository) UpsertSpendingCap(ctx context.Context, spendingCap *models.SpendingCap) error {
+	query := `
+		INSERT INTO tenant_schema.spending_caps
+		(id, organization_id, function_id, period, limit_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (organization_id, (COALESCE(function_id, '')), period) DO UPDATE
+		SET limit_amount = EXCLUDED.limit_amount, updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		uuid.New().String(), spendingCap.OrganizationID, spendingCap.FunctionID, spendingCap.Period, spendingCap.LimitAmount,
+	).Scan(&spendingCap.ID, &spendingCap.CreatedAt, &spendingCap.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save spending cap: %w", err)
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) DeleteSpendingCap(ctx context.Context, capID string) error {
+	query := `
+		DELETE FROM tenant_schema.spending_caps
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, capID)
+	if err != nil {
+		return fmt.Errorf("failed to delete spending cap: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("spending cap")
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) GetUserOrgSpendSince(ctx context.Context, userOrgID string, functionID *string, since time.Time) (float64, error) {
+	return userOrgSpendSince(ctx, r.db, userOrgID, functionID, since)
+}
+
+// userOrgSpendSince sums the completed payments of a user organization through
+// db, which is either the pool or a transaction
+func userOrgSpendSince(ctx context.Context, db interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}, userOrgID string, functionID *string, since time.Time) (float64, error) {
+	var total float64
+
+	query := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM tenant_schema.function_execution_transactions
+		WHERE user_organization_id = $1
+		  AND ($2::text IS NULL OR function_id = $2)
+		  AND executed_at >= $3
+		  AND status = 'completed'
+	`
+
+	err := db.QueryRow(ctx, query, userOrgID, functionID, since).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user organization spend: %w", err)
+	}
+
+	return total, nil
+}
+
+// ================================
+// PAYOUT SCHEDULE OPERATIONS
+// ================================
+
+const payoutScheduleColumns = `
+	ps.developer_wallet_id, dw.organization_id, ps.frequency, ps.weekday, ps.day_of_month, ps.threshold, ps.reserve,
+	ps.next_run_at, ps.last_run_at, ps.last_withdrawal_id, ps.last_error, ps.created_at, ps.updated_at
+`
+
+func scanPayoutSchedule(row pgx.Row) (*models.PayoutSchedule, error) {
+	schedule := &models.PayoutSchedule{}
+	err := row.Scan(
+		&schedule.DeveloperWalletID, &schedule.OrganizationID, &schedule.Frequency, &schedule.Weekday, &schedule.DayOfMonth,
+		&schedule.Threshold, &schedule.Reserve, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.LastWithdrawalID,
+		&schedule.LastError, &schedule.CreatedAt, &schedule.UpdatedAt,
+	)
+	return schedule, err
+}
+
+func (r *stripeConnectRepository) GetPayoutSchedule(ctx context.Context, walletID string) (*models.PayoutSchedule, error) {
+	query := `
+		SELECT ` + payoutScheduleColumns + `
+		FROM tenant_schema.payout_schedules ps
+		JOIN tenant_schema.developer_wallets dw ON dw.id = ps.developer_wallet_id
+		WHERE ps.developer_wallet_id = $1
+	`
+
+	schedule, err := scanPayoutSchedule(r.db.QueryRow(ctx, query, walletID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("payout schedule")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+func (r *stripeConnectRepository) UpsertPayoutSchedule(ctx context.Context, schedule *models.PayoutSchedule) error {
+	query := `
+		INSERT INTO tenant_schema.payout_schedules
+		(developer_wallet_id, frequency, weekday, day_of_month, threshold, reserve, next_run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		ON CONFLICT (developer_wallet_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency, weekday = EXCLUDED.weekday, day_of_month = EXCLUDED.day_of_month,
+		    threshold = EXCLUDED.threshold, reserve = EXCLUDED.reserve, next_run_at = EXCLUDED.next_run_at, updated_at = NOW()
+		RETURNING last_run_at, last_withdrawal_id, last_error, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		schedule.DeveloperWalletID, schedule.Frequency, schedule.Weekday, schedule.DayOfMonth, schedule.Threshold, schedule.Reserve, schedule.NextRunAt,
+	).Scan(&schedule.LastRunAt, &schedule.LastWithdrawalID, &schedule.LastError, &schedule.CreatedAt, &schedule.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save payout schedule: %w", err)
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) GetDuePayoutSchedules(ctx context.Context, now time.Time, limit int) ([]*models.PayoutSchedule, error) {
+	query := `
+		SELECT ` + payoutScheduleColumns + `
+		FROM tenant_schema.payout_schedules ps
+		JOIN tenant_schema.developer_wallets dw ON dw.id = ps.developer_wallet_id
+		WHERE ps.next_run_at <= $1
+		ORDER BY ps.next_run_at, ps.developer_wallet_id
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due payout schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []*models.PayoutSchedule{}
+	for rows.Next() {
+		schedule, err := scanPayoutSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payout schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return schedules, nil
+}
+
+func (r *stripeConnectRepository) RecordPayoutRun(ctx context.Context, walletID string, ranAt time.Time, nextRunAt *time.Time, withdrawalID, lastError *string) error {
+	query := `
+		UPDATE tenant_schema.payout_schedules
+		SET last_run_at = $1, next_run_at = $2, last_withdrawal_id = COALESCE($3, last_withdrawal_id), last_error = $4, updated_at = NOW()
+		WHERE developer_wallet_id = $5
+	`
+
+	result, err := r.db.Exec(ctx, query, ranAt, nextRunAt, withdrawalID, lastError, walletID)
+	if err != nil {
+		return fmt.Errorf("failed to record payout run: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("payout schedule")
+	}
+
+	return nil
+}
+
+// ================================
+// PAYOUT BATCH OPERATIONS
+// ================================
+
+func (r *stripeConnectRepository) GetPayoutCandidates(ctx context.Context, cutoff time.Time, minimum float64) ([]*models.PayoutBatchEntry, error) {
+	query := `
+		SELECT id, organization_id, FLOOR(payable * 100) / 100
+		FROM (
+			SELECT dw.id, dw.organization_id,
+			       GREATEST(COALESCE(ps.threshold, 0), $2) AS threshold,
+			       dw.balance - dw.pending_balance - COALESCE(ps.reserve, 0)
+			       - COALESCE((
+			           SELECT SUM(wr.amount)
+			           FROM tenant_schema.withdrawal_requests wr
+			           WHERE wr.developer_wallet_id = dw.id AND wr.status IN ('pending', 'processing') AND wr.stripe_transfer_id IS NULL
+			       ), 0)
+			       - COALESCE((
+			           SELECT SUM(t.net_amount)
+			           FROM tenant_schema.function_execution_transactions t
+			           WHERE t.developer_wallet_id = dw.id AND t.released_at IS NOT NULL AND t.available_at > $1
+			       ), 0) AS payable
+			FROM tenant_schema.developer_wallets dw
+			LEFT JOIN tenant_schema.payout_schedules ps ON ps.developer_wallet_id = dw.id
+			WHERE dw.onboarding_completed AND dw.payouts_enabled AND dw.stripe_connect_account_id IS NOT NULL
+		) candidates
+		WHERE FLOOR(payable * 100) / 100 >= threshold
+		ORDER BY payable DESC, organization_id
+	`
+
+	rows, err := r.db.Query(ctx, query, cutoff, minimum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout candidates: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.PayoutBatchEntry{}
+	for rows.Next() {
+		entry := &models.PayoutBatchEntry{Status: models.PayoutBatchEntryPending}
+		if err := rows.Scan(&entry.DeveloperWalletID, &entry.OrganizationID, &entry.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan payout candidate: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *stripeConnectRepository) CreatePayoutBatch(ctx context.Context, batch *models.PayoutBatch, entries []*models.PayoutBatchEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch.ID = uuid.New().String()
+	batch.Status = models.PayoutBatchStatusDraft
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tenant_schema.payout_batches (id, status, cutoff_at)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at
+	`, batch.ID, batch.Status, batch.CutoffAt).Scan(&batch.CreatedAt, &batch.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create payout batch: %w", err)
+	}
+
+	for _, entry := range entries {
+		entry.ID = uuid.New().String()
+		entry.BatchID = batch.ID
+		entry.Status = models.PayoutBatchEntryPending
+		err = tx.QueryRow(ctx, `
+			INSERT INTO tenant_schema.payout_batch_entries (id, batch_id, developer_wallet_id, organization_id, amount, excluded, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING created_at, updated_at
+		`, entry.ID, entry.BatchID, entry.DeveloperWalletID, entry.OrganizationID, entry.Amount, entry.Excluded, entry.Status,
+		).Scan(&entry.CreatedAt, &entry.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create payout batch entry: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit payout batch: %w", err)
+	}
+
+	return nil
+}
+
+const payoutBatchColumns = `id, status, cutoff_at, executed_at, completed_at, created_at, updated_at`
+
+func scanPayoutBatch(row pgx.Row) (*models.PayoutBatch, error) {
+	batch := &models.PayoutBatch{}
+	err := row.Scan(&batch.ID, &batch.Status, &batch.CutoffAt, &batch.ExecutedAt, &batch.CompletedAt, &batch.CreatedAt, &batch.UpdatedAt)
+	return batch, err
+}
+
+func (r *stripeConnectRepository) GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatch, error) {
+	query := `SELECT ` + payoutBatchColumns + ` FROM tenant_schema.payout_batches WHERE id = $1`
+
+	batch, err := scanPayoutBatch(r.db.QueryRow(ctx, query, batchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("payout batch")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout batch: %w", err)
+	}
+
+	return batch, nil
+}
+
+func (r *stripeConnectRepository) GetPayoutBatches(ctx context.Context, page models.PageRequest) ([]*models.PayoutBatch, int, error) {
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM tenant_schema.payout_batches`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count payout batches: %w", err)
+	}
+
+	where := &whereBuilder{}
+	if page.After != nil {
+		where.add("(created_at, id) < (?, ?::uuid)", page.After.Time, page.After.ID)
+	}
+
+	query := `
+		SELECT ` + payoutBatchColumns + `
+		FROM tenant_schema.payout_batches
+		` + where.sql() + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + where.arg(page.Limit) + ` OFFSET ` + where.arg(page.Offset())
+
+	rows, err := r.db.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get payout batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []*models.PayoutBatch
+	for rows.Next() {
+		batch, err := scanPayoutBatch(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan payout batch: %w", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return batches, total, nil
+}
+
+func (r *stripeConnectRepository) GetPayoutBatchEntries(ctx context.Context, batchID string) ([]*models.PayoutBatchEntry, error) {
+	query := `
+		SELECT e.id, e.batch_id, e.developer_wallet_id, e.organization_id, e.amount, e.excluded, e.status,
+		       e.withdrawal_id, wr.status, e.error, e.created_at, e.updated_at
+		FROM tenant_schema.payout_batch_entries e
+		LEFT JOIN tenant_schema.withdrawal_requests wr ON wr.id = e.withdrawal_id
+		WHERE e.batch_id = $1
+		ORDER BY e.amount DESC, e.organization_id
 	`
 
-	result, err := r.db.Exec(ctx, query, amount, accountID)
+	rows, err := r.db.Query(ctx, query, batchID)
 	if err != nil {
-		return fmt.Errorf("failed to deduct balance: %w", err)
+		return nil, fmt.Errorf("failed to get payout batch entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.PayoutBatchEntry{}
+	for rows.Next() {
+		entry := &models.PayoutBatchEntry{}
+		err := rows.Scan(
+			&entry.ID, &entry.BatchID, &entry.DeveloperWalletID, &entry.OrganizationID, &entry.Amount, &entry.Excluded, &entry.Status,
+			&entry.WithdrawalID, &entry.WithdrawalStatus, &entry.Error, &entry.CreatedAt, &entry.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payout batch entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *stripeConnectRepository) SetPayoutBatchEntriesExcluded(ctx context.Context, batchID string, entryIDs []string, excluded bool) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the batch keeps it from being executed until the entries are updated
+	status, err := lockPayoutBatch(ctx, tx, batchID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && status != models.PayoutBatchStatusDraft) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock payout batch: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE tenant_schema.payout_batch_entries
+		SET excluded = $1, updated_at = NOW()
+		WHERE batch_id = $2 AND id = ANY($3::uuid[])
+	`, excluded, batchID, entryIDs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update payout batch entries: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit payout batch entries: %w", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
+
+func (r *stripeConnectRepository) TransitionPayoutBatch(ctx context.Context, batchID, from, to string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Takes the same lock as changing the entries, so a batch starts executing
+	// only with the entries of a finished change
+	status, err := lockPayoutBatch(ctx, tx, batchID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && status != from) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock payout batch: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE tenant_schema.payout_batches
+		SET status = $1,
+		    executed_at = CASE WHEN $1 = 'executing' THEN COALESCE(executed_at, NOW()) ELSE executed_at END,
+		    completed_at = CASE WHEN $1 = 'completed' THEN NOW() ELSE completed_at END,
+		    updated_at = NOW()
+		WHERE id = $2
+	`, to, batchID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update payout batch status: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit payout batch status: %w", err)
+	}
+
+	return true, nil
+}
+
+// lockPayoutBatch locks the row of a payout batch for the rest of tx and
+// returns its status
+func lockPayoutBatch(ctx context.Context, tx pgx.Tx, batchID string) (string, error) {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM tenant_schema.payout_batches WHERE id = $1 FOR UPDATE`, batchID).Scan(&status)
+	return status, err
+}
+
+func (r *stripeConnectRepository) RecordPayoutBatchEntry(ctx context.Context, entryID, status string, withdrawalID, errorMessage *string) error {
+	query := `
+		UPDATE tenant_schema.payout_batch_entries
+		SET status = $1, withdrawal_id = $2, error = $3, updated_at = NOW()
+		WHERE id = $4
+	`
+
+	result, err := r.db.Exec(ctx, query, status, withdrawalID, errorMessage, entryID)
+	if err != nil {
+		return fmt.Errorf("failed to record payout batch entry: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("payout batch entry")
+	}
+
+	return nil
+}
+
+// ================================
+// ADVISORY LOCKS
+// ================================
+
+// WithAdvisoryLock holds a session advisory lock on a dedicated connection,
+// keyed by the tenant schema and name so tenants do not block each other
+func (r *stripeConnectRepository) WithAdvisoryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := r.db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock connection: %w", err)
+	}
+	defer conn.Release()
+
+	unlock, locked, err := database.TryAdvisoryLock(ctx, conn, database.AdvisoryLockKey(tenant.FromContext(ctx)+":"+name))
+	if err != nil {
+		return false, fmt.Errorf("failed to take advisory lock %s: %w", name, err)
+	}
+	if !locked {
+		return false, nil
+	}
+	defer unlock()
+
+	return true, fn(ctx)
+}
+
+// ================================
+// WEBHOOK INBOX OPERATIONS
+// ================================
+
+func (r *stripeConnectRepository) RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error) {
+	// A redelivered event is handled again only if its last attempt did not finish
+	query := `
+		INSERT INTO tenant_schema.webhook_events (event_id, event_type, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (event_id) DO UPDATE
+		SET status = 'received',
+		    attempts = tenant_schema.webhook_events.attempts + 1
+		WHERE tenant_schema.webhook_events.status IN ('received', 'failed')
+	`
+
+	result, err := r.db.Exec(ctx, query, eventID, eventType, payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *stripeConnectRepository) CompleteWebhookEvent(ctx context.Context, eventID, status string, lastError *string) error {
+	query := `
+		UPDATE tenant_schema.webhook_events
+		SET status = $2, last_error = $3, processed_at = NOW()
+		WHERE event_id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, eventID, status, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to complete webhook event: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.NotFound("webhook event")
+	}
+
+	return nil
+}
+
+func (r *stripeConnectRepository) GetWebhookBacklog(ctx context.Context) (*models.QueueStats, error) {
+	stats := &models.QueueStats{}
+
+	query := `
+		SELECT COUNT(*), MIN(received_at)
+		FROM tenant_schema.webhook_events
+		WHERE status IN ('received', 'failed')
+	`
+
+	err := r.db.QueryRow(ctx, query).Scan(&stats.Count, &stats.OldestAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook backlog: %w", err)
+	}
+
+	return stats, nil
+}
+
+// ================================
+// RECONCILIATION OPERATIONS
+// ================================
+
+func (r *stripeConnectRepository) GetConnectedWallets(ctx context.Context) ([]*models.DeveloperWallet, error) {
+	query := `
+		SELECT id, organization_id, stripe_connect_account_id, balance, total_earned, total_withdrawn,
+		       onboarding_completed, onboarding_url, payouts_enabled, charges_enabled, status_synced_at, pending_balance, tier, created_at, updated_at
+		FROM tenant_schema.developer_wallets
+		WHERE stripe_connect_account_id IS NOT NULL
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query connected wallets: %w", err)
+	}
+	defer rows.Close()
+
+	var wallets []*models.DeveloperWallet
+	for rows.Next() {
+		wallet := &models.DeveloperWallet{}
+		err := rows.Scan(
+			&wallet.ID, &wallet.OrganizationID, &wallet.StripeConnectAccountID, &wallet.Balance,
+			&wallet.TotalEarned, &wallet.TotalWithdrawn, &wallet.OnboardingCompleted, &wallet.OnboardingURL,
+			&wallet.PayoutsEnabled, &wallet.ChargesEnabled, &wallet.StatusSyncedAt, &wallet.PendingBalance, &wallet.Tier, &wallet.CreatedAt, &wallet.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return wallets, nil
+}
+
+func (r *stripeConnectRepository) GetUnpaidTransfersTotal(ctx context.Context, walletID string) (float64, error) {
+	var total float64
+
+	query := `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM tenant_schema.withdrawal_requests
+		WHERE developer_wallet_id = $1 AND status = 'failed' AND stripe_transfer_id IS NOT NULL
+	`
+
+	err := r.db.QueryRow(ctx, query, walletID).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unpaid transfers: %w", err)
+	}
+
+	return total, nil
+}
+
+func (r *stripeConnectRepository) UpsertReconciliationIssue(ctx context.Context, issue *models.ReconciliationIssue) error {
+	// A resolved issue that shows up again is reopened
+	query := `
+		INSERT INTO tenant_schema.reconciliation_issues
+		(id, issue_type, status, stripe_account_id, stripe_object_id, withdrawal_id, organization_id,
+		 local_amount, stripe_amount, local_status, stripe_status, details, first_seen_at, last_seen_at)
+		VALUES ($1, $2, 'open', $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+		ON CONFLICT (issue_type, stripe_object_id) DO UPDATE
+		SET status = 'open',
+		    withdrawal_id = EXCLUDED.withdrawal_id,
+		    organization_id = EXCLUDED.organization_id,
+		    local_amount = EXCLUDED.local_amount,
+		    stripe_amount = EXCLUDED.stripe_amount,
+		    local_status = EXCLUDED.local_status,
+		    stripe_status = EXCLUDED.stripe_status,
+		    details = EXCLUDED.details,
+		    last_seen_at = NOW(),
+		    resolved_at = NULL
+		RETURNING id, status, first_seen_at, last_seen_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		uuid.New().String(), issue.IssueType, issue.StripeAccountID, issue.StripeObjectID, issue.WithdrawalID,
+		issue.OrganizationID, issue.LocalAmount, issue.StripeAmount, issue.LocalStatus, issue.StripeStatus, issue.Details,
+	).Scan(&issue.ID, &issue.Status, &issue.FirstSeenAt, &issue.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation issue: %w", err)
+	}
+
+	issue.ResolvedAt = nil
+	return nil
+}
+
+func (r *stripeConnectRepository) ResolveReconciliationIssues(ctx context.Context, objectIDs, stillOpen []string) (int, error) {
+	if len(objectIDs) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		UPDATE tenant_schema.reconciliation_issues
+		SET status = 'resolved', resolved_at = NOW()
+		WHERE status = 'open' AND stripe_object_id = ANY($1) AND NOT (id::text = ANY($2))
+	`
+
+	result, err := r.db.Exec(ctx, query, objectIDs, stillOpen)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve reconciliation issues: %w", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
+
+func (r *stripeConnectRepository) GetReconciliationIssues(ctx context.Context, filter models.ReconciliationIssueFilter, page models.PageRequest) ([]*models.ReconciliationIssue, int, error) {
+	where := &whereBuilder{}
+	if filter.Status != "" {
+		where.add("status = ?", filter.Status)
+	}
+	if filter.IssueType != "" {
+		where.add("issue_type = ?", filter.IssueType)
+	}
+	if filter.StripeAccountID != "" {
+		where.add("stripe_account_id = ?", filter.StripeAccountID)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM tenant_schema.reconciliation_issues ` + where.sql()
+	if err := r.db.QueryRow(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count reconciliation issues: %w", err)
+	}
+
+	pageWhere := where.clone()
+	if page.After != nil {
+		pageWhere.add("(first_seen_at, id) < (?, ?::uuid)", page.After.Time, page.After.ID)
+	}
+
+	query := `
+		SELECT id, issue_type, status, stripe_account_id, stripe_object_id, withdrawal_id, organization_id,
+		       local_amount, stripe_amount, local_status, stripe_status, details, first_seen_at, last_seen_at, resolved_at
+		FROM tenant_schema.reconciliation_issues
+		` + pageWhere.sql() + `
+		ORDER BY first_seen_at DESC, id DESC
+		LIMIT ` + pageWhere.arg(page.Limit) + ` OFFSET ` + pageWhere.arg(page.Offset())
+
+	rows, err := r.db.Query(ctx, query, pageWhere.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get reconciliation issues: %w", err)
+	}
+	defer rows.Close()
+
+	var issues []*models.ReconciliationIssue
+	for rows.Next() {
+		issue := &models.ReconciliationIssue{}
+		err := rows.Scan(
+			&issue.ID, &issue.IssueType, &issue.Status, &issue.StripeAccountID, &issue.StripeObjectID,
+			&issue.WithdrawalID, &issue.OrganizationID, &issue.LocalAmount, &issue.StripeAmount,
+			&issue.LocalStatus, &issue.StripeStatus, &issue.Details, &issue.FirstSeenAt, &issue.LastSeenAt, &issue.ResolvedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan reconciliation issue: %w", err)
+		}
+		issues = append(issues, issue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("insufficient balance")
+	return issues, total, nil
+}
+
+func (r *stripeConnectRepository) CreateReconciliationRun(ctx context.Context, run *models.ReconciliationRun) error {
+	run.ID = uuid.New().String()
+
+	query := `
+		INSERT INTO tenant_schema.reconciliation_runs
+		(id, started_at, finished_at, since, accounts_checked, issues_found, issues_resolved, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.Exec(ctx, query,
+		run.ID, run.StartedAt, run.FinishedAt, run.Since, run.AccountsChecked, run.IssuesFound, run.IssuesResolved, run.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save reconciliation run: %w", err)
 	}
 
 	return nil
 }
+
+func (r *stripeConnectRepository) GetLastReconciliationRun(ctx context.Context, successfulOnly bool) (*models.ReconciliationRun, error) {
+	run := &models.ReconciliationRun{}
+
+	query := `
+		SELECT id, started_at, finished_at, since, accounts_checked, issues_found, issues_resolved, error
+		FROM tenant_schema.reconciliation_runs
+		WHERE NOT $1 OR error IS NULL
+		ORDER BY started_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.QueryRow(ctx, query, successfulOnly).Scan(
+		&run.ID, &run.StartedAt, &run.FinishedAt, &run.Since, &run.AccountsChecked,
+		&run.IssuesFound, &run.IssuesResolved, &run.Error,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperrors.NotFound("reconciliation run")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation run: %w", err)
+	}
+
+	return run, nil
+}
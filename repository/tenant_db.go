@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"strpe-connect/tenant"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tenantDB runs queries written against tenant_schema in the schema of the
+// tenant carried by the context, so every repository serves all tenants from
+// one pool
+type tenantDB struct {
+	pool *pgxpool.Pool
+}
+
+func newTenantDB(pool *pgxpool.Pool) *tenantDB {
+	return &tenantDB{pool: pool}
+}
+
+func (db *tenantDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return db.pool.Exec(ctx, tenant.Qualify(ctx, sql), args...)
+}
+
+func (db *tenantDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return db.pool.Query(ctx, tenant.Qualify(ctx, sql), args...)
+}
+
+func (db *tenantDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return db.pool.QueryRow(ctx, tenant.Qualify(ctx, sql), args...)
+}
+
+func (db *tenantDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantTx{Tx: tx}, nil
+}
+
+// tenantTx qualifies the queries of a transaction the same way
+type tenantTx struct {
+	pgx.Tx
+}
+
+func (tx *tenantTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.Tx.Exec(ctx, tenant.Qualify(ctx, sql), args...)
+}
+
+func (tx *tenantTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return tx.Tx.Query(ctx, tenant.Qualify(ctx, sql), args...)
+}
+
+func (tx *tenantTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tx.Tx.QueryRow(ctx, tenant.Qualify(ctx, sql), args...)
+}
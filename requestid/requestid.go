@@ -0,0 +1,23 @@
+// Package requestid carries the ID of the current HTTP request through a context
+package requestid
+
+import "context"
+
+// Header is the HTTP header the request ID is read from and echoed in
+const Header = "X-Request-ID"
+
+// MaxLength bounds client supplied request IDs
+const MaxLength = 128
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
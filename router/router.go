@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"strpe-connect/handlers"
+	"strpe-connect/middleware"
+	"strpe-connect/ratelimit"
+	"strpe-connect/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the dependencies shared by every API version
+type Config struct {
+	Handler         *handlers.StripeConnectHandler
+	IdempotencyRepo repository.IdempotencyRepository
+	IdempotencyTTL  time.Duration
+	IdempotencyLock time.Duration     // How long a request holds its key before a retry may take it over
+	Limiter         ratelimit.Limiter // nil disables per-organization rate limiting
+	LegacySunset    time.Time         // Advertised in the Sunset header of unversioned routes
+	TenantSchemas   []string          // Schemas selectable with X-Tenant-ID, the first is the default
+}
+
+// Version is one major version of the HTTP API, mounted under /api/<Name>.
+// A new major version gets its own register function and response DTOs,
+// and is appended to Versions alongside the existing ones.
+type Version struct {
+	Name     string
+	Register func(api *gin.RouterGroup, cfg Config)
+}
+
+// Versions lists every API version served
+var Versions = []Version{
+	{Name: "v1", Register: registerV1},
+}
+
+// LegacyVersion is also served at the unversioned /api paths, as a deprecated alias
+const LegacyVersion = "v1"
+
+// Register mounts all API versions on r
+func Register(r *gin.Engine, cfg Config) {
+	api := r.Group("/api", middleware.Tenant(cfg.TenantSchemas))
+
+	for _, version := range Versions {
+		versioned := api.Group("/"+version.Name, apiVersionHeader(version.Name))
+		version.Register(versioned, cfg)
+
+		if version.Name == LegacyVersion {
+			legacy := api.Group("", apiVersionHeader(version.Name), Deprecated(version.Name, cfg.LegacySunset))
+			version.Register(legacy, cfg)
+		}
+	}
+}
+
+func apiVersionHeader(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("API-Version", version)
+		c.Next()
+	}
+}
+
+// Deprecated marks responses of unversioned routes with Deprecation, Sunset and
+// a Link to the versioned successor so clients can migrate before removal.
+func Deprecated(successorVersion string, sunset time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := strings.Replace(c.Request.URL.Path, "/api/", "/api/"+successorVersion+"/", 1)
+
+		c.Header("Deprecation", "true")
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"strpe-connect/gateway"
+	"strpe-connect/handlers"
+	"strpe-connect/repository"
+	"strpe-connect/services"
+)
+
+func newTestRouter(sunset time.Time) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	service := services.NewStripeConnectService(repository.NewMemoryRepository(), gateway.NewFake(gateway.FakeOptions{}), services.Options{})
+	r := gin.New()
+	Register(r, Config{
+		Handler:      handlers.NewStripeConnectHandler(service, "whsec_test"),
+		LegacySunset: sunset,
+	})
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Organization-ID", "org-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	sunset := time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+	r := newTestRouter(sunset)
+
+	// The successor link points at the path, without the query
+	legacy := get(r, "/api/connect/wallet/balance?page=1")
+	versioned := get(r, "/api/v1/connect/wallet/balance?page=1")
+
+	if legacy.Code != versioned.Code || legacy.Body.String() != versioned.Body.String() {
+		t.Errorf("legacy response %d %s, want the v1 response %d %s", legacy.Code, legacy.Body, versioned.Code, versioned.Body)
+	}
+
+	wantLegacy := map[string]string{
+		"API-Version": "v1",
+		"Deprecation": "true",
+		"Sunset":      "Wed, 30 Jun 2027 00:00:00 GMT",
+		"Link":        `</api/v1/connect/wallet/balance>; rel="successor-version"`,
+	}
+	for header, want := range wantLegacy {
+		if got := legacy.Header().Get(header); got != want {
+			t.Errorf("legacy %s = %q, want %q", header, got, want)
+		}
+	}
+
+	if got := versioned.Header().Get("API-Version"); got != "v1" {
+		t.Errorf("v1 API-Version = %q, want v1", got)
+	}
+	for _, header := range []string{"Deprecation", "Sunset", "Link"} {
+		if got := versioned.Header().Get(header); got != "" {
+			t.Errorf("v1 %s = %q, want none", header, got)
+		}
+	}
+}
+
+func TestLegacyRoutesWithoutSunset(t *testing.T) {
+	r := newTestRouter(time.Time{})
+
+	rec := get(r, "/api/admin/connected-developers")
+	if rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Link") != `</api/v1/admin/connected-developers>; rel="successor-version"` {
+		t.Errorf("headers = %v, want the deprecation and successor link", rec.Header())
+	}
+	if got := rec.Header().Get("Sunset"); got != "" {
+		t.Errorf("Sunset = %q, want none without a sunset date", got)
+	}
+}
+
+func TestLegacyRoutesMirrorVersionedRoutes(t *testing.T) {
+	r := newTestRouter(time.Time{})
+
+	for _, route := range r.Routes() {
+		const prefix = "/api/v1/"
+		if len(route.Path) <= len(prefix) || route.Path[:len(prefix)] != prefix {
+			continue
+		}
+		legacyPath := "/api/" + route.Path[len(prefix):]
+		found := false
+		for _, other := range r.Routes() {
+			if other.Method == route.Method && other.Path == legacyPath {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%s %s has no unversioned alias %s", route.Method, route.Path, legacyPath)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"strpe-connect/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerV1 mounts the v1 API. Its request and response bodies are the DTOs
+// in the models package; they must stay backwards compatible within v1.
+func registerV1(api *gin.RouterGroup, cfg Config) {
+	handler := cfg.Handler
+
+	// Stripe Connect routes
+	connect := api.Group("/connect")
+	if cfg.Limiter != nil {
+		connect.Use(middleware.RateLimit(cfg.Limiter))
+	}
+	connect.Use(middleware.Idempotency(cfg.IdempotencyRepo, cfg.IdempotencyTTL, cfg.IdempotencyLock))
+	{
+		// Onboarding
+		connect.POST("/onboard", handler.CreateConnectAccount)
+		connect.GET("/status", handler.GetConnectAccountStatus)
+		connect.POST("/refresh-onboarding", handler.RefreshOnboardingLink)
+		connect.GET("/connected-developers", handler.GetConnectedDevelopersForOrg)
+
+		// Wallet
+		wallet := connect.Group("/wallet")
+		{
+			wallet.GET("/balance", handler.GetWalletBalance)
+			wallet.GET("/transactions", handler.GetTransactionHistory)
+			wallet.GET("/analytics", handler.GetEarningsAnalytics)
+		}
+
+		// Withdrawals
+		withdrawals := connect.Group("/withdrawals")
+		{
+			withdrawals.POST("/request", handler.RequestWithdrawal)
+			withdrawals.GET("/history", handler.GetWithdrawalHistory)
+			withdrawals.GET("/schedule", handler.GetPayoutSchedule)
+			withdrawals.PUT("/schedule", handler.SetPayoutSchedule)
+		}
+
+		// Payments
+		payments := connect.Group("/payments")
+		{
+			payments.POST("/execute", handler.ProcessFunctionPayment)
+		}
+	}
+
+	// Billing routes for paying user organizations
+	billing := api.Group("/billing")
+	if cfg.Limiter != nil {
+		billing.Use(middleware.RateLimit(cfg.Limiter))
+	}
+	{
+		billing.GET("/transactions", handler.GetSpendHistory)
+		billing.GET("/usage", handler.GetBillingUsage)
+		billing.GET("/statements/:month", handler.GetBillingStatement)
+	}
+
+	// Admin endpoints
+	admin := api.Group("/admin")
+	{
+		admin.GET("/connected-developers", handler.GetConnectedDevelopers)
+		admin.POST("/connected-developers/:org_id/refresh-status", handler.RefreshConnectAccountStatus)
+		admin.PUT("/connected-developers/:org_id/tier", handler.SetDeveloperTier)
+
+		// Spending caps
+		admin.GET("/spending-caps", handler.GetSpendingCaps)
+		admin.PUT("/spending-caps", handler.SetSpendingCap)
+		admin.DELETE("/spending-caps/:id", handler.DeleteSpendingCap)
+
+		// Reconciliation
+		admin.GET("/reconciliation/issues", handler.GetReconciliationIssues)
+		admin.POST("/reconciliation/run", handler.RunReconciliation)
+
+		// Solvency
+		admin.GET("/solvency", handler.GetSolvencyReport)
+
+		// Payout batches
+		admin.GET("/payout-batches", handler.GetPayoutBatches)
+		admin.POST("/payout-batches", handler.CreatePayoutBatch)
+		admin.GET("/payout-batches/:id", handler.GetPayoutBatch)
+		admin.PATCH("/payout-batches/:id/entries", handler.UpdatePayoutBatchEntries)
+		admin.POST("/payout-batches/:id/execute", handler.ExecutePayoutBatch)
+		admin.GET("/payout-batches/:id/report", handler.GetPayoutBatchReport)
+	}
+
+	// Webhooks
+	webhooks := api.Group("/webhooks")
+	{
+		webhooks.POST("/stripe-connect", handler.HandleWebhook)
+	}
+}
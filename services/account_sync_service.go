@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"sync"
+	"time"
+)
+
+// AccountSyncOptions tunes the background sync of Connect account status. Zero
+// fields use the defaults below.
+type AccountSyncOptions struct {
+	StaleAfter           time.Duration // Onboarded accounts are read again after this long
+	OnboardingStaleAfter time.Duration // Accounts still onboarding are read again after this long
+	BatchSize            int           // Accounts read per run
+	Concurrency          int           // Stripe calls in flight
+	RequestsPerSecond    float64       // Stripe calls started per second, across all workers
+}
+
+const (
+	DefaultAccountSyncStaleAfter           = 24 * time.Hour
+	DefaultAccountSyncOnboardingStaleAfter = 5 * time.Minute
+	DefaultAccountSyncBatchSize            = 200
+	DefaultAccountSyncConcurrency          = 4
+	DefaultAccountSyncRequestsPerSecond    = 10
+)
+
+func (o AccountSyncOptions) withDefaults() AccountSyncOptions {
+	if o.StaleAfter <= 0 {
+		o.StaleAfter = DefaultAccountSyncStaleAfter
+	}
+	if o.OnboardingStaleAfter <= 0 {
+		o.OnboardingStaleAfter = DefaultAccountSyncOnboardingStaleAfter
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultAccountSyncBatchSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultAccountSyncConcurrency
+	}
+	if o.RequestsPerSecond <= 0 {
+		o.RequestsPerSecond = DefaultAccountSyncRequestsPerSecond
+	}
+	return o
+}
+
+// ================================
+// ACCOUNT STATUS SYNC
+// ================================
+
+// SyncConnectAccounts reads the status of Connect accounts from Stripe for the
+// wallets of the tenant in ctx that were never synced, were synced longer than
+// StaleAfter ago, or are still onboarding and were synced longer than
+// OnboardingStaleAfter ago. Calls are paced to RequestsPerSecond, and the run
+// stops at the first rate limit or outage so the next run picks up the rest.
+// It returns how many accounts were synced.
+func (s *stripeConnectService) SyncConnectAccounts(ctx context.Context) (int, error) {
+	now := time.Now()
+	wallets, err := s.repo.GetWalletsToSync(ctx, now.Add(-s.accountSync.StaleAfter), now.Add(-s.accountSync.OnboardingStaleAfter), s.accountSync.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get wallets to sync: %w", err)
+	}
+	if len(wallets) == 0 {
+		return 0, nil
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	pace := time.NewTicker(time.Duration(float64(time.Second) / s.accountSync.RequestsPerSecond))
+	defer pace.Stop()
+
+	var (
+		mu       sync.Mutex
+		synced   int
+		failures []error
+		wg       sync.WaitGroup
+	)
+	queue := make(chan *models.DeveloperWallet)
+	for i := 0; i < s.accountSync.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for wallet := range queue {
+				err := s.syncAccountStatus(ctx, wallet)
+
+				mu.Lock()
+				if err == nil {
+					synced++
+				} else if ctx.Err() == nil {
+					failures = append(failures, err)
+					slog.WarnContext(ctx, "failed to sync account status", "organization_id", wallet.OrganizationID, "error", err)
+				}
+				mu.Unlock()
+
+				// Stripe is rate limiting or down, leave the rest for the next run
+				if apperrors.IsTransient(err) {
+					stop()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, wallet := range wallets {
+		select {
+		case <-ctx.Done():
+			break feed
+		case <-pace.C:
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- wallet:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	slog.InfoContext(ctx, "account status sync finished", "due", len(wallets), "synced", synced, "failed", len(failures))
+	if len(failures) > 0 {
+		return synced, fmt.Errorf("failed to sync %d of %d accounts: %w", len(failures), len(wallets), errors.Join(failures...))
+	}
+	return synced, nil
+}
+
+// RefreshConnectAccountStatus reads the status of an organization's Connect
+// account from Stripe right away, for admins who cannot wait for a webhook
+// or the next sync
+func (s *stripeConnectService) RefreshConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error) {
+	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+	if wallet.StripeConnectAccountID == nil || *wallet.StripeConnectAccountID == "" {
+		return nil, apperrors.NotFound("Stripe Connect account")
+	}
+
+	if err := s.syncAccountStatus(ctx, wallet); err != nil {
+		return nil, err
+	}
+
+	return s.accountStatus(ctx, wallet), nil
+}
+
+// syncAccountStatus reads the account of wallet from Stripe and saves its
+// status flags, updating wallet to match
+func (s *stripeConnectService) syncAccountStatus(ctx context.Context, wallet *models.DeveloperWallet) error {
+	acc, err := s.gateway.GetAccount(ctx, *wallet.StripeConnectAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get Stripe account: %w", stripeError(err))
+	}
+
+	return s.saveAccountStatus(ctx, wallet, acc)
+}
+
+func (s *stripeConnectService) saveAccountStatus(ctx context.Context, wallet *models.DeveloperWallet, acc *gateway.Account) error {
+	if err := s.repo.UpdateOnboardingStatus(ctx, wallet.ID, acc.DetailsSubmitted, acc.PayoutsEnabled, acc.ChargesEnabled); err != nil {
+		return fmt.Errorf("failed to update onboarding status: %w", err)
+	}
+
+	changed := wallet.OnboardingCompleted != acc.DetailsSubmitted || wallet.PayoutsEnabled != acc.PayoutsEnabled || wallet.ChargesEnabled != acc.ChargesEnabled
+	now := time.Now()
+	wallet.OnboardingCompleted = acc.DetailsSubmitted
+	wallet.PayoutsEnabled = acc.PayoutsEnabled
+	wallet.ChargesEnabled = acc.ChargesEnabled
+	wallet.StatusSyncedAt = &now
+
+	if changed {
+		slog.InfoContext(ctx, "account status updated", "organization_id", wallet.OrganizationID,
+			"onboarding_completed", acc.DetailsSubmitted, "payouts_enabled", acc.PayoutsEnabled, "charges_enabled", acc.ChargesEnabled)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"time"
+)
+
+// ================================
+// EARNINGS ANALYTICS
+// ================================
+
+func (s *stripeConnectService) GetEarningsAnalytics(ctx context.Context, orgID, granularity string, from, to time.Time) (*models.GetEarningsAnalyticsResponse, error) {
+	if !models.IsValidGranularity(granularity) {
+		return nil, apperrors.InvalidRequest("granularity must be day, week or month")
+	}
+
+	// The rollup is kept per UTC day, so the range is widened to whole days
+	from = startOfDayUTC(from)
+	if toDay := startOfDayUTC(to); toDay.Before(to) {
+		to = toDay.AddDate(0, 0, 1)
+	}
+
+	asOf, err := s.repo.GetEarningsRollupWatermark(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get analytics freshness: %w", err)
+	}
+
+	totals, err := s.repo.GetEarningsTotals(ctx, orgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings totals: %w", err)
+	}
+
+	series, err := s.repo.GetEarningsSeries(ctx, orgID, granularity, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings series: %w", err)
+	}
+
+	byFunction, err := s.repo.GetEarningsByFunction(ctx, orgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earnings by function: %w", err)
+	}
+	for i := range byFunction {
+		byFunction[i].FunctionName = functionDisplayName(byFunction[i].FunctionID, byFunction[i].FunctionName)
+	}
+
+	return &models.GetEarningsAnalyticsResponse{
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		AsOf:        asOf,
+		Totals:      *totals,
+		Series:      series,
+		ByFunction:  byFunction,
+	}, nil
+}
+
+func (s *stripeConnectService) RefreshEarningsRollup(ctx context.Context) error {
+	refreshedThrough, err := s.repo.RefreshEarningsRollup(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh earnings rollup: %w", err)
+	}
+
+	slog.InfoContext(ctx, "earnings rollup refreshed", "through", refreshedThrough.Format(time.RFC3339))
+	return nil
+}
+
+// functionDisplayName falls back to a short ID for functions missing from the functions table
+func functionDisplayName(functionID, name string) string {
+	if name != "" {
+		return name
+	}
+	if len(functionID) > 8 {
+		functionID = functionID[:8]
+	}
+	return "Function " + functionID
+}
+
+func startOfDayUTC(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
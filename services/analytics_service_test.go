@@ -0,0 +1,94 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+)
+
+func TestEarningsRollupIsIncremental(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		developerOrgID := env.newOrg(t)
+		alice, bob := env.newOrg(t), env.newOrg(t)
+		env.addAccount(t, alice, 1000)
+		env.addAccount(t, bob, 1000)
+
+		// Payments are rolled up once they are older than the five minute settle
+		// window, so they are backdated within the current day
+		now := time.Now().UTC()
+		var fees float64
+		pay := func(userOrgID, functionID string, amount float64, executedAt time.Time) {
+			t.Helper()
+			resp, err := env.service.ProcessFunctionExecutionPayment(ctx, userOrgID, functionID, developerOrgID, amount)
+			if err != nil {
+				t.Fatalf("ProcessFunctionExecutionPayment: %v", err)
+			}
+			env.backdatePayment(t, resp.TransactionID, executedAt)
+			fees += resp.PlatformFee
+		}
+		refresh := func() {
+			t.Helper()
+			if err := env.service.RefreshEarningsRollup(ctx); err != nil {
+				t.Fatalf("RefreshEarningsRollup: %v", err)
+			}
+		}
+		analytics := func() *models.GetEarningsAnalyticsResponse {
+			t.Helper()
+			resp, err := env.service.GetEarningsAnalytics(ctx, developerOrgID, models.GranularityDay, now.AddDate(0, 0, -1), now)
+			if err != nil {
+				t.Fatalf("GetEarningsAnalytics: %v", err)
+			}
+			return resp
+		}
+		assertTotals := func(label string, got models.EarningsTotals, calls int, gross float64, payers int) {
+			t.Helper()
+			if got.CallCount != calls || got.UniquePayingOrgs != payers {
+				t.Errorf("%s = %d calls from %d payers, want %d from %d", label, got.CallCount, got.UniquePayingOrgs, calls, payers)
+			}
+			assertMoney(t, label+" gross", got.GrossAmount, gross)
+			assertMoney(t, label+" fees and net", got.PlatformFees+got.NetAmount, gross)
+		}
+
+		pay(alice, "fn-search", 10, now.Add(-30*time.Minute))
+		pay(bob, "fn-render", 20, now.Add(-20*time.Minute))
+		refresh()
+		resp := analytics()
+		assertTotals("first refresh", resp.Totals, 2, 30, 2)
+		assertMoney(t, "platform fees", resp.Totals.PlatformFees, fees)
+		if resp.AsOf.After(time.Now().Add(-5 * time.Minute)) {
+			t.Errorf("as of %v, want at least five minutes ago", resp.AsOf)
+		}
+
+		// A payment recorded late for the current day, and one too recent to settle
+		pay(alice, "fn-search", 5, now.Add(-15*time.Minute))
+		pay(bob, "fn-search", 7, now)
+		assertTotals("before the next refresh", analytics().Totals, 2, 30, 2)
+
+		refresh()
+		resp = analytics()
+		assertTotals("second refresh", resp.Totals, 3, 35, 2)
+
+		// Refreshing again rebuilds the day rather than adding it twice
+		refresh()
+		resp = analytics()
+		assertTotals("third refresh", resp.Totals, 3, 35, 2)
+
+		var bucketCalls int
+		for _, bucket := range resp.Series {
+			bucketCalls += bucket.CallCount
+		}
+		if bucketCalls != 3 {
+			t.Errorf("series has %d calls, want 3", bucketCalls)
+		}
+		byFunction := map[string]models.EarningsTotals{}
+		for _, fn := range resp.ByFunction {
+			byFunction[fn.FunctionID] = fn.EarningsTotals
+		}
+		assertTotals("fn-search", byFunction["fn-search"], 2, 15, 1)
+		assertTotals("fn-render", byFunction["fn-render"], 1, 20, 1)
+	})
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"time"
+)
+
+// ================================
+// BILLING (PAYING USER ORGANIZATIONS)
+// ================================
+
+func (s *stripeConnectService) GetSpendHistory(ctx context.Context, userOrgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetSpendHistoryResponse, error) {
+	page = normalizePage(page)
+
+	transactions, total, err := s.repo.GetTransactionsByUserOrg(ctx, userOrgID, filter, peekPage(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+
+	hasMore := len(transactions) > page.Limit
+	if hasMore {
+		transactions = transactions[:page.Limit]
+	}
+
+	summaries := make([]models.SpendSummary, len(transactions))
+	for i, tx := range transactions {
+		summaries[i] = models.SpendSummary{
+			ID:                    tx.ID,
+			FunctionID:            tx.FunctionID,
+			FunctionName:          functionDisplayName(tx.FunctionID, stringValue(tx.FunctionName)),
+			DeveloperOrganization: tx.DeveloperOrganizationID,
+			Amount:                tx.Amount,
+			Status:                tx.Status,
+			ExecutedAt:            tx.ExecutedAt,
+		}
+	}
+
+	nextCursor := ""
+	if hasMore {
+		last := transactions[len(transactions)-1]
+		nextCursor = models.Cursor{Time: last.ExecutedAt, ID: last.ID}.Encode()
+	}
+
+	return &models.GetSpendHistoryResponse{
+		Transactions: summaries,
+		Total:        total,
+		Page:         page.Page,
+		Limit:        page.Limit,
+		NextCursor:   nextCursor,
+		HasMore:      hasMore,
+	}, nil
+}
+
+func (s *stripeConnectService) GetBillingUsage(ctx context.Context, userOrgID string, from, to time.Time) (*models.GetBillingUsageResponse, error) {
+	if !to.After(from) {
+		return nil, apperrors.InvalidRequest("to must be after from")
+	}
+
+	byFunction, err := s.repo.GetUserOrgSpendByFunction(ctx, userOrgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spend by function: %w", err)
+	}
+	for i := range byFunction {
+		byFunction[i].FunctionName = functionDisplayName(byFunction[i].FunctionID, byFunction[i].FunctionName)
+	}
+
+	byDeveloper, err := s.repo.GetUserOrgSpendByDeveloper(ctx, userOrgID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spend by developer: %w", err)
+	}
+
+	totalSpend := 0.0
+	totalCalls := 0
+	for _, ds := range byDeveloper {
+		totalSpend += ds.TotalAmount
+		totalCalls += ds.CallCount
+	}
+
+	return &models.GetBillingUsageResponse{
+		OrganizationID: userOrgID,
+		From:           from,
+		To:             to,
+		TotalSpend:     totalSpend,
+		TotalCalls:     totalCalls,
+		ByFunction:     byFunction,
+		ByDeveloper:    byDeveloper,
+	}, nil
+}
+
+func (s *stripeConnectService) GetBillingStatement(ctx context.Context, userOrgID string, month time.Time) (*models.GetBillingStatementResponse, error) {
+	periodStart := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+	if periodStart.After(time.Now()) {
+		return nil, apperrors.InvalidRequest(fmt.Sprintf("statement month %s is in the future", periodStart.Format(models.StatementMonthFormat)))
+	}
+
+	userAccount, err := s.repo.GetAccountByOrgID(ctx, userOrgID)
+	if err != nil {
+		return nil, fmt.Errorf("user account not found: %w", err)
+	}
+
+	ledger, err := s.repo.GetAccountLedgerSummary(ctx, userOrgID, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account ledger: %w", err)
+	}
+
+	// Walk back from the current balance, the ledger holds every change since
+	return &models.GetBillingStatementResponse{
+		OrganizationID: userOrgID,
+		Month:          periodStart.Format(models.StatementMonthFormat),
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodEnd,
+		OpeningBalance: userAccount.AccountBalance - ledger.NetSinceStart,
+		TopUps:         ledger.TopUps,
+		Charges:        ledger.Charges,
+		Refunds:        ledger.Refunds,
+		Adjustments:    ledger.Adjustments,
+		ClosingBalance: userAccount.AccountBalance - ledger.NetSinceEnd,
+	}, nil
+}
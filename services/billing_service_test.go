@@ -0,0 +1,64 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+)
+
+func TestBillingStatementMonthBoundaries(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		orgID := env.newOrg(t)
+		env.addAccount(t, orgID, 0)
+
+		// Entries on either side of the February 2024 (leap year) boundaries, in UTC
+		env.adjustBalance(t, orgID, models.LedgerEntryTopUp, 100, time.Date(2024, 1, 31, 23, 59, 59, 999000000, time.UTC))
+		env.adjustBalance(t, orgID, models.LedgerEntryCharge, -30, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+		env.adjustBalance(t, orgID, models.LedgerEntryRefund, 5, time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC))
+		env.adjustBalance(t, orgID, models.LedgerEntryAdjustment, -10, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+
+		tests := []struct {
+			name                     string
+			month                    time.Time
+			wantMonth                string
+			opening, closing         float64
+			topUps, charges, refunds float64
+			adjustments              float64
+		}{
+			{name: "january", month: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), wantMonth: "2024-01", closing: 100, topUps: 100},
+			{name: "february", month: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), wantMonth: "2024-02", opening: 100, closing: 75, charges: 30, refunds: 5},
+			{name: "march", month: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), wantMonth: "2024-03", opening: 75, closing: 65, adjustments: -10},
+			{name: "any day of the month", month: time.Date(2024, 2, 17, 15, 4, 5, 0, time.UTC), wantMonth: "2024-02", opening: 100, closing: 75, charges: 30, refunds: 5},
+			{name: "a later month carries the balance", month: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), wantMonth: "2024-06", opening: 65, closing: 65},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				statement, err := env.service.GetBillingStatement(ctx, orgID, tt.month)
+				if err != nil {
+					t.Fatalf("GetBillingStatement: %v", err)
+				}
+				if statement.Month != tt.wantMonth {
+					t.Errorf("month = %s, want %s", statement.Month, tt.wantMonth)
+				}
+				start, _ := time.Parse(models.StatementMonthFormat, tt.wantMonth)
+				if !statement.PeriodStart.Equal(start) || !statement.PeriodEnd.Equal(start.AddDate(0, 1, 0)) {
+					t.Errorf("period = %v to %v, want the calendar month of %s in UTC", statement.PeriodStart, statement.PeriodEnd, tt.wantMonth)
+				}
+				assertMoney(t, "opening balance", statement.OpeningBalance, tt.opening)
+				assertMoney(t, "top-ups", statement.TopUps, tt.topUps)
+				assertMoney(t, "charges", statement.Charges, tt.charges)
+				assertMoney(t, "refunds", statement.Refunds, tt.refunds)
+				assertMoney(t, "adjustments", statement.Adjustments, tt.adjustments)
+				assertMoney(t, "closing balance", statement.ClosingBalance, tt.closing)
+			})
+		}
+
+		_, err := env.service.GetBillingStatement(ctx, orgID, time.Now().AddDate(0, 1, 0))
+		assertCode(t, err, apperrors.CodeInvalidRequest)
+	})
+}
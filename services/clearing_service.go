@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"time"
+)
+
+// ClearingOptions sets how long function execution earnings stay pending
+// before they can be withdrawn, so refunds and fraudulent top-ups can still
+// be recovered. A period of zero makes earnings available right away.
+type ClearingOptions struct {
+	Period          time.Duration            // Clearing period of developers without a tier
+	TierPeriods     map[string]time.Duration // Clearing period by developer tier
+	FunctionPeriods map[string]time.Duration // Clearing period by function ID, over the developer's
+}
+
+// periodFor returns the clearing period of a payment for functionID to wallet
+func (o ClearingOptions) periodFor(wallet *models.DeveloperWallet, functionID string) time.Duration {
+	if period, ok := o.FunctionPeriods[functionID]; ok {
+		return period
+	}
+	if wallet.Tier != nil {
+		if period, ok := o.TierPeriods[*wallet.Tier]; ok {
+			return period
+		}
+	}
+	return o.Period
+}
+
+// availableBalance is what a developer can withdraw: the balance less the
+// earnings still clearing and the withdrawals still pending
+func availableBalance(wallet *models.DeveloperWallet, pendingWithdrawals float64) float64 {
+	return math.Round((wallet.Balance-wallet.PendingBalance-pendingWithdrawals)*100) / 100
+}
+
+// ================================
+// EARNINGS CLEARING
+// ================================
+
+// ReleaseClearedEarnings makes the earnings of the tenant in ctx whose
+// clearing period is over available for withdrawal. It returns how many
+// payments were released.
+func (s *stripeConnectService) ReleaseClearedEarnings(ctx context.Context) (int, error) {
+	released, amount, err := s.repo.ReleaseClearedEarnings(ctx, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to release cleared earnings: %w", err)
+	}
+	if released > 0 {
+		slog.InfoContext(ctx, "released cleared earnings", "payments", released, "amount", amount)
+	}
+	return released, nil
+}
+
+// SetDeveloperTier assigns an organization's wallet to a clearing period
+// tier, or back to the global clearing period when the tier is empty. Only
+// payments made after the change use the new period.
+func (s *stripeConnectService) SetDeveloperTier(ctx context.Context, orgID string, req *models.SetDeveloperTierRequest) (*models.DeveloperTierResponse, error) {
+	var tier *string
+	if req.Tier != "" {
+		if _, ok := s.clearing.TierPeriods[req.Tier]; !ok {
+			tiers := make([]string, 0, len(s.clearing.TierPeriods))
+			for name := range s.clearing.TierPeriods {
+				tiers = append(tiers, name)
+			}
+			sort.Strings(tiers)
+			return nil, apperrors.InvalidRequest(fmt.Sprintf("unknown tier %q, expected one of: %s", req.Tier, strings.Join(tiers, ", ")))
+		}
+		tier = &req.Tier
+	}
+
+	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+	if err := s.repo.UpdateWalletTier(ctx, wallet.ID, tier); err != nil {
+		return nil, fmt.Errorf("failed to update tier: %w", err)
+	}
+	wallet.Tier = tier
+
+	slog.InfoContext(ctx, "developer tier updated", "organization_id", orgID, "tier", req.Tier)
+	return &models.DeveloperTierResponse{
+		OrganizationID:        orgID,
+		Tier:                  tier,
+		ClearingPeriodSeconds: int64(s.clearing.periodFor(wallet, "").Seconds()),
+	}, nil
+}
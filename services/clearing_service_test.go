@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"strpe-connect/services"
+)
+
+func TestEarningsClearing(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		env.service = services.NewStripeConnectService(env.repo, env.stripe, services.Options{
+			Clearing: services.ClearingOptions{
+				Period:          time.Hour,
+				TierPeriods:     map[string]time.Duration{"trusted": 0, "new": 48 * time.Hour},
+				FunctionPeriods: map[string]time.Duration{"fn-instant": 0},
+			},
+		})
+		balance := func(orgID string) *models.GetWalletBalanceResponse {
+			t.Helper()
+			resp, err := env.service.GetWalletBalance(ctx, orgID)
+			if err != nil {
+				t.Fatalf("GetWalletBalance: %v", err)
+			}
+			return resp
+		}
+		pay := func(functionID, orgID string, amount float64) *models.FunctionExecutionPaymentResponse {
+			t.Helper()
+			userOrgID := env.newOrg(t)
+			env.addAccount(t, userOrgID, amount)
+			resp, err := env.service.ProcessFunctionExecutionPayment(ctx, userOrgID, functionID, orgID, amount)
+			if err != nil {
+				t.Fatalf("ProcessFunctionExecutionPayment: %v", err)
+			}
+			return resp
+		}
+
+		// Earnings of the global period are credited but cannot be withdrawn yet
+		orgID, _ := env.onboardedDeveloper(t, 100)
+		pending := balance(orgID)
+		assertMoney(t, "balance", pending.Balance, 100)
+		assertMoney(t, "pending balance", pending.PendingBalance, 100)
+		assertMoney(t, "available balance", pending.AvailableBalance, 0)
+		if pending.CanWithdraw {
+			t.Error("can withdraw = true, want false while earnings clear")
+		}
+		_, err := env.service.RequestWithdrawal(ctx, orgID, 50)
+		assertCode(t, err, apperrors.CodeInsufficientFunds)
+
+		// Earnings of a function without a clearing period are available at once
+		instant := pay("fn-instant", orgID, 60)
+		if instant.AvailableAt.After(time.Now()) {
+			t.Errorf("available at = %v, want now", instant.AvailableAt)
+		}
+		assertMoney(t, "available balance", balance(orgID).AvailableBalance, 60)
+		env.withdraw(t, orgID, 50)
+		assertMoney(t, "available balance after withdrawal", balance(orgID).AvailableBalance, 10)
+
+		// Nothing has matured yet
+		if _, err := env.service.ReleaseClearedEarnings(ctx); err != nil {
+			t.Fatalf("ReleaseClearedEarnings: %v", err)
+		}
+		assertMoney(t, "pending balance", balance(orgID).PendingBalance, 100)
+
+		// Once the period is over the earnings are released
+		if _, _, err := env.repo.ReleaseClearedEarnings(ctx, time.Now().Add(2*time.Hour)); err != nil {
+			t.Fatalf("ReleaseClearedEarnings: %v", err)
+		}
+		released := balance(orgID)
+		assertMoney(t, "balance", released.Balance, 110)
+		assertMoney(t, "pending balance", released.PendingBalance, 0)
+		assertMoney(t, "available balance", released.AvailableBalance, 110)
+		env.withdraw(t, orgID, 100)
+	})
+}
+
+func TestSetDeveloperTier(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		env.service = services.NewStripeConnectService(env.repo, env.stripe, services.Options{
+			Clearing: services.ClearingOptions{
+				Period:      time.Hour,
+				TierPeriods: map[string]time.Duration{"trusted": 0},
+			},
+		})
+		orgID, _ := env.onboardedDeveloper(t, 0)
+
+		_, err := env.service.SetDeveloperTier(ctx, orgID, &models.SetDeveloperTierRequest{Tier: "gold"})
+		assertCode(t, err, apperrors.CodeInvalidRequest)
+		_, err = env.service.SetDeveloperTier(ctx, env.newOrg(t), &models.SetDeveloperTierRequest{Tier: "trusted"})
+		assertCode(t, err, apperrors.CodeNotFound)
+
+		resp, err := env.service.SetDeveloperTier(ctx, orgID, &models.SetDeveloperTierRequest{Tier: "trusted"})
+		if err != nil {
+			t.Fatalf("SetDeveloperTier: %v", err)
+		}
+		if stringValue(resp.Tier) != "trusted" || resp.ClearingPeriodSeconds != 0 {
+			t.Errorf("tier = %q with clearing period %ds, want trusted with none", stringValue(resp.Tier), resp.ClearingPeriodSeconds)
+		}
+
+		// Later earnings use the tier's period
+		userOrgID := env.newOrg(t)
+		env.addAccount(t, userOrgID, 75)
+		if _, err := env.service.ProcessFunctionExecutionPayment(ctx, userOrgID, "fn-earnings", orgID, 75); err != nil {
+			t.Fatalf("ProcessFunctionExecutionPayment: %v", err)
+		}
+		wallet := env.wallet(t, orgID)
+		assertMoney(t, "pending balance", wallet.PendingBalance, 0)
+		if stringValue(wallet.Tier) != "trusted" {
+			t.Errorf("stored tier = %q, want trusted", stringValue(wallet.Tier))
+		}
+
+		// An empty tier goes back to the global period
+		resp, err = env.service.SetDeveloperTier(ctx, orgID, &models.SetDeveloperTierRequest{})
+		if err != nil {
+			t.Fatalf("SetDeveloperTier: %v", err)
+		}
+		if resp.Tier != nil || resp.ClearingPeriodSeconds != 3600 {
+			t.Errorf("tier = %v with clearing period %ds, want none with 3600s", resp.Tier, resp.ClearingPeriodSeconds)
+		}
+	})
+}
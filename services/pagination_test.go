@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"strpe-connect/gateway"
+	"strpe-connect/handlers"
+	"strpe-connect/models"
+)
+
+func TestTransactionHistoryPagination(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		developerOrgID := env.newOrg(t)
+		alice, bob := env.newOrg(t), env.newOrg(t)
+		env.addAccount(t, alice, 1000)
+		env.addAccount(t, bob, 1000)
+
+		// Seven payments, one per millisecond so their order is stable
+		start := time.Now()
+		payments := []struct {
+			userOrgID  string
+			functionID string
+			amount     float64
+		}{
+			{alice, "fn-search", 1}, {alice, "fn-search", 2}, {bob, "fn-search", 3}, {alice, "fn-render", 4},
+			{bob, "fn-render", 5}, {alice, "fn-search", 6}, {bob, "fn-search", 7},
+		}
+		for _, p := range payments {
+			if _, err := env.service.ProcessFunctionExecutionPayment(ctx, p.userOrgID, p.functionID, developerOrgID, p.amount); err != nil {
+				t.Fatalf("ProcessFunctionExecutionPayment: %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// Walking the cursors returns every transaction once, newest first
+		var amounts []float64
+		page := models.PageRequest{Limit: 3}
+		for pages := 0; ; pages++ {
+			resp, err := env.service.GetTransactionHistory(ctx, developerOrgID, page, models.TransactionFilter{})
+			if err != nil {
+				t.Fatalf("GetTransactionHistory: %v", err)
+			}
+			if resp.Total != len(payments) {
+				t.Errorf("total = %d, want %d on every page", resp.Total, len(payments))
+			}
+			for _, tx := range resp.Transactions {
+				amounts = append(amounts, tx.Amount)
+			}
+			if !resp.HasMore {
+				if resp.NextCursor != "" || pages != 2 {
+					t.Errorf("last page %d has cursor %q, want page 2 without one", pages, resp.NextCursor)
+				}
+				break
+			}
+			cursor, err := models.DecodeCursor(resp.NextCursor)
+			if err != nil {
+				t.Fatalf("DecodeCursor: %v", err)
+			}
+			page.After = cursor
+		}
+		want := []float64{7, 6, 5, 4, 3, 2, 1}
+		if len(amounts) != len(want) {
+			t.Fatalf("amounts = %v, want %v", amounts, want)
+		}
+		for i := range want {
+			assertMoney(t, "amount", amounts[i], want[i])
+		}
+
+		// Page numbers still work
+		resp, err := env.service.GetTransactionHistory(ctx, developerOrgID, models.PageRequest{Page: 3, Limit: 3}, models.TransactionFilter{})
+		if err != nil {
+			t.Fatalf("GetTransactionHistory: %v", err)
+		}
+		if len(resp.Transactions) != 1 || resp.HasMore || resp.Page != 3 {
+			t.Errorf("page 3 = %+v, want the oldest transaction only", resp)
+		}
+
+		minAmount, maxAmount := 2.0, 6.0
+		end := time.Now()
+		tests := []struct {
+			name   string
+			filter models.TransactionFilter
+			want   []float64
+		}{
+			{"function", models.TransactionFilter{FunctionID: "fn-render"}, []float64{5, 4}},
+			{"counterparty", models.TransactionFilter{CounterpartyOrgID: bob}, []float64{7, 5, 3}},
+			{"amount range", models.TransactionFilter{MinAmount: &minAmount, MaxAmount: &maxAmount}, []float64{6, 5, 4, 3, 2}},
+			{"combined", models.TransactionFilter{FunctionID: "fn-search", CounterpartyOrgID: alice, MinAmount: &minAmount}, []float64{6, 2}},
+			{"status", models.TransactionFilter{Status: models.TransactionStatusCompleted, From: &start, To: &end}, []float64{7, 6, 5, 4, 3, 2, 1}},
+			{"empty window", models.TransactionFilter{To: &start}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				// A page smaller than the result still reports the filtered total
+				resp, err := env.service.GetTransactionHistory(ctx, developerOrgID, models.PageRequest{Limit: 2}, tt.filter)
+				if err != nil {
+					t.Fatalf("GetTransactionHistory: %v", err)
+				}
+				if resp.Total != len(tt.want) || resp.HasMore != (len(tt.want) > 2) {
+					t.Errorf("total = %d (has more %v), want %d", resp.Total, resp.HasMore, len(tt.want))
+				}
+				for i, tx := range resp.Transactions {
+					assertMoney(t, "amount", tx.Amount, tt.want[i])
+				}
+			})
+		}
+	})
+}
+
+func TestWithdrawalHistoryFilters(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		orgID, _ := env.onboardedDeveloper(t, 200)
+
+		env.withdraw(t, orgID, 50)
+		env.withdraw(t, orgID, 60)
+		failed := env.withdraw(t, orgID, 70)
+		if err := env.service.HandlePayoutFailed(ctx, failed.ID, "account_closed"); err != nil {
+			t.Fatalf("HandlePayoutFailed: %v", err)
+		}
+
+		minAmount := 55.0
+		tests := []struct {
+			name   string
+			filter models.WithdrawalFilter
+			want   int
+		}{
+			{"all", models.WithdrawalFilter{}, 3},
+			{"status", models.WithdrawalFilter{Status: models.WithdrawalStatusFailed}, 1},
+			{"minimum amount", models.WithdrawalFilter{MinAmount: &minAmount}, 2},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := env.service.GetWithdrawalHistory(ctx, orgID, models.PageRequest{Limit: 1}, tt.filter)
+				if err != nil {
+					t.Fatalf("GetWithdrawalHistory: %v", err)
+				}
+				if resp.Total != tt.want || len(resp.Withdrawals) != 1 || resp.HasMore != (tt.want > 1) {
+					t.Errorf("total = %d with %d on the page (has more %v), want %d", resp.Total, len(resp.Withdrawals), resp.HasMore, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestTamperedCursorIsRejected(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		r := gin.New()
+		r.GET("/transactions", handlers.NewStripeConnectHandler(env.service, webhookSecret).GetTransactionHistory)
+
+		tampered := base64.RawURLEncoding.EncodeToString([]byte("1709296200000000000:not-a-uuid"))
+		req := httptest.NewRequest(http.MethodGet, "/transactions?cursor="+tampered, nil)
+		req.Header.Set("X-Organization-ID", env.newOrg(t))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d %s, want 400", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"strpe-connect/tracing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// payoutBatchPollInterval is how long a submitted batch first waits before
+	// checking its withdrawals again, doubling up to maxPayoutBatchPollInterval
+	payoutBatchPollInterval    = time.Second
+	maxPayoutBatchPollInterval = time.Minute
+)
+
+// payoutBatchLock keeps a resumed execution of a batch from running alongside
+// the first one, on any replica
+func payoutBatchLock(batchID string) string {
+	return "payout_batch:" + batchID
+}
+
+// ================================
+// PAYOUT BATCHES
+// ================================
+
+// CreatePayoutBatch previews a payout batch as a draft with an entry for each
+// developer who can be paid, leaving out the earnings that cleared after
+// cutoff. Nothing is paid until the batch is executed.
+func (s *stripeConnectService) CreatePayoutBatch(ctx context.Context, cutoff time.Time) (*models.PayoutBatchResponse, error) {
+	entries, err := s.repo.GetPayoutCandidates(ctx, cutoff, s.minimumWithdrawal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout candidates: %w", err)
+	}
+
+	batch := &models.PayoutBatch{CutoffAt: cutoff.UTC()}
+	if err := s.repo.CreatePayoutBatch(ctx, batch, entries); err != nil {
+		return nil, fmt.Errorf("failed to create payout batch: %w", err)
+	}
+
+	resp := payoutBatchResponse(batch, entries)
+	slog.InfoContext(ctx, "payout batch created", "batch_id", batch.ID, "cutoff_at", batch.CutoffAt,
+		"entries", resp.Totals.Entries, "total_amount", resp.Totals.TotalAmount)
+	return resp, nil
+}
+
+// GetPayoutBatches returns the payout batches, newest first
+func (s *stripeConnectService) GetPayoutBatches(ctx context.Context, page models.PageRequest) (*models.GetPayoutBatchesResponse, error) {
+	page = normalizePage(page)
+
+	batches, total, err := s.repo.GetPayoutBatches(ctx, peekPage(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout batches: %w", err)
+	}
+
+	hasMore := len(batches) > page.Limit
+	if hasMore {
+		batches = batches[:page.Limit]
+	}
+
+	resp := &models.GetPayoutBatchesResponse{
+		Batches: make([]models.PayoutBatch, len(batches)),
+		Total:   total,
+		Page:    page.Page,
+		Limit:   page.Limit,
+		HasMore: hasMore,
+	}
+	for i, batch := range batches {
+		resp.Batches[i] = *batch
+	}
+	if hasMore {
+		last := batches[len(batches)-1]
+		resp.NextCursor = models.Cursor{Time: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return resp, nil
+}
+
+// GetPayoutBatch returns a payout batch with the progress of its withdrawals
+func (s *stripeConnectService) GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error) {
+	batch, entries, err := s.loadPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	return payoutBatchResponse(batch, entries), nil
+}
+
+// UpdatePayoutBatchEntries excludes entries from a draft payout batch, or
+// includes them again
+func (s *stripeConnectService) UpdatePayoutBatchEntries(ctx context.Context, batchID string, req *models.UpdatePayoutBatchEntriesRequest) (*models.PayoutBatchResponse, error) {
+	batch, entries, err := s.loadPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.Status != models.PayoutBatchStatusDraft {
+		return nil, apperrors.Conflict(fmt.Sprintf("payout batch is %s, only draft batches can be changed", batch.Status))
+	}
+
+	inBatch := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		inBatch[entry.ID] = true
+	}
+	for _, id := range req.EntryIDs {
+		if !inBatch[id] {
+			return nil, apperrors.NotFound("payout batch entry").WithDetails(map[string]string{"entry_id": id})
+		}
+	}
+
+	if _, err := s.repo.SetPayoutBatchEntriesExcluded(ctx, batchID, req.EntryIDs, req.Excluded); err != nil {
+		return nil, fmt.Errorf("failed to update payout batch entries: %w", err)
+	}
+
+	// The batch may have been executed since it was read
+	batch, entries, err = s.loadPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.Status != models.PayoutBatchStatusDraft {
+		return nil, apperrors.Conflict(fmt.Sprintf("payout batch is %s, only draft batches can be changed", batch.Status))
+	}
+
+	slog.InfoContext(ctx, "payout batch entries updated", "batch_id", batchID, "entries", len(req.EntryIDs), "excluded", req.Excluded)
+	return payoutBatchResponse(batch, entries), nil
+}
+
+// ExecutePayoutBatch starts requesting the withdrawals of a draft payout
+// batch in the background. Executing a batch that is still executing or
+// submitted, after a restart or a transient failure, resumes its entries that
+// were not requested yet and waits for its withdrawals again.
+func (s *stripeConnectService) ExecutePayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error) {
+	batch, err := s.getPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch batch.Status {
+	case models.PayoutBatchStatusDraft:
+		started, err := s.repo.TransitionPayoutBatch(ctx, batchID, models.PayoutBatchStatusDraft, models.PayoutBatchStatusExecuting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start payout batch: %w", err)
+		}
+		if !started {
+			return nil, apperrors.Conflict("payout batch is already executing")
+		}
+	case models.PayoutBatchStatusExecuting, models.PayoutBatchStatusSubmitted:
+	default:
+		return nil, apperrors.Conflict(fmt.Sprintf("payout batch is already %s", batch.Status))
+	}
+
+	runDetached(ctx, "ExecutePayoutBatch", func(ctx context.Context) error {
+		err := s.executePayoutBatch(ctx, batchID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to execute payout batch", "batch_id", batchID, "error", err)
+		}
+		return err
+	}, attribute.String("batch_id", batchID))
+
+	batch, entries, err := s.loadPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	return payoutBatchResponse(batch, entries), nil
+}
+
+// executePayoutBatch requests a withdrawal for each included entry not
+// requested yet, submits the batch and completes it once its withdrawals
+// settled. The withdrawals are processed one at a time, so a large batch does
+// not send all of its transfers to Stripe at once. Each entry records the ID of its withdrawal before requesting it,
+// so a resumed execution can tell whether the request went through. Rejected
+// withdrawals are recorded on their entry; a transient error stops the
+// execution and leaves the batch executing, so it can be resumed.
+func (s *stripeConnectService) executePayoutBatch(ctx context.Context, batchID string) error {
+	var requested, rejected int
+	locked, err := s.repo.WithAdvisoryLock(ctx, payoutBatchLock(batchID), func(ctx context.Context) error {
+		entries, err := s.repo.GetPayoutBatchEntries(ctx, batchID)
+		if err != nil {
+			return fmt.Errorf("failed to get payout batch entries: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.Excluded {
+				continue
+			}
+
+			switch entry.Status {
+			case models.PayoutBatchEntryPending:
+				withdrawalID := uuid.New().String()
+				if err := s.repo.RecordPayoutBatchEntry(ctx, entry.ID, models.PayoutBatchEntryRequesting, &withdrawalID, nil); err != nil {
+					return fmt.Errorf("failed to record payout batch entry: %w", err)
+				}
+				entry.WithdrawalID = &withdrawalID
+			case models.PayoutBatchEntryRequesting:
+				// The execution stopped around the request, which created the withdrawal or not
+				_, err := s.repo.GetWithdrawalByID(ctx, *entry.WithdrawalID)
+				if err == nil {
+					if err := s.repo.RecordPayoutBatchEntry(ctx, entry.ID, models.PayoutBatchEntryRequested, entry.WithdrawalID, nil); err != nil {
+						return fmt.Errorf("failed to record payout batch entry: %w", err)
+					}
+					requested++
+					continue
+				}
+				if !errors.Is(err, apperrors.ErrNotFound) {
+					return fmt.Errorf("failed to get withdrawal: %w", err)
+				}
+			default:
+				continue
+			}
+
+			resp, err := s.createWithdrawal(ctx, *entry.WithdrawalID, entry.OrganizationID, entry.Amount)
+			switch {
+			case err == nil:
+				if err := s.repo.RecordPayoutBatchEntry(ctx, entry.ID, models.PayoutBatchEntryRequested, &resp.WithdrawalID, nil); err != nil {
+					return fmt.Errorf("failed to record payout batch entry: %w", err)
+				}
+				requested++
+
+				// A failed attempt is left to the withdrawal retries
+				processCtx, span := startSpan(ctx, "ProcessWithdrawal", attribute.String("withdrawal_id", resp.WithdrawalID))
+				tracing.End(span, s.processWithdrawal(processCtx, resp.WithdrawalID))
+			case apperrors.IsTransient(err):
+				return fmt.Errorf("failed to request withdrawal of %s: %w", entry.OrganizationID, err)
+			default:
+				message := rejectionMessage(err)
+				if err := s.repo.RecordPayoutBatchEntry(ctx, entry.ID, models.PayoutBatchEntryRejected, nil, &message); err != nil {
+					return fmt.Errorf("failed to record payout batch entry: %w", err)
+				}
+				rejected++
+				slog.WarnContext(ctx, "payout batch withdrawal rejected", "batch_id", batchID, "organization_id", entry.OrganizationID, "amount", entry.Amount, "error", err)
+			}
+		}
+
+		if _, err := s.repo.TransitionPayoutBatch(ctx, batchID, models.PayoutBatchStatusExecuting, models.PayoutBatchStatusSubmitted); err != nil {
+			return fmt.Errorf("failed to submit payout batch: %w", err)
+		}
+		return nil
+	})
+	if !locked && err == nil {
+		slog.InfoContext(ctx, "payout batch is executing elsewhere", "batch_id", batchID)
+		return nil
+	}
+
+	slog.InfoContext(ctx, "payout batch executed", "batch_id", batchID, "withdrawals_requested", requested, "withdrawals_rejected", rejected)
+	if err != nil {
+		return err
+	}
+	return s.completePayoutBatch(ctx, batchID)
+}
+
+// completePayoutBatch waits for every withdrawal of a submitted batch to
+// complete or fail, checking less often the longer it waits, and completes
+// the batch
+func (s *stripeConnectService) completePayoutBatch(ctx context.Context, batchID string) error {
+	wait := payoutBatchPollInterval
+	for {
+		batch, entries, err := s.loadPayoutBatch(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		if batch.Status != models.PayoutBatchStatusSubmitted {
+			return nil
+		}
+
+		totals := payoutBatchResponse(batch, entries).Totals
+		if totals.Pending == 0 && totals.InFlight == 0 {
+			completed, err := s.repo.TransitionPayoutBatch(ctx, batchID, models.PayoutBatchStatusSubmitted, models.PayoutBatchStatusCompleted)
+			if err != nil {
+				return fmt.Errorf("failed to complete payout batch: %w", err)
+			}
+			if completed {
+				slog.InfoContext(ctx, "payout batch completed", "batch_id", batchID,
+					"completed_amount", totals.CompletedAmount, "failed_amount", totals.FailedAmount)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, maxPayoutBatchPollInterval)
+	}
+}
+
+// getPayoutBatch reads a payout batch, which cannot exist unless batchID is a UUID
+func (s *stripeConnectService) getPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatch, error) {
+	if _, err := uuid.Parse(batchID); err != nil {
+		return nil, apperrors.NotFound("payout batch")
+	}
+	batch, err := s.repo.GetPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout batch: %w", err)
+	}
+	return batch, nil
+}
+
+// loadPayoutBatch reads a payout batch and its entries
+func (s *stripeConnectService) loadPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatch, []*models.PayoutBatchEntry, error) {
+	batch, err := s.getPayoutBatch(ctx, batchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := s.repo.GetPayoutBatchEntries(ctx, batchID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get payout batch entries: %w", err)
+	}
+	return batch, entries, nil
+}
+
+// payoutBatchEntryStatus is the status an entry is reported with, which
+// follows its withdrawal once it is requested
+func payoutBatchEntryStatus(entry *models.PayoutBatchEntry) string {
+	switch {
+	case entry.Excluded:
+		return models.PayoutBatchEntryExcluded
+	case entry.Status == models.PayoutBatchEntryRequested && entry.WithdrawalStatus != nil:
+		return *entry.WithdrawalStatus
+	default:
+		return entry.Status
+	}
+}
+
+func payoutBatchResponse(batch *models.PayoutBatch, entries []*models.PayoutBatchEntry) *models.PayoutBatchResponse {
+	resp := &models.PayoutBatchResponse{
+		ID:          batch.ID,
+		Status:      batch.Status,
+		CutoffAt:    batch.CutoffAt,
+		CreatedAt:   batch.CreatedAt,
+		ExecutedAt:  batch.ExecutedAt,
+		CompletedAt: batch.CompletedAt,
+		Entries:     make([]models.PayoutBatchEntryResponse, len(entries)),
+	}
+
+	totals := &resp.Totals
+	for i, entry := range entries {
+		status := payoutBatchEntryStatus(entry)
+		resp.Entries[i] = models.PayoutBatchEntryResponse{
+			ID:                entry.ID,
+			OrganizationID:    entry.OrganizationID,
+			DeveloperWalletID: entry.DeveloperWalletID,
+			Amount:            entry.Amount,
+			Status:            status,
+			WithdrawalID:      entry.WithdrawalID,
+			Error:             entry.Error,
+		}
+
+		if entry.Excluded {
+			totals.Excluded++
+			totals.ExcludedAmount += entry.Amount
+			continue
+		}
+		totals.Entries++
+		totals.TotalAmount += entry.Amount
+		switch status {
+		case models.PayoutBatchEntryPending:
+			totals.Pending++
+		case models.WithdrawalStatusCompleted:
+			totals.Completed++
+			totals.CompletedAmount += entry.Amount
+		case models.PayoutBatchEntryRejected, models.WithdrawalStatusFailed: // Also a rejected withdrawal
+			totals.Failed++
+			totals.FailedAmount += entry.Amount
+		default:
+			totals.InFlight++
+			totals.InFlightAmount += entry.Amount
+		}
+	}
+
+	totals.TotalAmount = roundCents(totals.TotalAmount)
+	totals.ExcludedAmount = roundCents(totals.ExcludedAmount)
+	totals.InFlightAmount = roundCents(totals.InFlightAmount)
+	totals.CompletedAmount = roundCents(totals.CompletedAmount)
+	totals.FailedAmount = roundCents(totals.FailedAmount)
+	return resp
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,269 @@
+package services_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"strpe-connect/services"
+)
+
+// entryOf returns the entry of orgID in a payout batch, or nil
+func entryOf(batch *models.PayoutBatchResponse, orgID string) *models.PayoutBatchEntryResponse {
+	for i := range batch.Entries {
+		if batch.Entries[i].OrganizationID == orgID {
+			return &batch.Entries[i]
+		}
+	}
+	return nil
+}
+
+func TestPayoutBatch(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		get := func(batchID string) *models.PayoutBatchResponse {
+			t.Helper()
+			batch, err := env.service.GetPayoutBatch(ctx, batchID)
+			if err != nil {
+				t.Fatalf("GetPayoutBatch: %v", err)
+			}
+			return batch
+		}
+		earn := func(orgID string, amount float64) {
+			t.Helper()
+			userOrgID := env.newOrg(t)
+			env.addAccount(t, userOrgID, amount)
+			if _, err := env.service.ProcessFunctionExecutionPayment(ctx, userOrgID, "fn-earnings", orgID, amount); err != nil {
+				t.Fatalf("ProcessFunctionExecutionPayment: %v", err)
+			}
+		}
+
+		paid, _ := env.onboardedDeveloper(t, 180.55)
+		excluded, _ := env.onboardedDeveloper(t, 120)
+		rejected, _ := env.onboardedDeveloper(t, 75)
+		reserved, _ := env.onboardedDeveloper(t, 100)
+		if _, err := env.service.SetPayoutSchedule(ctx, reserved, &models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyManual, Reserve: 60}); err != nil {
+			t.Fatalf("SetPayoutSchedule: %v", err)
+		}
+		disabled, _ := env.onboardedDeveloper(t, 90)
+		if err := env.repo.UpdateOnboardingStatus(ctx, env.wallet(t, disabled).ID, true, false, true); err != nil {
+			t.Fatalf("UpdateOnboardingStatus: %v", err)
+		}
+		belowMinimum, _ := env.onboardedDeveloper(t, 30)
+
+		// Earnings after the cutoff wait for the next batch
+		cutoff := time.Now()
+		time.Sleep(time.Millisecond)
+		earn(paid, 40)
+		late, _ := env.onboardedDeveloper(t, 80)
+
+		batch, err := env.service.CreatePayoutBatch(ctx, cutoff)
+		if err != nil {
+			t.Fatalf("CreatePayoutBatch: %v", err)
+		}
+		if batch.Status != models.PayoutBatchStatusDraft {
+			t.Errorf("status = %s, want draft", batch.Status)
+		}
+		for _, orgID := range []string{reserved, disabled, belowMinimum, late} {
+			if entry := entryOf(batch, orgID); entry != nil {
+				t.Errorf("entry %+v, want none for a developer who cannot be paid", entry)
+			}
+		}
+		if entry := entryOf(batch, paid); entry == nil || entry != &batch.Entries[0] {
+			t.Fatalf("entries = %+v, want the largest payout first", batch.Entries)
+		}
+		assertMoney(t, "paid amount", entryOf(batch, paid).Amount, 180.55)
+		assertMoney(t, "total amount", batch.Totals.TotalAmount, 375.55)
+		if batch.Totals.Entries != 3 || batch.Totals.Pending != 3 {
+			t.Errorf("totals = %+v, want 3 pending entries", batch.Totals)
+		}
+
+		// Review
+		_, err = env.service.UpdatePayoutBatchEntries(ctx, batch.ID, &models.UpdatePayoutBatchEntriesRequest{EntryIDs: []string{uuid.NewString()}, Excluded: true})
+		assertCode(t, err, apperrors.CodeNotFound)
+		batch, err = env.service.UpdatePayoutBatchEntries(ctx, batch.ID, &models.UpdatePayoutBatchEntriesRequest{EntryIDs: []string{entryOf(batch, excluded).ID}, Excluded: true})
+		if err != nil {
+			t.Fatalf("UpdatePayoutBatchEntries: %v", err)
+		}
+		if entryOf(batch, excluded).Status != models.PayoutBatchEntryExcluded || batch.Totals.Entries != 2 || batch.Totals.Excluded != 1 {
+			t.Errorf("totals = %+v, want one entry excluded", batch.Totals)
+		}
+		assertMoney(t, "excluded amount", batch.Totals.ExcludedAmount, 120)
+		assertMoney(t, "total amount", batch.Totals.TotalAmount, 255.55)
+
+		// A developer who can no longer be paid is rejected at execution
+		if err := env.repo.UpdateOnboardingStatus(ctx, env.wallet(t, rejected).ID, true, false, true); err != nil {
+			t.Fatalf("UpdateOnboardingStatus: %v", err)
+		}
+
+		batch, err = env.service.ExecutePayoutBatch(ctx, batch.ID)
+		if err != nil {
+			t.Fatalf("ExecutePayoutBatch: %v", err)
+		}
+		if batch.Status != models.PayoutBatchStatusExecuting || batch.ExecutedAt == nil {
+			t.Errorf("status = %s (executed at %v), want executing", batch.Status, batch.ExecutedAt)
+		}
+
+		eventually(t, func() bool { return get(batch.ID).Status == models.PayoutBatchStatusCompleted })
+		batch = get(batch.ID)
+		if batch.CompletedAt == nil {
+			t.Error("completed at = nil, want the completion time")
+		}
+		if entry := entryOf(batch, paid); entry.Status != models.WithdrawalStatusCompleted || entry.WithdrawalID == nil {
+			t.Errorf("paid entry = %+v, want a completed withdrawal", entry)
+		}
+		if entry := entryOf(batch, rejected); entry.Status != models.PayoutBatchEntryRejected || entry.Error == nil || entry.WithdrawalID != nil {
+			t.Errorf("rejected entry = %+v, want the rejection", entry)
+		}
+		if entry := entryOf(batch, excluded); entry.Status != models.PayoutBatchEntryExcluded || entry.WithdrawalID != nil {
+			t.Errorf("excluded entry = %+v, want no withdrawal", entry)
+		}
+		if batch.Totals.Completed != 1 || batch.Totals.Failed != 1 || batch.Totals.Pending != 0 || batch.Totals.InFlight != 0 {
+			t.Errorf("totals = %+v, want one completed and one failed", batch.Totals)
+		}
+		assertMoney(t, "completed amount", batch.Totals.CompletedAmount, 180.55)
+		assertMoney(t, "failed amount", batch.Totals.FailedAmount, 75)
+		assertMoney(t, "paid balance", env.wallet(t, paid).Balance, 40)
+		assertMoney(t, "excluded balance", env.wallet(t, excluded).Balance, 120)
+
+		// An executed batch can no longer change
+		_, err = env.service.ExecutePayoutBatch(ctx, batch.ID)
+		assertCode(t, err, apperrors.CodeConflict)
+		_, err = env.service.UpdatePayoutBatchEntries(ctx, batch.ID, &models.UpdatePayoutBatchEntriesRequest{EntryIDs: []string{entryOf(batch, excluded).ID}})
+		assertCode(t, err, apperrors.CodeConflict)
+
+		list, err := env.service.GetPayoutBatches(ctx, models.PageRequest{})
+		if err != nil {
+			t.Fatalf("GetPayoutBatches: %v", err)
+		}
+		if len(list.Batches) == 0 || list.Batches[0].ID != batch.ID {
+			t.Errorf("batches = %+v, want the batch first", list.Batches)
+		}
+
+		_, err = env.service.GetPayoutBatch(ctx, "not-a-batch")
+		assertCode(t, err, apperrors.CodeNotFound)
+	})
+}
+
+func TestExecutePayoutBatchResumes(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		stopped, _ := env.onboardedDeveloper(t, 100)
+		requested, _ := env.onboardedDeveloper(t, 100)
+		lost, _ := env.onboardedDeveloper(t, 100)
+
+		batch, err := env.service.CreatePayoutBatch(ctx, time.Now())
+		if err != nil {
+			t.Fatalf("CreatePayoutBatch: %v", err)
+		}
+		for _, orgID := range []string{stopped, requested, lost} {
+			if entryOf(batch, orgID) == nil {
+				t.Fatalf("entries = %+v, want every developer", batch.Entries)
+			}
+		}
+
+		// An execution that stopped before requesting the first withdrawal, right
+		// after requesting the second and before creating the third
+		if started, err := env.repo.TransitionPayoutBatch(ctx, batch.ID, models.PayoutBatchStatusDraft, models.PayoutBatchStatusExecuting); !started || err != nil {
+			t.Fatalf("TransitionPayoutBatch = %v, %v", started, err)
+		}
+		withdrawal := env.withdraw(t, requested, 100)
+		if err := env.repo.RecordPayoutBatchEntry(ctx, entryOf(batch, requested).ID, models.PayoutBatchEntryRequesting, &withdrawal.ID, nil); err != nil {
+			t.Fatalf("RecordPayoutBatchEntry: %v", err)
+		}
+		lostID := uuid.NewString()
+		if err := env.repo.RecordPayoutBatchEntry(ctx, entryOf(batch, lost).ID, models.PayoutBatchEntryRequesting, &lostID, nil); err != nil {
+			t.Fatalf("RecordPayoutBatchEntry: %v", err)
+		}
+		_, err = env.service.UpdatePayoutBatchEntries(ctx, batch.ID, &models.UpdatePayoutBatchEntriesRequest{EntryIDs: []string{entryOf(batch, stopped).ID}, Excluded: true})
+		assertCode(t, err, apperrors.CodeConflict)
+
+		if _, err := env.service.ExecutePayoutBatch(ctx, batch.ID); err != nil {
+			t.Fatalf("ExecutePayoutBatch: %v", err)
+		}
+		eventually(t, func() bool {
+			batch, err = env.service.GetPayoutBatch(ctx, batch.ID)
+			return err == nil && batch.Status == models.PayoutBatchStatusCompleted
+		})
+		for _, orgID := range []string{stopped, requested, lost} {
+			if entry := entryOf(batch, orgID); entry.Status != models.WithdrawalStatusCompleted {
+				t.Errorf("entry = %+v, want a completed withdrawal", entry)
+			}
+			assertMoney(t, "balance", env.wallet(t, orgID).Balance, 0)
+		}
+		if entry := entryOf(batch, requested); entry.WithdrawalID == nil || *entry.WithdrawalID != withdrawal.ID {
+			t.Errorf("withdrawal = %v, want the one requested before the restart", entry.WithdrawalID)
+		}
+		if entry := entryOf(batch, lost); entry.WithdrawalID == nil || *entry.WithdrawalID != lostID {
+			t.Errorf("withdrawal = %v, want the recorded ID %s", entry.WithdrawalID, lostID)
+		}
+
+		// A completed batch is not waited for again
+		_, err = env.service.ExecutePayoutBatch(ctx, batch.ID)
+		assertCode(t, err, apperrors.CodeConflict)
+	})
+}
+
+// concurrentTransfers records how many transfers were being created at once
+type concurrentTransfers struct {
+	gateway.StripeGateway
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (g *concurrentTransfers) CreateTransfer(ctx context.Context, params *gateway.CreateTransferParams) (*gateway.Transfer, error) {
+	g.mu.Lock()
+	g.active++
+	g.maxSeen = max(g.maxSeen, g.active)
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.active--
+		g.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	return g.StripeGateway.CreateTransfer(ctx, params)
+}
+
+func TestPayoutBatchTransfersOneAtATime(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		orgIDs := make([]string, 5)
+		for i := range orgIDs {
+			orgIDs[i], _ = env.onboardedDeveloper(t, 100)
+		}
+
+		stripe := &concurrentTransfers{StripeGateway: env.stripe}
+		service := services.NewStripeConnectService(env.repo, stripe, services.Options{})
+		batch, err := service.CreatePayoutBatch(ctx, time.Now())
+		if err != nil {
+			t.Fatalf("CreatePayoutBatch: %v", err)
+		}
+		if _, err := service.ExecutePayoutBatch(ctx, batch.ID); err != nil {
+			t.Fatalf("ExecutePayoutBatch: %v", err)
+		}
+		eventually(t, func() bool {
+			batch, err = service.GetPayoutBatch(ctx, batch.ID)
+			return err == nil && batch.Status == models.PayoutBatchStatusCompleted
+		})
+
+		for _, orgID := range orgIDs {
+			if entry := entryOf(batch, orgID); entry == nil || entry.Status != models.WithdrawalStatusCompleted {
+				t.Errorf("entry = %+v, want a completed withdrawal", entry)
+			}
+		}
+		stripe.mu.Lock()
+		defer stripe.mu.Unlock()
+		if len(env.stripe.Transfers()) != len(orgIDs) || stripe.maxSeen != 1 {
+			t.Errorf("%d transfers, at most %d at once, want %d one at a time", len(env.stripe.Transfers()), stripe.maxSeen, len(orgIDs))
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strpe-connect/apperrors"
+	"strpe-connect/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// payoutSchedulerLock keeps replicas from running the scheduler of a tenant at once
+const payoutSchedulerLock = "payout_scheduler"
+
+// payoutScheduleBatchSize is how many due schedules are read at a time
+const payoutScheduleBatchSize = 100
+
+// ================================
+// PAYOUT SCHEDULES
+// ================================
+
+// GetPayoutSchedule returns an organization's payout schedule, which is
+// manual until the developer sets one
+func (s *stripeConnectService) GetPayoutSchedule(ctx context.Context, orgID string) (*models.PayoutScheduleResponse, error) {
+	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+
+	schedule, err := s.repo.GetPayoutSchedule(ctx, wallet.ID)
+	if apperrors.CodeOf(err) == apperrors.CodeNotFound {
+		schedule = &models.PayoutSchedule{DeveloperWalletID: wallet.ID, OrganizationID: orgID, Frequency: models.PayoutFrequencyManual}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get payout schedule: %w", err)
+	}
+
+	return s.payoutScheduleResponse(schedule), nil
+}
+
+// SetPayoutSchedule saves an organization's payout schedule, whose first run
+// is the next one after now
+func (s *stripeConnectService) SetPayoutSchedule(ctx context.Context, orgID string, req *models.SetPayoutScheduleRequest) (*models.PayoutScheduleResponse, error) {
+	schedule := &models.PayoutSchedule{
+		OrganizationID: orgID,
+		Frequency:      req.Frequency,
+		Threshold:      req.Threshold,
+		Reserve:        req.Reserve,
+	}
+	switch req.Frequency {
+	case models.PayoutFrequencyWeekly:
+		if req.Weekday == nil {
+			return nil, apperrors.InvalidRequest("weekday is required for weekly payouts")
+		}
+		schedule.Weekday = req.Weekday
+	case models.PayoutFrequencyMonthly:
+		if req.DayOfMonth == nil {
+			return nil, apperrors.InvalidRequest("day_of_month is required for monthly payouts")
+		}
+		schedule.DayOfMonth = req.DayOfMonth
+	case models.PayoutFrequencyManual, models.PayoutFrequencyDaily:
+	default:
+		return nil, apperrors.InvalidRequest(fmt.Sprintf("unknown payout frequency %q", req.Frequency))
+	}
+	if req.Threshold > 0 && req.Threshold < s.minimumWithdrawal {
+		return nil, apperrors.New(apperrors.CodeBelowMinimum, fmt.Sprintf("threshold must be at least the minimum withdrawal amount of $%.2f", s.minimumWithdrawal)).
+			WithDetails(map[string]float64{"minimum": s.minimumWithdrawal, "threshold": req.Threshold})
+	}
+
+	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %w", err)
+	}
+	schedule.DeveloperWalletID = wallet.ID
+	schedule.NextRunAt = models.NextPayoutRun(schedule, time.Now())
+
+	if err := s.repo.UpsertPayoutSchedule(ctx, schedule); err != nil {
+		return nil, fmt.Errorf("failed to save payout schedule: %w", err)
+	}
+
+	slog.InfoContext(ctx, "payout schedule updated", "organization_id", orgID, "frequency", schedule.Frequency, "next_run_at", schedule.NextRunAt)
+	return s.payoutScheduleResponse(schedule), nil
+}
+
+// RunScheduledPayouts requests the withdrawals of the due payout schedules of
+// the tenant in ctx. Only one replica runs it at a time per tenant, the others
+// return right away. A schedule that fails is logged and stays due for the next
+// run, without holding up the others. It returns how many withdrawals were requested.
+func (s *stripeConnectService) RunScheduledPayouts(ctx context.Context) (int, error) {
+	var requested, failed int
+	locked, err := s.repo.WithAdvisoryLock(ctx, payoutSchedulerLock, func(ctx context.Context) error {
+		now := time.Now()
+		// Failed schedules stay due and come back first, so each is tried once
+		tried := make(map[string]bool)
+		for {
+			schedules, err := s.repo.GetDuePayoutSchedules(ctx, now, payoutScheduleBatchSize)
+			if err != nil {
+				return fmt.Errorf("failed to get due payout schedules: %w", err)
+			}
+
+			ran := 0
+			for _, schedule := range schedules {
+				if tried[schedule.DeveloperWalletID] {
+					continue
+				}
+				tried[schedule.DeveloperWalletID] = true
+				ran++
+
+				withdrawn, err := s.runPayoutSchedule(ctx, schedule, now)
+				if err != nil {
+					failed++
+					slog.ErrorContext(ctx, "failed to run payout schedule, it stays due", "organization_id", schedule.OrganizationID, "error", err)
+					continue
+				}
+				if withdrawn {
+					requested++
+				}
+			}
+
+			if len(schedules) < payoutScheduleBatchSize || ran == 0 {
+				return nil
+			}
+		}
+	})
+	if !locked && err == nil {
+		slog.DebugContext(ctx, "payout scheduler is running elsewhere")
+	}
+	if requested > 0 {
+		slog.InfoContext(ctx, "scheduled payouts requested", "withdrawals", requested)
+	}
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d payout schedules failed and stay due", failed)
+	}
+	return requested, err
+}
+
+// runPayoutSchedule withdraws the available balance above the reserve of a due
+// schedule through RequestWithdrawal, when it reaches the threshold, and moves
+// the schedule to its next run. The run is recorded before the withdrawal is
+// requested, so a schedule never withdraws twice for one run. Rejected
+// withdrawals are recorded on the schedule; only transient errors are
+// returned, after moving the schedule back so it is due again unless the
+// withdrawal was created before the error.
+func (s *stripeConnectService) runPayoutSchedule(ctx context.Context, schedule *models.PayoutSchedule, now time.Time) (bool, error) {
+	wallet, err := s.repo.GetWalletByID(ctx, schedule.DeveloperWalletID)
+	if err != nil {
+		return false, fmt.Errorf("wallet not found: %w", err)
+	}
+	pendingTotal, err := s.repo.GetPendingWithdrawalsTotal(ctx, wallet.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check pending withdrawals: %w", err)
+	}
+
+	// Whole cents only, never rounding up past the reserve
+	amount := math.Floor((availableBalance(wallet, pendingTotal)-schedule.Reserve)*100+1e-6) / 100
+	nextRunAt := models.NextPayoutRun(schedule, now)
+
+	if err := s.repo.RecordPayoutRun(ctx, wallet.ID, now, nextRunAt, nil, nil); err != nil {
+		return false, fmt.Errorf("failed to record payout run: %w", err)
+	}
+	if amount < s.payoutThreshold(schedule) {
+		return false, nil
+	}
+
+	// The ID is chosen up front, so an error reported after the withdrawal was
+	// created can be told apart from one that created nothing
+	withdrawalID := uuid.New().String()
+	_, err = s.requestWithdrawal(ctx, withdrawalID, schedule.OrganizationID, amount)
+	if err != nil && apperrors.IsTransient(err) {
+		if _, getErr := s.repo.GetWithdrawalByID(ctx, withdrawalID); getErr == nil {
+			slog.WarnContext(ctx, "scheduled payout requested despite an error", "organization_id", schedule.OrganizationID, "withdrawal_id", withdrawalID, "error", err)
+			err = nil
+		} else if !errors.Is(getErr, apperrors.ErrNotFound) {
+			// Whether it was created is unknown, so the run stays recorded rather than risk a second withdrawal
+			slog.ErrorContext(ctx, "scheduled payout may not have been requested", "organization_id", schedule.OrganizationID, "withdrawal_id", withdrawalID, "error", err)
+			return false, fmt.Errorf("failed to check scheduled withdrawal: %w", getErr)
+		}
+	}
+
+	switch {
+	case err == nil:
+		slog.InfoContext(ctx, "scheduled payout requested", "organization_id", schedule.OrganizationID, "amount", amount, "withdrawal_id", withdrawalID)
+		if err := s.repo.RecordPayoutRun(ctx, wallet.ID, now, nextRunAt, &withdrawalID, nil); err != nil {
+			// The run is already recorded, only the link to the withdrawal is missing
+			slog.ErrorContext(ctx, "failed to record scheduled withdrawal", "organization_id", schedule.OrganizationID, "withdrawal_id", withdrawalID, "error", err)
+		}
+		return true, nil
+	case apperrors.IsTransient(err):
+		// Nothing was withdrawn, so the schedule goes back to its due run
+		message := "withdrawal could not be requested, it will be retried"
+		if recordErr := s.repo.RecordPayoutRun(ctx, wallet.ID, now, schedule.NextRunAt, nil, &message); recordErr != nil {
+			slog.ErrorContext(ctx, "failed to move payout schedule back", "organization_id", schedule.OrganizationID, "error", recordErr)
+		}
+		return false, err
+	default:
+		message := rejectionMessage(err)
+		slog.WarnContext(ctx, "scheduled payout rejected", "organization_id", schedule.OrganizationID, "amount", amount, "error", err)
+		if err := s.repo.RecordPayoutRun(ctx, wallet.ID, now, nextRunAt, nil, &message); err != nil {
+			return false, fmt.Errorf("failed to record payout run: %w", err)
+		}
+		return false, nil
+	}
+}
+
+// rejectionMessage explains a rejected withdrawal without the wrapping of
+// the layers it went through
+func rejectionMessage(err error) string {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return err.Error()
+}
+
+// payoutThreshold is the smallest withdrawal a schedule makes
+func (s *stripeConnectService) payoutThreshold(schedule *models.PayoutSchedule) float64 {
+	return math.Max(schedule.Threshold, s.minimumWithdrawal)
+}
+
+func (s *stripeConnectService) payoutScheduleResponse(schedule *models.PayoutSchedule) *models.PayoutScheduleResponse {
+	return &models.PayoutScheduleResponse{
+		OrganizationID:   schedule.OrganizationID,
+		Frequency:        schedule.Frequency,
+		Weekday:          schedule.Weekday,
+		DayOfMonth:       schedule.DayOfMonth,
+		Threshold:        s.payoutThreshold(schedule),
+		Reserve:          schedule.Reserve,
+		NextRunAt:        schedule.NextRunAt,
+		LastRunAt:        schedule.LastRunAt,
+		LastWithdrawalID: schedule.LastWithdrawalID,
+		LastError:        schedule.LastError,
+	}
+}
@@ -0,0 +1,339 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"strpe-connect/repository"
+	"strpe-connect/services"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestNextPayoutRun(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2026, time.January, 28, 15, 30, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		schedule models.PayoutSchedule
+		after    time.Time
+		want     *time.Time
+	}{
+		{"manual", models.PayoutSchedule{Frequency: models.PayoutFrequencyManual}, now, nil},
+		{"daily", models.PayoutSchedule{Frequency: models.PayoutFrequencyDaily}, now, ptr(day(time.January, 29))},
+		{"daily at midnight", models.PayoutSchedule{Frequency: models.PayoutFrequencyDaily}, day(time.January, 29), ptr(day(time.January, 30))},
+		{"weekly later this week", models.PayoutSchedule{Frequency: models.PayoutFrequencyWeekly, Weekday: intPtr(int(time.Friday))}, now, ptr(day(time.January, 30))},
+		{"weekly on today", models.PayoutSchedule{Frequency: models.PayoutFrequencyWeekly, Weekday: intPtr(int(time.Wednesday))}, now, ptr(day(time.February, 4))},
+		{"weekly next week", models.PayoutSchedule{Frequency: models.PayoutFrequencyWeekly, Weekday: intPtr(int(time.Monday))}, now, ptr(day(time.February, 2))},
+		{"monthly later this month", models.PayoutSchedule{Frequency: models.PayoutFrequencyMonthly, DayOfMonth: intPtr(30)}, now, ptr(day(time.January, 30))},
+		{"monthly next month", models.PayoutSchedule{Frequency: models.PayoutFrequencyMonthly, DayOfMonth: intPtr(1)}, now, ptr(day(time.February, 1))},
+		{"monthly in a shorter month", models.PayoutSchedule{Frequency: models.PayoutFrequencyMonthly, DayOfMonth: intPtr(31)}, day(time.January, 31), ptr(day(time.February, 28))},
+		{"monthly without a day", models.PayoutSchedule{Frequency: models.PayoutFrequencyMonthly}, now, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := models.NextPayoutRun(&tt.schedule, tt.after)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("NextPayoutRun = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestSetPayoutSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      models.SetPayoutScheduleRequest
+		wantCode apperrors.Code
+	}{
+		{"weekly", models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyWeekly, Weekday: intPtr(5), Threshold: 100, Reserve: 25}, ""},
+		{"weekly without weekday", models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyWeekly}, apperrors.CodeInvalidRequest},
+		{"monthly without day", models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyMonthly}, apperrors.CodeInvalidRequest},
+		{"unknown frequency", models.SetPayoutScheduleRequest{Frequency: "hourly"}, apperrors.CodeInvalidRequest},
+		{"threshold below minimum", models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyDaily, Threshold: 10}, apperrors.CodeBelowMinimum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+				ctx := context.Background()
+				orgID, _ := env.onboardedDeveloper(t, 0)
+
+				resp, err := env.service.SetPayoutSchedule(ctx, orgID, &tt.req)
+				assertCode(t, err, tt.wantCode)
+				if err != nil {
+					return
+				}
+
+				got, err := env.service.GetPayoutSchedule(ctx, orgID)
+				if err != nil {
+					t.Fatalf("GetPayoutSchedule: %v", err)
+				}
+				if got.Frequency != tt.req.Frequency || got.Weekday == nil || *got.Weekday != *tt.req.Weekday || got.NextRunAt == nil {
+					t.Errorf("schedule = %+v, want the saved weekly schedule", got)
+				}
+				if !got.NextRunAt.Equal(*resp.NextRunAt) || got.NextRunAt.Weekday() != time.Friday {
+					t.Errorf("next run = %v, want the next Friday %v", got.NextRunAt, resp.NextRunAt)
+				}
+				assertMoney(t, "threshold", got.Threshold, 100)
+				assertMoney(t, "reserve", got.Reserve, 25)
+			})
+		})
+	}
+}
+
+func TestGetPayoutScheduleDefaultsToManual(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		orgID, _ := env.onboardedDeveloper(t, 0)
+
+		got, err := env.service.GetPayoutSchedule(context.Background(), orgID)
+		if err != nil {
+			t.Fatalf("GetPayoutSchedule: %v", err)
+		}
+		if got.Frequency != models.PayoutFrequencyManual || got.NextRunAt != nil {
+			t.Errorf("schedule = %+v, want manual", got)
+		}
+		assertMoney(t, "threshold", got.Threshold, models.MinimumWithdrawalAmount)
+
+		_, err = env.service.GetPayoutSchedule(context.Background(), env.newOrg(t))
+		assertCode(t, err, apperrors.CodeNotFound)
+	})
+}
+
+func TestRunScheduledPayouts(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		schedule := func(orgID string, req models.SetPayoutScheduleRequest) {
+			t.Helper()
+			if _, err := env.service.SetPayoutSchedule(ctx, orgID, &req); err != nil {
+				t.Fatalf("SetPayoutSchedule: %v", err)
+			}
+			// Make it due
+			wallet := env.wallet(t, orgID)
+			stored, err := env.repo.GetPayoutSchedule(ctx, wallet.ID)
+			if err != nil {
+				t.Fatalf("GetPayoutSchedule: %v", err)
+			}
+			stored.NextRunAt = ptr(time.Now().Add(-time.Minute))
+			if err := env.repo.UpsertPayoutSchedule(ctx, stored); err != nil {
+				t.Fatalf("UpsertPayoutSchedule: %v", err)
+			}
+		}
+		run := func() int {
+			t.Helper()
+			requested, err := env.service.RunScheduledPayouts(ctx)
+			if err != nil {
+				t.Fatalf("RunScheduledPayouts: %v", err)
+			}
+			return requested
+		}
+		status := func(orgID string) *models.PayoutScheduleResponse {
+			t.Helper()
+			resp, err := env.service.GetPayoutSchedule(ctx, orgID)
+			if err != nil {
+				t.Fatalf("GetPayoutSchedule: %v", err)
+			}
+			return resp
+		}
+
+		paid, _ := env.onboardedDeveloper(t, 200.55)
+		schedule(paid, models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyDaily, Reserve: 25})
+		belowThreshold, _ := env.onboardedDeveloper(t, 120)
+		schedule(belowThreshold, models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyDaily, Threshold: 150})
+		rejected, _ := env.onboardedDeveloper(t, 100)
+		schedule(rejected, models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyMonthly, DayOfMonth: intPtr(15)})
+		if err := env.repo.UpdateOnboardingStatus(ctx, env.wallet(t, rejected).ID, true, false, true); err != nil {
+			t.Fatalf("UpdateOnboardingStatus: %v", err)
+		}
+
+		// Another replica holding the lock keeps this one from running
+		locked, err := env.repo.WithAdvisoryLock(ctx, "payout_scheduler", func(ctx context.Context) error {
+			if requested := run(); requested != 0 {
+				t.Errorf("requested = %d while locked, want 0", requested)
+			}
+			return nil
+		})
+		if !locked || err != nil {
+			t.Fatalf("WithAdvisoryLock = %v, %v", locked, err)
+		}
+		if status(paid).LastRunAt != nil {
+			t.Fatal("schedule ran while the lock was held")
+		}
+
+		if requested := run(); requested != 1 {
+			t.Errorf("requested = %d, want 1", requested)
+		}
+
+		// The balance above the reserve was withdrawn
+		got := status(paid)
+		if got.LastWithdrawalID == nil || got.LastError != nil || got.LastRunAt == nil {
+			t.Fatalf("schedule = %+v, want a withdrawal", got)
+		}
+		if got.NextRunAt == nil || !got.NextRunAt.After(time.Now()) {
+			t.Errorf("next run = %v, want tomorrow", got.NextRunAt)
+		}
+		withdrawal, err := env.repo.GetWithdrawalByID(ctx, *got.LastWithdrawalID)
+		if err != nil {
+			t.Fatalf("GetWithdrawalByID: %v", err)
+		}
+		assertMoney(t, "withdrawal amount", withdrawal.Amount, 175.55)
+		eventually(t, func() bool { return env.wallet(t, paid).TotalWithdrawn > 0 })
+		assertMoney(t, "balance", env.wallet(t, paid).Balance, 25)
+
+		// Below the threshold nothing is withdrawn, but the schedule moves on
+		got = status(belowThreshold)
+		if got.LastWithdrawalID != nil || got.LastError != nil || got.LastRunAt == nil || !got.NextRunAt.After(time.Now()) {
+			t.Errorf("schedule = %+v, want a run without withdrawal", got)
+		}
+
+		// A rejected withdrawal is reported on the schedule
+		got = status(rejected)
+		if got.LastWithdrawalID != nil || got.LastError == nil || !got.NextRunAt.After(time.Now()) {
+			t.Errorf("schedule = %+v, want the rejection as last error", got)
+		}
+
+		// Nothing is due any more
+		if requested := run(); requested != 0 {
+			t.Errorf("requested = %d on the second run, want 0", requested)
+		}
+	})
+}
+
+// flakyWithdrawals fails the withdrawals of one wallet with a database error,
+// after creating them when committed is set
+type flakyWithdrawals struct {
+	repository.StripeConnectRepository
+	walletID  string
+	committed bool
+}
+
+func (r *flakyWithdrawals) CreateWithdrawalRequest(ctx context.Context, withdrawal *models.WithdrawalRequest) error {
+	if withdrawal.DeveloperWalletID != r.walletID {
+		return r.StripeConnectRepository.CreateWithdrawalRequest(ctx, withdrawal)
+	}
+	if r.committed {
+		if err := r.StripeConnectRepository.CreateWithdrawalRequest(ctx, withdrawal); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection reset by peer")
+}
+
+func TestRunScheduledPayoutsContinuesPastTransientErrors(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		due := ptr(time.Now().Add(-time.Minute).Truncate(time.Microsecond))
+		schedule := func(orgID string) {
+			t.Helper()
+			req := models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyDaily}
+			if _, err := env.service.SetPayoutSchedule(ctx, orgID, &req); err != nil {
+				t.Fatalf("SetPayoutSchedule: %v", err)
+			}
+			stored, err := env.repo.GetPayoutSchedule(ctx, env.wallet(t, orgID).ID)
+			if err != nil {
+				t.Fatalf("GetPayoutSchedule: %v", err)
+			}
+			stored.NextRunAt = due
+			if err := env.repo.UpsertPayoutSchedule(ctx, stored); err != nil {
+				t.Fatalf("UpsertPayoutSchedule: %v", err)
+			}
+		}
+
+		failing, _ := env.onboardedDeveloper(t, 100)
+		schedule(failing)
+		paid, _ := env.onboardedDeveloper(t, 100)
+		schedule(paid)
+
+		repo := &flakyWithdrawals{StripeConnectRepository: env.repo, walletID: env.wallet(t, failing).ID}
+		service := services.NewStripeConnectService(repo, env.stripe, services.Options{})
+		requested, err := service.RunScheduledPayouts(ctx)
+		if err == nil {
+			t.Error("RunScheduledPayouts succeeded, want the failed schedule reported")
+		}
+		if requested != 1 {
+			t.Errorf("requested = %d, want 1", requested)
+		}
+
+		got, err := env.service.GetPayoutSchedule(ctx, paid)
+		if err != nil {
+			t.Fatalf("GetPayoutSchedule: %v", err)
+		}
+		if got.LastWithdrawalID == nil || got.NextRunAt == nil || !got.NextRunAt.After(time.Now()) {
+			t.Errorf("schedule = %+v, want a withdrawal and the next run tomorrow", got)
+		}
+
+		// The failed schedule is still due, and the next run withdraws
+		got, err = env.service.GetPayoutSchedule(ctx, failing)
+		if err != nil {
+			t.Fatalf("GetPayoutSchedule: %v", err)
+		}
+		if got.LastWithdrawalID != nil || got.LastError == nil || got.NextRunAt == nil || !got.NextRunAt.Equal(*due) {
+			t.Errorf("schedule = %+v, want it due at %v with an error", got, due)
+		}
+		if requested, err := env.service.RunScheduledPayouts(ctx); err != nil || requested != 1 {
+			t.Errorf("second run = %d, %v, want 1 withdrawal", requested, err)
+		}
+		if got, err := env.service.GetPayoutSchedule(ctx, failing); err != nil || got.LastWithdrawalID == nil || got.LastError != nil {
+			t.Errorf("schedule after the second run = %+v, %v, want a withdrawal", got, err)
+		}
+	})
+}
+
+func TestScheduledPayoutCreatedDespiteAnErrorIsNotRepeated(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		orgID, _ := env.onboardedDeveloper(t, 100)
+		walletID := env.wallet(t, orgID).ID
+		if _, err := env.service.SetPayoutSchedule(ctx, orgID, &models.SetPayoutScheduleRequest{Frequency: models.PayoutFrequencyDaily}); err != nil {
+			t.Fatalf("SetPayoutSchedule: %v", err)
+		}
+		stored, err := env.repo.GetPayoutSchedule(ctx, walletID)
+		if err != nil {
+			t.Fatalf("GetPayoutSchedule: %v", err)
+		}
+		stored.NextRunAt = ptr(time.Now().Add(-time.Minute))
+		if err := env.repo.UpsertPayoutSchedule(ctx, stored); err != nil {
+			t.Fatalf("UpsertPayoutSchedule: %v", err)
+		}
+
+		// The withdrawal commits, but the error reaches the scheduler anyway
+		repo := &flakyWithdrawals{StripeConnectRepository: env.repo, walletID: walletID, committed: true}
+		service := services.NewStripeConnectService(repo, env.stripe, services.Options{})
+		if requested, err := service.RunScheduledPayouts(ctx); err != nil || requested != 1 {
+			t.Fatalf("RunScheduledPayouts = %d, %v, want the withdrawal counted", requested, err)
+		}
+
+		got, err := env.service.GetPayoutSchedule(ctx, orgID)
+		if err != nil {
+			t.Fatalf("GetPayoutSchedule: %v", err)
+		}
+		if got.LastWithdrawalID == nil || got.LastError != nil || got.NextRunAt == nil || !got.NextRunAt.After(time.Now()) {
+			t.Fatalf("schedule = %+v, want the withdrawal and the next run tomorrow", got)
+		}
+		if _, err := env.repo.GetWithdrawalByID(ctx, *got.LastWithdrawalID); err != nil {
+			t.Errorf("GetWithdrawalByID: %v", err)
+		}
+		if requested, err := env.service.RunScheduledPayouts(ctx); err != nil || requested != 0 {
+			t.Errorf("second run = %d, %v, want no second withdrawal", requested, err)
+		}
+		pending, err := env.repo.GetPendingWithdrawalsTotal(ctx, walletID)
+		if err != nil {
+			t.Fatalf("GetPendingWithdrawalsTotal: %v", err)
+		}
+		assertMoney(t, "pending withdrawals", pending, 100)
+	})
+}
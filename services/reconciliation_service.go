@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ================================
+// RECONCILIATION
+// ================================
+
+// RunReconciliation compares the withdrawals and wallets of the tenant in ctx
+// with the transfers, payouts and balance transactions Stripe has for each
+// connected account. Stripe objects created since the last successful run,
+// less the lookback so late payout failures are still seen, are matched to
+// withdrawals by their withdrawal_id metadata and by ID. Mismatches are stored
+// as open issues, and open issues about objects that now match are resolved.
+func (s *stripeConnectService) RunReconciliation(ctx context.Context) (*models.ReconciliationRun, error) {
+	run := &models.ReconciliationRun{StartedAt: time.Now(), Since: time.Unix(0, 0).UTC()}
+
+	last, err := s.repo.GetLastReconciliationRun(ctx, true)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get last reconciliation run: %w", err)
+	}
+	if err == nil {
+		run.Since = last.StartedAt.Add(-s.reconciliationLookback)
+	}
+
+	wallets, err := s.repo.GetConnectedWallets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connected wallets: %w", err)
+	}
+
+	var examined, stillOpen, failures []string
+	for _, wallet := range wallets {
+		account, err := s.reconcileAccount(ctx, wallet, run.Since)
+		if err != nil {
+			// The checkpoint does not move, so the account is compared again next run
+			failures = append(failures, fmt.Sprintf("%s: %v", *wallet.StripeConnectAccountID, err))
+			continue
+		}
+
+		for _, issue := range account.issues {
+			if err := s.repo.UpsertReconciliationIssue(ctx, issue); err != nil {
+				return nil, fmt.Errorf("failed to save reconciliation issue: %w", err)
+			}
+			stillOpen = append(stillOpen, issue.ID)
+		}
+		examined = append(examined, account.examined...)
+		run.AccountsChecked++
+		run.IssuesFound += len(account.issues)
+	}
+
+	run.IssuesResolved, err = s.repo.ResolveReconciliationIssues(ctx, examined, stillOpen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve reconciliation issues: %w", err)
+	}
+
+	run.FinishedAt = time.Now()
+	if len(failures) > 0 {
+		failed := strings.Join(failures, "; ")
+		run.Error = &failed
+	}
+	if err := s.repo.CreateReconciliationRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to save reconciliation run: %w", err)
+	}
+
+	level := slog.LevelInfo
+	if run.IssuesFound > 0 || run.Error != nil {
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "reconciliation finished", "accounts_checked", run.AccountsChecked,
+		"issues_found", run.IssuesFound, "issues_resolved", run.IssuesResolved, "failed_accounts", len(failures))
+
+	return run, nil
+}
+
+func (s *stripeConnectService) GetReconciliationIssues(ctx context.Context, page models.PageRequest, filter models.ReconciliationIssueFilter) (*models.GetReconciliationIssuesResponse, error) {
+	page = normalizePage(page)
+
+	issues, total, err := s.repo.GetReconciliationIssues(ctx, filter, peekPage(page))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reconciliation issues: %w", err)
+	}
+
+	hasMore := len(issues) > page.Limit
+	if hasMore {
+		issues = issues[:page.Limit]
+	}
+
+	resp := &models.GetReconciliationIssuesResponse{
+		Issues:  make([]models.ReconciliationIssue, len(issues)),
+		Total:   total,
+		Page:    page.Page,
+		Limit:   page.Limit,
+		HasMore: hasMore,
+	}
+	for i, issue := range issues {
+		resp.Issues[i] = *issue
+	}
+	if hasMore {
+		last := issues[len(issues)-1]
+		resp.NextCursor = models.Cursor{Time: last.FirstSeenAt, ID: last.ID}.Encode()
+	}
+
+	resp.LastRun, err = s.repo.GetLastReconciliationRun(ctx, false)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get last reconciliation run: %w", err)
+	}
+
+	return resp, nil
+}
+
+// accountReconciliation collects the issues found on one connected account and
+// the Stripe objects that were compared
+type accountReconciliation struct {
+	wallet    *models.DeveloperWallet
+	accountID string
+	issues    []*models.ReconciliationIssue
+	examined  []string
+}
+
+func (a *accountReconciliation) flag(issueType, objectID, details string, withdrawal *models.WithdrawalRequest) *models.ReconciliationIssue {
+	issue := &models.ReconciliationIssue{
+		IssueType:       issueType,
+		StripeAccountID: a.accountID,
+		StripeObjectID:  objectID,
+		OrganizationID:  &a.wallet.OrganizationID,
+		Details:         details,
+	}
+	if withdrawal != nil {
+		issue.WithdrawalID = &withdrawal.ID
+		issue.LocalAmount = &withdrawal.Amount
+		issue.LocalStatus = &withdrawal.Status
+	}
+	a.issues = append(a.issues, issue)
+	return issue
+}
+
+func (s *stripeConnectService) reconcileAccount(ctx context.Context, wallet *models.DeveloperWallet, since time.Time) (*accountReconciliation, error) {
+	account := &accountReconciliation{wallet: wallet, accountID: *wallet.StripeConnectAccountID}
+
+	transfers, err := s.gateway.ListTransfers(ctx, account.accountID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transfers: %w", err)
+	}
+	payouts, err := s.gateway.ListPayouts(ctx, account.accountID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payouts: %w", err)
+	}
+	history, err := s.gateway.ListBalanceTransactions(ctx, account.accountID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list balance transactions: %w", err)
+	}
+
+	for _, tr := range transfers {
+		if err := s.reconcileTransfer(ctx, account, tr); err != nil {
+			return nil, err
+		}
+	}
+
+	// The balance history shows payouts whose funds came back even when the
+	// payout object was not updated yet
+	returned := map[string]bool{}
+	for _, txn := range history {
+		if txn.Type == gateway.BalanceTransactionTypePayoutFailure || txn.Type == gateway.BalanceTransactionTypePayoutCancel {
+			returned[txn.SourceID] = true
+		}
+	}
+	for _, po := range payouts {
+		if err := s.reconcilePayout(ctx, account, po, returned[po.ID]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.reconcileBalance(ctx, account); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *stripeConnectService) reconcileTransfer(ctx context.Context, account *accountReconciliation, tr *gateway.Transfer) error {
+	account.examined = append(account.examined, tr.ID)
+
+	withdrawal, withdrawalID, err := s.withdrawalForStripeObject(ctx, account.wallet, tr.Metadata)
+	if err != nil {
+		return err
+	}
+	switch {
+	case withdrawalID == "":
+		account.flag(models.ReconciliationIssueOrphanTransfer, tr.ID,
+			fmt.Sprintf("transfer %s has no withdrawal_id metadata", tr.ID), nil).StripeAmount = dollars(tr.AmountCents)
+		return nil
+	case withdrawal == nil:
+		issue := account.flag(models.ReconciliationIssueMissingLocalRecord, tr.ID,
+			fmt.Sprintf("transfer %s names withdrawal %s, which this wallet does not have", tr.ID, withdrawalID), nil)
+		issue.WithdrawalID = &withdrawalID
+		issue.StripeAmount = dollars(tr.AmountCents)
+		return nil
+	}
+
+	if amountCents(withdrawal.Amount) != tr.AmountCents {
+		account.flag(models.ReconciliationIssueAmountMismatch, tr.ID,
+			fmt.Sprintf("transfer %s moved %s but the withdrawal is for %s", tr.ID, formatCents(tr.AmountCents), formatCents(amountCents(withdrawal.Amount))),
+			withdrawal).StripeAmount = dollars(tr.AmountCents)
+	}
+
+	// Pending and processing withdrawals record their transfer when processing ends
+	if inFlight(withdrawal) {
+		return nil
+	}
+	if recorded := stringValue(withdrawal.StripeTransferID); recorded != tr.ID {
+		details := fmt.Sprintf("transfer %s was made but the %s withdrawal has no transfer recorded", tr.ID, withdrawal.Status)
+		if recorded != "" {
+			details = fmt.Sprintf("transfer %s was made but the withdrawal records transfer %s", tr.ID, recorded)
+		}
+		issue := account.flag(models.ReconciliationIssueStatusDrift, tr.ID, details, withdrawal)
+		issue.StripeAmount = dollars(tr.AmountCents)
+		issue.StripeStatus = stringPtr("transferred")
+	}
+	return nil
+}
+
+func (s *stripeConnectService) reconcilePayout(ctx context.Context, account *accountReconciliation, po *gateway.Payout, fundsReturned bool) error {
+	account.examined = append(account.examined, po.ID)
+
+	stripeStatus := po.Status
+	if fundsReturned && po.Status != gateway.PayoutStatusFailed && po.Status != gateway.PayoutStatusCanceled {
+		stripeStatus = gateway.PayoutStatusFailed
+	}
+
+	withdrawal, withdrawalID, err := s.withdrawalForStripeObject(ctx, account.wallet, po.Metadata)
+	if err != nil {
+		return err
+	}
+	switch {
+	case withdrawalID == "":
+		issue := account.flag(models.ReconciliationIssueOrphanPayout, po.ID,
+			fmt.Sprintf("payout %s was not made for a withdrawal", po.ID), nil)
+		issue.StripeAmount = dollars(po.AmountCents)
+		issue.StripeStatus = &stripeStatus
+		return nil
+	case withdrawal == nil:
+		issue := account.flag(models.ReconciliationIssueMissingLocalRecord, po.ID,
+			fmt.Sprintf("payout %s names withdrawal %s, which this wallet does not have", po.ID, withdrawalID), nil)
+		issue.WithdrawalID = &withdrawalID
+		issue.StripeAmount = dollars(po.AmountCents)
+		issue.StripeStatus = &stripeStatus
+		return nil
+	}
+
+	if amountCents(withdrawal.Amount) != po.AmountCents {
+		issue := account.flag(models.ReconciliationIssueAmountMismatch, po.ID,
+			fmt.Sprintf("payout %s is for %s but the withdrawal is for %s", po.ID, formatCents(po.AmountCents), formatCents(amountCents(withdrawal.Amount))),
+			withdrawal)
+		issue.StripeAmount = dollars(po.AmountCents)
+		issue.StripeStatus = &stripeStatus
+	}
+
+	if inFlight(withdrawal) {
+		return nil
+	}
+	payoutFailed := stripeStatus == gateway.PayoutStatusFailed || stripeStatus == gateway.PayoutStatusCanceled
+	var details string
+	switch recorded := stringValue(withdrawal.StripePayoutID); {
+	case payoutFailed && withdrawal.Status != models.WithdrawalStatusFailed:
+		// The wallet was charged when the transfer succeeded, so the funds are
+		// already paid and sit on the connected account
+		details = fmt.Sprintf("payout %s is %s but the withdrawal is %s, its funds are back on the connected account", po.ID, stripeStatus, withdrawal.Status)
+	case !payoutFailed && withdrawal.Status == models.WithdrawalStatusFailed:
+		details = fmt.Sprintf("payout %s is %s but the withdrawal is failed", po.ID, stripeStatus)
+	case recorded != po.ID:
+		details = fmt.Sprintf("payout %s was made but the withdrawal records payout %q", po.ID, recorded)
+	default:
+		return nil
+	}
+	issue := account.flag(models.ReconciliationIssueStatusDrift, po.ID, details, withdrawal)
+	issue.StripeAmount = dollars(po.AmountCents)
+	issue.StripeStatus = &stripeStatus
+	return nil
+}
+
+// reconcileBalance checks that the connected account holds exactly the funds of
+// failed withdrawals whose transfer went through, since every other transfer
+// is paid out right away. Those funds left the wallet with the transfer, so they
+// count as paid to the developer. Accounts with a withdrawal in flight are skipped.
+func (s *stripeConnectService) reconcileBalance(ctx context.Context, account *accountReconciliation) error {
+	inFlight, err := s.repo.HasWithdrawalsInFlight(ctx, account.wallet.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check pending withdrawals: %w", err)
+	}
+	if inFlight {
+		return nil
+	}
+
+	expected, err := s.repo.GetUnpaidTransfersTotal(ctx, account.wallet.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get unpaid transfers: %w", err)
+	}
+	balance, err := s.gateway.GetBalance(ctx, account.accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	account.examined = append(account.examined, account.accountID)
+	heldCents := balance.Available[gateway.CurrencyUSD] + balance.Pending[gateway.CurrencyUSD]
+	if heldCents != amountCents(expected) {
+		issue := account.flag(models.ReconciliationIssueBalanceMismatch, account.accountID,
+			fmt.Sprintf("connected account holds %s but failed withdrawals account for %s", formatCents(heldCents), formatCents(amountCents(expected))), nil)
+		issue.LocalAmount = &expected
+		issue.StripeAmount = dollars(heldCents)
+	}
+	return nil
+}
+
+// withdrawalForStripeObject returns the withdrawal named by the withdrawal_id
+// metadata of a Stripe object, and the ID itself. The withdrawal is nil when the
+// ID is empty or names no withdrawal of wallet.
+func (s *stripeConnectService) withdrawalForStripeObject(ctx context.Context, wallet *models.DeveloperWallet, metadata map[string]string) (*models.WithdrawalRequest, string, error) {
+	withdrawalID := metadata["withdrawal_id"]
+	if _, err := uuid.Parse(withdrawalID); err != nil {
+		return nil, withdrawalID, nil
+	}
+
+	withdrawal, err := s.repo.GetWithdrawalByID(ctx, withdrawalID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil, withdrawalID, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get withdrawal: %w", err)
+	}
+	if withdrawal.DeveloperWalletID != wallet.ID {
+		return nil, withdrawalID, nil
+	}
+	return withdrawal, withdrawalID, nil
+}
+
+func inFlight(withdrawal *models.WithdrawalRequest) bool {
+	return withdrawal.Status == models.WithdrawalStatusPending || withdrawal.Status == models.WithdrawalStatusProcessing
+}
+
+func amountCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func dollars(cents int64) *float64 {
+	amount := float64(cents) / 100
+	return &amount
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("$%.2f", float64(cents)/100)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
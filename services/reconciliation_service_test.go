@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+
+	"github.com/google/uuid"
+)
+
+// openIssues returns the open issues of a connected account as type/object pairs
+func (env *testEnv) openIssues(t *testing.T, accountID string) []string {
+	t.Helper()
+	resp, err := env.service.GetReconciliationIssues(context.Background(), models.PageRequest{Limit: 100}, models.ReconciliationIssueFilter{
+		Status:          models.ReconciliationIssueStatusOpen,
+		StripeAccountID: accountID,
+	})
+	if err != nil {
+		t.Fatalf("GetReconciliationIssues: %v", err)
+	}
+
+	var issues []string
+	for _, issue := range resp.Issues {
+		issues = append(issues, issue.IssueType+"/"+issue.StripeObjectID)
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+func assertIssues(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("open issues = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("open issues = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunReconciliation(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		orgID, accountID := env.onboardedDeveloper(t, 100)
+		withdrawal := env.withdraw(t, orgID, 70)
+
+		if _, err := env.service.RunReconciliation(ctx); err != nil {
+			t.Fatalf("RunReconciliation: %v", err)
+		}
+		assertIssues(t, env.openIssues(t, accountID))
+
+		// Money moved on Stripe without the platform, and a payout failure the
+		// service never heard of
+		orphan, err := env.stripe.CreateTransfer(ctx, &gateway.CreateTransferParams{
+			DestinationAccountID: accountID, AmountCents: 500, Currency: gateway.CurrencyUSD,
+		})
+		if err != nil {
+			t.Fatalf("CreateTransfer: %v", err)
+		}
+		orphanPayout, err := env.stripe.CreatePayout(ctx, &gateway.CreatePayoutParams{
+			AccountID: accountID, AmountCents: 500, Currency: gateway.CurrencyUSD,
+		})
+		if err != nil {
+			t.Fatalf("CreatePayout: %v", err)
+		}
+		unknown := map[string]string{"withdrawal_id": uuid.NewString()}
+		unknownTransfer, err := env.stripe.CreateTransfer(ctx, &gateway.CreateTransferParams{
+			DestinationAccountID: accountID, AmountCents: 300, Currency: gateway.CurrencyUSD, Metadata: unknown,
+		})
+		if err != nil {
+			t.Fatalf("CreateTransfer: %v", err)
+		}
+		unknownPayout, err := env.stripe.CreatePayout(ctx, &gateway.CreatePayoutParams{
+			AccountID: accountID, AmountCents: 300, Currency: gateway.CurrencyUSD, Metadata: unknown,
+		})
+		if err != nil {
+			t.Fatalf("CreatePayout: %v", err)
+		}
+		if err := env.stripe.FailPayout(ctx, *withdrawal.StripePayoutID, "account_closed", "The bank account has been closed"); err != nil {
+			t.Fatalf("FailPayout: %v", err)
+		}
+
+		run, err := env.service.RunReconciliation(ctx)
+		if err != nil {
+			t.Fatalf("RunReconciliation: %v", err)
+		}
+		if run.IssuesFound < 6 {
+			t.Errorf("issues found = %d, want at least 6", run.IssuesFound)
+		}
+		assertIssues(t, env.openIssues(t, accountID),
+			models.ReconciliationIssueOrphanTransfer+"/"+orphan.ID,
+			models.ReconciliationIssueOrphanPayout+"/"+orphanPayout.ID,
+			models.ReconciliationIssueMissingLocalRecord+"/"+unknownTransfer.ID,
+			models.ReconciliationIssueMissingLocalRecord+"/"+unknownPayout.ID,
+			models.ReconciliationIssueStatusDrift+"/"+*withdrawal.StripePayoutID,
+			models.ReconciliationIssueBalanceMismatch+"/"+accountID,
+		)
+
+		// The late webhook fixes the withdrawal, and the returned funds are now expected
+		if err := env.service.HandlePayoutFailed(ctx, withdrawal.ID, "account_closed"); err != nil {
+			t.Fatalf("HandlePayoutFailed: %v", err)
+		}
+		run, err = env.service.RunReconciliation(ctx)
+		if err != nil {
+			t.Fatalf("RunReconciliation: %v", err)
+		}
+		if run.IssuesResolved != 2 {
+			t.Errorf("issues resolved = %d, want 2", run.IssuesResolved)
+		}
+		assertIssues(t, env.openIssues(t, accountID),
+			models.ReconciliationIssueOrphanTransfer+"/"+orphan.ID,
+			models.ReconciliationIssueOrphanPayout+"/"+orphanPayout.ID,
+			models.ReconciliationIssueMissingLocalRecord+"/"+unknownTransfer.ID,
+			models.ReconciliationIssueMissingLocalRecord+"/"+unknownPayout.ID,
+		)
+	})
+}
+
+func TestRunReconciliationRecordsFailedAccounts(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		env.onboardedDeveloper(t, 0)
+		env.stripe.FailNext("ListPayouts", stripeOutage())
+
+		run, err := env.service.RunReconciliation(ctx)
+		if err != nil {
+			t.Fatalf("RunReconciliation: %v", err)
+		}
+		if run.Error == nil {
+			t.Fatal("run error = nil, want the failed account")
+		}
+
+		resp, err := env.service.GetReconciliationIssues(ctx, models.PageRequest{}, models.ReconciliationIssueFilter{})
+		if err != nil {
+			t.Fatalf("GetReconciliationIssues: %v", err)
+		}
+		if resp.LastRun == nil || resp.LastRun.ID != run.ID || resp.LastRun.Error == nil {
+			t.Errorf("last run = %+v, want the failed run %s", resp.LastRun, run.ID)
+		}
+	})
+}
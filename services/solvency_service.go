@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strpe-connect/gateway"
+	"strpe-connect/metrics"
+	"strpe-connect/models"
+	"strpe-connect/tenant"
+	"time"
+)
+
+// ================================
+// SOLVENCY
+// ================================
+
+// GetSolvencyReport compares developer wallet balances and user prepaid
+// balances of every tenant with the platform balance on Stripe. Money is only
+// ever owed in USD, so coverage counts the available and pending USD balance;
+// other currencies are reported but not counted. A coverage ratio below the
+// configured minimum, or too little available balance for the pending
+// withdrawals, is logged as an error and listed in Alerts.
+func (s *stripeConnectService) GetSolvencyReport(ctx context.Context) (*models.SolvencyReport, error) {
+	schemas := s.tenantSchemas
+	if len(schemas) == 0 {
+		schemas = []string{tenant.FromContext(ctx)}
+	}
+
+	report := &models.SolvencyReport{
+		MinCoverageRatio: s.minCoverageRatio,
+		Alerts:           []string{},
+		Tenants:          make([]models.TenantLiabilities, 0, len(schemas)),
+		GeneratedAt:      time.Now(),
+	}
+
+	// Sum in cents so totals over many tenants do not drift
+	var walletCents, pendingCents, prepaidCents, revenueCents int64
+	for _, schema := range schemas {
+		liabilities, err := s.repo.GetLiabilities(tenant.NewContext(ctx, schema))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get liabilities of tenant %s: %w", schema, err)
+		}
+		report.Tenants = append(report.Tenants, models.TenantLiabilities{Tenant: schema, Liabilities: *liabilities})
+
+		walletCents += amountCents(liabilities.WalletBalance)
+		pendingCents += amountCents(liabilities.PendingWithdrawalAmount)
+		prepaidCents += amountCents(liabilities.UserPrepaidBalance)
+		revenueCents += amountCents(liabilities.PlatformRevenue)
+		report.PendingWithdrawalCount += liabilities.PendingWithdrawalCount
+	}
+	totalCents := walletCents + prepaidCents
+	report.DeveloperLiabilities = *dollars(walletCents)
+	report.PendingWithdrawals = *dollars(pendingCents)
+	report.UserPrepaidBalances = *dollars(prepaidCents)
+	report.TotalLiabilities = *dollars(totalCents)
+	report.PlatformRevenue = *dollars(revenueCents)
+
+	balance, err := s.gateway.GetBalance(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get platform balance: %w", stripeError(err))
+	}
+	currencies := map[string]bool{}
+	for currency := range balance.Available {
+		currencies[currency] = true
+	}
+	for currency := range balance.Pending {
+		currencies[currency] = true
+	}
+	for currency := range currencies {
+		available, pending := *dollars(balance.Available[currency]), *dollars(balance.Pending[currency])
+		report.StripeBalance = append(report.StripeBalance, models.CurrencyBalance{Currency: currency, Available: available, Pending: pending})
+		metrics.ObservePlatformBalance(currency, available, pending)
+	}
+	sort.Slice(report.StripeBalance, func(i, j int) bool { return report.StripeBalance[i].Currency < report.StripeBalance[j].Currency })
+
+	availableCents := balance.Available[gateway.CurrencyUSD]
+	stripeCents := availableCents + balance.Pending[gateway.CurrencyUSD]
+	report.Surplus = *dollars(stripeCents - totalCents)
+
+	coverage := math.Inf(1)
+	if totalCents > 0 {
+		coverage = float64(stripeCents) / float64(totalCents)
+		report.CoverageRatio = &coverage
+	}
+	metrics.ObserveSolvency(coverage)
+
+	if coverage < s.minCoverageRatio {
+		report.Alerts = append(report.Alerts, fmt.Sprintf("Stripe balance of %s covers %.1f%% of liabilities of %s, below the minimum of %.1f%%",
+			formatCents(stripeCents), coverage*100, formatCents(totalCents), s.minCoverageRatio*100))
+	}
+	if availableCents < pendingCents {
+		report.Alerts = append(report.Alerts, fmt.Sprintf("available Stripe balance of %s does not fund pending withdrawals of %s",
+			formatCents(availableCents), formatCents(pendingCents)))
+	}
+	report.Healthy = len(report.Alerts) == 0
+
+	if !report.Healthy {
+		slog.ErrorContext(ctx, "platform balance does not cover liabilities", "coverage_ratio", coverage,
+			"total_liabilities", report.TotalLiabilities, "stripe_balance", *dollars(stripeCents), "alerts", report.Alerts)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"strpe-connect/gateway"
+	"strpe-connect/models"
+)
+
+func TestGetSolvencyReport(t *testing.T) {
+	forEachBackend(t, gateway.FakeOptions{}, func(t *testing.T, env *testEnv) {
+		ctx := context.Background()
+		report := func() *models.SolvencyReport {
+			t.Helper()
+			report, err := env.service.GetSolvencyReport(ctx)
+			if err != nil {
+				t.Fatalf("GetSolvencyReport: %v", err)
+			}
+			return report
+		}
+		// Postgres may hold rows of other tests, so amounts are compared with a baseline
+		before := report()
+
+		orgID, _ := env.onboardedDeveloper(t, 100)
+		env.addAccount(t, env.newOrg(t), 50)
+		env.withdraw(t, orgID, 60)
+
+		// The platform was never funded, and the withdrawal's transfer drew on it
+		underfunded := report()
+		assertMoney(t, "developer liabilities", underfunded.DeveloperLiabilities-before.DeveloperLiabilities, 40)
+		assertMoney(t, "user prepaid balances", underfunded.UserPrepaidBalances-before.UserPrepaidBalances, 50)
+		assertMoney(t, "total liabilities", underfunded.TotalLiabilities-before.TotalLiabilities, 90)
+		if underfunded.Healthy || len(underfunded.Alerts) == 0 {
+			t.Errorf("healthy = %v with alerts %v, want coverage alerts", underfunded.Healthy, underfunded.Alerts)
+		}
+		if underfunded.CoverageRatio == nil || *underfunded.CoverageRatio >= 1 {
+			t.Errorf("coverage ratio = %v, want below 1", underfunded.CoverageRatio)
+		}
+
+		// Fund the platform for everything it owes plus $10 of headroom
+		shortfall := -underfunded.Surplus
+		env.stripe.FundPlatform(int64(math.Round((shortfall + 10) * 100)))
+		funded := report()
+		if !funded.Healthy || len(funded.Alerts) != 0 {
+			t.Errorf("healthy = %v with alerts %v, want no alerts", funded.Healthy, funded.Alerts)
+		}
+		assertMoney(t, "surplus", funded.Surplus, 10)
+		if len(funded.StripeBalance) != 1 || funded.StripeBalance[0].Currency != gateway.CurrencyUSD {
+			t.Errorf("stripe balance = %+v, want one USD balance", funded.StripeBalance)
+		}
+	})
+}
@@ -2,15 +2,22 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strpe-connect/apperrors"
+	"strpe-connect/gateway"
+	"strpe-connect/metrics"
 	"strpe-connect/models"
 	"strpe-connect/repository"
+	"strpe-connect/requestid"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v83"
-	"github.com/stripe/stripe-go/v83/account"
-	"github.com/stripe/stripe-go/v83/accountlink"
-	"github.com/stripe/stripe-go/v83/payout"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type StripeConnectService interface {
@@ -18,40 +25,136 @@ type StripeConnectService interface {
 	CreateConnectAccount(ctx context.Context, orgID, refreshURL, returnURL string) (*models.CreateConnectAccountResponse, error)
 	GetConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error)
 	RefreshOnboardingLink(ctx context.Context, orgID, refreshURL, returnURL string) (*models.CreateConnectAccountResponse, error)
+	RefreshConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error)
+	SyncConnectAccounts(ctx context.Context) (int, error)
 
 	// Wallet Management
 	GetWalletBalance(ctx context.Context, orgID string) (*models.GetWalletBalanceResponse, error)
-	GetTransactionHistory(ctx context.Context, orgID string, page, limit int) (*models.GetTransactionHistoryResponse, error)
-	GetConnectedDevelopers(ctx context.Context, page, limit int) (*models.GetConnectedDevelopersResponse, error)
+	GetTransactionHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetTransactionHistoryResponse, error)
+	GetConnectedDevelopers(ctx context.Context, page models.PageRequest, filter models.DeveloperFilter) (*models.GetConnectedDevelopersResponse, error)
 	GetConnectedDevelopersForOrg(ctx context.Context, userOrgID string) (*models.GetConnectedDevelopersResponse, error)
 
 	// Withdrawals
 	RequestWithdrawal(ctx context.Context, orgID string, amount float64) (*models.CreateWithdrawalResponse, error)
-	GetWithdrawalHistory(ctx context.Context, orgID string, page, limit int) (*models.GetWithdrawalHistoryResponse, error)
+	GetWithdrawalHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.WithdrawalFilter) (*models.GetWithdrawalHistoryResponse, error)
 	ProcessWithdrawal(ctx context.Context, withdrawalID string) error
+	RetryWithdrawals(ctx context.Context) (int, error)
 
 	// Function Execution Payment
 	ProcessFunctionExecutionPayment(ctx context.Context, userOrgID, functionID, developerOrgID string, amount float64) (*models.FunctionExecutionPaymentResponse, error)
 
+	// Earnings Analytics
+	GetEarningsAnalytics(ctx context.Context, orgID, granularity string, from, to time.Time) (*models.GetEarningsAnalyticsResponse, error)
+	RefreshEarningsRollup(ctx context.Context) error
+
+	// Billing (paying user organizations)
+	GetSpendHistory(ctx context.Context, userOrgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetSpendHistoryResponse, error)
+	GetBillingUsage(ctx context.Context, userOrgID string, from, to time.Time) (*models.GetBillingUsageResponse, error)
+	GetBillingStatement(ctx context.Context, userOrgID string, month time.Time) (*models.GetBillingStatementResponse, error)
+
+	// Spending Caps
+	GetSpendingCaps(ctx context.Context, userOrgID string) (*models.GetSpendingCapsResponse, error)
+	SetSpendingCap(ctx context.Context, req *models.SetSpendingCapRequest) (*models.SpendingCapSummary, error)
+	DeleteSpendingCap(ctx context.Context, capID string) error
+
 	// Webhook handling
+	RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error)
+	CompleteWebhookEvent(ctx context.Context, eventID, eventType string, handlingErr error) error
 	HandleAccountUpdated(ctx context.Context, stripeAccountID string) error
 	HandlePayoutPaid(ctx context.Context, withdrawalID, payoutID string) error
 	HandlePayoutFailed(ctx context.Context, withdrawalID, failureReason string) error
+
+	// Reconciliation
+	RunReconciliation(ctx context.Context) (*models.ReconciliationRun, error)
+	GetReconciliationIssues(ctx context.Context, page models.PageRequest, filter models.ReconciliationIssueFilter) (*models.GetReconciliationIssuesResponse, error)
+
+	// Solvency
+	GetSolvencyReport(ctx context.Context) (*models.SolvencyReport, error)
+
+	// Earnings Clearing
+	ReleaseClearedEarnings(ctx context.Context) (int, error)
+	SetDeveloperTier(ctx context.Context, orgID string, req *models.SetDeveloperTierRequest) (*models.DeveloperTierResponse, error)
+
+	// Payout Schedules
+	GetPayoutSchedule(ctx context.Context, orgID string) (*models.PayoutScheduleResponse, error)
+	SetPayoutSchedule(ctx context.Context, orgID string, req *models.SetPayoutScheduleRequest) (*models.PayoutScheduleResponse, error)
+	RunScheduledPayouts(ctx context.Context) (int, error)
+
+	// Payout Batches
+	CreatePayoutBatch(ctx context.Context, cutoff time.Time) (*models.PayoutBatchResponse, error)
+	GetPayoutBatches(ctx context.Context, page models.PageRequest) (*models.GetPayoutBatchesResponse, error)
+	GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error)
+	UpdatePayoutBatchEntries(ctx context.Context, batchID string, req *models.UpdatePayoutBatchEntriesRequest) (*models.PayoutBatchResponse, error)
+	ExecutePayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error)
+}
+
+// Options holds the payment settings of the service. A zero MinimumWithdrawal
+// uses models.MinimumWithdrawalAmount, a zero ReconciliationLookback uses
+// DefaultReconciliationLookback, a zero MinCoverageRatio uses
+// models.DefaultMinCoverageRatio and a zero WithdrawalRetryAfter uses
+// DefaultWithdrawalRetryAfter.
+type Options struct {
+	MinimumWithdrawal      float64
+	PlatformFeePercent     float64
+	ReconciliationLookback time.Duration // How far before the last run Stripe objects are compared again
+	MinCoverageRatio       float64       // Solvency alert threshold for the Stripe balance over liabilities
+	TenantSchemas          []string      // Tenants sharing the platform Stripe balance, empty for the tenant in the context
+	WithdrawalRetryAfter   time.Duration // Withdrawals still pending or processing after this long are processed again
+	AccountSync            AccountSyncOptions
+	Clearing               ClearingOptions
 }
 
+// DefaultReconciliationLookback covers payouts that fail a few days after they were created
+const DefaultReconciliationLookback = 72 * time.Hour
+
+// DefaultWithdrawalRetryAfter leaves a withdrawal this long to its own processing
+// before RetryWithdrawals takes it over
+const DefaultWithdrawalRetryAfter = 5 * time.Minute
+
+// withdrawalRetryLock keeps replicas from retrying the withdrawals of a tenant at once
+const withdrawalRetryLock = "withdrawal_retry"
+
+// withdrawalRetryBatchSize is how many withdrawals a retry run processes at most
+const withdrawalRetryBatchSize = 100
+
 type stripeConnectService struct {
-	repo          repository.StripeConnectRepository
-	stripeKey     string
-	platformFeePercent float64
+	repo                   repository.StripeConnectRepository
+	gateway                gateway.StripeGateway
+	minimumWithdrawal      float64
+	platformFeePercent     float64
+	reconciliationLookback time.Duration
+	minCoverageRatio       float64
+	tenantSchemas          []string
+	withdrawalRetryAfter   time.Duration
+	accountSync            AccountSyncOptions
+	clearing               ClearingOptions
 }
 
-func NewStripeConnectService(repo repository.StripeConnectRepository, stripeKey string) StripeConnectService {
-	stripe.Key = stripeKey
+func NewStripeConnectService(repo repository.StripeConnectRepository, stripeGateway gateway.StripeGateway, opts Options) StripeConnectService {
+	if opts.MinimumWithdrawal <= 0 {
+		opts.MinimumWithdrawal = models.MinimumWithdrawalAmount
+	}
+	if opts.ReconciliationLookback <= 0 {
+		opts.ReconciliationLookback = DefaultReconciliationLookback
+	}
+	if opts.MinCoverageRatio <= 0 {
+		opts.MinCoverageRatio = models.DefaultMinCoverageRatio
+	}
+	if opts.WithdrawalRetryAfter <= 0 {
+		opts.WithdrawalRetryAfter = DefaultWithdrawalRetryAfter
+	}
 
 	return &stripeConnectService{
-		repo:          repo,
-		stripeKey:     stripeKey,
-		platformFeePercent: models.DefaultPlatformFeePercent,
+		repo:                   repo,
+		gateway:                stripeGateway,
+		minimumWithdrawal:      opts.MinimumWithdrawal,
+		platformFeePercent:     opts.PlatformFeePercent,
+		reconciliationLookback: opts.ReconciliationLookback,
+		minCoverageRatio:       opts.MinCoverageRatio,
+		tenantSchemas:          opts.TenantSchemas,
+		withdrawalRetryAfter:   opts.WithdrawalRetryAfter,
+		accountSync:            opts.AccountSync.withDefaults(),
+		clearing:               opts.Clearing,
 	}
 }
 
@@ -62,6 +165,9 @@ func NewStripeConnectService(repo repository.StripeConnectRepository, stripeKey
 func (s *stripeConnectService) CreateConnectAccount(ctx context.Context, orgID, refreshURL, returnURL string) (*models.CreateConnectAccountResponse, error) {
 	// Check if wallet already exists
 	existingWallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get developer wallet: %w", err)
+	}
 	if err == nil && existingWallet.StripeConnectAccountID != nil && *existingWallet.StripeConnectAccountID != "" {
 		// Wallet exists, generate new onboarding link
 		return s.RefreshOnboardingLink(ctx, orgID, refreshURL, returnURL)
@@ -75,23 +181,17 @@ func (s *stripeConnectService) CreateConnectAccount(ctx context.Context, orgID,
 		}
 	}
 
-	// Create Stripe Connect Express account
-	params := &stripe.AccountParams{
-		Type: stripe.String(string(stripe.AccountTypeExpress)),
-		Capabilities: &stripe.AccountCapabilitiesParams{
-			Transfers: &stripe.AccountCapabilitiesTransfersParams{
-				Requested: stripe.Bool(true),
-			},
-		},
+	// Create Stripe Connect Express account, once per wallet even if this request is retried.
+	// No request_id metadata: a retry has a new one, and Stripe rejects replays with other parameters.
+	acc, err := s.gateway.CreateAccount(ctx, &gateway.CreateAccountParams{
 		Metadata: map[string]string{
 			"organization_id": orgID,
-			"wallet_id":      existingWallet.ID,
+			"wallet_id":       existingWallet.ID,
 		},
-	}
-
-	acc, err := account.New(params)
+		IdempotencyKey: gateway.AccountIdempotencyKey(existingWallet.ID),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Stripe account: %w", err)
+		return nil, fmt.Errorf("failed to create Stripe account: %w", stripeError(err))
 	}
 
 	// Save Stripe account ID to wallet
@@ -100,16 +200,13 @@ func (s *stripeConnectService) CreateConnectAccount(ctx context.Context, orgID,
 	}
 
 	// Create account link for onboarding
-	linkParams := &stripe.AccountLinkParams{
-		Account:    stripe.String(acc.ID),
-		RefreshURL: stripe.String(refreshURL),
-		ReturnURL:  stripe.String(returnURL),
-		Type:       stripe.String("account_onboarding"),
-	}
-
-	link, err := accountlink.New(linkParams)
+	link, err := s.gateway.CreateAccountLink(ctx, &gateway.CreateAccountLinkParams{
+		AccountID:  acc.ID,
+		RefreshURL: refreshURL,
+		ReturnURL:  returnURL,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create account link: %w", err)
+		return nil, fmt.Errorf("failed to create account link: %w", stripeError(err))
 	}
 
 	return &models.CreateConnectAccountResponse{
@@ -126,19 +223,16 @@ func (s *stripeConnectService) RefreshOnboardingLink(ctx context.Context, orgID,
 	}
 
 	if wallet.StripeConnectAccountID == nil || *wallet.StripeConnectAccountID == "" {
-		return nil, fmt.Errorf("no Stripe Connect account found")
-	}
-
-	linkParams := &stripe.AccountLinkParams{
-		Account:    stripe.String(*wallet.StripeConnectAccountID),
-		RefreshURL: stripe.String(refreshURL),
-		ReturnURL:  stripe.String(returnURL),
-		Type:       stripe.String("account_onboarding"),
+		return nil, apperrors.NotFound("Stripe Connect account")
 	}
 
-	link, err := accountlink.New(linkParams)
+	link, err := s.gateway.CreateAccountLink(ctx, &gateway.CreateAccountLinkParams{
+		AccountID:  *wallet.StripeConnectAccountID,
+		RefreshURL: refreshURL,
+		ReturnURL:  returnURL,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create account link: %w", err)
+		return nil, fmt.Errorf("failed to create account link: %w", stripeError(err))
 	}
 
 	return &models.CreateConnectAccountResponse{
@@ -148,48 +242,30 @@ func (s *stripeConnectService) RefreshOnboardingLink(ctx context.Context, orgID,
 	}, nil
 }
 
+// GetConnectAccountStatus reads the wallet only. Webhooks and the background
+// account sync keep its status flags up to date, so dashboard polling does
+// not call Stripe.
 func (s *stripeConnectService) GetConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error) {
 	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("wallet not found: %w", err)
 	}
 
-	accountID := ""
-	if wallet.StripeConnectAccountID != nil {
-		accountID = *wallet.StripeConnectAccountID
-
-		// Fetch latest status from Stripe API
-		stripe.Key = s.stripeKey
-		acc, err := account.GetByID(accountID, nil)
-		if err == nil {
-			// Update database with latest status from Stripe
-			onboardingCompleted := acc.DetailsSubmitted
-			payoutsEnabled := acc.PayoutsEnabled
-			chargesEnabled := acc.ChargesEnabled
-
-			err = s.repo.UpdateOnboardingStatus(ctx, wallet.ID, onboardingCompleted, payoutsEnabled, chargesEnabled)
-			if err != nil {
-				log.Printf("WARNING: Failed to update onboarding status: %v", err)
-			} else {
-				// Update local wallet object
-				wallet.OnboardingCompleted = onboardingCompleted
-				wallet.PayoutsEnabled = payoutsEnabled
-				wallet.ChargesEnabled = chargesEnabled
-			}
-		}
-	}
+	return s.accountStatus(ctx, wallet), nil
+}
 
+func (s *stripeConnectService) accountStatus(ctx context.Context, wallet *models.DeveloperWallet) *models.GetConnectAccountStatusResponse {
 	// Get pending withdrawals
 	pendingTotal, err := s.repo.GetPendingWithdrawalsTotal(ctx, wallet.ID)
 	if err != nil {
 		pendingTotal = 0
 	}
 
-	availableBalance := wallet.Balance - pendingTotal
-	canWithdraw := wallet.OnboardingCompleted && wallet.PayoutsEnabled && availableBalance >= models.MinimumWithdrawalAmount
+	availableBalance := availableBalance(wallet, pendingTotal)
+	canWithdraw := wallet.OnboardingCompleted && wallet.PayoutsEnabled && availableBalance >= s.minimumWithdrawal
 
 	return &models.GetConnectAccountStatusResponse{
-		AccountID:           accountID,
+		AccountID:           stringValue(wallet.StripeConnectAccountID),
 		OnboardingCompleted: wallet.OnboardingCompleted,
 		PayoutsEnabled:      wallet.PayoutsEnabled,
 		ChargesEnabled:      wallet.ChargesEnabled,
@@ -197,8 +273,9 @@ func (s *stripeConnectService) GetConnectAccountStatus(ctx context.Context, orgI
 		TotalEarned:         wallet.TotalEarned,
 		TotalWithdrawn:      wallet.TotalWithdrawn,
 		CanWithdraw:         canWithdraw,
-		MinimumWithdrawal:   models.MinimumWithdrawalAmount,
-	}, nil
+		MinimumWithdrawal:   s.minimumWithdrawal,
+		StatusSyncedAt:      wallet.StatusSyncedAt,
+	}
 }
 
 // ================================
@@ -216,41 +293,41 @@ func (s *stripeConnectService) GetWalletBalance(ctx context.Context, orgID strin
 		pendingTotal = 0
 	}
 
-	availableBalance := wallet.Balance - pendingTotal
-	canWithdraw := wallet.OnboardingCompleted && wallet.PayoutsEnabled && availableBalance >= models.MinimumWithdrawalAmount
+	availableBalance := availableBalance(wallet, pendingTotal)
+	canWithdraw := wallet.OnboardingCompleted && wallet.PayoutsEnabled && availableBalance >= s.minimumWithdrawal
 
 	return &models.GetWalletBalanceResponse{
 		Balance:            wallet.Balance,
 		TotalEarned:        wallet.TotalEarned,
 		TotalWithdrawn:     wallet.TotalWithdrawn,
 		PendingWithdrawals: pendingTotal,
+		PendingBalance:     wallet.PendingBalance,
+		AvailableBalance:   availableBalance,
 		CanWithdraw:        canWithdraw,
-		MinimumWithdrawal:  models.MinimumWithdrawalAmount,
+		MinimumWithdrawal:  s.minimumWithdrawal,
 	}, nil
 }
 
-func (s *stripeConnectService) GetTransactionHistory(ctx context.Context, orgID string, page, limit int) (*models.GetTransactionHistoryResponse, error) {
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
-	if page < 1 {
-		page = 1
-	}
-
-	offset := (page - 1) * limit
+func (s *stripeConnectService) GetTransactionHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetTransactionHistoryResponse, error) {
+	page = normalizePage(page)
 
-	transactions, err := s.repo.GetTransactionsByDeveloperOrg(ctx, orgID, limit, offset)
+	transactions, total, err := s.repo.GetTransactionsByDeveloperOrg(ctx, orgID, filter, peekPage(page))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get transactions: %w", err)
 	}
 
+	hasMore := len(transactions) > page.Limit
+	if hasMore {
+		transactions = transactions[:page.Limit]
+	}
+
 	// Convert to summary format
 	summaries := make([]models.TransactionSummary, len(transactions))
 	for i, tx := range transactions {
 		summaries[i] = models.TransactionSummary{
 			ID:               tx.ID,
 			FunctionID:       tx.FunctionID,
-			FunctionName:     fmt.Sprintf("Function %s", tx.FunctionID[:8]), // Simplified - you can join with functions table
+			FunctionName:     functionDisplayName(tx.FunctionID, stringValue(tx.FunctionName)),
 			UserOrganization: tx.UserOrganizationID,
 			Amount:           tx.Amount,
 			PlatformFee:      tx.PlatformFee,
@@ -260,29 +337,35 @@ func (s *stripeConnectService) GetTransactionHistory(ctx context.Context, orgID
 		}
 	}
 
+	nextCursor := ""
+	if hasMore {
+		last := transactions[len(transactions)-1]
+		nextCursor = models.Cursor{Time: last.ExecutedAt, ID: last.ID}.Encode()
+	}
+
 	return &models.GetTransactionHistoryResponse{
 		Transactions: summaries,
-		Total:        len(summaries),
-		Page:         page,
-		Limit:        limit,
+		Total:        total,
+		Page:         page.Page,
+		Limit:        page.Limit,
+		NextCursor:   nextCursor,
+		HasMore:      hasMore,
 	}, nil
 }
 
-func (s *stripeConnectService) GetConnectedDevelopers(ctx context.Context, page, limit int) (*models.GetConnectedDevelopersResponse, error) {
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
-	if page < 1 {
-		page = 1
-	}
-
-	offset := (page - 1) * limit
+func (s *stripeConnectService) GetConnectedDevelopers(ctx context.Context, page models.PageRequest, filter models.DeveloperFilter) (*models.GetConnectedDevelopersResponse, error) {
+	page = normalizePage(page)
 
-	wallets, err := s.repo.GetAllDeveloperWallets(ctx, limit, offset)
+	wallets, total, err := s.repo.GetAllDeveloperWallets(ctx, filter, peekPage(page))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get developer wallets: %w", err)
 	}
 
+	hasMore := len(wallets) > page.Limit
+	if hasMore {
+		wallets = wallets[:page.Limit]
+	}
+
 	// Convert to summary format
 	developers := make([]models.ConnectedDeveloperSummary, len(wallets))
 	for i, wallet := range wallets {
@@ -299,11 +382,19 @@ func (s *stripeConnectService) GetConnectedDevelopers(ctx context.Context, page,
 		}
 	}
 
+	nextCursor := ""
+	if hasMore {
+		last := wallets[len(wallets)-1]
+		nextCursor = models.Cursor{Time: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
 	return &models.GetConnectedDevelopersResponse{
 		Developers: developers,
-		Total:      len(developers),
-		Page:       page,
-		Limit:      limit,
+		Total:      total,
+		Page:       page.Page,
+		Limit:      page.Limit,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
 	}, nil
 }
 
@@ -342,9 +433,33 @@ func (s *stripeConnectService) GetConnectedDevelopersForOrg(ctx context.Context,
 // ================================
 
 func (s *stripeConnectService) RequestWithdrawal(ctx context.Context, orgID string, amount float64) (*models.CreateWithdrawalResponse, error) {
+	return s.requestWithdrawal(ctx, "", orgID, amount)
+}
+
+// requestWithdrawal creates the withdrawal with withdrawalID, or a new ID when
+// it is empty, so a caller can record the ID before the withdrawal exists, and
+// processes it in the background
+func (s *stripeConnectService) requestWithdrawal(ctx context.Context, withdrawalID, orgID string, amount float64) (*models.CreateWithdrawalResponse, error) {
+	resp, err := s.createWithdrawal(ctx, withdrawalID, orgID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Process withdrawal immediately (in production, you might want to queue this)
+	runDetached(ctx, "ProcessWithdrawal", func(ctx context.Context) error {
+		return s.processWithdrawal(ctx, resp.WithdrawalID)
+	}, attribute.String("withdrawal_id", resp.WithdrawalID))
+
+	return resp, nil
+}
+
+// createWithdrawal creates the withdrawal like requestWithdrawal, leaving it
+// pending for the caller to process
+func (s *stripeConnectService) createWithdrawal(ctx context.Context, withdrawalID, orgID string, amount float64) (*models.CreateWithdrawalResponse, error) {
 	// Validate amount
-	if amount < models.MinimumWithdrawalAmount {
-		return nil, fmt.Errorf("minimum withdrawal amount is $%.2f", models.MinimumWithdrawalAmount)
+	if amount < s.minimumWithdrawal {
+		return nil, apperrors.New(apperrors.CodeBelowMinimum, fmt.Sprintf("minimum withdrawal amount is $%.2f", s.minimumWithdrawal)).
+			WithDetails(map[string]float64{"minimum": s.minimumWithdrawal, "requested": amount})
 	}
 
 	// Get wallet
@@ -355,40 +470,28 @@ func (s *stripeConnectService) RequestWithdrawal(ctx context.Context, orgID stri
 
 	// Check onboarding
 	if !wallet.OnboardingCompleted || !wallet.PayoutsEnabled {
-		return nil, fmt.Errorf("please complete Stripe Connect onboarding before requesting withdrawals")
+		return nil, apperrors.New(apperrors.CodeOnboardingIncomplete, "please complete Stripe Connect onboarding before requesting withdrawals")
 	}
 
-	// Check pending withdrawals
-	pendingTotal, err := s.repo.GetPendingWithdrawalsTotal(ctx, wallet.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check pending withdrawals: %w", err)
-	}
-
-	// Check available balance
-	availableBalance := wallet.Balance - pendingTotal
-	if availableBalance < amount {
-		return nil, fmt.Errorf("insufficient balance (available: $%.2f, pending: $%.2f)", availableBalance, pendingTotal)
-	}
-
-	// Create withdrawal request
+	// Create withdrawal request, reserving the amount against the balance less
+	// pending withdrawals in one locked step so concurrent requests cannot overdraw
 	withdrawal := &models.WithdrawalRequest{
+		ID:                withdrawalID,
 		DeveloperWalletID: wallet.ID,
 		OrganizationID:    orgID,
 		Amount:            amount,
 		Status:            models.WithdrawalStatusPending,
 	}
+	if id := requestid.FromContext(ctx); id != "" {
+		withdrawal.RequestID = &id
+	}
 
-	if err := s.repo.CreateWithdrawalRequest(ctx, withdrawal); err != nil {
+	if err := s.repo.CreateWithdrawalRequest(ctx, withdrawal); errors.Is(err, apperrors.ErrInsufficientFunds) {
+		return nil, s.insufficientFunds(ctx, wallet, amount)
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to create withdrawal request: %w", err)
 	}
-
-	// Process withdrawal immediately (in production, you might want to queue this)
-	go func() {
-		ctx := context.Background()
-		if err := s.ProcessWithdrawal(ctx, withdrawal.ID); err != nil {
-			log.Printf("Failed to process withdrawal %s: %v", withdrawal.ID, err)
-		}
-	}()
+	metrics.ObserveWithdrawal(models.WithdrawalStatusPending, amount)
 
 	return &models.CreateWithdrawalResponse{
 		WithdrawalID:     withdrawal.ID,
@@ -399,12 +502,44 @@ func (s *stripeConnectService) RequestWithdrawal(ctx context.Context, orgID stri
 	}, nil
 }
 
+// processWithdrawal processes a withdrawal, logging why it failed
+func (s *stripeConnectService) processWithdrawal(ctx context.Context, withdrawalID string) error {
+	err := s.ProcessWithdrawal(ctx, withdrawalID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to process withdrawal", "withdrawal_id", withdrawalID, "error", err)
+	}
+	return err
+}
+
+// insufficientFunds explains a rejected withdrawal with the balance as it is
+// now, which may have changed since the reservation was checked
+func (s *stripeConnectService) insufficientFunds(ctx context.Context, wallet *models.DeveloperWallet, amount float64) error {
+	if current, err := s.repo.GetWalletByID(ctx, wallet.ID); err == nil {
+		wallet = current
+	}
+	pendingTotal, err := s.repo.GetPendingWithdrawalsTotal(ctx, wallet.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check pending withdrawals: %w", err)
+	}
+
+	availableBalance := availableBalance(wallet, pendingTotal)
+	return apperrors.New(apperrors.CodeInsufficientFunds, fmt.Sprintf("insufficient balance (available: $%.2f, pending: $%.2f, clearing: $%.2f)", availableBalance, pendingTotal, wallet.PendingBalance)).
+		WithDetails(map[string]float64{"available": availableBalance, "pending": pendingTotal, "clearing": wallet.PendingBalance, "requested": amount})
+}
+
+// ProcessWithdrawal transfers a pending or processing withdrawal to the
+// connected account and pays it out. When Stripe cannot be reached the
+// withdrawal stays processing and RetryWithdrawals repeats the calls with the
+// same idempotency keys; it only fails once Stripe rejects a call.
 func (s *stripeConnectService) ProcessWithdrawal(ctx context.Context, withdrawalID string) error {
 	// Get withdrawal request
 	withdrawal, err := s.repo.GetWithdrawalByID(ctx, withdrawalID)
 	if err != nil {
 		return fmt.Errorf("failed to get withdrawal: %w", err)
 	}
+	if !inFlight(withdrawal) {
+		return apperrors.Conflict(fmt.Sprintf("withdrawal is already %s", withdrawal.Status))
+	}
 
 	// Get wallet
 	wallet, err := s.repo.GetWalletByID(ctx, withdrawal.DeveloperWalletID)
@@ -414,66 +549,147 @@ func (s *stripeConnectService) ProcessWithdrawal(ctx context.Context, withdrawal
 
 	if wallet.StripeConnectAccountID == nil || *wallet.StripeConnectAccountID == "" {
 		failureReason := "no Stripe Connect account"
-		_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusFailed, nil, &failureReason)
+		_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusFailed, nil, nil, &failureReason)
+		metrics.ObserveWithdrawal(models.WithdrawalStatusFailed, withdrawal.Amount)
 		return fmt.Errorf("no Stripe Connect account found")
 	}
 
-	// Update status to processing
-	_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusProcessing, nil, nil)
-
-	// Create payout in Stripe
-	amountInCents := int64(withdrawal.Amount * 100)
-	payoutParams := &stripe.PayoutParams{
-		Amount:   stripe.Int64(amountInCents),
-		Currency: stripe.String(string(stripe.CurrencyUSD)),
-		Params: stripe.Params{
-			StripeAccount: wallet.StripeConnectAccountID,
-		},
-		Metadata: map[string]string{
-			"withdrawal_id":   withdrawalID,
-			"wallet_id":       wallet.ID,
-			"organization_id": wallet.OrganizationID,
-		},
+	// Update status to processing, which also restarts the retry clock
+	_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusProcessing, nil, nil, nil)
+	if withdrawal.Status == models.WithdrawalStatusPending {
+		metrics.ObserveWithdrawal(models.WithdrawalStatusProcessing, withdrawal.Amount)
+	}
+
+	metadata := map[string]string{
+		"withdrawal_id":   withdrawalID,
+		"wallet_id":       wallet.ID,
+		"organization_id": wallet.OrganizationID,
+	}
+	// The request ID is stored with the withdrawal, so retries send the same
+	// metadata and Stripe accepts them as replays of the same idempotent request
+	if withdrawal.RequestID != nil {
+		metadata["request_id"] = *withdrawal.RequestID
+	}
+	amountInCents := int64(math.Round(withdrawal.Amount * 100))
+
+	// Earnings are held by the platform, move them to the connected account first.
+	// Keys are derived from the withdrawal so a retry never moves the money twice,
+	// and a transfer recorded by an earlier attempt is not sent again at all.
+	transferID := stringValue(withdrawal.StripeTransferID)
+	if transferID == "" {
+		tr, err := s.gateway.CreateTransfer(ctx, &gateway.CreateTransferParams{
+			DestinationAccountID: *wallet.StripeConnectAccountID,
+			AmountCents:          amountInCents,
+			Currency:             gateway.CurrencyUSD,
+			Metadata:             metadata,
+			IdempotencyKey:       gateway.TransferIdempotencyKey(withdrawalID),
+		})
+		if err != nil {
+			return s.withdrawalCallFailed(ctx, withdrawal, nil, "transfer", err)
+		}
+		transferID = tr.ID
+
+		// The transfer paid the developer, so the amount leaves the wallet now even if
+		// the payout fails: the funds are on the connected account, and crediting
+		// them back would let a second withdrawal pay them again. The withdrawal is
+		// still processing, so its amount is never available to another one in between.
+		// Paying out without the deduction would pay the developer twice, so the
+		// withdrawal is held processing instead: a retry replays the same transfer and
+		// records it again, and one that keeps failing shows in the withdrawal queue check.
+		if err := s.repo.RecordWithdrawalTransfer(ctx, withdrawalID, transferID); err != nil {
+			slog.ErrorContext(ctx, "failed to deduct transferred amount, payout held", "withdrawal_id", withdrawalID, "transfer_id", transferID, "error", err)
+			return fmt.Errorf("failed to record transfer: %w", err)
+		}
 	}
 
-	po, err := payout.New(payoutParams)
+	// Then pay out the connected account balance to the developer's bank
+	po, err := s.gateway.CreatePayout(ctx, &gateway.CreatePayoutParams{
+		AccountID:      *wallet.StripeConnectAccountID,
+		AmountCents:    amountInCents,
+		Currency:       gateway.CurrencyUSD,
+		Metadata:       metadata,
+		IdempotencyKey: gateway.PayoutIdempotencyKey(withdrawalID),
+	})
 	if err != nil {
-		failureReason := err.Error()
-		_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusFailed, nil, &failureReason)
-		return fmt.Errorf("failed to create payout: %w", err)
+		return s.withdrawalCallFailed(ctx, withdrawal, &transferID, "payout", err)
 	}
 
-	// Update withdrawal with payout ID
+	// Update withdrawal with transfer and payout IDs
 	payoutID := po.ID
-	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusCompleted, &payoutID, nil); err != nil {
-		log.Printf("Failed to update withdrawal status: %v", err)
-	}
-
-	// Deduct from wallet balance
-	if err := s.repo.UpdateWalletBalance(ctx, wallet.ID, -withdrawal.Amount); err != nil {
-		log.Printf("Failed to update wallet balance: %v", err)
+	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusCompleted, &transferID, &payoutID, nil); err != nil {
+		slog.ErrorContext(ctx, "failed to update withdrawal status", "withdrawal_id", withdrawalID, "error", err)
 	}
+	metrics.ObserveWithdrawal(models.WithdrawalStatusCompleted, withdrawal.Amount)
 
-	log.Printf("✅ Withdrawal processed: ID=%s, Amount=$%.2f, PayoutID=%s", withdrawalID, withdrawal.Amount, payoutID)
+	slog.InfoContext(ctx, "withdrawal processed", "withdrawal_id", withdrawalID, "amount", withdrawal.Amount, "transfer_id", transferID, "payout_id", payoutID)
 
 	return nil
 }
 
-func (s *stripeConnectService) GetWithdrawalHistory(ctx context.Context, orgID string, page, limit int) (*models.GetWithdrawalHistoryResponse, error) {
-	if limit <= 0 || limit > 100 {
-		limit = 50
+// withdrawalCallFailed handles a failed transfer or payout of a withdrawal.
+// Transient errors leave it processing for RetryWithdrawals; a call Stripe
+// rejected fails it. transferID is the transfer that already went through, if any.
+func (s *stripeConnectService) withdrawalCallFailed(ctx context.Context, withdrawal *models.WithdrawalRequest, transferID *string, call string, err error) error {
+	if !stripeRejected(err) {
+		slog.WarnContext(ctx, "withdrawal left processing until Stripe can be reached",
+			"withdrawal_id", withdrawal.ID, "transfer_id", stringValue(transferID), "call", call, "error", err)
+		return fmt.Errorf("failed to create %s: %w", call, stripeError(err))
+	}
+
+	if transferID != nil {
+		slog.ErrorContext(ctx, "transfer succeeded but the payout failed, funds remain on the connected account",
+			"withdrawal_id", withdrawal.ID, "transfer_id", *transferID, "error", err)
+	}
+	// Stored reasons are shown to the developer, so raw Stripe messages stay in the logs
+	failureReason := payoutFailureReason(err)
+	_ = s.repo.UpdateWithdrawalStatus(ctx, withdrawal.ID, models.WithdrawalStatusFailed, transferID, nil, &failureReason)
+	metrics.ObserveWithdrawal(models.WithdrawalStatusFailed, withdrawal.Amount)
+	return fmt.Errorf("failed to create %s: %w", call, stripeError(err))
+}
+
+// RetryWithdrawals processes again the withdrawals of the tenant in ctx that
+// were left pending or processing for longer than the retry delay, by a Stripe
+// outage or a restart, and returns how many completed.
+func (s *stripeConnectService) RetryWithdrawals(ctx context.Context) (int, error) {
+	var completed int
+	locked, err := s.repo.WithAdvisoryLock(ctx, withdrawalRetryLock, func(ctx context.Context) error {
+		withdrawals, err := s.repo.GetWithdrawalsToRetry(ctx, time.Now().Add(-s.withdrawalRetryAfter), withdrawalRetryBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get withdrawals to retry: %w", err)
+		}
+
+		for _, withdrawal := range withdrawals {
+			// Each attempt restarts the retry clock, so a failure here waits for the next run
+			if err := s.ProcessWithdrawal(ctx, withdrawal.ID); err != nil {
+				slog.WarnContext(ctx, "withdrawal retry failed", "withdrawal_id", withdrawal.ID, "error", err)
+				continue
+			}
+			completed++
+		}
+		return nil
+	})
+	if !locked && err == nil {
+		slog.DebugContext(ctx, "withdrawal retries are running elsewhere")
 	}
-	if page < 1 {
-		page = 1
+	if completed > 0 {
+		slog.InfoContext(ctx, "retried withdrawals completed", "withdrawals", completed)
 	}
+	return completed, err
+}
 
-	offset := (page - 1) * limit
+func (s *stripeConnectService) GetWithdrawalHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.WithdrawalFilter) (*models.GetWithdrawalHistoryResponse, error) {
+	page = normalizePage(page)
 
-	withdrawals, err := s.repo.GetWithdrawalsByOrgID(ctx, orgID, limit, offset)
+	withdrawals, total, err := s.repo.GetWithdrawalsByOrgID(ctx, orgID, filter, peekPage(page))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get withdrawals: %w", err)
 	}
 
+	hasMore := len(withdrawals) > page.Limit
+	if hasMore {
+		withdrawals = withdrawals[:page.Limit]
+	}
+
 	summaries := make([]models.WithdrawalSummary, len(withdrawals))
 	for i, w := range withdrawals {
 		summaries[i] = models.WithdrawalSummary{
@@ -486,14 +702,89 @@ func (s *stripeConnectService) GetWithdrawalHistory(ctx context.Context, orgID s
 		}
 	}
 
+	nextCursor := ""
+	if hasMore {
+		last := withdrawals[len(withdrawals)-1]
+		nextCursor = models.Cursor{Time: last.RequestedAt, ID: last.ID}.Encode()
+	}
+
 	return &models.GetWithdrawalHistoryResponse{
 		Withdrawals: summaries,
-		Total:       len(summaries),
-		Page:        page,
-		Limit:       limit,
+		Total:       total,
+		Page:        page.Page,
+		Limit:       page.Limit,
+		NextCursor:  nextCursor,
+		HasMore:     hasMore,
 	}, nil
 }
 
+// stripeRejected reports whether Stripe refused a call outright, so repeating it
+// cannot succeed. Outages, throttling, idempotency conflicts, network errors and
+// an open circuit breaker are transient instead.
+func stripeRejected(err error) bool {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode != 0 {
+		switch stripeErr.HTTPStatusCode {
+		case http.StatusConflict, http.StatusTooManyRequests:
+			return false
+		}
+		return stripeErr.HTTPStatusCode < http.StatusInternalServerError
+	}
+	return !apperrors.IsTransient(stripeError(err))
+}
+
+// stripeError classifies a failed Stripe API call. Outages and throttling are
+// reported as stripe_unavailable so clients retry, anything else is our bug and
+// stays an internal error. Neither exposes the Stripe message to clients.
+func stripeError(err error) error {
+	// Already typed by the gateway, e.g. while its circuit breaker is open
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return err
+	}
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode < http.StatusInternalServerError &&
+		stripeErr.HTTPStatusCode != http.StatusTooManyRequests && stripeErr.HTTPStatusCode != 0 {
+		return err
+	}
+	return apperrors.StripeUnavailable(err)
+}
+
+// payoutFailureReason returns a failure reason safe to show to the developer
+func payoutFailureReason(err error) string {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Code != "" {
+		return "payout could not be created: " + string(stripeErr.Code)
+	}
+	return "payout could not be created"
+}
+
+// stringValue dereferences an optional string
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// normalizePage applies the default and maximum page size
+func normalizePage(page models.PageRequest) models.PageRequest {
+	if page.Limit <= 0 || page.Limit > models.MaxPageLimit {
+		page.Limit = models.DefaultPageLimit
+	}
+	if page.Page < 1 {
+		page.Page = 1
+	}
+	return page
+}
+
+// peekPage asks for one extra row so we know whether another page exists
+func peekPage(page models.PageRequest) models.PageRequest {
+	page.Limit++
+	page.Peek = true
+	return page
+}
+
 // ================================
 // FUNCTION EXECUTION PAYMENT
 // ================================
@@ -501,12 +792,12 @@ func (s *stripeConnectService) GetWithdrawalHistory(ctx context.Context, orgID s
 func (s *stripeConnectService) ProcessFunctionExecutionPayment(ctx context.Context, userOrgID, functionID, developerOrgID string, amount float64) (*models.FunctionExecutionPaymentResponse, error) {
 	// Validate amount
 	if amount <= 0 {
-		return nil, fmt.Errorf("invalid amount")
+		return nil, apperrors.InvalidRequest("amount must be positive")
 	}
 
 	// Validate developer org ID (in production, this would be looked up from functions table)
 	if developerOrgID == "" {
-		return nil, fmt.Errorf("developer organization ID is required")
+		return nil, apperrors.InvalidRequest("developer organization ID is required")
 	}
 
 	// Get user account
@@ -517,11 +808,28 @@ func (s *stripeConnectService) ProcessFunctionExecutionPayment(ctx context.Conte
 
 	// Check user balance
 	if userAccount.AccountBalance < amount {
-		return nil, fmt.Errorf("insufficient balance (have: $%.2f, need: $%.2f)", userAccount.AccountBalance, amount)
+		return nil, apperrors.New(apperrors.CodeInsufficientFunds, fmt.Sprintf("insufficient balance (have: $%.2f, need: $%.2f)", userAccount.AccountBalance, amount)).
+			WithDetails(map[string]float64{"balance": userAccount.AccountBalance, "requested": amount})
+	}
+
+	// Check spending caps up front so a rejected payment creates no wallet. The
+	// check is repeated inside the charge, where it is race free.
+	caps, err := s.repo.GetSpendingCapsByOrgID(ctx, userOrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check spending caps: %w", err)
+	}
+	spent := func(ctx context.Context, functionID *string, since time.Time) (float64, error) {
+		return s.repo.GetUserOrgSpendSince(ctx, userOrgID, functionID, since)
+	}
+	if err := checkSpendingCaps(ctx, caps, functionID, amount, spent); err != nil {
+		return nil, err
 	}
 
 	// Get or create developer wallet
 	developerWallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, developerOrgID)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get developer wallet: %w", err)
+	}
 	if err != nil {
 		// Create wallet if doesn't exist
 		developerWallet, err = s.repo.CreateDeveloperWallet(ctx, developerOrgID)
@@ -534,9 +842,12 @@ func (s *stripeConnectService) ProcessFunctionExecutionPayment(ctx context.Conte
 	platformFee := amount * s.platformFeePercent / 100.0
 	netAmount := amount - platformFee
 
-	// Create transaction record
+	// Create transaction record, withdrawable once its clearing period is over
+	now := time.Now()
+	clearingPeriod := s.clearing.periodFor(developerWallet, functionID)
 	description := fmt.Sprintf("Function execution payment for %s", functionID)
 	transaction := &models.FunctionExecutionTransaction{
+		ID:                      uuid.New().String(),
 		FunctionID:              functionID,
 		UserOrganizationID:      userOrgID,
 		DeveloperOrganizationID: developerOrgID,
@@ -547,24 +858,23 @@ func (s *stripeConnectService) ProcessFunctionExecutionPayment(ctx context.Conte
 		NetAmount:               netAmount,
 		Description:             &description,
 		Status:                  models.TransactionStatusCompleted,
+		AvailableAt:             now.Add(clearingPeriod),
 	}
-
-	// Deduct from user balance
-	if err := s.repo.DeductUserBalance(ctx, userAccount.ID, amount); err != nil {
-		return nil, fmt.Errorf("failed to deduct user balance: %w", err)
-	}
-
-	// Add to developer wallet
-	if err := s.repo.UpdateWalletBalance(ctx, developerWallet.ID, netAmount); err != nil {
-		// Rollback user balance deduction
-		log.Printf("ERROR: Failed to credit developer wallet, manual intervention needed: %v", err)
-		return nil, fmt.Errorf("failed to credit developer wallet: %w", err)
+	if clearingPeriod <= 0 {
+		transaction.ReleasedAt = &now
 	}
 
-	// Record transaction
-	if err := s.repo.CreateTransaction(ctx, transaction); err != nil {
-		log.Printf("WARNING: Failed to record transaction: %v", err)
+	// Deduct from user balance, record the transaction and credit the developer
+	// wallet at once, so a failed request can be retried without charging twice.
+	// Spending caps are checked again under the account lock so concurrent
+	// payments cannot overshoot them together.
+	err = s.repo.ChargeFunctionExecution(ctx, transaction, func(ctx context.Context, spent repository.SpendReader) error {
+		return checkSpendingCaps(ctx, caps, functionID, amount, spent)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to charge function execution: %w", err)
 	}
+	metrics.ObservePayment(amount, platformFee)
 
 	// Get updated balances
 	updatedUserAccount, _ := s.repo.GetAccountByOrgID(ctx, userOrgID)
@@ -587,19 +897,189 @@ func (s *stripeConnectService) ProcessFunctionExecutionPayment(ctx context.Conte
 		NetAmount:        netAmount,
 		UserBalance:      userBalance,
 		DeveloperBalance: developerBalance,
+		AvailableAt:      transaction.AvailableAt,
 		Message:          "Payment processed successfully",
 	}, nil
 }
 
+// ================================
+// SPENDING CAPS
+// ================================
+
+// SpendingCapExceededError is returned when a payment would push a user
+// organization over one of its spending caps
+type SpendingCapExceededError struct {
+	CapID        string    `json:"cap_id"`
+	FunctionID   *string   `json:"function_id,omitempty"`
+	Period       string    `json:"period"`
+	LimitAmount  float64   `json:"limit_amount"`
+	CurrentSpend float64   `json:"current_spend"`
+	Requested    float64   `json:"requested"`
+	ResetsAt     time.Time `json:"resets_at"`
+}
+
+func (e *SpendingCapExceededError) Error() string {
+	scope := "all functions"
+	if e.FunctionID != nil {
+		scope = "function " + *e.FunctionID
+	}
+	return fmt.Sprintf("%s spending cap of $%.2f for %s exceeded (spent: $%.2f, requested: $%.2f)",
+		e.Period, e.LimitAmount, scope, e.CurrentSpend, e.Requested)
+}
+
+// checkSpendingCaps fails when charging amount for functionID would take the
+// spend read through spent over one of caps
+func checkSpendingCaps(ctx context.Context, caps []*models.SpendingCap, functionID string, amount float64, spent repository.SpendReader) error {
+	now := time.Now()
+	for _, spendingCap := range caps {
+		if spendingCap.FunctionID != nil && *spendingCap.FunctionID != functionID {
+			continue
+		}
+
+		periodStart, periodEnd := models.SpendingCapWindow(spendingCap.Period, now)
+		spend, err := spent(ctx, spendingCap.FunctionID, periodStart)
+		if err != nil {
+			return fmt.Errorf("failed to check spending caps: %w", err)
+		}
+
+		if spend+amount > spendingCap.LimitAmount {
+			capErr := &SpendingCapExceededError{
+				CapID:        spendingCap.ID,
+				FunctionID:   spendingCap.FunctionID,
+				Period:       spendingCap.Period,
+				LimitAmount:  spendingCap.LimitAmount,
+				CurrentSpend: spend,
+				Requested:    amount,
+				ResetsAt:     periodEnd,
+			}
+			return apperrors.Wrap(capErr, apperrors.CodeSpendingCapExceeded, capErr.Error()).WithDetails(capErr)
+		}
+	}
+
+	return nil
+}
+
+func (s *stripeConnectService) GetSpendingCaps(ctx context.Context, userOrgID string) (*models.GetSpendingCapsResponse, error) {
+	caps, err := s.repo.GetSpendingCapsByOrgID(ctx, userOrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spending caps: %w", err)
+	}
+
+	summaries := make([]models.SpendingCapSummary, len(caps))
+	for i, spendingCap := range caps {
+		summary, err := s.summarizeSpendingCap(ctx, spendingCap)
+		if err != nil {
+			return nil, err
+		}
+		summaries[i] = *summary
+	}
+
+	return &models.GetSpendingCapsResponse{
+		OrganizationID: userOrgID,
+		Caps:           summaries,
+	}, nil
+}
+
+func (s *stripeConnectService) SetSpendingCap(ctx context.Context, req *models.SetSpendingCapRequest) (*models.SpendingCapSummary, error) {
+	functionID := req.FunctionID
+	if functionID != nil && *functionID == "" {
+		functionID = nil
+	}
+
+	spendingCap := &models.SpendingCap{
+		OrganizationID: req.OrganizationID,
+		FunctionID:     functionID,
+		Period:         req.Period,
+		LimitAmount:    req.LimitAmount,
+	}
+
+	if err := s.repo.UpsertSpendingCap(ctx, spendingCap); err != nil {
+		return nil, fmt.Errorf("failed to save spending cap: %w", err)
+	}
+
+	slog.InfoContext(ctx, "spending cap set", "organization_id", req.OrganizationID, "period", req.Period, "limit", req.LimitAmount)
+
+	return s.summarizeSpendingCap(ctx, spendingCap)
+}
+
+func (s *stripeConnectService) DeleteSpendingCap(ctx context.Context, capID string) error {
+	if err := s.repo.DeleteSpendingCap(ctx, capID); err != nil {
+		return fmt.Errorf("failed to delete spending cap: %w", err)
+	}
+
+	return nil
+}
+
+func (s *stripeConnectService) summarizeSpendingCap(ctx context.Context, spendingCap *models.SpendingCap) (*models.SpendingCapSummary, error) {
+	periodStart, periodEnd := models.SpendingCapWindow(spendingCap.Period, time.Now())
+	spent, err := s.repo.GetUserOrgSpendSince(ctx, spendingCap.OrganizationID, spendingCap.FunctionID, periodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current spend: %w", err)
+	}
+
+	remaining := spendingCap.LimitAmount - spent
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &models.SpendingCapSummary{
+		ID:             spendingCap.ID,
+		OrganizationID: spendingCap.OrganizationID,
+		FunctionID:     spendingCap.FunctionID,
+		Period:         spendingCap.Period,
+		LimitAmount:    spendingCap.LimitAmount,
+		CurrentSpend:   spent,
+		Remaining:      remaining,
+		PeriodStart:    periodStart,
+		ResetsAt:       periodEnd,
+	}, nil
+}
+
 // ================================
 // WEBHOOK HANDLING
 // ================================
 
+// RecordWebhookEvent stores a verified event in the inbox. It returns false for
+// an event that was already handled, which the caller should acknowledge and skip.
+func (s *stripeConnectService) RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error) {
+	isNew, err := s.repo.RecordWebhookEvent(ctx, eventID, eventType, payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook event %s: %w", eventID, err)
+	}
+	if !isNew {
+		metrics.ObserveWebhookEvent(eventType, "duplicate")
+	}
+	return isNew, nil
+}
+
+// CompleteWebhookEvent records the outcome of handling an event. Errors that a
+// redelivery could fix (database or Stripe outages) leave the event failed for
+// Stripe to retry; anything else discards it.
+func (s *stripeConnectService) CompleteWebhookEvent(ctx context.Context, eventID, eventType string, handlingErr error) error {
+	status := models.WebhookEventStatusProcessed
+	var lastError *string
+	if handlingErr != nil {
+		message := handlingErr.Error()
+		lastError = &message
+
+		status = models.WebhookEventStatusDiscarded
+		if apperrors.IsTransient(handlingErr) {
+			status = models.WebhookEventStatusFailed
+		}
+	}
+
+	if err := s.repo.CompleteWebhookEvent(ctx, eventID, status, lastError); err != nil {
+		return fmt.Errorf("failed to complete webhook event %s: %w", eventID, err)
+	}
+	metrics.ObserveWebhookEvent(eventType, status)
+	return nil
+}
+
 func (s *stripeConnectService) HandleAccountUpdated(ctx context.Context, stripeAccountID string) error {
 	// Get account details from Stripe
-	acc, err := account.GetByID(stripeAccountID, nil)
+	acc, err := s.gateway.GetAccount(ctx, stripeAccountID)
 	if err != nil {
-		return fmt.Errorf("failed to get Stripe account: %w", err)
+		return fmt.Errorf("failed to get Stripe account: %w", stripeError(err))
 	}
 
 	// Get wallet by Stripe account ID
@@ -607,60 +1087,46 @@ func (s *stripeConnectService) HandleAccountUpdated(ctx context.Context, stripeA
 	// For now, we'll update based on metadata if available
 	orgID := acc.Metadata["organization_id"]
 	if orgID == "" {
-		log.Printf("No organization_id in account metadata for %s", stripeAccountID)
+		slog.WarnContext(ctx, "no organization_id in account metadata", "stripe_account", stripeAccountID)
 		return nil
 	}
 
 	wallet, err := s.repo.GetDeveloperWalletByOrgID(ctx, orgID)
 	if err != nil {
-		log.Printf("Wallet not found for organization %s", orgID)
+		slog.WarnContext(ctx, "wallet not found for organization", "organization_id", orgID)
 		return err
 	}
 
 	// Update onboarding status
-	chargesEnabled := acc.ChargesEnabled
-	payoutsEnabled := acc.PayoutsEnabled
-	detailsSubmitted := acc.DetailsSubmitted
-
-	if err := s.repo.UpdateOnboardingStatus(ctx, wallet.ID, detailsSubmitted, payoutsEnabled, chargesEnabled); err != nil {
-		return fmt.Errorf("failed to update onboarding status: %w", err)
-	}
-
-	log.Printf("✅ Updated account status for %s: onboarding=%v, payouts=%v, charges=%v",
-		orgID, detailsSubmitted, payoutsEnabled, chargesEnabled)
-
-	return nil
+	return s.saveAccountStatus(ctx, wallet, acc)
 }
 
 func (s *stripeConnectService) HandlePayoutPaid(ctx context.Context, withdrawalID, payoutID string) error {
 	// Update withdrawal status to completed
-	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusCompleted, &payoutID, nil); err != nil {
+	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusCompleted, nil, &payoutID, nil); err != nil {
 		return fmt.Errorf("failed to update withdrawal status: %w", err)
 	}
 
-	log.Printf("✅ Payout completed: withdrawalID=%s, payoutID=%s", withdrawalID, payoutID)
+	slog.InfoContext(ctx, "payout completed", "withdrawal_id", withdrawalID, "payout_id", payoutID)
 	return nil
 }
 
 func (s *stripeConnectService) HandlePayoutFailed(ctx context.Context, withdrawalID, failureReason string) error {
 	// Update withdrawal status to failed with reason
-	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusFailed, nil, &failureReason); err != nil {
+	if err := s.repo.UpdateWithdrawalStatus(ctx, withdrawalID, models.WithdrawalStatusFailed, nil, nil, &failureReason); err != nil {
 		return fmt.Errorf("failed to update withdrawal status: %w", err)
 	}
 
-	// Get withdrawal to credit back the amount to wallet
 	withdrawal, err := s.repo.GetWithdrawalByID(ctx, withdrawalID)
 	if err != nil {
-		log.Printf("ERROR: Failed to get withdrawal for refund: %v", err)
-		return err
-	}
-
-	// Credit back the amount to developer wallet
-	if err := s.repo.UpdateWalletBalance(ctx, withdrawal.DeveloperWalletID, withdrawal.Amount); err != nil {
-		log.Printf("ERROR: Failed to credit back failed withdrawal amount: %v", err)
+		slog.ErrorContext(ctx, "failed to get failed withdrawal", "withdrawal_id", withdrawalID, "error", err)
 		return err
 	}
+	metrics.ObserveWithdrawal(models.WithdrawalStatusFailed, withdrawal.Amount)
 
-	log.Printf("❌ Payout failed: withdrawalID=%s, reason=%s (amount credited back)", withdrawalID, failureReason)
+	// Stripe returns a failed payout to the connected account, not to the
+	// platform, so the wallet is not credited: the transfer already paid it
+	slog.WarnContext(ctx, "payout failed, funds returned to the connected account",
+		"withdrawal_id", withdrawalID, "transfer_id", stringValue(withdrawal.StripeTransferID), "reason", failureReason)
 	return nil
 }
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"strpe-connect/models"
+	"strpe-connect/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedService starts a span for every StripeConnectService call, so the SQL
+// and Stripe spans below it are grouped by operation
+type tracedService struct {
+	next StripeConnectService
+}
+
+// NewTracedService wraps next with a span per method call
+func NewTracedService(next StripeConnectService) StripeConnectService {
+	return &tracedService{next: next}
+}
+
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "StripeConnectService."+method, trace.SpanKindInternal, attrs...)
+}
+
+// runDetached runs fn in the background under a span of its own
+func runDetached(ctx context.Context, method string, fn func(ctx context.Context) error, attrs ...attribute.KeyValue) {
+	go func() {
+		// Detached from the request, but still scoped to its tenant and part of its trace
+		ctx, span := startSpan(context.WithoutCancel(ctx), method, append(attrs, attribute.Bool("async", true))...)
+		tracing.End(span, fn(ctx))
+	}()
+}
+
+func orgAttr(orgID string) attribute.KeyValue {
+	return attribute.String("organization_id", orgID)
+}
+
+// ================================
+// ONBOARDING
+// ================================
+
+func (s *tracedService) CreateConnectAccount(ctx context.Context, orgID, refreshURL, returnURL string) (*models.CreateConnectAccountResponse, error) {
+	ctx, span := startSpan(ctx, "CreateConnectAccount", orgAttr(orgID))
+	resp, err := s.next.CreateConnectAccount(ctx, orgID, refreshURL, returnURL)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error) {
+	ctx, span := startSpan(ctx, "GetConnectAccountStatus", orgAttr(orgID))
+	resp, err := s.next.GetConnectAccountStatus(ctx, orgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) RefreshOnboardingLink(ctx context.Context, orgID, refreshURL, returnURL string) (*models.CreateConnectAccountResponse, error) {
+	ctx, span := startSpan(ctx, "RefreshOnboardingLink", orgAttr(orgID))
+	resp, err := s.next.RefreshOnboardingLink(ctx, orgID, refreshURL, returnURL)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) RefreshConnectAccountStatus(ctx context.Context, orgID string) (*models.GetConnectAccountStatusResponse, error) {
+	ctx, span := startSpan(ctx, "RefreshConnectAccountStatus", orgAttr(orgID))
+	resp, err := s.next.RefreshConnectAccountStatus(ctx, orgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) SyncConnectAccounts(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "SyncConnectAccounts")
+	synced, err := s.next.SyncConnectAccounts(ctx)
+	span.SetAttributes(attribute.Int("synced", synced))
+	tracing.End(span, err)
+	return synced, err
+}
+
+// ================================
+// WALLET MANAGEMENT
+// ================================
+
+func (s *tracedService) GetWalletBalance(ctx context.Context, orgID string) (*models.GetWalletBalanceResponse, error) {
+	ctx, span := startSpan(ctx, "GetWalletBalance", orgAttr(orgID))
+	resp, err := s.next.GetWalletBalance(ctx, orgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetTransactionHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetTransactionHistoryResponse, error) {
+	ctx, span := startSpan(ctx, "GetTransactionHistory", orgAttr(orgID))
+	resp, err := s.next.GetTransactionHistory(ctx, orgID, page, filter)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetConnectedDevelopers(ctx context.Context, page models.PageRequest, filter models.DeveloperFilter) (*models.GetConnectedDevelopersResponse, error) {
+	ctx, span := startSpan(ctx, "GetConnectedDevelopers")
+	resp, err := s.next.GetConnectedDevelopers(ctx, page, filter)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetConnectedDevelopersForOrg(ctx context.Context, userOrgID string) (*models.GetConnectedDevelopersResponse, error) {
+	ctx, span := startSpan(ctx, "GetConnectedDevelopersForOrg", orgAttr(userOrgID))
+	resp, err := s.next.GetConnectedDevelopersForOrg(ctx, userOrgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// ================================
+// WITHDRAWALS
+// ================================
+
+func (s *tracedService) RequestWithdrawal(ctx context.Context, orgID string, amount float64) (*models.CreateWithdrawalResponse, error) {
+	ctx, span := startSpan(ctx, "RequestWithdrawal", orgAttr(orgID), attribute.Float64("amount", amount))
+	resp, err := s.next.RequestWithdrawal(ctx, orgID, amount)
+	if resp != nil {
+		span.SetAttributes(attribute.String("withdrawal_id", resp.WithdrawalID))
+	}
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetWithdrawalHistory(ctx context.Context, orgID string, page models.PageRequest, filter models.WithdrawalFilter) (*models.GetWithdrawalHistoryResponse, error) {
+	ctx, span := startSpan(ctx, "GetWithdrawalHistory", orgAttr(orgID))
+	resp, err := s.next.GetWithdrawalHistory(ctx, orgID, page, filter)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) ProcessWithdrawal(ctx context.Context, withdrawalID string) error {
+	ctx, span := startSpan(ctx, "ProcessWithdrawal", attribute.String("withdrawal_id", withdrawalID))
+	err := s.next.ProcessWithdrawal(ctx, withdrawalID)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedService) RetryWithdrawals(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "RetryWithdrawals")
+	completed, err := s.next.RetryWithdrawals(ctx)
+	span.SetAttributes(attribute.Int("withdrawals_completed", completed))
+	tracing.End(span, err)
+	return completed, err
+}
+
+// ================================
+// FUNCTION EXECUTION PAYMENT
+// ================================
+
+func (s *tracedService) ProcessFunctionExecutionPayment(ctx context.Context, userOrgID, functionID, developerOrgID string, amount float64) (*models.FunctionExecutionPaymentResponse, error) {
+	ctx, span := startSpan(ctx, "ProcessFunctionExecutionPayment",
+		attribute.String("user_organization_id", userOrgID),
+		attribute.String("developer_organization_id", developerOrgID),
+		attribute.String("function_id", functionID),
+		attribute.Float64("amount", amount),
+	)
+	resp, err := s.next.ProcessFunctionExecutionPayment(ctx, userOrgID, functionID, developerOrgID, amount)
+	if resp != nil {
+		span.SetAttributes(attribute.String("transaction_id", resp.TransactionID))
+	}
+	tracing.End(span, err)
+	return resp, err
+}
+
+// ================================
+// EARNINGS ANALYTICS
+// ================================
+
+func (s *tracedService) GetEarningsAnalytics(ctx context.Context, orgID, granularity string, from, to time.Time) (*models.GetEarningsAnalyticsResponse, error) {
+	ctx, span := startSpan(ctx, "GetEarningsAnalytics", orgAttr(orgID), attribute.String("granularity", granularity))
+	resp, err := s.next.GetEarningsAnalytics(ctx, orgID, granularity, from, to)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) RefreshEarningsRollup(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "RefreshEarningsRollup")
+	err := s.next.RefreshEarningsRollup(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// ================================
+// BILLING (PAYING USER ORGANIZATIONS)
+// ================================
+
+func (s *tracedService) GetSpendHistory(ctx context.Context, userOrgID string, page models.PageRequest, filter models.TransactionFilter) (*models.GetSpendHistoryResponse, error) {
+	ctx, span := startSpan(ctx, "GetSpendHistory", orgAttr(userOrgID))
+	resp, err := s.next.GetSpendHistory(ctx, userOrgID, page, filter)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetBillingUsage(ctx context.Context, userOrgID string, from, to time.Time) (*models.GetBillingUsageResponse, error) {
+	ctx, span := startSpan(ctx, "GetBillingUsage", orgAttr(userOrgID))
+	resp, err := s.next.GetBillingUsage(ctx, userOrgID, from, to)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetBillingStatement(ctx context.Context, userOrgID string, month time.Time) (*models.GetBillingStatementResponse, error) {
+	ctx, span := startSpan(ctx, "GetBillingStatement", orgAttr(userOrgID))
+	resp, err := s.next.GetBillingStatement(ctx, userOrgID, month)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// ================================
+// SPENDING CAPS
+// ================================
+
+func (s *tracedService) GetSpendingCaps(ctx context.Context, userOrgID string) (*models.GetSpendingCapsResponse, error) {
+	ctx, span := startSpan(ctx, "GetSpendingCaps", orgAttr(userOrgID))
+	resp, err := s.next.GetSpendingCaps(ctx, userOrgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) SetSpendingCap(ctx context.Context, req *models.SetSpendingCapRequest) (*models.SpendingCapSummary, error) {
+	ctx, span := startSpan(ctx, "SetSpendingCap", orgAttr(req.OrganizationID))
+	resp, err := s.next.SetSpendingCap(ctx, req)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) DeleteSpendingCap(ctx context.Context, capID string) error {
+	ctx, span := startSpan(ctx, "DeleteSpendingCap", attribute.String("cap_id", capID))
+	err := s.next.DeleteSpendingCap(ctx, capID)
+	tracing.End(span, err)
+	return err
+}
+
+// ================================
+// WEBHOOK HANDLING
+// ================================
+
+func (s *tracedService) RecordWebhookEvent(ctx context.Context, eventID, eventType string, payload []byte) (bool, error) {
+	ctx, span := startSpan(ctx, "RecordWebhookEvent", attribute.String("event_id", eventID), attribute.String("event_type", eventType))
+	isNew, err := s.next.RecordWebhookEvent(ctx, eventID, eventType, payload)
+	span.SetAttributes(attribute.Bool("duplicate", err == nil && !isNew))
+	tracing.End(span, err)
+	return isNew, err
+}
+
+func (s *tracedService) CompleteWebhookEvent(ctx context.Context, eventID, eventType string, handlingErr error) error {
+	ctx, span := startSpan(ctx, "CompleteWebhookEvent", attribute.String("event_id", eventID), attribute.String("event_type", eventType))
+	err := s.next.CompleteWebhookEvent(ctx, eventID, eventType, handlingErr)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedService) HandleAccountUpdated(ctx context.Context, stripeAccountID string) error {
+	ctx, span := startSpan(ctx, "HandleAccountUpdated", attribute.String("stripe.account_id", stripeAccountID))
+	err := s.next.HandleAccountUpdated(ctx, stripeAccountID)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedService) HandlePayoutPaid(ctx context.Context, withdrawalID, payoutID string) error {
+	ctx, span := startSpan(ctx, "HandlePayoutPaid", attribute.String("withdrawal_id", withdrawalID), attribute.String("stripe.payout_id", payoutID))
+	err := s.next.HandlePayoutPaid(ctx, withdrawalID, payoutID)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedService) HandlePayoutFailed(ctx context.Context, withdrawalID, failureReason string) error {
+	ctx, span := startSpan(ctx, "HandlePayoutFailed", attribute.String("withdrawal_id", withdrawalID))
+	err := s.next.HandlePayoutFailed(ctx, withdrawalID, failureReason)
+	tracing.End(span, err)
+	return err
+}
+
+// ================================
+// RECONCILIATION
+// ================================
+
+func (s *tracedService) RunReconciliation(ctx context.Context) (*models.ReconciliationRun, error) {
+	ctx, span := startSpan(ctx, "RunReconciliation")
+	run, err := s.next.RunReconciliation(ctx)
+	if err == nil {
+		span.SetAttributes(attribute.Int("accounts_checked", run.AccountsChecked), attribute.Int("issues_found", run.IssuesFound))
+	}
+	tracing.End(span, err)
+	return run, err
+}
+
+func (s *tracedService) GetReconciliationIssues(ctx context.Context, page models.PageRequest, filter models.ReconciliationIssueFilter) (*models.GetReconciliationIssuesResponse, error) {
+	ctx, span := startSpan(ctx, "GetReconciliationIssues")
+	resp, err := s.next.GetReconciliationIssues(ctx, page, filter)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// ================================
+// SOLVENCY
+// ================================
+
+func (s *tracedService) GetSolvencyReport(ctx context.Context) (*models.SolvencyReport, error) {
+	ctx, span := startSpan(ctx, "GetSolvencyReport")
+	report, err := s.next.GetSolvencyReport(ctx)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("healthy", report.Healthy))
+	}
+	tracing.End(span, err)
+	return report, err
+}
+
+// ================================
+// EARNINGS CLEARING
+// ================================
+
+func (s *tracedService) ReleaseClearedEarnings(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "ReleaseClearedEarnings")
+	released, err := s.next.ReleaseClearedEarnings(ctx)
+	span.SetAttributes(attribute.Int("released", released))
+	tracing.End(span, err)
+	return released, err
+}
+
+func (s *tracedService) SetDeveloperTier(ctx context.Context, orgID string, req *models.SetDeveloperTierRequest) (*models.DeveloperTierResponse, error) {
+	ctx, span := startSpan(ctx, "SetDeveloperTier", orgAttr(orgID), attribute.String("tier", req.Tier))
+	resp, err := s.next.SetDeveloperTier(ctx, orgID, req)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// ================================
+// PAYOUT SCHEDULES
+// ================================
+
+func (s *tracedService) GetPayoutSchedule(ctx context.Context, orgID string) (*models.PayoutScheduleResponse, error) {
+	ctx, span := startSpan(ctx, "GetPayoutSchedule", orgAttr(orgID))
+	resp, err := s.next.GetPayoutSchedule(ctx, orgID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) SetPayoutSchedule(ctx context.Context, orgID string, req *models.SetPayoutScheduleRequest) (*models.PayoutScheduleResponse, error) {
+	ctx, span := startSpan(ctx, "SetPayoutSchedule", orgAttr(orgID), attribute.String("frequency", req.Frequency))
+	resp, err := s.next.SetPayoutSchedule(ctx, orgID, req)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) RunScheduledPayouts(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "RunScheduledPayouts")
+	requested, err := s.next.RunScheduledPayouts(ctx)
+	span.SetAttributes(attribute.Int("withdrawals_requested", requested))
+	tracing.End(span, err)
+	return requested, err
+}
+
+// ================================
+// PAYOUT BATCHES
+// ================================
+
+func (s *tracedService) CreatePayoutBatch(ctx context.Context, cutoff time.Time) (*models.PayoutBatchResponse, error) {
+	ctx, span := startSpan(ctx, "CreatePayoutBatch", attribute.String("cutoff", cutoff.Format(time.RFC3339)))
+	resp, err := s.next.CreatePayoutBatch(ctx, cutoff)
+	if resp != nil {
+		span.SetAttributes(attribute.String("batch_id", resp.ID), attribute.Int("entries", resp.Totals.Entries))
+	}
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetPayoutBatches(ctx context.Context, page models.PageRequest) (*models.GetPayoutBatchesResponse, error) {
+	ctx, span := startSpan(ctx, "GetPayoutBatches")
+	resp, err := s.next.GetPayoutBatches(ctx, page)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) GetPayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error) {
+	ctx, span := startSpan(ctx, "GetPayoutBatch", attribute.String("batch_id", batchID))
+	resp, err := s.next.GetPayoutBatch(ctx, batchID)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) UpdatePayoutBatchEntries(ctx context.Context, batchID string, req *models.UpdatePayoutBatchEntriesRequest) (*models.PayoutBatchResponse, error) {
+	ctx, span := startSpan(ctx, "UpdatePayoutBatchEntries", attribute.String("batch_id", batchID),
+		attribute.Int("entries", len(req.EntryIDs)), attribute.Bool("excluded", req.Excluded))
+	resp, err := s.next.UpdatePayoutBatchEntries(ctx, batchID, req)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (s *tracedService) ExecutePayoutBatch(ctx context.Context, batchID string) (*models.PayoutBatchResponse, error) {
+	ctx, span := startSpan(ctx, "ExecutePayoutBatch", attribute.String("batch_id", batchID))
+	resp, err := s.next.ExecutePayoutBatch(ctx, batchID)
+	tracing.End(span, err)
+	return resp, err
+}
@@ -49,11 +49,12 @@ echo ""
 # Step 3: Apply Database Schema
 echo "Step 3: Applying Database Schema"
 echo "---------------------------------"
-PGPASSWORD=$DB_PASSWORD psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f database/stripe_connect_schema.sql > /dev/null 2>&1
+go run . migrate up
 if [ $? -eq 0 ]; then
     echo "✅ Schema applied successfully"
 else
-    echo "⚠️  Schema might already exist (this is okay)"
+    echo "❌ Failed to apply schema migrations"
+    exit 1
 fi
 echo ""
 
@@ -2,8 +2,8 @@
 
 echo "Setting up Stripe Connect database..."
 
-# Apply schema
-psql -U postgres -d rival -f database/stripe_connect_schema.sql
+# Apply schema migrations (uses the DB_* settings from .env)
+go run . migrate up
 
 if [ $? -eq 0 ]; then
     echo "✅ Database schema applied successfully"
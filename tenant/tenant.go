@@ -0,0 +1,59 @@
+// Package tenant carries the Postgres schema of the current tenant through a
+// context. Every tenant's tables live in their own schema with the same layout;
+// SQL is written against tenant_schema and qualified for the tenant at run time.
+package tenant
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Header is the HTTP header a request selects its tenant with
+const Header = "X-Tenant-ID"
+
+// QueryParam selects the tenant where a header cannot be set, such as the URL
+// a Stripe webhook endpoint is registered with
+const QueryParam = "tenant_id"
+
+// DefaultSchema is the schema SQL is written against, and the tenant used when
+// none is configured
+const DefaultSchema = "tenant_schema"
+
+// schemaPattern keeps tenant schemas to plain lowercase identifiers, so they can
+// be substituted into SQL without quoting
+var schemaPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// ValidSchema reports whether name can be used as a tenant schema
+func ValidSchema(name string) bool {
+	return schemaPattern.MatchString(name)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying schema
+func NewContext(ctx context.Context, schema string) context.Context {
+	return context.WithValue(ctx, contextKey{}, schema)
+}
+
+// FromContext returns the tenant schema in ctx, or DefaultSchema if there is none
+func FromContext(ctx context.Context) string {
+	if schema, ok := ctx.Value(contextKey{}).(string); ok {
+		return schema
+	}
+	return DefaultSchema
+}
+
+// Qualify rewrites the tenant_schema qualifier in query to the schema of the
+// tenant in ctx
+func Qualify(ctx context.Context, query string) string {
+	return QualifyFor(FromContext(ctx), query)
+}
+
+// QualifyFor rewrites the tenant_schema qualifier in query to schema
+func QualifyFor(schema, query string) string {
+	if schema == DefaultSchema {
+		return query
+	}
+	return strings.ReplaceAll(query, DefaultSchema+".", schema+".")
+}
@@ -0,0 +1,65 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"tenant_schema", true},
+		{"acme", true},
+		{"_acme2", true},
+		{strings.Repeat("a", 63), true},
+		{"", false},
+		{"Acme", false},
+		{"2acme", false},
+		{"acme-corp", false},
+		{"acme.wallets", false},
+		{"acme; DROP TABLE wallets", false},
+		{`"acme"`, false},
+		{strings.Repeat("a", 64), false},
+	}
+	for _, tt := range tests {
+		if got := ValidSchema(tt.name); got != tt.want {
+			t.Errorf("ValidSchema(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != DefaultSchema {
+		t.Errorf("FromContext without a tenant = %q, want %q", got, DefaultSchema)
+	}
+	ctx := NewContext(context.Background(), "acme")
+	if got := FromContext(ctx); got != "acme" {
+		t.Errorf("FromContext = %q, want acme", got)
+	}
+	if got := FromContext(NewContext(ctx, "globex")); got != "globex" {
+		t.Errorf("FromContext after switching tenants = %q, want globex", got)
+	}
+}
+
+func TestQualify(t *testing.T) {
+	query := "SELECT w.balance FROM tenant_schema.wallets w JOIN tenant_schema.accounts a ON a.id = w.account_id WHERE w.id = $1"
+
+	if got := Qualify(context.Background(), query); got != query {
+		t.Errorf("Qualify for the default tenant = %q, want the query unchanged", got)
+	}
+
+	want := "SELECT w.balance FROM acme.wallets w JOIN acme.accounts a ON a.id = w.account_id WHERE w.id = $1"
+	if got := Qualify(NewContext(context.Background(), "acme"), query); got != want {
+		t.Errorf("Qualify = %q, want %q", got, want)
+	}
+
+	// Only the schema qualifier is rewritten, not other mentions of the name
+	query = "SELECT 'tenant_schema' FROM tenant_schema.wallets"
+	want = "SELECT 'tenant_schema' FROM acme.wallets"
+	if got := QualifyFor("acme", query); got != want {
+		t.Errorf("QualifyFor = %q, want %q", got, want)
+	}
+}
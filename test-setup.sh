@@ -76,7 +76,7 @@ if command -v psql &> /dev/null; then
             echo "✅ Stripe Connect tables exist"
         else
             echo "❌ Stripe Connect tables not found!"
-            echo "   Run: psql -U $DB_USER -d $DB_NAME -f database/stripe_connect_schema.sql"
+            echo "   Run: go run . migrate up"
         fi
     else
         echo "❌ Database connection failed"